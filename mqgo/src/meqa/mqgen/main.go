@@ -6,6 +6,8 @@ import (
 	"meqa/mqplan"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
 	"meqa/mqswag"
 	"meqa/mqutil"
@@ -16,10 +18,11 @@ const (
 	algoSimple  = "simple"
 	algoObject  = "object"
 	algoPath    = "path"
+	algoCRUD    = "crud"
 	algoAll     = "all"
 )
 
-var algoList []string = []string{algoSimple, algoObject, algoPath}
+var algoList []string = []string{algoSimple, algoObject, algoPath, algoCRUD}
 
 func main() {
 	mqutil.Logger = mqutil.NewStdLogger()
@@ -27,14 +30,90 @@ func main() {
 	swaggerJSONFile := filepath.Join(meqaDataDir, "swagger.yml")
 	meqaPath := flag.String("d", meqaDataDir, "the directory where we put the generated files")
 	swaggerFile := flag.String("s", swaggerJSONFile, "the swagger.yml file location")
-	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, all")
+	algorithm := flag.String("a", "all", "the algorithm - simple, object, path, crud, all")
 	verbose := flag.Bool("v", false, "turn on verbose mode")
 	whitelistFile := flag.String("w", "", "the whitelist.txt file location")
+	localRefs := flag.Bool("l", false, "only resolve $refs to local files, don't fetch $refs to http(s) URLs")
+	migrateFile := flag.String("m", "", "migrate the test names in an existing test plan or result file to the current naming scheme")
+	postmanFile := flag.String("postman", "", "import the Postman v2.1 collection file as the postman.yml test plan")
+	deprecated := flag.String("deprecated", mqplan.DeprecatedTest, "skip, warn or test the deprecated operations, skip leaves them out of the plans")
+	skipDeprecated := flag.Bool("skip-deprecated", false, "leave the deprecated operations out of the plans, the same as -deprecated skip")
 
 	flag.Parse()
+	mqswag.FetchRemoteRefs = !*localRefs
+	if err := mqplan.SetDeprecated(*deprecated, *skipDeprecated); err != nil {
+		mqutil.Logger.Printf("Error: %s", err.Error())
+		os.Exit(1)
+	}
+	if len(*migrateFile) > 0 {
+		err := migrate(*swaggerFile, *meqaPath, *migrateFile)
+		if err != nil {
+			mqutil.Logger.Printf("Error: %s", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	if len(*postmanFile) > 0 {
+		err := importPostman(*swaggerFile, *meqaPath, *postmanFile)
+		if err != nil {
+			mqutil.Logger.Printf("Error: %s", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 	run(meqaPath, swaggerFile, algorithm, verbose, whitelistFile)
 }
 
+// importPostman turns the Postman collection into a test plan, with the requests matched to the operations
+// in the spec.
+func importPostman(swaggerPath string, meqaPath string, postmanPath string) error {
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerPath, meqaPath)
+	if err != nil {
+		return err
+	}
+	testPlan, err := mqplan.ImportPostmanFile(postmanPath, swagger)
+	if err != nil {
+		return err
+	}
+	testPlanFile := filepath.Join(meqaPath, "postman.yml")
+	err = testPlan.DumpToFile(testPlanFile)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Test plan imported at:", testPlanFile)
+	return nil
+}
+
+// migrate renames the tests in the plan or result file so that old baselines keep working with the
+// plans we generate now. The migrated file is written next to the original one.
+func migrate(swaggerPath string, meqaPath string, planPath string) error {
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerPath, meqaPath)
+	if err != nil {
+		return err
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+
+	ext := filepath.Ext(planPath)
+	outPath := strings.TrimSuffix(planPath, ext) + "_migrated" + ext
+	mapping, err := mqplan.MigrateTestPlanFile(planPath, outPath, db)
+	if err != nil {
+		return err
+	}
+	var oldNames []string
+	for oldName := range mapping {
+		oldNames = append(oldNames, oldName)
+	}
+	sort.Strings(oldNames)
+	for _, oldName := range oldNames {
+		if newName := mapping[oldName]; oldName != newName {
+			fmt.Printf("%s -> %s\n", oldName, newName)
+		}
+	}
+	fmt.Println("Migrated test plan written to:", outPath)
+	return nil
+}
+
 func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool, whitelistFile *string) {
 	mqutil.Verbose = *verbose
 
@@ -99,6 +178,8 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 			testPlan, err = mqplan.GeneratePathTestPlan(swagger, dag, whitelist)
 		case algoObject:
 			testPlan, err = mqplan.GenerateTestPlan(swagger, dag)
+		case algoCRUD:
+			testPlan, err = mqplan.GenerateCRUDTestPlan(swagger)
 		default:
 			testPlan, err = mqplan.GenerateSimpleTestPlan(swagger, dag)
 		}
@@ -107,6 +188,13 @@ func run(meqaPath *string, swaggerFile *string, algorithm *string, verbose *bool
 			os.Exit(1)
 		}
 		testPlanFile := filepath.Join(testPlanPath, algo+".yml")
+		if _, err := os.Stat(testPlanFile); err == nil {
+			// Keep the notes added by hand to the tests of the plan we generated before.
+			err = testPlan.KeepHandNotes(testPlanFile)
+			if err != nil {
+				mqutil.Logger.Printf("Error: %s", err.Error())
+			}
+		}
 		err = testPlan.DumpToFile(testPlanFile)
 		if err != nil {
 			mqutil.Logger.Printf("Error: %s", err.Error())
@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"strings"
+	"time"
 
 	"meqa/mqplan"
 	"meqa/mqswag"
@@ -21,10 +22,12 @@ import (
 )
 
 const (
-	meqaDataDir = "meqa_data"
-	configFile  = ".config.yml"
-	resultFile  = "result.yml"
-	serverURL   = "https://api.meqa.io"
+	meqaDataDir     = "meqa_data"
+	configFile      = ".config.yml"
+	resultFile      = "result.yml"
+	explorePlanFile = "explore.yml"
+	coverageFile    = "coverage.yml"
+	serverURL       = "https://api.meqa.io"
 )
 
 const (
@@ -201,32 +204,170 @@ Do you wish to proceed? y/n: `
 	return nil
 }
 
+// runOptions are the options of the commands that send the tests, run and explore.
+type runOptions struct {
+	meqaPath        string
+	swaggerFile     string
+	planPath        string
+	resultPath      string
+	testToRun       string
+	username        string
+	password        string
+	apitoken        string
+	verbose         bool
+	localRefs       bool
+	checkFormat     bool
+	nullProbability float64
+	rate            float64
+	parallel        int
+	mask            string
+	unique          string
+	postmanPath     string
+	jsonPath        string
+	htmlPath        string
+	server          string
+	serverVars      string
+	proxy           string
+	noProxy         string
+	keepRuns        int
+	baseline        string
+	tls             mqplan.TLSOptions
+}
+
+// registerRunFlags adds the flags shared by run and explore to the flag set. The options only used by one of
+// them, and -p whose meaning differs, are added by the caller.
+func registerRunFlags(fs *flag.FlagSet) *runOptions {
+	opts := &runOptions{parallel: 1}
+	fs.StringVar(&opts.meqaPath, "d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	fs.StringVar(&opts.swaggerFile, "s", "", "the meqa generated OpenAPI (Swagger) spec file path")
+	fs.StringVar(&opts.resultPath, "r", "", "the test result file name (default result.yml in meqa_data dir)")
+	fs.StringVar(&opts.username, "u", "", "the username for basic HTTP authentication")
+	fs.StringVar(&opts.password, "w", "", "the password for basic HTTP authentication")
+	fs.StringVar(&opts.apitoken, "a", "", "the api token for bearer HTTP authentication")
+	fs.BoolVar(&opts.verbose, "v", false, "turn on verbose mode")
+	fs.BoolVar(&opts.localRefs, "l", false, "only resolve $refs to local files, don't fetch $refs to http(s) URLs")
+	fs.BoolVar(&opts.checkFormat, "f", false, "check the format (date, date-time, uuid, email, uri, ipv4, ipv6, byte, int32, int64) of values in server responses")
+	fs.Float64Var(&opts.nullProbability, "n", mqplan.NullProbability, "the probability of sending null for an optional nullable property")
+	fs.Float64Var(&opts.rate, "rate", 0, "the most calls per second to send, across the parallel suites (default the plan's rateLimit, or no limit)")
+	fs.StringVar(&opts.mask, "mask", "", "the comma separated names, e.g. token,secret, whose values are masked in the logs besides the ones with the password format")
+	fs.StringVar(&opts.unique, "unique", "", "the comma separated names, e.g. username,email, whose generated values are unique besides the ones marked x-meqa-unique")
+	fs.BoolVar(&opts.tls.InsecureSkipVerify, "insecure", true, "don't verify the server's TLS certificate, unless -ca is given")
+	fs.StringVar(&opts.tls.CAFile, "ca", "", "the PEM file of the CA certificates to verify the server's TLS certificate with")
+	fs.StringVar(&opts.tls.CertFile, "cert", "", "the PEM file of the client certificate, for the servers that require one")
+	fs.StringVar(&opts.tls.KeyFile, "key", "", "the PEM file of the client certificate's private key")
+	fs.StringVar(&opts.proxy, "proxy", "", "the proxy to send the calls through, e.g. http://proxy.example.com:3128")
+	fs.StringVar(&opts.noProxy, "no-proxy", "", "the comma separated hosts, domains and CIDRs, e.g. localhost,.internal.example.com, to call without the proxy (default $NO_PROXY)")
+	return opts
+}
+
+// apply fills in the default result path and sets the globals the options control.
+func (opts *runOptions) apply() error {
+	if len(opts.resultPath) == 0 {
+		if opts.keepRuns > 0 {
+			// In the run's own directory.
+			opts.resultPath = resultFile
+		} else {
+			opts.resultPath = filepath.Join(opts.meqaPath, resultFile)
+		}
+	}
+	mqswag.FetchRemoteRefs = !opts.localRefs
+	mqswag.CheckFormat = opts.checkFormat
+	mqplan.NullProbability = opts.nullProbability
+	mqplan.RateLimit = opts.rate
+	if len(opts.mask) > 0 {
+		mqplan.MaskedNames = strings.Split(opts.mask, ",")
+	}
+	if len(opts.unique) > 0 {
+		mqplan.UniqueNames = strings.Split(opts.unique, ",")
+	}
+	mqutil.Verbose = opts.verbose
+	if len(opts.proxy) > 0 {
+		return mqplan.SetProxy(opts.proxy, opts.noProxy)
+	}
+	return nil
+}
+
 func main() {
 	genCommand := flag.NewFlagSet("generate", flag.ExitOnError)
 	genCommand.SetOutput(os.Stdout)
 	runCommand := flag.NewFlagSet("run", flag.ExitOnError)
 	runCommand.SetOutput(os.Stdout)
+	exploreCommand := flag.NewFlagSet("explore", flag.ExitOnError)
+	exploreCommand.SetOutput(os.Stdout)
+	auditCommand := flag.NewFlagSet("audit", flag.ExitOnError)
+	auditCommand.SetOutput(os.Stdout)
+	validateCommand := flag.NewFlagSet("validate", flag.ExitOnError)
+	validateCommand.SetOutput(os.Stdout)
+	cleanRunsCommand := flag.NewFlagSet("clean-runs", flag.ExitOnError)
+	cleanRunsCommand.SetOutput(os.Stdout)
+	selftestCommand := flag.NewFlagSet("selftest", flag.ExitOnError)
+	selftestCommand.SetOutput(os.Stdout)
 
 	genMeqaPath := genCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
 	genSwaggerFile := genCommand.String("s", "", "the OpenAPI (Swagger) spec file path")
 
-	runMeqaPath := runCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
-	runSwaggerFile := runCommand.String("s", "", "the meqa generated OpenAPI (Swagger) spec file path")
-	testPlanFile := runCommand.String("p", "", "the test plan file name")
-	resultPath := runCommand.String("r", "", "the test result file name (default result.yml in meqa_data dir)")
-	testToRun := runCommand.String("t", "all", "the test to run")
-	username := runCommand.String("u", "", "the username for basic HTTP authentication")
-	password := runCommand.String("w", "", "the password for basic HTTP authentication")
-	apitoken := runCommand.String("a", "", "the api token for bearer HTTP authentication")
-	verbose := runCommand.Bool("v", false, "turn on verbose mode")
+	runOpts := registerRunFlags(runCommand)
+	runCommand.StringVar(&runOpts.planPath, "p", "", "the test plan file name")
+	runCommand.StringVar(&runOpts.testToRun, "t", "all", "the test to run")
+	runCommand.IntVar(&runOpts.parallel, "j", 1, "the number of test suites to run in parallel")
+	compareHosts := runCommand.String("compare-hosts", "", "run the plan against both base URLs, e.g. http://a.example.com/v1,http://b.example.com/v1, and report the tests whose results differ")
+	compareIgnore := runCommand.String("compare-ignore", "", "the comma separated response fields, e.g. id,owner.createdAt, not to compare between the hosts")
+	assertionThreshold := runCommand.Int("e", mqplan.AssertionThreshold, "report the tests whose assertion strength is below this (1 status, 2 schema, 3 body, 4 client DB)")
+	runCommand.StringVar(&runOpts.postmanPath, "postman", "", "also write the tests that were sent to this file as a Postman v2.1 collection")
+	runCommand.StringVar(&runOpts.jsonPath, "json", "", "also write the results of the tests that were sent to this file as JSON")
+	runCommand.StringVar(&runOpts.htmlPath, "html", "", "also write the results of the tests that were sent to this file as an HTML page")
+	deprecated := runCommand.String("deprecated", mqplan.DeprecatedTest, "skip, warn or test the deprecated operations, unless the plan's meqa_init sets deprecated")
+	skipDeprecated := runCommand.Bool("skip-deprecated", false, "skip the tests that call the deprecated operations, the same as -deprecated skip")
+	runCommand.StringVar(&runOpts.server, "server", "", "the OpenAPI 3 server to send the tests to, by index or a substring of its url (default the plan's server, or the first one)")
+	runCommand.IntVar(&runOpts.keepRuns, "keep-runs", 0, "save the result and the reports of each run in its own directory under meqa_data/runs, and only keep the last this many runs")
+	runCommand.StringVar(&runOpts.baseline, "baseline", "", "the run directory, or a file in it, never to remove when pruning the runs")
+	artifactBudget := runCommand.Int64("artifact-budget", 0, "the most MB of the Postman collection and the JSON and HTML reports to save, the ones beyond are skipped (default no limit)")
+	runCommand.StringVar(&runOpts.serverVars, "server-vars", "", "the comma separated values of the OpenAPI 3 server's variables, e.g. region=eu-west-1,basePath=v3, overriding the plan's serverVariables")
+
+	exploreOpts := registerRunFlags(exploreCommand)
+	exploreCommand.StringVar(&exploreOpts.planPath, "p", "", "the file to write the replayable test plan to (default explore.yml in meqa_data dir)")
+	exploreBudget := exploreCommand.Duration("budget", 10*time.Minute, "how long to explore for")
+	exploreSeed := exploreCommand.Int64("seed", 1, "the seed for picking operations and generating parameters, except the ones with a pattern")
+	coveragePath := exploreCommand.String("c", "", "the coverage file to update (default coverage.yml in meqa_data dir)")
+
+	auditMeqaPath := auditCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	auditSwaggerFile := auditCommand.String("s", "", "the OpenAPI (Swagger) spec file path")
+	auditLocalRefs := auditCommand.Bool("l", false, "only resolve $refs to local files, don't fetch $refs to http(s) URLs")
+
+	validateMeqaPath := validateCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	validateSwaggerFile := validateCommand.String("s", "", "the OpenAPI (Swagger) spec file path")
+	validateLocalRefs := validateCommand.Bool("l", false, "only resolve $refs to local files, don't fetch $refs to http(s) URLs")
+
+	cleanRunsMeqaPath := cleanRunsCommand.String("d", meqaDataDir, "the directory where meqa config, log and output files reside")
+	cleanRunsKeep := cleanRunsCommand.Int("keep", 10, "the number of the newest runs to keep, 0 to keep them all")
+	cleanRunsMaxAge := cleanRunsCommand.Duration("max-age", 0, "remove the runs older than this, e.g. 168h (default no limit)")
+	cleanRunsBaseline := cleanRunsCommand.String("baseline", "", "the run directory, or a file in it, never to remove")
+
+	selftestVerbose := selftestCommand.Bool("v", false, "turn on verbose mode")
 
 	flag.Usage = func() {
-		fmt.Println("Usage: mqgo {generate|run} [options]")
+		fmt.Println("Usage: mqgo {generate|run|explore|audit|validate|clean-runs|selftest} [options]")
 		fmt.Println("generate: generate test plans to be used by run command")
 		genCommand.PrintDefaults()
 
 		fmt.Println("\nrun: run the tests the in a test plan file")
 		runCommand.PrintDefaults()
+
+		fmt.Println("\nexplore: keep calling the least covered operations until the time budget runs out")
+		exploreCommand.PrintDefaults()
+
+		fmt.Println("\naudit: check the examples and default values in the spec against their schemas")
+		auditCommand.PrintDefaults()
+
+		fmt.Println("\nvalidate: check the spec for unresolved $refs, parameters without types and other problems")
+		validateCommand.PrintDefaults()
+
+		fmt.Println("\nclean-runs: remove the old run directories that run -keep-runs saved")
+		cleanRunsCommand.PrintDefaults()
+
+		fmt.Println("\nselftest: run the bundled tests against a mock petstore server, to check this binary works. Retries aren't\n" +
+			"covered, mqgo doesn't retry the calls that fail")
+		selftestCommand.PrintDefaults()
 	}
 
 	if len(os.Args) < 2 {
@@ -243,8 +384,41 @@ func main() {
 		swaggerFile = genSwaggerFile
 	case "run":
 		runCommand.Parse(os.Args[2:])
-		meqaPath = runMeqaPath
-		swaggerFile = runSwaggerFile
+		meqaPath = &runOpts.meqaPath
+		swaggerFile = &runOpts.swaggerFile
+	case "explore":
+		exploreCommand.Parse(os.Args[2:])
+		meqaPath = &exploreOpts.meqaPath
+		swaggerFile = &exploreOpts.swaggerFile
+	case "audit":
+		auditCommand.Parse(os.Args[2:])
+		meqaPath = auditMeqaPath
+		swaggerFile = auditSwaggerFile
+	case "validate":
+		validateCommand.Parse(os.Args[2:])
+		meqaPath = validateMeqaPath
+		swaggerFile = validateSwaggerFile
+	case "clean-runs":
+		cleanRunsCommand.Parse(os.Args[2:])
+		removed, err := mqplan.CleanRuns(filepath.Join(*cleanRunsMeqaPath, mqplan.RunsDir), *cleanRunsKeep,
+			*cleanRunsMaxAge, *cleanRunsBaseline)
+		for _, dir := range removed {
+			fmt.Println("Removed:", dir)
+		}
+		if err != nil {
+			fmt.Println(mqutil.ErrorMessage(err))
+			os.Exit(1)
+		}
+		return
+	case "selftest":
+		selftestCommand.Parse(os.Args[2:])
+		mqutil.NewLogger(ioutil.Discard)
+		mqutil.Verbose = *selftestVerbose
+		if _, err := selfTest(); err != nil {
+			fmt.Println(mqutil.ErrorMessage(err))
+			os.Exit(1)
+		}
+		return
 	default:
 		flag.Usage()
 		os.Exit(1)
@@ -264,13 +438,6 @@ func main() {
 		os.Exit(1)
 	}
 
-	if os.Args[1] == "run" {
-		if len(*resultPath) == 0 {
-			rf := filepath.Join(*meqaPath, resultFile)
-			resultPath = &rf
-		}
-	}
-
 	mqutil.Logger = mqutil.NewFileLogger(filepath.Join(*meqaPath, "mqgo.log"))
 	mqutil.Logger.Println(os.Args)
 
@@ -288,66 +455,313 @@ func main() {
 		return
 	}
 
-	runMeqa(meqaPath, swaggerFile, testPlanFile, resultPath, testToRun, username, password, apitoken, verbose)
-}
+	if auditCommand.Parsed() {
+		mqswag.FetchRemoteRefs = !*auditLocalRefs
+		count, err := auditSpec(*swaggerFile, *meqaPath)
+		if err != nil {
+			fmt.Printf("got an err:\n%s", err.Error())
+			os.Exit(1)
+		}
+		if count > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+
+	if validateCommand.Parsed() {
+		mqswag.FetchRemoteRefs = !*validateLocalRefs
+		count, err := validateSpec(*swaggerFile, *meqaPath)
+		if err != nil {
+			fmt.Printf("got an err:\n%s", err.Error())
+			os.Exit(1)
+		}
+		if count > 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
-func runMeqa(meqaPath *string, swaggerFile *string, testPlanFile *string, resultPath *string,
-	testToRun *string, username *string, password *string, apitoken *string, verbose *bool) {
+	if exploreCommand.Parsed() {
+		if len(exploreOpts.planPath) == 0 {
+			exploreOpts.planPath = filepath.Join(*meqaPath, explorePlanFile)
+		}
+		if len(*coveragePath) == 0 {
+			*coveragePath = filepath.Join(*meqaPath, coverageFile)
+		}
+		if err = exploreOpts.apply(); err != nil {
+			fmt.Println(mqutil.ErrorMessage(err))
+			os.Exit(1)
+		}
+		err = exploreMeqa(exploreOpts, *coveragePath, *exploreBudget, *exploreSeed)
+		if err != nil {
+			fmt.Printf("got an err:\n%s", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
 
-	mqutil.Verbose = *verbose
+	mqplan.AssertionThreshold = *assertionThreshold
+	mqplan.ArtifactBudget = *artifactBudget * 1024 * 1024
+	if err = mqplan.SetDeprecated(*deprecated, *skipDeprecated); err != nil {
+		fmt.Println(mqutil.ErrorMessage(err))
+		os.Exit(1)
+	}
+	if err = runOpts.apply(); err != nil {
+		fmt.Println(mqutil.ErrorMessage(err))
+		os.Exit(1)
+	}
+	if len(*compareHosts) > 0 {
+		var ignoreFields []string
+		if len(*compareIgnore) > 0 {
+			ignoreFields = strings.Split(*compareIgnore, ",")
+		}
+		err = compareMeqa(strings.Split(*compareHosts, ","), ignoreFields, runOpts)
+		if err != nil {
+			fmt.Printf("got an err:\n%s", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+	runMeqa(runOpts)
+}
 
-	if len(*testPlanFile) == 0 {
+func runMeqa(opts *runOptions) {
+	if len(opts.planPath) == 0 {
 		fmt.Println("You must use -p to specify a test plan file. Use -h to see more options.")
 		return
 	}
 
-	if _, err := os.Stat(*testPlanFile); os.IsNotExist(err) {
-		fmt.Printf("can't load test plan file at the following location %s", *testPlanFile)
+	if _, err := os.Stat(opts.planPath); os.IsNotExist(err) {
+		fmt.Printf("can't load test plan file at the following location %s", opts.planPath)
 		return
 	}
 
 	// load swagger.yml
-	swagger, err := mqswag.CreateSwaggerFromURL(*swaggerFile, *meqaPath)
+	swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile, opts.meqaPath)
 	if err != nil {
 		mqutil.Logger.Printf("Error: %s", err.Error())
 	}
 	mqswag.ObjDB.Init(swagger)
 
 	// load test plan
-	mqplan.Current.Username = *username
-	mqplan.Current.Password = *password
-	mqplan.Current.ApiToken = *apitoken
-	err = mqplan.Current.InitFromFile(*testPlanFile, &mqswag.ObjDB)
+	mqplan.Current.Username = opts.username
+	mqplan.Current.Password = opts.password
+	mqplan.Current.ApiToken = opts.apitoken
+	err = mqplan.Current.InitFromFile(opts.planPath, &mqswag.ObjDB)
 	if err != nil {
 		mqutil.Logger.Printf("Error loading test plan: %s", err.Error())
 	}
+	if len(opts.server) > 0 {
+		mqplan.Current.Server = opts.server
+	}
+	if err = mqplan.Current.SetServerVariables(opts.serverVars); err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+	baseURL, err := mqplan.Current.ResolveServer()
+	if err != nil {
+		fmt.Printf("can't resolve the base url: %s\n", err.Error())
+		return
+	}
+	fmt.Printf("Base URL: %s\n", baseURL)
 
-	// for testing, set the config to skip verifying https certificates
-	resty.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	if err = mqplan.SetTLS(&opts.tls); err != nil {
+		fmt.Println(mqutil.ErrorMessage(err))
+		return
+	}
 	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
 
 	mqplan.Current.ResultCounts = make(map[string]int)
-	if *testToRun == "all" {
+	var suiteNames []string
+	if opts.testToRun == "all" {
 		for _, testSuite := range mqplan.Current.SuiteList {
-			mqutil.Logger.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			fmt.Printf("\n---\nTest suite: %s\n", testSuite.Name)
-			counts, err := mqplan.Current.Run(testSuite.Name, nil)
-			mqutil.Logger.Printf("err:\n%v", err)
-			for k := range counts {
-				mqplan.Current.ResultCounts[k] += counts[k]
-			}
+			suiteNames = append(suiteNames, testSuite.Name)
 		}
 	} else {
-		mqutil.Logger.Printf("\n---\nTest suite: %s\n", *testToRun)
-		fmt.Printf("\n---\nTest suite: %s\n", *testToRun)
-		counts, err := mqplan.Current.Run(*testToRun, nil)
-		mqutil.Logger.Printf("err:\n%v", err)
-		for k := range counts {
-			mqplan.Current.ResultCounts[k] += counts[k]
-		}
+		suiteNames = append(suiteNames, opts.testToRun)
 	}
+	mqplan.Current.RunSuites(suiteNames, opts.parallel)
 	mqplan.Current.LogErrors()
+	if mqplan.AssertionThreshold > 0 {
+		mqplan.Current.PrintWeakAssertions(mqplan.AssertionThreshold)
+	}
 	mqplan.Current.PrintSummary()
-	os.Remove(*resultPath)
-	mqplan.Current.WriteResultToFile(*resultPath)
+	artifacts := &mqplan.RunArtifacts{Budget: mqplan.ArtifactBudget}
+	runsDir := filepath.Join(opts.meqaPath, mqplan.RunsDir)
+	if opts.keepRuns > 0 {
+		if artifacts, err = mqplan.NewRunDir(runsDir); err != nil {
+			fmt.Println(err.Error())
+			return
+		}
+		fmt.Println("Saving the run to:", artifacts.Dir)
+	}
+	err = mqplan.Current.SaveArtifacts(artifacts, opts.resultPath, opts.postmanPath, opts.jsonPath, opts.htmlPath)
+	if err != nil {
+		mqutil.Logger.Printf("Error writing the results: %s", err.Error())
+	}
+	if opts.keepRuns > 0 {
+		_, err = mqplan.CleanRuns(runsDir, opts.keepRuns, 0, opts.baseline)
+		if err != nil {
+			mqutil.Logger.Printf("Error removing the old runs: %s", err.Error())
+		}
+	}
+}
+
+// compareMeqa runs the plan against each of the two hosts with the same seed, then reports the tests whose
+// results differ.
+func compareMeqa(hosts []string, ignoreFields []string, opts *runOptions) error {
+
+	if len(hosts) != 2 {
+		return mqutil.NewError(mqutil.ErrInvalid, "-compare-hosts takes two base URLs separated by a comma")
+	}
+	if err := mqplan.SetTLS(&opts.tls); err != nil {
+		return err
+	}
+	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
+
+	seed := time.Now().UnixNano()
+	var plans []*mqplan.TestPlan
+	for _, host := range hosts {
+		swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile, opts.meqaPath)
+		if err != nil {
+			return err
+		}
+		err = mqplan.SetBaseURL(swagger, host)
+		if err != nil {
+			return err
+		}
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		plan := &mqplan.TestPlan{Username: opts.username, Password: opts.password, ApiToken: opts.apitoken}
+		err = plan.InitFromFile(opts.planPath, db)
+		if err != nil {
+			return err
+		}
+		if mutating := plan.MutatingTests(); len(plans) == 0 && len(mutating) > 0 {
+			fmt.Print(mqutil.YELLOW)
+			fmt.Printf("Warning: %d tests change objects on the server, e.g. %s %s. Both %s and %s will be written to.\n",
+				len(mutating), mutating[0].Method, mutating[0].Path, hosts[0], hosts[1])
+			fmt.Print(mqutil.END)
+		}
+
+		var suiteNames []string
+		if opts.testToRun == "all" {
+			for _, testSuite := range plan.SuiteList {
+				suiteNames = append(suiteNames, testSuite.Name)
+			}
+		} else {
+			suiteNames = append(suiteNames, opts.testToRun)
+		}
+		fmt.Printf("\n===\nRunning against: %s\n", host)
+		mqplan.History.Reset()
+		mqplan.Seed(seed)
+		plan.ResultCounts = make(map[string]int)
+		plan.RunSuites(suiteNames, 1)
+		plan.PrintSummary()
+		plans = append(plans, plan)
+	}
+	mqplan.PrintDivergences(hosts[0], hosts[1], mqplan.CompareResults(plans[0], plans[1], ignoreFields))
+	return nil
+}
+
+func exploreMeqa(opts *runOptions, coveragePath string, budget time.Duration, seed int64) error {
+
+	swagger, err := mqswag.CreateSwaggerFromURL(opts.swaggerFile, opts.meqaPath)
+	if err != nil {
+		return err
+	}
+	mqswag.ObjDB.Init(swagger)
+	dag := mqswag.NewDAG()
+	err = swagger.AddToDAG(dag)
+	if err != nil {
+		return err
+	}
+	dag.Sort()
+	dag.CheckWeight()
+
+	coverage, err := mqplan.LoadCoverageFromFile(coveragePath)
+	if err != nil {
+		return err
+	}
+
+	// Seed the values of the parameters too, so a run can be reproduced.
+	mqplan.Seed(seed)
+	if err = mqplan.SetTLS(&opts.tls); err != nil {
+		return err
+	}
+	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
+
+	plan := &mqplan.Current
+	plan.Init(swagger, &mqswag.ObjDB)
+	plan.Username = opts.username
+	plan.Password = opts.password
+	plan.ApiToken = opts.apitoken
+	plan.ResultCounts = make(map[string]int)
+	baseURL, err := plan.ResolveServer()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Base URL: %s\n", baseURL)
+
+	err = mqplan.NewExplorer(plan, dag, coverage, seed).Run(budget)
+	if err != nil {
+		return err
+	}
+
+	plan.LogErrors()
+	plan.PrintSummary()
+	os.Remove(opts.resultPath)
+	err = plan.WriteResultToFile(opts.resultPath)
+	if err != nil {
+		return err
+	}
+	err = plan.DumpToFile(opts.planPath)
+	if err != nil {
+		return err
+	}
+	err = coverage.WriteToFile(coveragePath)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Test plan of the explored operations written to:", opts.planPath)
+	fmt.Println("Coverage written to:", coveragePath)
+	return nil
+}
+
+// auditSpec prints the examples and default values that don't match their schemas. Returns the number
+// of the values found.
+func auditSpec(swaggerFile string, meqaPath string) (int, error) {
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerFile, meqaPath)
+	if err != nil {
+		return 0, err
+	}
+	issues := swagger.AuditExamples()
+	for _, issue := range issues {
+		fmt.Println(issue.String())
+	}
+	if len(issues) == 0 {
+		fmt.Println("All the examples and default values match their schemas.")
+	} else {
+		fmt.Printf("%d examples or default values don't match their schemas.\n", len(issues))
+	}
+	return len(issues), nil
+}
+
+// validateSpec prints the problems in the spec, e.g. unresolved $refs and parameters without types. Returns the
+// number of the problems found.
+func validateSpec(swaggerFile string, meqaPath string) (int, error) {
+	swagger, err := mqswag.CreateSwaggerFromURL(swaggerFile, meqaPath)
+	if err != nil {
+		return 0, err
+	}
+	issues := swagger.Validate()
+	for _, issue := range issues {
+		fmt.Println(issue.String())
+	}
+	if len(issues) == 0 {
+		fmt.Println("No problems found in the spec.")
+	} else {
+		fmt.Printf("%d problems found in the spec.\n", len(issues))
+	}
+	return len(issues), nil
 }
@@ -1,28 +1,87 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqplan"
 	"meqa/mqutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
 	"testing"
 )
 
 func TestMqgo(t *testing.T) {
 	wd, _ := os.Getwd()
 	meqaPath := filepath.Join(wd, "../../../testdata")
-	swaggerPath := filepath.Join(meqaPath, "petstore_meqa.yml")
-	planPath := filepath.Join(meqaPath, "object.yml")
-	resultPath := filepath.Join(meqaPath, "result.yml")
-	testToRun := "all"
-	username := ""
-	password := ""
-	apitoken := ""
-	verbose := false
+	opts := &runOptions{
+		meqaPath:    meqaPath,
+		swaggerFile: filepath.Join(meqaPath, "petstore_meqa.yml"),
+		planPath:    filepath.Join(meqaPath, "object.yml"),
+		resultPath:  filepath.Join(meqaPath, "result.yml"),
+		testToRun:   "all",
+		parallel:    1,
+	}
+	opts.tls.InsecureSkipVerify = true
 
 	mqutil.Logger = mqutil.NewFileLogger(filepath.Join(meqaPath, "mqgo.log"))
-	runMeqa(&meqaPath, &swaggerPath, &planPath, &resultPath, &testToRun, &username, &password, &apitoken, &verbose)
+	runMeqa(opts)
+}
+
+func TestRegisterRunFlags(t *testing.T) {
+	for _, name := range []string{"run", "explore"} {
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		opts := registerRunFlags(fs)
+		err := fs.Parse([]string{"-d", "data", "-s", "spec.yml", "-u", "ann", "-rate", "5", "-insecure=false", "-ca", "ca.pem"})
+		if err != nil {
+			t.Fatalf("%s: can't parse the flags: %v", name, err)
+		}
+		if opts.meqaPath != "data" || opts.swaggerFile != "spec.yml" || opts.username != "ann" || opts.rate != 5 ||
+			opts.tls.InsecureSkipVerify || opts.tls.CAFile != "ca.pem" || opts.nullProbability != mqplan.NullProbability {
+			t.Errorf("%s: unexpected options %+v", name, opts)
+		}
+		if err = opts.apply(); err != nil || opts.resultPath != filepath.Join("data", resultFile) {
+			t.Errorf("%s: expecting the default result path, got %s, %v", name, opts.resultPath, err)
+		}
+	}
 }
 
 func TestMain(m *testing.M) {
 	os.Exit(m.Run())
 }
+
+func TestSelfTest(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	plan, err := selfTest()
+	if err != nil {
+		t.Fatalf("the selftest failed: %v", err)
+	}
+	if plan.ResultCounts[mqutil.Passed] == 0 {
+		t.Errorf("expecting the selftest to run tests, got %v", plan.ResultCounts)
+	}
+}
+
+func TestSelfTestRepeatable(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	// The mock server's port changes, and the dates are picked before the current time, the other values sent
+	// don't.
+	dateTime := regexp.MustCompile(`\d{4}-\d\d-\d\dT[0-9:.]+Z?`)
+	requests := func() []string {
+		plan, err := selfTest()
+		if err != nil {
+			t.Fatalf("the selftest failed: %v", err)
+		}
+		var sent []string
+		for _, r := range plan.Results() {
+			body := fmt.Sprintf("%v", r.Request.Body)
+			sent = append(sent, r.Name+" "+r.Method+" "+r.Path+" "+dateTime.ReplaceAllString(body, "<date>"))
+		}
+		return sent
+	}
+	first, second := requests(), requests()
+	if len(first) == 0 || !reflect.DeepEqual(first, second) {
+		t.Errorf("expecting the selftest to send the same values, got\n%v\n%v", first, second)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	_ "embed"
+	"io/ioutil"
+	"meqa/mqplan"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+)
+
+// The selftest runs a bundled plan against the mock server of the bundled petstore spec, so that a new binary can
+// be checked without a server or the network. The plan creates, finds, updates and deletes objects through the
+// history, checks a get strictly, sends the negative tests of a body, and needs the bearer token meqa injects.
+
+//go:embed selftest/petstore_meqa.yml
+var selftestSpec []byte
+
+//go:embed selftest/plan.yml
+var selftestPlan []byte
+
+const (
+	selftestToken = "meqa-selftest"
+	selftestSeed  = 1
+)
+
+// selfTest runs the bundled plan against the mock server. Returns the plan, whose ResultCounts has the number of
+// the tests that passed and failed.
+func selfTest() (*mqplan.TestPlan, error) {
+	dir, err := ioutil.TempDir("", "meqa-selftest")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	specPath := filepath.Join(dir, "petstore_meqa.yml")
+	planPath := filepath.Join(dir, "plan.yml")
+	if err = ioutil.WriteFile(specPath, selftestSpec, 0644); err != nil {
+		return nil, err
+	}
+	if err = ioutil.WriteFile(planPath, selftestPlan, 0644); err != nil {
+		return nil, err
+	}
+
+	swagger, err := mqswag.CreateSwaggerFromURL(specPath, dir)
+	if err != nil {
+		return nil, err
+	}
+	server := httptest.NewServer(mqplan.NewMockServer(swagger, selftestToken))
+	defer server.Close()
+	if err = mqplan.SetBaseURL(swagger, server.URL+swagger.BasePath); err != nil {
+		return nil, err
+	}
+
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &mqplan.TestPlan{ApiToken: selftestToken}
+	if err = plan.InitFromFile(planPath, db); err != nil {
+		return nil, err
+	}
+	var suiteNames []string
+	for _, testSuite := range plan.SuiteList {
+		suiteNames = append(suiteNames, testSuite.Name)
+	}
+	// The same seed generates the same values, so the selftest is repeatable.
+	mqplan.History.Reset()
+	mqplan.Seed(selftestSeed)
+	plan.ResultCounts = make(map[string]int)
+	plan.RunSuites(suiteNames, 1)
+	plan.LogErrors()
+	plan.PrintSummary()
+	if plan.ResultCounts[mqutil.Failed] > 0 {
+		return plan, mqutil.NewError(mqutil.ErrHttp, "the selftest failed")
+	}
+	return plan, nil
+}
@@ -0,0 +1,98 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"strconv"
+
+	"github.com/go-openapi/spec"
+)
+
+// The assertion strength of a test, i.e. how much of the response it checks, from the weakest to the strongest.
+const (
+	AssertStatus = 1 + iota // only the status code
+	AssertSchema            // the status code, and the body against the response schema in the spec
+	AssertBody              // also the fields of the body against the test's expect body
+	AssertDB                // also the body against the objects in the client DB
+)
+
+// AssertionThreshold is the assertion strength below which the tests are reported in the run summary.
+// The default of 0 doesn't report any test.
+var AssertionThreshold = 0
+
+// AssertionStrength scores how much of the response the test checks, and suggests what the test can check
+// in addition. The tests that don't make a call themselves, e.g. the ones with a ref or steps, score 0.
+func (t *Test) AssertionStrength() (int, string) {
+	if len(t.Path) == 0 || len(t.Method) == 0 || t.db == nil || t.db.Swagger == nil {
+		return 0, ""
+	}
+	if body, ok := t.Expect[ExpectBody].(map[string]interface{}); ok && body[ExpectDB] != nil {
+		return AssertDB, ""
+	}
+	if t.Expect[ExpectBody] != nil {
+		return AssertBody, fmt.Sprintf("consider checking the body against the client DB through %s", ExpectDB)
+	}
+	if respSchema := t.expectedResponseSchema(); respSchema != nil {
+		return AssertSchema, fmt.Sprintf("response declares %s schema; consider an expect body with %s or "+
+			"the fields to check", t.schemaName(respSchema), ExpectDB)
+	}
+	return AssertStatus, "response declares no schema; consider declaring one in the spec, or an expect body"
+}
+
+// expectedResponseSchema finds the schema of the response the test expects in the spec.
+func (t *Test) expectedResponseSchema() *spec.Schema {
+	pathItem := t.db.Swagger.Paths.Paths[t.Path]
+	op := GetOperationByMethod(&pathItem, t.Method)
+	if op == nil || op.Responses == nil {
+		return nil
+	}
+	var expectedStatus interface{} = "success"
+	if t.Expect[ExpectStatus] != nil {
+		expectedStatus = t.Expect[ExpectStatus]
+	}
+	for status, resp := range op.Responses.StatusCodeResponses {
+		if resp.Schema == nil {
+			continue
+		}
+		if expectedStatus == status || fmt.Sprint(expectedStatus) == strconv.Itoa(status) ||
+			expectedStatus == "success" && status >= 200 && status < 300 {
+			return resp.Schema
+		}
+	}
+	if op.Responses.Default != nil {
+		return op.Responses.Default.Schema
+	}
+	return nil
+}
+
+// schemaName describes the schema by the name of the definition it refers to.
+func (t *Test) schemaName(schema *spec.Schema) string {
+	if schema.Items != nil && schema.Items.Schema != nil {
+		return "array of " + t.schemaName(schema.Items.Schema)
+	}
+	if name, _, _ := t.db.Swagger.GetReferredSchema((*mqswag.Schema)(schema)); len(name) > 0 {
+		return name
+	}
+	return "response"
+}
+
+// PrintWeakAssertions prints the tests whose assertion strength is below the threshold, with what they can
+// check in addition.
+func (plan *TestPlan) PrintWeakAssertions(threshold int) {
+	fmt.Print(mqutil.AQUA)
+	fmt.Printf("-----------------------------Weak Assertions-------------------------\n")
+	fmt.Print(mqutil.END)
+	for _, t := range plan.resultList {
+		if t.Assertions == 0 || t.Assertions >= threshold {
+			continue
+		}
+		fmt.Print(mqutil.YELLOW)
+		fmt.Printf("%v: %v, assertion strength %d\n", t.Path, t.Name, t.Assertions)
+		fmt.Print(mqutil.END)
+		fmt.Printf("... %s\n", t.assertionHint)
+	}
+	fmt.Print(mqutil.AQUA)
+	fmt.Println("---------------------------------------------------------------------")
+	fmt.Print(mqutil.END)
+}
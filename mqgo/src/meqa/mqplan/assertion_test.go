@@ -0,0 +1,43 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"meqa/mqswag"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestAssertionStrength(t *testing.T) {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(orderSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+
+	cases := []struct {
+		path     string
+		method   string
+		expect   map[string]interface{}
+		strength int
+		hint     string
+	}{
+		{"/order/capture", mqswag.MethodPost, nil, AssertStatus, "no schema"},
+		{"/order", mqswag.MethodPost, nil, AssertSchema, "declares Order schema"},
+		{"/order", mqswag.MethodPost, map[string]interface{}{ExpectStatus: 200}, AssertSchema, "declares Order schema"},
+		{"/order", mqswag.MethodPost, map[string]interface{}{ExpectBody: map[string]interface{}{"name": "order"}}, AssertBody, ExpectDB},
+		{"/order", mqswag.MethodPost, map[string]interface{}{ExpectBody: map[string]interface{}{
+			ExpectDB: map[string]interface{}{ExpectDBClass: "Order"}}}, AssertDB, ""},
+		{"", "", nil, 0, ""},
+	}
+	for _, c := range cases {
+		test := &Test{Path: c.path, Method: c.method, Expect: c.expect, db: db}
+		strength, hint := test.AssertionStrength()
+		if strength != c.strength || !strings.Contains(hint, c.hint) {
+			t.Errorf("%s %s %v: expecting %d %q, got %d %q", c.method, c.path, c.expect, c.strength, c.hint, strength, hint)
+		}
+	}
+}
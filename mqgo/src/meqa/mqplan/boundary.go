@@ -0,0 +1,244 @@
+package mqplan
+
+import (
+	"fmt"
+	"math"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// In the boundary mode, a test runs once per combination of the edge values of its parameters instead of once
+// with random values. The edges come from the minimum and maximum of the numbers, the minLength and maxLength of
+// the strings, and the minItems and maxItems of the arrays: the bound itself, and the value just inside it. The
+// values outside the bounds are left to the negative tests.
+
+// The generation modes of the tests.
+const (
+	GenerateRandom   = "random"
+	GenerateBoundary = "boundary"
+	GenerateNegative = "negative"
+)
+
+// checkGenerate returns an error if the generation mode isn't valid.
+func checkGenerate(mode string) error {
+	switch mode {
+	case "", GenerateRandom, GenerateBoundary, GenerateNegative:
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid generate %s, expecting random, boundary or negative",
+		mode))
+}
+
+// DefaultBoundaryLimit is the number of tests a test expands to in the boundary mode, when meqa_init doesn't set
+// boundaryLimit.
+var DefaultBoundaryLimit = 20
+
+// boundary is an edge value of a parameter, e.g. the maximum of limit.
+type boundary struct {
+	param string
+	label string // min, min+1, max-1, max, or the same for minLength and minItems
+	value float64
+}
+
+// paramBoundaries returns the edge values of the parameter, in the order of the labels. The values that coincide,
+// e.g. min+1 and max when the range is 1 wide, are only kept once.
+func paramBoundaries(p *spec.Parameter) []boundary {
+	var lower, upper *float64
+	var prefix string
+	step := 1.0
+	switch p.Type {
+	case "integer", "number":
+		if p.Minimum != nil {
+			v := *p.Minimum
+			if p.ExclusiveMinimum {
+				v = nextInside(v, p.Type, 1)
+			}
+			lower = &v
+		}
+		if p.Maximum != nil {
+			v := *p.Maximum
+			if p.ExclusiveMaximum {
+				v = nextInside(v, p.Type, -1)
+			}
+			upper = &v
+		}
+		if p.MultipleOf != nil && *p.MultipleOf > 0 {
+			step = *p.MultipleOf
+			if lower != nil {
+				*lower = math.Ceil(*lower/step) * step
+			}
+			if upper != nil {
+				*upper = math.Floor(*upper/step) * step
+			}
+		}
+	case "string":
+		prefix = "Length"
+		if p.Enum != nil || len(p.Format) > 0 {
+			// The values of an enum or a format have their own lengths.
+			return nil
+		}
+		lower, upper = int64Bound(p.MinLength), int64Bound(p.MaxLength)
+	case "array":
+		prefix = "Items"
+		lower, upper = int64Bound(p.MinItems), int64Bound(p.MaxItems)
+	default:
+		return nil
+	}
+	if prefix == "Length" && lower != nil && *lower < 0 {
+		*lower = 0
+	}
+	if prefix == "Items" && lower != nil && *lower < 1 {
+		// The generated arrays have at least one item, an empty one is the same as leaving the parameter out.
+		*lower = 1
+	}
+
+	var found []boundary
+	add := func(label string, v float64) {
+		if lower != nil && v < *lower || upper != nil && v > *upper {
+			return
+		}
+		for _, b := range found {
+			if b.value == v {
+				return
+			}
+		}
+		found = append(found, boundary{p.Name, label, v})
+	}
+	if lower != nil {
+		add("min"+prefix, *lower)
+		add("min"+prefix+"+1", *lower+step)
+	}
+	if upper != nil {
+		add("max"+prefix+"-1", *upper-step)
+		add("max"+prefix, *upper)
+	}
+	return found
+}
+
+func int64Bound(v *int64) *float64 {
+	if v == nil {
+		return nil
+	}
+	f := float64(*v)
+	return &f
+}
+
+// nextInside returns the first value inside an exclusive bound, in the direction given.
+func nextInside(v float64, typeName string, direction float64) float64 {
+	if typeName == "integer" {
+		if direction > 0 {
+			return math.Floor(v) + 1
+		}
+		return math.Ceil(v) - 1
+	}
+	return math.Nextafter(v, direction*math.Inf(1))
+}
+
+// ExpandBoundaries returns one test per combination of the edge values of the test's parameters, up to the plan's
+// boundaryLimit. The parameters the test or the suite sets keep their values. A test without bounded parameters
+// is returned as is.
+func (t *Test) ExpandBoundaries() []*Test {
+	var params []spec.Parameter
+	if t.db != nil && t.db.Swagger != nil && t.db.Swagger.Paths != nil {
+		pathItem := t.db.Swagger.Paths.Paths[t.Path]
+		if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+			params = operationParams(&pathItem, op)
+		}
+	}
+	var lists [][]boundary
+	for i := range params {
+		p := &params[i]
+		if p.In == "body" || t.paramIsSet(p) {
+			continue
+		}
+		if found := paramBoundaries(p); len(found) > 0 {
+			lists = append(lists, found)
+		}
+	}
+	if len(lists) == 0 {
+		return []*Test{t}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i][0].param < lists[j][0].param })
+
+	limit := DefaultBoundaryLimit
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.BoundaryLimit > 0 {
+		limit = t.suite.plan.BoundaryLimit
+	}
+	total := 1
+	for _, list := range lists {
+		total *= len(list)
+	}
+	if total > limit {
+		mqutil.Logger.Printf("%s: %d combinations of boundary values, running the first %d", t.Name, total, limit)
+		total = limit
+	}
+
+	var tests []*Test
+	for n := 0; n < total; n++ {
+		test := *t
+		test.boundaries = make(map[string]boundary)
+		var names []string
+		// The last parameter's values change first.
+		index := n
+		for i := len(lists) - 1; i >= 0; i-- {
+			b := lists[i][index%len(lists[i])]
+			index /= len(lists[i])
+			test.boundaries[b.param] = b
+			names = append([]string{b.param + "=" + b.label}, names...)
+		}
+		test.Name = fmt.Sprintf("%s[%s]", t.Name, strings.Join(names, ","))
+		tests = append(tests, &test)
+	}
+	return tests
+}
+
+// paramIsSet returns whether the test or its suite sets the parameter.
+func (t *Test) paramIsSet(p *spec.Parameter) bool {
+	sections := []*TestParams{&t.TestParams}
+	if t.suite != nil {
+		sections = append(sections, &t.suite.TestParams)
+	}
+	for _, section := range sections {
+		var m map[string]interface{}
+		switch p.In {
+		case "path":
+			m = section.PathParams
+		case "query":
+			m = section.QueryParams
+		case "header":
+			if _, exist := mqutil.HeaderKey(section.HeaderParams, p.Name); exist {
+				return true
+			}
+		case "formData":
+			m = section.FormParams
+		}
+		if _, exist := m[p.Name]; exist {
+			return true
+		}
+	}
+	return false
+}
+
+// generateBoundary generates the parameter's edge value picked for the test.
+func (t *Test) generateBoundary(paramSpec *spec.Parameter, b boundary, db *mqswag.DB) (interface{}, error) {
+	schema := (*spec.Schema)(mqswag.CreateSchemaFromSimple(&paramSpec.SimpleSchema, &paramSpec.CommonValidations))
+	switch paramSpec.Type {
+	case "integer":
+		return int64(b.value), nil
+	case "number":
+		return b.value, nil
+	case "string":
+		length := int64(b.value)
+		schema.MinLength, schema.MaxLength = &length, &length
+		return generateString(schema, paramSpec.Name)
+	case "array":
+		count := int64(b.value)
+		schema.MinItems, schema.MaxItems = &count, &count
+		return t.generateArray("", nil, schema, db, 0)
+	}
+	return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("no boundary values for %s", paramSpec.Type))
+}
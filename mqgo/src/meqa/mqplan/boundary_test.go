@@ -0,0 +1,84 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const boundarySwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "boundary", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets": {"get": {
+			"parameters": [
+				{"name": "limit", "in": "query", "type": "integer", "minimum": 1, "maximum": 100},
+				{"name": "name", "in": "query", "type": "string", "minLength": 2, "maxLength": 3},
+				{"name": "tags", "in": "query", "type": "array", "items": {"type": "string"}, "maxItems": 2,
+					"collectionFormat": "csv"}],
+			"responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+func TestBoundaryValues(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	run := func(init string, test string) []*Test {
+		plan := newTestPlan(t, boundarySwagger, server.URL, "  generate: boundary\n"+init)
+		if err := plan.AddFromString("suite:\n- name: list\n  path: /pets\n  method: get\n" + test); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		queries = nil
+		if _, err := plan.Run("suite", nil); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		return plan.resultList
+	}
+
+	// 4 values of limit, 2 of name, as min+1 is max, and 2 of tags, which has no minItems.
+	results := run("", "")
+	if len(results) != 16 || len(queries) != 16 {
+		t.Fatalf("expecting 16 tests, got %d", len(results))
+	}
+	found := false
+	for i, test := range results {
+		if test.Name != "list[limit=max,name=minLength,tags=maxItems]" {
+			continue
+		}
+		q := queries[i]
+		if q.Get("limit") != "100" || len(q.Get("name")) != 2 || len(strings.Split(q.Get("tags"), ",")) != 2 {
+			t.Errorf("expecting the edge values, got %v", q)
+		}
+		found = true
+	}
+	if !found {
+		t.Errorf("expecting a test named after its boundaries, got %v", results[0].Name)
+	}
+	for _, q := range queries {
+		limit := q.Get("limit")
+		if limit != "1" && limit != "2" && limit != "99" && limit != "100" {
+			t.Errorf("expecting limit at its edges, got %s", limit)
+		}
+	}
+
+	// The limit caps the tests, and the parameters the test sets aren't expanded.
+	if results = run("  boundaryLimit: 3\n", ""); len(results) != 3 {
+		t.Errorf("expecting the boundaryLimit to cap the tests, got %d", len(results))
+	}
+	results = run("", "  queryParams:\n    limit: 5\n    tags: x\n")
+	if len(results) != 2 || results[0].Name != "list[name=minLength]" || queries[0].Get("limit") != "5" {
+		t.Errorf("expecting only name to be expanded, got %d tests, %s", len(results), results[0].Name)
+	}
+}
@@ -0,0 +1,220 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file compares the results of running the same plan against two hosts, e.g. the current backend
+// and the one about to replace it. Each host is run with its own plan and client DB, and the tests are
+// paired up by name in the order they ran.
+
+// The latency of a test differs when the slower call takes more than LatencyRatio times as long as the
+// faster one, and the difference is more than LatencyMargin.
+var (
+	LatencyRatio  = 2.0
+	LatencyMargin = 100 * time.Millisecond
+)
+
+// Divergence is a test whose outcome differs between the two hosts.
+type Divergence struct {
+	Name  string
+	Path  string
+	Diffs []string // e.g. "status: 200 != 404", "body.name: tom != jerry"
+}
+
+// SetBaseURL points the swagger at the scheme, host and base path of the URL, e.g. https://staging.example.com/v1.
+func SetBaseURL(swagger *mqswag.Swagger, baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid base url: %s", baseURL))
+	}
+	swagger.Schemes = []string{u.Scheme}
+	swagger.Host = u.Host
+	swagger.BasePath = strings.TrimSuffix(u.Path, "/")
+	return nil
+}
+
+// MutatingTests returns the tests in the plan that change the server's objects.
+func (plan *TestPlan) MutatingTests() []*Test {
+	var mutating []*Test
+	var add func(tests []*Test)
+	add = func(tests []*Test) {
+		for _, t := range tests {
+			if t.Method == mqswag.MethodPost || t.Method == mqswag.MethodPut || t.Method == mqswag.MethodPatch ||
+				t.Method == mqswag.MethodDelete {
+				mutating = append(mutating, t)
+			}
+			add(t.Setup)
+			add(t.Teardown)
+			add(t.Steps)
+			add(t.OnFailure)
+		}
+	}
+	for _, tc := range plan.SuiteList {
+		add(tc.Tests)
+	}
+	return mutating
+}
+
+// CompareResults compares the results of the two plans test by test. The fields in ignoreFields, either a
+// property name or a path like "owner.id", aren't compared.
+func CompareResults(a *TestPlan, b *TestPlan, ignoreFields []string) []Divergence {
+	ignore := make(map[string]bool)
+	for _, field := range ignoreFields {
+		ignore[field] = true
+	}
+	// Pair up the tests by name, the nth run of a name on one host with the nth run on the other.
+	bTests := make(map[string][]*Test)
+	for _, t := range b.resultList {
+		bTests[t.Name] = append(bTests[t.Name], t)
+	}
+	var divergences []Divergence
+	for _, ta := range a.resultList {
+		if len(bTests[ta.Name]) == 0 {
+			divergences = append(divergences, Divergence{ta.Name, ta.Path, []string{"only ran on the first host"}})
+			continue
+		}
+		tb := bTests[ta.Name][0]
+		bTests[ta.Name] = bTests[ta.Name][1:]
+		if diffs := compareTests(ta, tb, ignore); len(diffs) > 0 {
+			divergences = append(divergences, Divergence{ta.Name, ta.Path, diffs})
+		}
+	}
+	for _, tb := range b.resultList {
+		if len(bTests[tb.Name]) > 0 && bTests[tb.Name][0] == tb {
+			divergences = append(divergences, Divergence{tb.Name, tb.Path, []string{"only ran on the second host"}})
+			bTests[tb.Name] = bTests[tb.Name][1:]
+		}
+	}
+	return divergences
+}
+
+func compareTests(a *Test, b *Test, ignore map[string]bool) []string {
+	var diffs []string
+	outcome := func(t *Test) string {
+		if t.err != nil {
+			return "failed"
+		}
+		return "passed"
+	}
+	if outcome(a) != outcome(b) {
+		diffs = append(diffs, fmt.Sprintf("outcome: %s != %s", outcome(a), outcome(b)))
+	}
+	status := func(t *Test) int {
+		if t.resp == nil {
+			return 0
+		}
+		return t.resp.StatusCode()
+	}
+	if status(a) != status(b) {
+		diffs = append(diffs, fmt.Sprintf("status: %d != %d", status(a), status(b)))
+	}
+	schema := func(t *Test) string {
+		if t.schemaError != nil {
+			return "mismatch"
+		}
+		return "match"
+	}
+	if schema(a) != schema(b) {
+		diffs = append(diffs, fmt.Sprintf("schema: %s != %s", schema(a), schema(b)))
+	}
+	diffs = append(diffs, diffValues("body", responseBody(a), responseBody(b), ignore)...)
+
+	latencyA, latencyB := a.stopTime.Sub(a.startTime), b.stopTime.Sub(b.startTime)
+	slower, faster := latencyA, latencyB
+	if slower < faster {
+		slower, faster = faster, slower
+	}
+	if float64(slower) > LatencyRatio*float64(faster) && slower-faster > LatencyMargin {
+		diffs = append(diffs, fmt.Sprintf("latency: %v != %v", latencyA, latencyB))
+	}
+	return diffs
+}
+
+func responseBody(t *Test) interface{} {
+	if t.resp == nil || len(t.resp.Body()) == 0 {
+		return nil
+	}
+	var body interface{}
+	d := json.NewDecoder(bytes.NewReader(t.resp.Body()))
+	d.UseNumber()
+	if d.Decode(&body) != nil {
+		return string(t.resp.Body())
+	}
+	return body
+}
+
+// diffValues lists the differences between the two values, naming the fields by their path.
+func diffValues(path string, a interface{}, b interface{}, ignore map[string]bool) []string {
+	var diffs []string
+	mapA, aIsMap := a.(map[string]interface{})
+	mapB, bIsMap := b.(map[string]interface{})
+	if aIsMap && bIsMap {
+		keys := make(map[string]bool)
+		for k := range mapA {
+			keys[k] = true
+		}
+		for k := range mapB {
+			keys[k] = true
+		}
+		var sorted []string
+		for k := range keys {
+			sorted = append(sorted, k)
+		}
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			fieldPath := k
+			if path != "body" {
+				fieldPath = strings.TrimPrefix(path, "body.") + "." + k
+			}
+			if ignore[k] || ignore[fieldPath] {
+				continue
+			}
+			diffs = append(diffs, diffValues(path+"."+k, mapA[k], mapB[k], ignore)...)
+		}
+		return diffs
+	}
+	arrayA, aIsArray := a.([]interface{})
+	arrayB, bIsArray := b.([]interface{})
+	if aIsArray && bIsArray {
+		if len(arrayA) != len(arrayB) {
+			return []string{fmt.Sprintf("%s: %d != %d entries", path, len(arrayA), len(arrayB))}
+		}
+		for i := range arrayA {
+			diffs = append(diffs, diffValues(fmt.Sprintf("%s.%d", path, i), arrayA[i], arrayB[i], ignore)...)
+		}
+		return diffs
+	}
+	if mqutil.InterfaceToJsonString(a) != mqutil.InterfaceToJsonString(b) {
+		return []string{fmt.Sprintf("%s: %s != %s", path, mqutil.InterfaceToJsonString(a), mqutil.InterfaceToJsonString(b))}
+	}
+	return nil
+}
+
+// PrintDivergences prints the divergence report of the two hosts.
+func PrintDivergences(hostA string, hostB string, divergences []Divergence) {
+	fmt.Print(mqutil.AQUA)
+	fmt.Printf("-----------------------------Divergences-----------------------------\n")
+	fmt.Printf("%s != %s\n", hostA, hostB)
+	fmt.Print(mqutil.END)
+	for _, d := range divergences {
+		fmt.Print(mqutil.YELLOW)
+		fmt.Printf("%v: %v\n", d.Path, d.Name)
+		fmt.Print(mqutil.END)
+		for _, diff := range d.Diffs {
+			fmt.Printf("... %s\n", diff)
+		}
+	}
+	fmt.Print(mqutil.AQUA)
+	fmt.Printf("%d tests diverged\n", len(divergences))
+	fmt.Println("---------------------------------------------------------------------")
+	fmt.Print(mqutil.END)
+}
@@ -0,0 +1,73 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestCompareResults(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	servers := []*httptest.Server{
+		httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": 1, "name": "tom", "tags": ["a"]}`))
+		})),
+		httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/v1/fail" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": 2, "name": "jerry", "tags": ["a"]}`))
+		})),
+	}
+	var plans []*TestPlan
+	for _, server := range servers {
+		defer server.Close()
+		swagger := &mqswag.Swagger{}
+		err := json.Unmarshal([]byte(setupSwagger), (*spec.Swagger)(swagger))
+		if err != nil {
+			t.Fatalf("can't load swagger: %v", err)
+		}
+		if err = SetBaseURL(swagger, server.URL+"/v1/"); err != nil {
+			t.Fatalf("can't set the base url: %v", err)
+		}
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		plan := &TestPlan{}
+		plan.Init(swagger, db)
+		if err = plan.AddFromString("suite:\n- name: login\n  path: /login\n  method: post\n- name: fail\n  path: /fail\n  method: get\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		if len(plan.MutatingTests()) != 1 {
+			t.Errorf("expecting the post to be the only mutating test, got %v", plan.MutatingTests())
+		}
+		plan.ResultCounts = make(map[string]int)
+		plan.RunSuites([]string{"suite"}, 1)
+		plans = append(plans, plan)
+	}
+
+	divergences := CompareResults(plans[0], plans[1], []string{"id"})
+	if len(divergences) != 2 {
+		t.Fatalf("expecting both tests to diverge, got %v", divergences)
+	}
+	login, fail := strings.Join(divergences[0].Diffs, "; "), strings.Join(divergences[1].Diffs, "; ")
+	if divergences[0].Name != "login" || login != "body.name: tom != jerry" {
+		t.Errorf("expecting only the name to differ, got %s", login)
+	}
+	if divergences[1].Name != "fail" || !strings.Contains(fail, "outcome: passed != failed") ||
+		!strings.Contains(fail, "status: 200 != 500") {
+		t.Errorf("expecting the outcome and status to differ, got %s", fail)
+	}
+	if len(CompareResults(plans[0], plans[0], nil)) != 0 {
+		t.Errorf("expecting no divergence between a plan and itself")
+	}
+}
@@ -0,0 +1,51 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqutil"
+	"strings"
+)
+
+// The conditions of runIf and skipIf compare a template with a value, e.g. "{{login.expect.status}} == 200",
+// or check that a template has a value, e.g. "{{login.outputs.token}}".
+
+// Skipped returns whether the test should be skipped because of its runIf or skipIf condition.
+func (t *Test) Skipped(h *TestHistory) (bool, error) {
+	if len(t.RunIf) > 0 {
+		run, err := evalCondition(t.RunIf, h)
+		if err != nil || !run {
+			return true, err
+		}
+	}
+	if len(t.SkipIf) > 0 {
+		return evalCondition(t.SkipIf, h)
+	}
+	return false, nil
+}
+
+func evalCondition(condition string, h *TestHistory) (bool, error) {
+	for _, op := range []string{"==", "!="} {
+		ar := strings.SplitN(condition, op, 2)
+		if len(ar) != 2 {
+			continue
+		}
+		equal := conditionOperand(ar[0], h) == conditionOperand(ar[1], h)
+		return equal == (op == "=="), nil
+	}
+	condition = strings.TrimSpace(condition)
+	if !strings.HasPrefix(condition, "{{") || !strings.HasSuffix(condition, "}}") {
+		return false, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid condition: %s, the format is {{testName.paramSection.paramName}} == value", condition))
+	}
+	value := StringParamsResolveWithHistory(condition, h)
+	return value != nil && value != false, nil
+}
+
+// conditionOperand returns the operand with the templates resolved, as a string.
+func conditionOperand(operand string, h *TestHistory) string {
+	operand = strings.TrimSpace(operand)
+	if value := StringParamsResolveWithHistory(operand, h); value != nil {
+		return mqutil.InterfaceToJsonString(value)
+	}
+	return strings.Trim(operand, `"'`)
+}
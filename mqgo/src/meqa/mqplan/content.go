@@ -0,0 +1,324 @@
+package mqplan
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"meqa/mqutil"
+	"mime/multipart"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/resty.v0"
+)
+
+// The media types a test sends and accepts follow the consumes and produces of its operation, or those of the
+// spec when the operation doesn't declare any. The request bodies are sent as JSON when the operation consumes
+// a JSON media type, or doesn't say. Otherwise they are sent as XML when the operation consumes application/xml,
+// and an object body is sent as form fields when the operation only consumes application/x-www-form-urlencoded
+// or multipart/form-data.
+
+const (
+	mediaTypeJSON           = "application/json"
+	mediaTypeFormURLEncoded = "application/x-www-form-urlencoded"
+	mediaTypeMultipart      = "multipart/form-data"
+)
+
+// baseMediaType returns the media type without its parameters, e.g. the charset, in lower case.
+func baseMediaType(mediaType string) string {
+	return strings.ToLower(strings.TrimSpace(strings.Split(mediaType, ";")[0]))
+}
+
+func isJSONMediaType(mediaType string) bool {
+	base := baseMediaType(mediaType)
+	return base == mediaTypeJSON || strings.HasSuffix(base, "+json")
+}
+
+// mediaTypeAllowed returns whether the media type is in the list. The wildcards */* and type/* match too.
+func mediaTypeAllowed(mediaType string, list []string) bool {
+	base := baseMediaType(mediaType)
+	for _, m := range list {
+		allowed := baseMediaType(m)
+		if allowed == base || allowed == "*/*" ||
+			strings.HasSuffix(allowed, "/*") && strings.HasPrefix(base, strings.TrimSuffix(allowed, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveMediaTypes decides the Content-Type and the Accept headers of the request, once the parameters are
+// resolved. The headers the test sets win.
+func (t *Test) resolveMediaTypes() {
+	t.contentType, t.accept = "", ""
+	consumes := t.db.Swagger.GetConsumes(t.op)
+	if key, exist := mqutil.HeaderKey(t.HeaderParams, "Content-Type"); exist {
+		t.contentType = fmt.Sprint(t.HeaderParams[key])
+	} else if t.BodyParams != nil {
+		t.contentType = pickBodyMediaType(consumes, t.BodyParams)
+	} else if len(t.FormParams) > 0 {
+		t.contentType = mediaTypeFormURLEncoded
+		for _, p := range t.op.Parameters {
+			if p.Type == "file" && t.FormParams[p.Name] != nil {
+				t.contentType = mediaTypeMultipart
+			}
+		}
+	}
+	if len(t.contentType) > 0 && len(consumes) > 0 && !mediaTypeAllowed(t.contentType, consumes) {
+		fmt.Printf("... warning: sending %s, the operation consumes %s\n", t.contentType, strings.Join(consumes, ", "))
+		mqutil.Logger.Printf("%s: sending %s, the operation consumes %s", t.Name, t.contentType, strings.Join(consumes, ", "))
+	}
+
+	if key, exist := mqutil.HeaderKey(t.HeaderParams, "Accept"); exist {
+		t.accept = fmt.Sprint(t.HeaderParams[key])
+	} else {
+		t.accept = strings.Join(t.db.Swagger.GetProduces(t.op), ", ")
+	}
+}
+
+// pickBodyMediaType picks the media type to send the body with from the ones the operation consumes: the first
+// JSON one, otherwise the first XML one, otherwise a form media type if the body is an object, otherwise
+// application/json.
+func pickBodyMediaType(consumes []string, body interface{}) string {
+	for _, c := range consumes {
+		if isJSONMediaType(c) {
+			return c
+		}
+	}
+	for _, c := range consumes {
+		if isXMLMediaType(c) {
+			return c
+		}
+	}
+	if _, isMap := body.(map[string]interface{}); isMap {
+		for _, c := range consumes {
+			if base := baseMediaType(c); base == mediaTypeFormURLEncoded || base == mediaTypeMultipart {
+				return c
+			}
+		}
+	}
+	return mediaTypeJSON
+}
+
+// setBody sets the request body, encoded for the request's Content-Type. An object body is encoded as form
+// fields for the form media types, a body for an XML media type is encoded as XML, anything else is sent as JSON. Must be called after the test's headers are set,
+// a multipart Content-Type needs the boundary of the body.
+func (t *Test) setBody(req *resty.Request) {
+	bodyMap, isMap := t.BodyParams.(map[string]interface{})
+	_, headerSet := mqutil.HeaderKey(t.HeaderParams, "Content-Type")
+	contentType := t.contentType
+	switch baseMediaType(t.contentType) {
+	case mediaTypeFormURLEncoded:
+		if isMap {
+			req.SetBody(formValues(bodyMap).Encode())
+		} else {
+			req.SetBody(t.BodyParams)
+		}
+	case mediaTypeMultipart:
+		if isMap {
+			var body []byte
+			body, contentType = multipartBody(bodyMap)
+			req.SetBody(body)
+			// The boundary is only known now.
+			headerSet = false
+		} else {
+			req.SetBody(t.BodyParams)
+		}
+	default:
+		if isXMLMediaType(t.contentType) {
+			body, err := t.xmlBody()
+			if err == nil {
+				req.SetBody(body)
+				break
+			}
+			mqutil.Logger.Printf("%s: can't encode the body as XML, sending JSON: %s", t.Name, err.Error())
+		}
+		req.SetBody(t.BodyParams)
+	}
+	if !headerSet && len(contentType) > 0 {
+		req.SetHeader("Content-Type", contentType)
+	}
+}
+
+// formValues turns the fields of an object into form fields. An array becomes one field per entry, and the nulls
+// are left out.
+func formValues(obj map[string]interface{}) url.Values {
+	values := url.Values{}
+	for k, v := range obj {
+		if ar, ok := v.([]interface{}); ok {
+			for _, entry := range ar {
+				values.Add(k, mqutil.InterfaceToJsonString(entry))
+			}
+		} else if v != nil {
+			values.Add(k, mqutil.InterfaceToJsonString(v))
+		}
+	}
+	return values
+}
+
+// multipartBody encodes the fields of an object as a multipart/form-data body. Returns the body and its
+// Content-Type with the boundary.
+func multipartBody(obj map[string]interface{}) ([]byte, string) {
+	return multipartForm(formValues(obj), nil)
+}
+
+// multipartForm encodes the form fields and the files as a multipart/form-data body. Returns the body and its
+// Content-Type with the boundary.
+func multipartForm(values url.Values, files map[string]*UploadFile) ([]byte, string) {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, k := range keys {
+		for _, v := range values[k] {
+			w.WriteField(k, v)
+		}
+	}
+	keys = nil
+	for k := range files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		part, err := w.CreateFormFile(k, files[k].Name)
+		if err == nil {
+			part.Write(files[k].Content)
+		}
+	}
+	w.Close()
+	return buf.Bytes(), w.FormDataContentType()
+}
+
+// UploadFile is a file generated in memory for a file parameter. A file parameter can also be set to the path of
+// a file on disk.
+type UploadFile struct {
+	Name    string `json:"name"`
+	Size    int    `json:"size"`
+	Content []byte `json:"-"`
+}
+
+// The size of the files generated for the file parameters, when neither the test nor meqa_init sets fileSize, and
+// meqa_init doesn't set fileContent.
+var DefaultFileSize = 1024
+
+// generateFile generates the file to upload for a file parameter. The content is the plan's fileContent, or
+// fileSize random letters and digits.
+func (t *Test) generateFile(paramName string) *UploadFile {
+	size, content := t.planLimit(t.FileSize, func(plan *TestPlan) int { return plan.FileSize }, DefaultFileSize), ""
+	if t.suite != nil && t.suite.plan != nil {
+		content = t.suite.plan.FileContent
+	}
+	if len(content) == 0 {
+		content = randomString(lowerLetters+digits, size)
+	}
+	name := paramName
+	if len(name) == 0 {
+		name = "file"
+	}
+	return &UploadFile{name + ".txt", len(content), []byte(content)}
+}
+
+// setMediaTypes sets the Accept header if the test doesn't set it itself.
+func (t *Test) setMediaTypes(req *resty.Request) {
+	if _, exist := mqutil.HeaderKey(t.HeaderParams, "Accept"); !exist && len(t.accept) > 0 {
+		req.SetHeader("Accept", t.accept)
+	}
+}
+
+// checkResponseMediaType warns when the response's Content-Type isn't one the operation produces.
+func (t *Test) checkResponseMediaType(resp *resty.Response) {
+	t.respContentType = resp.Header().Get("Content-Type")
+	produces := t.db.Swagger.GetProduces(t.op)
+	if len(t.respContentType) == 0 || len(resp.Body()) == 0 || len(produces) == 0 ||
+		mediaTypeAllowed(t.respContentType, produces) {
+		return
+	}
+	fmt.Printf("... warning: the response is %s, the operation produces %s\n", t.respContentType,
+		strings.Join(produces, ", "))
+	mqutil.Logger.Printf("%s: the response is %s, the operation produces %s", t.Name, t.respContentType,
+		strings.Join(produces, ", "))
+}
+
+// isBinaryMediaType returns whether the media type is for binary content, e.g. application/octet-stream or
+// image/png, rather than JSON, text, XML or a form.
+func isBinaryMediaType(mediaType string) bool {
+	base := baseMediaType(mediaType)
+	if len(base) == 0 || strings.Contains(base, "*") || isJSONMediaType(base) || strings.HasPrefix(base, "text/") ||
+		strings.HasSuffix(base, "/xml") || strings.HasSuffix(base, "+xml") || base == mediaTypeFormURLEncoded ||
+		strings.HasPrefix(base, "multipart/") {
+		return false
+	}
+	return true
+}
+
+// isBinaryResponse returns whether the response body is binary. The Content-Type of the response decides. Without
+// one, the body is binary if the response's schema is a file, or the operation only produces a binary media type.
+func (t *Test) isBinaryResponse(resp *resty.Response) bool {
+	if mediaType := resp.Header().Get("Content-Type"); len(mediaType) > 0 {
+		return isBinaryMediaType(mediaType)
+	}
+	if t.op == nil {
+		return false
+	}
+	if respSpec, _ := t.getResponseSpec(resp.StatusCode()); respSpec.Schema != nil && respSpec.Schema.Type.Contains("file") {
+		return true
+	}
+	produces := t.db.Swagger.GetProduces(t.op)
+	return len(produces) == 1 && isBinaryMediaType(produces[0])
+}
+
+// The expectations on a binary response body, e.g. expect: {bodySha256: 9f86d0...} or expect: {minBytes: 1024}.
+const (
+	ExpectBodySha256 = "bodySha256"
+	ExpectMinBytes   = "minBytes"
+)
+
+// magicBytes are how the files of the common binary media types start.
+var magicBytes = map[string][]byte{
+	"image/png":        []byte("\x89PNG\r\n\x1a\n"),
+	"image/jpeg":       {0xff, 0xd8, 0xff},
+	"image/gif":        []byte("GIF8"),
+	"application/pdf":  []byte("%PDF-"),
+	"application/zip":  []byte("PK\x03\x04"),
+	"application/gzip": {0x1f, 0x8b},
+}
+
+// checkBinaryBody records the size and the SHA-256 of the binary body, and checks it against the test's
+// expectations. A success response that returns content must not be empty, and must start with the magic bytes
+// of its media type, if we know them.
+func (t *Test) checkBinaryBody(body []byte, mediaType string, needsContent bool) error {
+	sum := sha256.Sum256(body)
+	t.bodySize, t.bodySha256 = len(body), hex.EncodeToString(sum[:])
+	if needsContent && len(body) == 0 {
+		return mqutil.NewError(mqutil.ErrExpect, "the binary response body is empty")
+	}
+	if magic, ok := magicBytes[baseMediaType(mediaType)]; ok && len(body) > 0 && !bytes.HasPrefix(body, magic) {
+		prefix := body
+		if len(prefix) > len(magic) {
+			prefix = prefix[:len(magic)]
+		}
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the body isn't %s, it starts with %x",
+			baseMediaType(mediaType), prefix))
+	}
+	if minBytes, exist := t.Expect[ExpectMinBytes]; exist {
+		n, err := strconv.Atoi(fmt.Sprint(minBytes))
+		if err != nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid %s %v", ExpectMinBytes, minBytes))
+		}
+		if len(body) < n {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the body has %d bytes, expecting at least %d",
+				len(body), n))
+		}
+	}
+	if expected, exist := t.Expect[ExpectBodySha256]; exist && !strings.EqualFold(fmt.Sprint(expected), t.bodySha256) {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the body's SHA-256 is %s, expecting %v",
+			t.bodySha256, expected))
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+)
+
+const mediaTypeSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "media types", "version": "1.0"},
+	"schemes": ["http"],
+	"consumes": ["application/json"],
+	"produces": ["application/json"],
+	"paths": {
+		"/pets": {
+			"post": {
+				"parameters": [{"name": "pet", "in": "body", "schema": {"type": "object",
+					"properties": {"name": {"type": "string"}}}}],
+				"responses": {"200": {"description": "ok"}}
+			},
+			"put": {
+				"consumes": ["application/xml", "application/vnd.pet+json"],
+				"produces": ["application/vnd.pet+json"],
+				"parameters": [{"name": "pet", "in": "body", "schema": {"type": "object",
+					"properties": {"name": {"type": "string"}}}}],
+				"responses": {"200": {"description": "ok"}}
+			}
+		}
+	}
+}`
+
+func TestMediaTypes(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	requests := make(map[string]http.Header)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method] = r.Header
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"name": "rex"}`))
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, mediaTypeSwagger, server.URL, "")
+	swagger := plan.swagger
+	op := swagger.Paths.Paths["/pets"].Put
+	if consumes := swagger.GetConsumes(op); len(consumes) != 2 || consumes[0] != "application/xml" {
+		t.Errorf("expecting the operation's consumes, got %v", consumes)
+	}
+	if produces := swagger.GetProduces(swagger.Paths.Paths["/pets"].Post); len(produces) != 1 ||
+		produces[0] != "application/json" {
+		t.Errorf("expecting the global produces, got %v", produces)
+	}
+
+	err := plan.AddFromString(`suite:
+- name: post
+  path: /pets
+  method: post
+- name: put
+  path: /pets
+  method: put
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("suite", nil)
+
+	// The operation's own list wins over the global one, and a JSON media type is picked for the body.
+	if h := requests["POST"]; h.Get("Content-Type") != "application/json" || h.Get("Accept") != "application/json" {
+		t.Errorf("expecting the global media types for post, got %v", h)
+	}
+	if h := requests["PUT"]; h.Get("Content-Type") != "application/vnd.pet+json" ||
+		h.Get("Accept") != "application/vnd.pet+json" {
+		t.Errorf("expecting the operation's media types for put, got %v", h)
+	}
+	results := plan.Results()
+	if len(results) != 2 {
+		t.Fatalf("expecting both tests to be sent, got %v", results)
+	}
+	put := results[1]
+	if put.Request.ContentType != "application/vnd.pet+json" || put.Request.Accept != "application/vnd.pet+json" ||
+		put.ContentType != "application/json; charset=utf-8" {
+		t.Errorf("expecting the media types in the result, got %+v", put)
+	}
+}
+
+const bodyEncodingSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "body encoding", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/json": {"post": {
+			"parameters": [{"name": "pet", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok"}}}},
+		"/form": {"post": {
+			"consumes": ["application/x-www-form-urlencoded"],
+			"parameters": [{"name": "pet", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok"}}}},
+		"/multipart": {"post": {
+			"consumes": ["multipart/form-data"],
+			"parameters": [{"name": "pet", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok"}}}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "required": ["name", "tags"], "properties": {
+			"name": {"type": "string"},
+			"tags": {"type": "array", "items": {"type": "string"}}}}
+	}
+}`
+
+func TestBodyEncoding(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	contentTypes := make(map[string]string)
+	bodies := make(map[string]map[string][]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes[r.URL.Path] = r.Header.Get("Content-Type")
+		switch r.URL.Path {
+		case "/json":
+			var body map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body != nil {
+				bodies[r.URL.Path] = map[string][]string{"name": {fmt.Sprint(body["name"])}}
+			}
+		case "/form":
+			r.ParseForm()
+			bodies[r.URL.Path] = r.PostForm
+		case "/multipart":
+			if r.ParseMultipartForm(1<<20) == nil {
+				bodies[r.URL.Path] = r.MultipartForm.Value
+			}
+		}
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, bodyEncodingSwagger, server.URL, "")
+	err := plan.AddFromString(`suite:
+- name: json
+  path: /json
+  method: post
+- name: form
+  path: /form
+  method: post
+- name: multipart
+  path: /multipart
+  method: post
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	if _, err = plan.Run("suite", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if contentTypes["/json"] != "application/json" || len(bodies["/json"]["name"]) != 1 {
+		t.Errorf("expecting a JSON body, got %s %v", contentTypes["/json"], bodies["/json"])
+	}
+	if contentTypes["/form"] != "application/x-www-form-urlencoded" || len(bodies["/form"]["name"]) != 1 ||
+		len(bodies["/form"]["tags"]) == 0 {
+		t.Errorf("expecting a form encoded body, got %s %v", contentTypes["/form"], bodies["/form"])
+	}
+	if !strings.HasPrefix(contentTypes["/multipart"], "multipart/form-data; boundary=") ||
+		len(bodies["/multipart"]["name"]) != 1 || len(bodies["/multipart"]["tags"]) == 0 {
+		t.Errorf("expecting a multipart body, got %s %v", contentTypes["/multipart"], bodies["/multipart"])
+	}
+}
+
+const fileUploadSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "file upload", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets/photo": {"post": {
+			"consumes": ["multipart/form-data"],
+			"parameters": [
+				{"name": "photo", "in": "formData", "type": "file", "required": true},
+				{"name": "caption", "in": "formData", "type": "string", "required": true}],
+			"responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+func TestFileUpload(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var sizes []int64
+	var contents, captions []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, header, err := r.FormFile("photo")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		content, _ := ioutil.ReadAll(file)
+		sizes = append(sizes, header.Size)
+		contents = append(contents, string(content))
+		captions = append(captions, r.FormValue("caption"))
+	}))
+	defer server.Close()
+
+	for _, init := range []string{"fileSize: 100", "fileContent: hello"} {
+		plan := newTestPlan(t, fileUploadSwagger, server.URL, "  "+init+"\n")
+		if err := plan.AddFromString("suite:\n- name: upload\n  path: /pets/photo\n  method: post\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		if _, err := plan.Run("suite", nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(sizes) != 2 || sizes[0] != 100 || len(contents[0]) != 100 || sizes[1] != 5 || contents[1] != "hello" {
+		t.Errorf("expecting a 100 bytes file and then hello, got %v %q", sizes, contents)
+	}
+	if len(captions) != 2 || len(captions[0]) == 0 {
+		t.Errorf("expecting the caption along with the file, got %q", captions)
+	}
+}
+
+func TestBinaryResponses(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	var contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(contentType) > 0 {
+			w.Header().Set("Content-Type", contentType)
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	op := &spec.Operation{}
+	op.Produces = []string{"image/png"}
+	op.Responses = &spec.Responses{}
+	op.Responses.StatusCodeResponses = map[int]spec.Response{200: *spec.NewResponse()}
+	cases := []struct {
+		contentType string
+		body        []byte
+		expect      map[string]interface{}
+		ok          bool
+	}{
+		{"image/png", png, nil, true},
+		{"", png, nil, true},
+		{"image/png", nil, nil, false},
+		{"image/png", []byte("<html>oops</html>"), nil, false},
+		{"application/octet-stream", []byte{1, 2, 3}, nil, true},
+		{"application/octet-stream", []byte{1, 2, 3}, map[string]interface{}{ExpectMinBytes: 1024}, false},
+		{"image/png", png, map[string]interface{}{ExpectMinBytes: 100}, true},
+		{"application/octet-stream", []byte("test"), map[string]interface{}{
+			ExpectBodySha256: "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"}, true},
+		{"application/octet-stream", []byte("tests"), map[string]interface{}{
+			ExpectBodySha256: "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}, false},
+	}
+	for i, c := range cases {
+		contentType, body = c.contentType, c.body
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = op
+		test.Expect = c.expect
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if !test.isBinaryResponse(resp) {
+			t.Errorf("case %d: expecting a binary response", i)
+		}
+		err = test.ProcessResult(resp)
+		if c.ok != (err == nil) {
+			t.Errorf("case %d: expecting ok %v, got %v", i, c.ok, err)
+		}
+		if test.bodySize != len(c.body) || len(test.bodySha256) != 64 {
+			t.Errorf("case %d: expecting the size and the hash of the body, got %d %s", i, test.bodySize, test.bodySha256)
+		}
+		if sha, exist := c.expect[ExpectBodySha256]; exist && !c.ok && test.Expect[ExpectBodySha256] == sha {
+			t.Errorf("case %d: expecting the actual hash in the expect, got %v", i, test.Expect)
+		}
+	}
+
+	for mediaType, binary := range map[string]bool{"application/json; charset=utf-8": false, "text/plain": false,
+		"application/problem+xml": false, "multipart/form-data": false, "*/*": false, "image/png": true,
+		"application/pdf": true, "application/octet-stream": true} {
+		if isBinaryMediaType(mediaType) != binary {
+			t.Errorf("expecting %s binary %v", mediaType, binary)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"os"
+	"strconv"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Coverage tracks the status codes each operation has returned so far. It's kept in a yaml file so the
+// coverage accumulates over runs.
+type Coverage struct {
+	// The "method path" of the operation to the status code to the number of times it's returned.
+	Operations map[string]map[string]int `yaml:"operations"`
+}
+
+func NewCoverage() *Coverage {
+	return &Coverage{make(map[string]map[string]int)}
+}
+
+// LoadCoverageFromFile loads the coverage from the file at path. Returns an empty coverage if the file
+// doesn't exist.
+func LoadCoverageFromFile(path string) (*Coverage, error) {
+	c := NewCoverage()
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.Unmarshal(data, c)
+	if err != nil {
+		mqutil.Logger.Printf("The following is not a valid coverage file: %s", path)
+		return nil, err
+	}
+	if c.Operations == nil {
+		c.Operations = make(map[string]map[string]int)
+	}
+	return c, nil
+}
+
+func (c *Coverage) WriteToFile(path string) error {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func coverageKey(method string, path string) string {
+	return method + " " + path
+}
+
+// Record records that the operation returned the status.
+func (c *Coverage) Record(method string, path string, status int) {
+	key := coverageKey(method, path)
+	if c.Operations[key] == nil {
+		c.Operations[key] = make(map[string]int)
+	}
+	c.Operations[key][strconv.Itoa(status)]++
+}
+
+// RecordTests records the status of all the tests that got a response from the server.
+func (c *Coverage) RecordTests(tests []*Test) {
+	for _, t := range tests {
+		if len(t.Steps) > 0 {
+			c.RecordTests(t.Steps)
+			c.RecordTests(t.OnFailure)
+			continue
+		}
+		if t.resp != nil && t.resp.StatusCode() > 0 {
+			c.Record(t.Method, t.Path, t.resp.StatusCode())
+		}
+	}
+}
+
+// Count returns the number of times the operation returned the status. The "default" status counts
+// all the statuses not in the declared list.
+func (c *Coverage) Count(method string, path string, status string, declared []string) int {
+	statusCounts := c.Operations[coverageKey(method, path)]
+	if status != "default" {
+		return statusCounts[status]
+	}
+	count := 0
+	for s, n := range statusCounts {
+		isDeclared := false
+		for _, d := range declared {
+			if s == d {
+				isDeclared = true
+				break
+			}
+		}
+		if !isDeclared {
+			count += n
+		}
+	}
+	return count
+}
@@ -0,0 +1,21 @@
+package mqplan
+
+import "testing"
+
+func TestCoverageCount(t *testing.T) {
+	c := NewCoverage()
+	c.Record("get", "/pet/{petId}", 200)
+	c.Record("get", "/pet/{petId}", 200)
+	c.Record("get", "/pet/{petId}", 500)
+	declared := []string{"200", "404", "default"}
+
+	if n := c.Count("get", "/pet/{petId}", "200", declared); n != 2 {
+		t.Errorf("expected 2 for 200, got %d", n)
+	}
+	if n := c.Count("get", "/pet/{petId}", "404", declared); n != 0 {
+		t.Errorf("expected 0 for 404, got %d", n)
+	}
+	if n := c.Count("get", "/pet/{petId}", "default", declared); n != 1 {
+		t.Errorf("expected 1 for default, got %d", n)
+	}
+}
@@ -0,0 +1,125 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// A CRUD suite follows one object through its life: it's created with a post on the collection, e.g. /items, read
+// back with a get on the item's path, e.g. /items/{id}, updated with a put or a patch, read back again, deleted,
+// and read once more, expecting a 404. The tests after the create take the object's id from its outputs, and the
+// read-backs check the body against the object in the client DB.
+
+// crudOperation returns the operation, unless the generated plans leave it out.
+func crudOperation(op *spec.Operation) *spec.Operation {
+	if op == nil || op.Deprecated && Deprecated == DeprecatedSkip {
+		return nil
+	}
+	return op
+}
+
+// GenerateCRUDTestSuite generates the CRUD suite of the collection's path, e.g. /items, and the item's path under
+// it, e.g. /items/{id}. It returns nil if the collection has no post, or the item has no get or no delete. The
+// update and its read-back are left out if the item has neither a put nor a patch.
+func GenerateCRUDTestSuite(collectionPath string, itemPath string, plan *TestPlan) *TestSuite {
+	paths := plan.swagger.Paths.Paths
+	collection, item := paths[collectionPath], paths[itemPath]
+	create, read, remove := crudOperation(collection.Post), crudOperation(item.Get), crudOperation(item.Delete)
+	update, updateMethod := crudOperation(item.Put), mqswag.MethodPut
+	if update == nil {
+		update, updateMethod = crudOperation(item.Patch), mqswag.MethodPatch
+	}
+	idParam := GetLastPathParam(itemPath)
+	if create == nil || read == nil || remove == nil || len(idParam) == 0 {
+		return nil
+	}
+
+	// The id is the property the path param is tagged with, e.g. <meqa Item.itemId>, or else id.
+	idProperty, class := "id", ""
+	params := operationParams(&item, read)
+	for i := range params {
+		if p := &params[i]; p.In == "path" && p.Name == idParam {
+			if tag := mqswag.GetTag(p); tag != nil && len(tag.Property) > 0 {
+				idProperty, class = tag.Property, tag.Class
+			}
+		}
+	}
+	for _, p := range create.Parameters {
+		if p.In == "body" && p.Schema != nil && len(class) == 0 {
+			if tag, _ := plan.swagger.GetSchemaRootType((*mqswag.Schema)(p.Schema), nil); tag != nil {
+				class = tag.Class
+			}
+		}
+	}
+
+	namer := NewTestNamer()
+	testSuite := CreateTestSuite(fmt.Sprintf("%s -- crud", collectionPath), nil, plan)
+	createTest := plan.createTest(mqswag.MethodPost, collectionPath, create, namer)
+	createTest.addNote("crud chain: creates the object the other tests use")
+	testSuite.Tests = append(testSuite.Tests, createTest)
+	id := fmt.Sprintf("{{%s.outputs.%s}}", createTest.Name, idProperty)
+	addItemTest := func(method string, op *spec.Operation, note string) *Test {
+		t := plan.createTest(method, itemPath, op, namer)
+		t.PathParams = map[string]interface{}{idParam: id}
+		t.addNote("crud chain: %s, path param %s: the output %s of %s", note, idParam, idProperty, createTest.Name)
+		testSuite.Tests = append(testSuite.Tests, t)
+		return t
+	}
+	addReadBack := func(note string) {
+		t := addItemTest(mqswag.MethodGet, read, note)
+		if len(class) > 0 {
+			t.Expect = map[string]interface{}{ExpectBody: map[string]interface{}{ExpectDB: map[string]interface{}{
+				ExpectDBClass: class,
+				ExpectDBMatch: map[string]interface{}{idProperty: id},
+			}}}
+		}
+	}
+
+	addReadBack("reads the created object back")
+	if update != nil {
+		addItemTest(updateMethod, update, "updates the object")
+		addReadBack("reads the updated object back")
+	}
+	addItemTest(mqswag.MethodDelete, remove, "deletes the object")
+	gone := addItemTest(mqswag.MethodGet, read, "the deleted object is gone")
+	gone.Expect = map[string]interface{}{ExpectStatus: 404}
+	return testSuite
+}
+
+// GenerateCRUDTestPlan generates a CRUD suite for each collection in the swagger that has an item path under it,
+// e.g. /items and /items/{id}.
+func GenerateCRUDTestPlan(swagger *mqswag.Swagger) (*TestPlan, error) {
+	testPlan := &TestPlan{}
+	testPlan.Init(swagger, nil)
+	testPlan.comment = `
+In this test plan, each test suite follows an object through its life: create, read, update,
+read, delete, then read again expecting a 404.
+`
+	addInitTestSuite(testPlan)
+	if swagger.Paths == nil {
+		return testPlan, nil
+	}
+
+	var itemPaths []string
+	for path := range swagger.Paths.Paths {
+		if strings.HasSuffix(strings.TrimSuffix(path, "/"), "}") {
+			itemPaths = append(itemPaths, path)
+		}
+	}
+	sort.Strings(itemPaths)
+	for _, itemPath := range itemPaths {
+		collectionPath := strings.TrimSuffix(itemPath, "/")
+		collectionPath = collectionPath[:strings.LastIndex(collectionPath, "/")]
+		if _, exist := swagger.Paths.Paths[collectionPath]; !exist {
+			continue
+		}
+		if testSuite := GenerateCRUDTestSuite(collectionPath, itemPath, testPlan); testSuite != nil {
+			testPlan.Add(testSuite)
+		}
+	}
+	return testPlan, nil
+}
@@ -0,0 +1,140 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const crudSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "items", "version": "1.0"},
+	"paths": {
+		"/items": {"post": {"operationId": "addItem",
+			"parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Item"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Item"}}}}},
+		"/items/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "type": "integer"}],
+			"get": {"operationId": "getItem",
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Item"}},
+					"404": {"description": "not found"}}},
+			"put": {"operationId": "updateItem",
+				"parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Item"}}],
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Item"}}}},
+			"delete": {"operationId": "deleteItem", "responses": {"200": {"description": "ok"}}}},
+		"/tags": {"get": {"operationId": "getTags", "responses": {"200": {"description": "ok"}}}},
+		"/tags/{name}": {"get": {"operationId": "getTag",
+			"parameters": [{"name": "name", "in": "path", "required": true, "type": "string"}],
+			"responses": {"200": {"description": "ok"}}}}
+	},
+	"definitions": {"Item": {"type": "object", "required": ["name"], "properties": {
+		"id": {"type": "integer", "readOnly": true}, "name": {"type": "string"}}}}
+}`
+
+// itemServer keeps the items in memory, and answers 404 for the ones it doesn't have.
+func itemServer() *httptest.Server {
+	var mutex sync.Mutex
+	items := make(map[string]map[string]interface{})
+	nextId := 1
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		id := strings.TrimPrefix(r.URL.Path, "/items/")
+		var item map[string]interface{}
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+			if r.Method == http.MethodPut && items[id] == nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewDecoder(r.Body).Decode(&item)
+			if r.Method == http.MethodPost {
+				id = fmt.Sprint(nextId)
+				nextId++
+			}
+			item["id"] = json.Number(id)
+			items[id] = item
+		case http.MethodGet:
+			item = items[id]
+		case http.MethodDelete:
+			item = items[id]
+			delete(items, id)
+		}
+		if item == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(item)
+	}))
+}
+
+func TestCRUDChain(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(crudSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	plan, err := GenerateCRUDTestPlan(swagger)
+	if err != nil {
+		t.Fatalf("can't generate the plan: %v", err)
+	}
+	// /tags has no post, so only /items gets a suite.
+	if len(plan.SuiteList) != 2 || plan.SuiteList[1].Name != "/items -- crud" {
+		t.Fatalf("expecting the meqa_init suite and the /items one, got %v", plan.SuiteMap)
+	}
+	var chain []string
+	for _, test := range plan.SuiteList[1].Tests {
+		chain = append(chain, fmt.Sprintf("%s %s %v %v", test.Name, test.Method, test.PathParams, test.Expect))
+	}
+	expected := []string{
+		"addItem_1 post map[] map[]",
+		"getItem_1 get map[id:{{addItem_1.outputs.id}}] map[body:map[$db:map[class:Item match:map[id:{{addItem_1.outputs.id}}]]]]",
+		"updateItem_1 put map[id:{{addItem_1.outputs.id}}] map[]",
+		"getItem_2 get map[id:{{addItem_1.outputs.id}}] map[body:map[$db:map[class:Item match:map[id:{{addItem_1.outputs.id}}]]]]",
+		"deleteItem_1 delete map[id:{{addItem_1.outputs.id}}] map[]",
+		"getItem_3 get map[id:{{addItem_1.outputs.id}}] map[status:404]",
+	}
+	if strings.Join(chain, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expecting the chain\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(chain, "\n"))
+	}
+
+	// The chain passes against a server that keeps the items.
+	dir, err := ioutil.TempDir("", "crud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "crud.yml")
+	if err = plan.DumpToFile(path); err != nil {
+		t.Fatalf("can't write the plan: %v", err)
+	}
+	server := itemServer()
+	defer server.Close()
+	swagger.Host = strings.TrimPrefix(server.URL, "http://")
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan = &TestPlan{}
+	if err = plan.InitFromFile(path, db); err != nil {
+		t.Fatalf("can't load the plan: %v", err)
+	}
+	counts, err := plan.Run("/items -- crud", nil)
+	if err != nil {
+		t.Fatalf("the chain failed: %v", err)
+	}
+	if counts[mqutil.Passed] != 6 {
+		t.Errorf("expecting the six tests to pass, got %v", counts)
+	}
+}
@@ -0,0 +1,192 @@
+package mqplan
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"path/filepath"
+	"strings"
+)
+
+// This file implements the data driven tests. A test with a dataset runs once per row of the dataset.
+// The dataset is either a CSV file with a header line, or a JSON array of objects. The columns are
+// matched to the operation's parameters by name, or can name the parameter location explicitly, e.g.
+// "queryParams.limit". The columns that don't match any parameter are set on the body object.
+
+// LoadDataset loads the rows in the dataset file. A CSV file's values are strings.
+func LoadDataset(path string) ([]map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		mqutil.Logger.Printf("Can't open the dataset file: %s", path)
+		return nil, err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		return parseCSVDataset(data)
+	}
+
+	var rows []map[string]interface{}
+	err = json.Unmarshal(data, &rows)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("dataset %s is not a JSON array of objects: %s", path, err.Error()))
+	}
+	return rows, nil
+}
+
+func parseCSVDataset(data []byte) ([]map[string]interface{}, error) {
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid CSV dataset: %s", err.Error()))
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	var rows []map[string]interface{}
+	for _, record := range records[1:] {
+		row := make(map[string]interface{})
+		for i, value := range record {
+			// An empty cell means the column is missing for this row.
+			if i < len(header) && len(value) > 0 {
+				row[strings.TrimSpace(header[i])] = value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// getDatasetPath returns the dataset's path. A relative path is relative to the test plan file.
+func (t *Test) getDatasetPath() string {
+	if filepath.IsAbs(t.Dataset) || t.suite == nil || t.suite.plan == nil || len(t.suite.plan.path) == 0 {
+		return t.Dataset
+	}
+	return filepath.Join(filepath.Dir(t.suite.plan.path), t.Dataset)
+}
+
+// ExpandDataset returns one test per row of the test's dataset, with the row's values merged into the
+// test's parameters.
+func (t *Test) ExpandDataset() ([]*Test, error) {
+	rows, err := LoadDataset(t.getDatasetPath())
+	if err != nil {
+		return nil, err
+	}
+	var bodySchema *mqswag.Schema
+	var params []paramLocation
+	if t.db != nil && t.db.Swagger != nil && t.db.Swagger.Paths != nil {
+		pathItem := t.db.Swagger.Paths.Paths[t.Path]
+		if o := GetOperationByMethod(&pathItem, t.Method); o != nil {
+			for _, p := range operationParams(&pathItem, o) {
+				if p.In == "body" {
+					bodySchema = (*mqswag.Schema)(p.Schema)
+					continue
+				}
+				params = append(params, paramLocation{p.Name, p.In})
+			}
+		}
+	}
+
+	var tests []*Test
+	for i, row := range rows {
+		test := *t
+		test.Name = fmt.Sprintf("%s_row%d", t.Name, i+1)
+		test.Dataset = ""
+		test.TestParams = TestParams{}
+		(&test.TestParams).Copy(&t.TestParams)
+		(&test.TestParams).Copy(t.getRowParams(row, params, bodySchema))
+		tests = append(tests, &test)
+	}
+	return tests, nil
+}
+
+type paramLocation struct {
+	name string
+	in   string
+}
+
+// getRowParams puts the row's values into the parameter sections.
+func (t *Test) getRowParams(row map[string]interface{}, params []paramLocation, bodySchema *mqswag.Schema) *TestParams {
+	p := &TestParams{}
+	body := make(map[string]interface{})
+	var bodyProperties map[string]string // the body's property names to their types
+	if bodySchema != nil && t.db != nil {
+		bodyProperties = make(map[string]string)
+		for k, v := range bodySchema.GetProperties(t.db.Swagger) {
+			if len(v.Type) > 0 {
+				bodyProperties[k] = v.Type[0]
+			} else {
+				bodyProperties[k] = ""
+			}
+		}
+	}
+	set := func(section *map[string]interface{}, name string, value interface{}) {
+		if *section == nil {
+			*section = make(map[string]interface{})
+		}
+		(*section)[name] = value
+	}
+
+	for column, value := range row {
+		if ar := strings.SplitN(column, ".", 2); len(ar) == 2 {
+			switch ar[0] {
+			case "pathParams":
+				set(&p.PathParams, ar[1], value)
+				continue
+			case "queryParams":
+				set(&p.QueryParams, ar[1], value)
+				continue
+			case "headerParams":
+				set(&p.HeaderParams, ar[1], value)
+				continue
+			case "formParams":
+				set(&p.FormParams, ar[1], value)
+				continue
+			case "bodyParams":
+				body[ar[1]] = value
+				continue
+			}
+		}
+		found := false
+		for _, param := range params {
+			if param.name != column && !(param.in == "header" && strings.EqualFold(param.name, column)) {
+				continue
+			}
+			found = true
+			switch param.in {
+			case "path":
+				set(&p.PathParams, column, value)
+			case "query":
+				set(&p.QueryParams, column, value)
+			case "header":
+				set(&p.HeaderParams, column, value)
+			case "formData":
+				set(&p.FormParams, column, value)
+			}
+			break
+		}
+		if !found {
+			if s, ok := value.(string); ok && bodyProperties != nil {
+				// CSV values are strings, convert them to the type of the body's property.
+				value = convertDatasetValue(s, bodyProperties[column])
+			}
+			body[column] = value
+		}
+	}
+	if len(body) > 0 {
+		p.BodyParams = body
+	}
+	return p
+}
+
+func convertDatasetValue(s string, propertyType string) interface{} {
+	if propertyType == "string" {
+		return s
+	}
+	var v interface{}
+	if json.Unmarshal([]byte(s), &v) != nil {
+		return s
+	}
+	return v
+}
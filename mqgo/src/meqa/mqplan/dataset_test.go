@@ -0,0 +1,95 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const datasetSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {
+		"/pets/{petId}": {
+			"parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer"}],
+			"put": {
+				"parameters": [
+					{"name": "verbose", "in": "query", "type": "boolean"},
+					{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}
+				],
+				"responses": {"200": {"description": "ok"}}
+			}
+		}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "properties": {"name": {"type": "string"}, "age": {"type": "integer"}}}
+	}
+}`
+
+func createDatasetTest(t *testing.T, dir string, dataset string) *Test {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(datasetSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.path = filepath.Join(dir, "plan.yml")
+	test := &Test{Name: "updatePet_1", Path: "/pets/{petId}", Method: mqswag.MethodPut, Dataset: dataset}
+	test.QueryParams = map[string]interface{}{"verbose": true}
+	test.Init(CreateTestSuite("pets", []*Test{test}, plan))
+	return test
+}
+
+func TestExpandCSVDataset(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "meqa")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "pets.csv"), []byte("petId,name,age,queryParams.verbose\n1,tom,3,\n2,007,,false\n3,,5,\n"), 0644)
+
+	tests, err := createDatasetTest(t, dir, "pets.csv").ExpandDataset()
+	if err != nil {
+		t.Fatalf("expanding dataset failed: %v", err)
+	}
+	if len(tests) != 3 {
+		t.Fatalf("expecting 3 tests, got %d", len(tests))
+	}
+	first := tests[0]
+	if first.Name != "updatePet_1_row1" || first.PathParams["petId"] != "1" || first.QueryParams["verbose"] != true {
+		t.Errorf("unexpected parameters in first test: %v %v %v", first.Name, first.PathParams, first.QueryParams)
+	}
+	if body := first.BodyParams.(map[string]interface{}); body["name"] != "tom" || body["age"] != 3.0 {
+		t.Errorf("unexpected body in first test: %v", body)
+	}
+	// The name is a string property, it's not converted to a number. The missing age is generated.
+	second := tests[1]
+	if body := second.BodyParams.(map[string]interface{}); body["name"] != "007" || body["age"] != nil {
+		t.Errorf("unexpected body in second test: %v", body)
+	}
+	if second.QueryParams["verbose"] != "false" {
+		t.Errorf("the row should override the test's query param, got %v", second.QueryParams)
+	}
+}
+
+func TestExpandJSONDataset(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "meqa")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "pets.json"), []byte(`[{"petId": 1, "name": "tom"}, {"petId": 2, "age": 4}]`), 0644)
+
+	tests, err := createDatasetTest(t, dir, "pets.json").ExpandDataset()
+	if err != nil {
+		t.Fatalf("expanding dataset failed: %v", err)
+	}
+	if len(tests) != 2 {
+		t.Fatalf("expecting 2 tests, got %d", len(tests))
+	}
+	if tests[1].PathParams["petId"] != 2.0 || tests[1].BodyParams.(map[string]interface{})["age"] != 4.0 {
+		t.Errorf("unexpected parameters in second test: %v %v", tests[1].PathParams, tests[1].BodyParams)
+	}
+}
@@ -0,0 +1,131 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// The dates and the date-times are generated in the last 30 days, unless a dateRange sets the range. The dateRange
+// of a property, the x-meqa-dateRange extension in the spec, wins over the test's, which wins over the plan's in
+// meqa_init. The bounds are now, a time relative to now, e.g. +90d or -1h, or an absolute time, e.g. 2024-01-01 or
+// 2024-01-01T09:00:00Z.
+
+// DateRange is the range of the generated dates and date-times.
+type DateRange struct {
+	From string `yaml:"from,omitempty" json:"from,omitempty"`
+	To   string `yaml:"to,omitempty" json:"to,omitempty"`
+}
+
+// The span of the generated dates when the range has one bound or none.
+const defaultDateSpan = 30 * 24 * time.Hour
+
+var relativeTimeRegexp = regexp.MustCompile(`^([+-][0-9]+)([smhdw])$`)
+
+var timeUnits = map[string]time.Duration{
+	"s": time.Second,
+	"m": time.Minute,
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseTime parses a bound of a date range, relative to now.
+func parseTime(expr string, now time.Time) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "now" {
+		return now, nil
+	}
+	if m := relativeTimeRegexp.FindStringSubmatch(expr); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return now.Add(time.Duration(n) * timeUnits[m[2]]), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, expr); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid time %s in dateRange, expecting now, "+
+		"a relative time, e.g. +7d or -1h, or an absolute time, e.g. 2024-01-01 or 2024-01-01T09:00:00Z", expr))
+}
+
+// Bounds returns the start and the end of the range. A missing bound is 30 days away from the other one, and the
+// range without bounds is the last 30 days.
+func (r *DateRange) Bounds(now time.Time) (time.Time, time.Time, error) {
+	from, to := now.Add(-defaultDateSpan), now
+	var err error
+	if len(r.From) > 0 {
+		if from, err = parseTime(r.From, now); err != nil {
+			return from, to, err
+		}
+		to = from.Add(defaultDateSpan)
+	}
+	if len(r.To) > 0 {
+		if to, err = parseTime(r.To, now); err != nil {
+			return from, to, err
+		}
+		if len(r.From) == 0 {
+			from = to.Add(-defaultDateSpan)
+		}
+	}
+	if !to.After(from) {
+		return from, to, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid dateRange, from %s isn't before to %s", r.From, r.To))
+	}
+	return from, to, nil
+}
+
+// checkDateRange returns an error if the date range isn't valid.
+func checkDateRange(r *DateRange) error {
+	if r == nil {
+		return nil
+	}
+	_, _, err := r.Bounds(time.Now())
+	return err
+}
+
+// schemaDateRange returns the range of the dates generated for the schema, from its x-meqa-dateRange extension.
+func schemaDateRange(s *spec.Schema, now time.Time) (time.Time, time.Time, error) {
+	r := &DateRange{}
+	value, _ := (*mqswag.Schema)(s).GetExtension(mqswag.ExtDateRange)
+	switch ext := value.(type) {
+	case nil:
+	case *DateRange:
+		r = ext
+	case map[string]interface{}:
+		r.From, _ = ext["from"].(string)
+		r.To, _ = ext["to"].(string)
+	default:
+		return now, now, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid %s %v, expecting from and to", mqswag.ExtDateRange, ext))
+	}
+	return r.Bounds(now)
+}
+
+// withDateRange returns the date or date-time schema with the test's or the plan's dateRange, unless the schema
+// has its own.
+func (t *Test) withDateRange(s *spec.Schema) *spec.Schema {
+	r := t.DateRange
+	if r == nil && t.suite != nil && t.suite.plan != nil {
+		r = t.suite.plan.DateRange
+	}
+	if r == nil || s.Format != "date" && s.Format != "date-time" {
+		return s
+	}
+	if _, exist := (*mqswag.Schema)(s).GetExtension(mqswag.ExtDateRange); exist {
+		return s
+	}
+	ranged := *s
+	ranged.Extensions = make(spec.Extensions)
+	for k, v := range s.Extensions {
+		ranged.Extensions[k] = v
+	}
+	ranged.Extensions[mqswag.ExtDateRange] = r
+	return &ranged
+}
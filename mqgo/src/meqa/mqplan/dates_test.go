@@ -0,0 +1,80 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestDateRange(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		r        DateRange
+		from, to string
+	}{
+		{DateRange{}, "2024-01-31T12:00:00Z", "2024-03-01T12:00:00Z"},
+		{DateRange{From: "now", To: "+90d"}, "2024-03-01T12:00:00Z", "2024-05-30T12:00:00Z"},
+		{DateRange{From: "-1h"}, "2024-03-01T11:00:00Z", "2024-03-31T11:00:00Z"},
+		{DateRange{To: "+2w"}, "2024-02-14T12:00:00Z", "2024-03-15T12:00:00Z"},
+		{DateRange{From: "2024-01-01", To: "2024-12-31T23:59:59Z"}, "2024-01-01T00:00:00Z", "2024-12-31T23:59:59Z"},
+	} {
+		from, to, err := c.r.Bounds(now)
+		if err != nil || from.Format(time.RFC3339) != c.from || to.Format(time.RFC3339) != c.to {
+			t.Errorf("dateRange %+v: expecting %s to %s, got %s to %s, err %v", c.r, c.from, c.to, from, to, err)
+		}
+	}
+	for _, r := range []DateRange{{From: "tomorrow"}, {From: "+1y"}, {From: "+1d", To: "now"}} {
+		if _, _, err := r.Bounds(now); err == nil || !strings.Contains(err.Error(), "dateRange") {
+			t.Errorf("expecting an error for dateRange %+v, got %v", r, err)
+		}
+	}
+
+	// The property's x-meqa-dateRange wins over the plan's, and the plan's over the default.
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"checkIn": {"type": "string", "format": "date"},
+		"createdAt": {"type": "string", "format": "date-time"},
+		"fiscal": {"type": "string", "format": "date", "x-meqa-dateRange": {"from": "2030-01-01", "to": "2030-12-31"}}}}`),
+		&schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	test, db := createPetTest(t)
+	plan := &TestPlan{}
+	plan.Init(db.Swagger, db)
+	if err = plan.AddFromString("meqa_init:\n- name: meqa_init\n  dateRange:\n    from: now\n    to: +90d\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	test.suite.plan = plan
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj := v.(map[string]interface{})
+		checkIn, err := time.ParseInLocation("2006-01-02", obj["checkIn"].(string), start.Location())
+		if err != nil || checkIn.Before(start.AddDate(0, 0, -1)) || checkIn.After(start.AddDate(0, 0, 90)) {
+			t.Errorf("expecting a date in the next 90 days, got %v, err %v", obj["checkIn"], err)
+		}
+		createdAt, err := time.Parse(time.RFC3339, obj["createdAt"].(string))
+		if err != nil || createdAt.Before(start.Add(-time.Second)) || createdAt.After(start.AddDate(0, 0, 91)) {
+			t.Errorf("expecting an RFC3339 time in the next 90 days, got %v, err %v", obj["createdAt"], err)
+		}
+		if fiscal := obj["fiscal"].(string); !strings.HasPrefix(fiscal, "2030-") || len(fiscal) != 10 {
+			t.Errorf("expecting the property's range to win, got %s", fiscal)
+		}
+	}
+
+	plan = &TestPlan{}
+	plan.Init(db.Swagger, db)
+	if err = plan.AddFromString("meqa_init:\n- name: meqa_init\n  dateRange:\n    from: soon\n"); err == nil {
+		t.Errorf("expecting an error for an invalid dateRange")
+	}
+}
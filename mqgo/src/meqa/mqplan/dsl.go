@@ -6,8 +6,13 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math"
-	"math/rand"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -26,8 +31,31 @@ import (
 )
 
 const (
-	ExpectStatus = "status"
-	ExpectBody   = "body"
+	ExpectStatus    = "status"
+	ExpectBody      = "body"
+	ExpectHeaders   = "headers"
+	ExpectBodyMatch = "bodyMatch"
+	ExpectJSONPath  = "jsonPath"
+)
+
+// In expect.jsonPath, a JSONPath expression mapped to {$exists: true} only checks that the expression selects a
+// value, and to {$exists: false} that it selects none.
+const ExpectJSONPathExists = "$exists"
+
+// How the expected body is compared with the response body. By default the fields of the response that aren't
+// in the expected body are ignored, and the arrays aren't compared. A subset match compares the arrays item by
+// item, and an exact match also fails on the fields that aren't in the expected body.
+const (
+	BodyMatchSubset = "subset"
+	BodyMatchExact  = "exact"
+)
+
+// The fields of the expect body that refers to an object in the client DB. e.g.
+// expect: {body: {$db: {class: Pet, match: {id: "{{post_addPet_1.outputs.id}}"}}}}
+const (
+	ExpectDB      = "$db"
+	ExpectDBClass = "class"
+	ExpectDBMatch = "match"
 )
 
 func GetBaseURL(swagger *mqswag.Swagger) string {
@@ -51,6 +79,56 @@ func GetBaseURL(swagger *mqswag.Swagger) string {
 	return scheme + "://" + swagger.Host + swagger.BasePath
 }
 
+// ResolveServer points the plan's swagger at the OpenAPI 3 server the plan selects, with the plan's
+// serverVariables filled in. A relative server url only changes the base path. Returns the base URL the tests
+// are sent to.
+func (plan *TestPlan) ResolveServer() (string, error) {
+	if plan.swagger == nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, "the plan has no OpenAPI spec")
+	}
+	serverURL, err := plan.swagger.ResolveServerURL(plan.Server, plan.ServerVariables)
+	if err != nil {
+		return "", err
+	}
+	if len(serverURL) > 0 {
+		u, err := url.Parse(serverURL)
+		if err != nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid server url %s: %s", serverURL, err.Error()))
+		}
+		if len(u.Host) > 0 {
+			err = SetBaseURL(plan.swagger, serverURL)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			plan.swagger.BasePath = strings.TrimSuffix(u.Path, "/")
+		}
+	}
+	return GetBaseURL(plan.swagger), nil
+}
+
+// SetServerVariables overrides some of the plan's serverVariables for this run. The str is comma separated
+// name=value pairs, e.g. region=eu-west-1,basePath=v3. The other variables keep their values from the plan.
+func (plan *TestPlan) SetServerVariables(str string) error {
+	variables := make(map[string]interface{})
+	for k, v := range plan.ServerVariables {
+		variables[k] = v
+	}
+	for _, pair := range strings.Split(str, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || len(name) == 0 {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid server variable %s, expecting name=value", pair))
+		}
+		variables[name] = strings.TrimSpace(parts[1])
+	}
+	plan.ServerVariables = variables
+	return nil
+}
+
 // Post: old - nil, new - the new object we create.
 // Put, patch: old - the old object, new - the new one.
 // Get: old - the old object, new - the one we get from the server.
@@ -97,13 +175,23 @@ func (comp *Comparison) SetForOp(op string, key string, value interface{}) *Comp
 // Test represents a test object in the DSL. Extra care needs to be taken to copy the
 // Test before running it, because running it would change the parameter maps.
 type Test struct {
-	Name       string                 `yaml:"name,omitempty"`
-	Path       string                 `yaml:"path,omitempty"`
-	Method     string                 `yaml:"method,omitempty"`
-	Ref        string                 `yaml:"ref,omitempty"`
-	Expect     map[string]interface{} `yaml:"expect,omitempty"`
-	Strict     bool                   `yaml:"strict,omitempty"`
-	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
+	Name         string                 `yaml:"name,omitempty"`
+	Path         string                 `yaml:"path,omitempty"`
+	Method       string                 `yaml:"method,omitempty"`
+	Ref          string                 `yaml:"ref,omitempty"`
+	Expect       map[string]interface{} `yaml:"expect,omitempty"`
+	TestSettings `yaml:",inline"`
+	Dataset      string           `yaml:"dataset,omitempty"`    // run the test once per row of the CSV or JSON file
+	Repeat       int              `yaml:"repeat,omitempty"`     // run the test this many times, each time with fresh values
+	Steps        []*Test          `yaml:"steps,omitempty"`      // the calls that make up a transaction
+	OnFailure    []*Test          `yaml:"onFailure,omitempty"`  // the compensation calls when a step fails
+	Setup        []*Test          `yaml:"setup,omitempty"`      // in meqa_init, the tests to run before the suite
+	Teardown     []*Test          `yaml:"teardown,omitempty"`   // in meqa_init, the tests to run after the suite
+	RunIf        string           `yaml:"runIf,omitempty"`      // run the test only if the condition holds
+	SkipIf       string           `yaml:"skipIf,omitempty"`     // skip the test if the condition holds
+	Assertions   int              `yaml:"assertions,omitempty"` // in the results, the assertion strength of the test
+	PlanSettings `yaml:",inline"` // in meqa_init, the settings of the plan
+	TestParams   `yaml:",inline,omitempty" json:",inline,omitempty"`
 
 	startTime time.Time
 	stopTime  time.Time
@@ -121,6 +209,34 @@ type Test struct {
 
 	responseError interface{}
 	schemaError   error
+	assertionHint string // what the test can check in addition to raise its assertion strength
+	expectedBody  string // the expected body as JSON, if the body didn't match, with the secrets masked
+	gotBody       string // the response body, if it didn't match the expected body, with the secrets masked
+
+	skipped  bool     // the test wasn't sent because its operation is deprecated
+	warnings []string // the problems that don't fail the test, e.g. a deprecated operation
+
+	omitOptional bool // leave out the optional parameters in this run, with the coverage policy
+
+	bodySize   int    // the size of the binary response body
+	bodySha256 string // the SHA-256 of the binary response body, in hex
+
+	contentType     string // the media type of the request body
+	accept          string // the media types the request accepts
+	respContentType string // the media type of the response
+
+	genNodes  int      // the values generated for the request so far
+	genDepth  int      // the nesting depth of the object or array being generated
+	genCapped bool     // whether the generation reached the cap, see overGenerationCap
+	genFrames int      // the nesting of the GenerateSchema calls
+	genRefs   []string // the definitions being generated, from the outermost one
+
+	boundaries map[string]boundary    // in the boundary mode, the parameters' edge values picked for this test
+	enumValues map[string]interface{} // with allEnums, the parameters' enum values picked for this test
+	violation  *violation             // in the negative mode, the constraint this test breaks
+
+	notes     []string // the generator's explanation of its choices, written as comments above the test
+	handNotes []string // the comments added by hand above the test
 }
 
 func (t *Test) Init(suite *TestSuite) {
@@ -128,6 +244,18 @@ func (t *Test) Init(suite *TestSuite) {
 	if suite != nil {
 		t.db = suite.plan.db
 	}
+	for _, step := range t.Steps {
+		step.Init(suite)
+	}
+	for _, step := range t.OnFailure {
+		step.Init(suite)
+	}
+	for _, step := range t.Setup {
+		step.Init(suite)
+	}
+	for _, step := range t.Teardown {
+		step.Init(suite)
+	}
 	if len(t.Method) != 0 {
 		t.Method = strings.ToLower(t.Method)
 	}
@@ -139,12 +267,91 @@ func (t *Test) Init(suite *TestSuite) {
 			mqutil.Logger.Print(err)
 		}
 	}
+	if len(t.PropOverrides) > 0 {
+		var overrides interface{}
+		overrides, err = mqutil.YamlObjToJsonObj(t.PropOverrides)
+		if err != nil {
+			mqutil.Logger.Print(err)
+		} else {
+			t.PropOverrides, _ = overrides.(map[string]interface{})
+		}
+	}
 	if len(t.Expect) > 0 && t.Expect[ExpectBody] != nil {
 		t.Expect[ExpectBody], err = mqutil.YamlObjToJsonObj(t.Expect[ExpectBody])
 		if err != nil {
 			mqutil.Logger.Print(err)
 		}
 	}
+	if len(t.Expect) > 0 && t.Expect[ExpectHeaders] != nil {
+		t.Expect[ExpectHeaders], err = mqutil.YamlObjToJsonObj(t.Expect[ExpectHeaders])
+		if err != nil {
+			mqutil.Logger.Print(err)
+		}
+	}
+	if len(t.Expect) > 0 && t.Expect[ExpectJSONPath] != nil {
+		t.Expect[ExpectJSONPath], err = mqutil.YamlObjToJsonObj(t.Expect[ExpectJSONPath])
+		if err != nil {
+			mqutil.Logger.Print(err)
+		}
+	}
+}
+
+// checkMatchers makes sure the matchers named in the expect of the test and its children are registered, and
+// that the bodyMatch and the JSONPath expressions are valid.
+func (t *Test) checkMatchers() error {
+	if err := mqutil.CheckMatchers(t.Expect[ExpectBody]); err != nil {
+		mqutil.Logger.Printf("test %s expects an unknown matcher", t.Name)
+		return err
+	}
+	if err := checkExpectJSONPath(t.Expect[ExpectJSONPath]); err != nil {
+		mqutil.Logger.Printf("test %s has an invalid jsonPath", t.Name)
+		return err
+	}
+	if mode, exist := t.Expect[ExpectBodyMatch]; exist && mode != BodyMatchSubset && mode != BodyMatchExact {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("test %s has bodyMatch %v, expecting subset or exact",
+			t.Name, mode))
+	}
+	for _, list := range [][]*Test{t.Steps, t.OnFailure, t.Setup, t.Teardown} {
+		for _, step := range list {
+			if err := step.checkMatchers(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkOptions returns an error if the options the test sets aren't valid. The plan's settings are only set in
+// a meqa_init.
+func (t *Test) checkOptions() error {
+	if err := checkOptionalParams(t.OptionalParams); err != nil {
+		return err
+	}
+	if err := checkOptionalProps(t.OptionalProps); err != nil {
+		return err
+	}
+	if err := CheckDeprecated(t.Deprecated); err != nil {
+		return err
+	}
+	if err := checkGenerate(t.Generate); err != nil {
+		return err
+	}
+	if err := t.checkSizes(); err != nil {
+		return err
+	}
+	if t.Repeat < 0 {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("test %s has repeat %d, expecting a positive count",
+			t.Name, t.Repeat))
+	}
+	if t.ReuseChance < 0 || t.ReuseChance > 1 {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid reuseChance %v, expecting a probability between 0 and 1", t.ReuseChance))
+	}
+	if t.RateLimit < 0 {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid rateLimit %v, expecting the number of calls per second", t.RateLimit))
+	}
+	return checkRealisticNames(t.RealisticNames)
 }
 
 func (t *Test) Duplicate() *Test {
@@ -154,6 +361,7 @@ func (t *Test) Duplicate() *Test {
 	test.FormParams = mqutil.MapCopy(test.FormParams)
 	test.PathParams = mqutil.MapCopy(test.PathParams)
 	test.HeaderParams = mqutil.MapCopy(test.HeaderParams)
+	test.PropOverrides = mqutil.MapCopy(test.PropOverrides)
 	if m, ok := test.BodyParams.(map[string]interface{}); ok {
 		test.BodyParams = mqutil.MapCopy(m)
 	} else if a, ok := test.BodyParams.([]interface{}); ok {
@@ -165,15 +373,57 @@ func (t *Test) Duplicate() *Test {
 	test.resp = nil
 	test.comparisons = make(map[string]([]*Comparison))
 	test.err = nil
+	test.skipped = false
+	test.warnings = nil
 	test.db = test.suite.db
 
 	return &test
 }
 
+// ResolvedParams returns a copy of the test's parameters. After ResolveParameters, these are the values sent
+// to the server: the ones given in the plan and the generated ones. Changing the copy doesn't change the test.
+func (t *Test) ResolvedParams() TestParams {
+	return TestParams{
+		QueryParams:  t.ResolvedQuery(),
+		FormParams:   t.ResolvedForm(),
+		PathParams:   t.ResolvedPath(),
+		HeaderParams: t.ResolvedHeaders(),
+		BodyParams:   t.ResolvedBody(),
+	}
+}
+
+// ResolvedBody returns a copy of the request body, see ResolvedParams.
+func (t *Test) ResolvedBody() interface{} {
+	return mqutil.InterfaceCopy(t.BodyParams)
+}
+
+// ResolvedQuery returns a copy of the query parameters, see ResolvedParams.
+func (t *Test) ResolvedQuery() map[string]interface{} {
+	return mqutil.MapCopy(t.QueryParams)
+}
+
+// ResolvedPath returns a copy of the path parameters, see ResolvedParams.
+func (t *Test) ResolvedPath() map[string]interface{} {
+	return mqutil.MapCopy(t.PathParams)
+}
+
+// ResolvedHeaders returns a copy of the header parameters, see ResolvedParams.
+func (t *Test) ResolvedHeaders() map[string]interface{} {
+	return mqutil.MapCopy(t.HeaderParams)
+}
+
+// ResolvedForm returns a copy of the form parameters, see ResolvedParams.
+func (t *Test) ResolvedForm() map[string]interface{} {
+	return mqutil.MapCopy(t.FormParams)
+}
+
 func (t *Test) AddBasicComparison(tag *mqswag.MeqaTag, paramSpec *spec.Parameter, data interface{}) {
 	if paramSpec == nil {
 		return
 	}
+	if tag != nil && tag.Flags&mqswag.FlagNoCompare != 0 {
+		return
+	}
 	if tag == nil || len(tag.Class) == 0 || len(tag.Property) == 0 {
 		// No explicit tag. Info we have: t.Method, t.tag - indicate what operation we want to do.
 		// t.path - indicate what object we want to operate on. We need to extrace the equivalent
@@ -230,7 +480,7 @@ func (t *Test) AddObjectComparison(tag *mqswag.MeqaTag, obj map[string]interface
 	if len(class) == 0 {
 		cl, s := t.db.FindMatchingSchema(obj)
 		if s == nil {
-			mqutil.Logger.Printf("Can't find a known schema for obj %v", obj)
+			mqutil.Logger.Printf("Can't find a known schema for obj %v", maskValue(obj, (*mqswag.Schema)(schema), t.db.Swagger))
 			return
 		}
 		class = cl
@@ -257,10 +507,19 @@ func (t *Test) AddObjectComparison(tag *mqswag.MeqaTag, obj map[string]interface
 
 func (t *Test) CompareGetResult(className string, associations map[string]map[string]interface{}, resultArray []interface{}) error {
 
+	// The write-only fields we sent are never in the result or the DB.
+	classSchema := t.db.GetSchema(className)
+	getCriteria := func(comp *Comparison) map[string]interface{} {
+		if classSchema == nil {
+			return comp.oldUsed
+		}
+		return classSchema.RemoveWriteOnly(comp.oldUsed, t.db.Swagger)
+	}
+
 	var dbArray []interface{}
 	if len(t.comparisons[className]) > 0 {
 		for _, comp := range t.comparisons[className] {
-			dbArray = append(dbArray, t.db.Find(className, comp.oldUsed, associations, mqutil.InterfaceEquals, -1)...)
+			dbArray = append(dbArray, t.db.Find(className, getCriteria(comp), associations, mqutil.InterfaceEquals, -1)...)
 		}
 	} else {
 		dbArray = t.db.Find(className, nil, associations, mqutil.InterfaceEquals, -1)
@@ -270,6 +529,7 @@ func (t *Test) CompareGetResult(className string, associations map[string]map[st
 	// TODO optimize later. Should sort first.
 	if len(t.comparisons[className]) > 0 {
 		for _, comp := range t.comparisons[className] {
+			criteria := getCriteria(comp)
 			compFound := false
 			for _, entry := range resultArray {
 				// One of the comparison should match
@@ -279,7 +539,7 @@ func (t *Test) CompareGetResult(className string, associations map[string]map[st
 					// match we will catch that when we verify schema.
 					continue
 				}
-				if mqutil.InterfaceEquals(comp.oldUsed, entryMap) {
+				if mqutil.InterfaceEquals(criteria, entryMap) {
 					compFound = true
 					break
 				}
@@ -370,21 +630,34 @@ func (t *Test) GetParam(path []string) interface{} {
 		section = t.BodyParams
 	} else if path[0] == "outputs" {
 		section = t.Expect[ExpectBody]
+	} else if path[0] == "expect" {
+		section = t.Expect
 	}
 
 	topSection := section
-	// First try the exact search. This only works if there is no
-	// array on the search path.
+	// First try the exact search. The fields can be map keys or array indexes, e.g. outputs.tags.0.name.
 	for _, field := range path[1:] {
 		if section == nil {
 			break
 		}
-		paramMap, ok := section.(map[string]interface{})
-		if !ok {
+		switch s := section.(type) {
+		case map[string]interface{}:
+			section = s[field]
+		case []interface{}:
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 0 || i >= len(s) {
+				section = nil
+			} else {
+				section = s[i]
+			}
+		default:
 			section = nil
-			break
 		}
-		section = paramMap[field]
+	}
+	if section == nil && path[0] == "headerParams" && len(path) == 2 {
+		// Header names are case insensitive.
+		key, _ := mqutil.HeaderKey(t.HeaderParams, path[1])
+		section = t.HeaderParams[key]
 	}
 	if section != nil {
 		return section
@@ -405,25 +678,60 @@ func (t *Test) GetParam(path []string) interface{} {
 		mqutil.IterateFieldsInInterface(topSection, callback)
 		return found
 	}
+	mqutil.Logger.Printf("%s is not found in test %s", strings.Join(path, "."), t.Name)
 	return nil
 }
 
-// ProcessResult decodes the response from the server into a result array
-func (t *Test) ProcessResult(resp *resty.Response) error {
-	if t.err != nil {
-		fmt.Printf("REST call hit the following error: %s\n", t.err.Error())
-		return t.err
+// ResolveExpectBody returns the body we expect from the server. If the expect body refers to an object
+// in the client DB through $db, we look the object up now. This happens before the result of the current
+// test is applied to the DB, but after all the tests that ran before it.
+func (t *Test) ResolveExpectBody() (interface{}, error) {
+	body := t.Expect[ExpectBody]
+	bodyMap, ok := body.(map[string]interface{})
+	if !ok || bodyMap[ExpectDB] == nil {
+		return body, nil
+	}
+	dbMap, ok := bodyMap[ExpectDB].(map[string]interface{})
+	if !ok {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s in test %s must be a map", ExpectDB, t.Name))
+	}
+	className, _ := dbMap[ExpectDBClass].(string)
+	if len(className) == 0 || t.db.GetSchema(className) == nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s in test %s doesn't refer to a known class: %v",
+			ExpectDB, t.Name, dbMap[ExpectDBClass]))
+	}
+	var criteria map[string]interface{}
+	if dbMap[ExpectDBMatch] != nil {
+		matchMap, ok := dbMap[ExpectDBMatch].(map[string]interface{})
+		if !ok {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("%s.%s in test %s must be a map",
+				ExpectDB, ExpectDBMatch, t.Name))
+		}
+		criteria = mqutil.MapCopy(matchMap)
+		// The test isn't in the history while it runs, but the criteria can refer to its own parameters.
+		MapParamsResolveWithHistory(criteria, &TestHistory{tests: []*Test{t}, parent: t.suite.getHistory()})
 	}
 
-	// useDefaultSpec := true
-	t.resp = resp
-	status := resp.StatusCode()
-	var respSpec *spec.Response
-	if t.op.Responses != nil {
-		respObject, ok := t.op.Responses.StatusCodeResponses[status]
-		if ok {
+	found := t.db.Find(className, criteria, nil, mqutil.InterfaceEquals, -1)
+	if len(found) == 0 && t.suite != nil && t.suite.plan != nil && t.suite.plan.db != nil {
+		found = t.suite.plan.db.Find(className, criteria, nil, mqutil.InterfaceEquals, -1)
+	}
+	if len(found) != 1 {
+		criteriaJson, _ := json.Marshal(criteria)
+		return nil, mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("expecting exactly one %s in client DB matching %s, found %d",
+			className, criteriaJson, len(found)))
+	}
+	return found[0], nil
+}
+
+// getResponseSpec returns the operation's response for the status, or its default response if the status doesn't
+// have its own. An operation without either gets an empty response.
+func (t *Test) getResponseSpec(status int) (respSpec *spec.Response, isDefault bool) {
+	isDefault = true
+	if t.op != nil && t.op.Responses != nil {
+		if respObject, ok := t.op.Responses.StatusCodeResponses[status]; ok {
 			respSpec = &respObject
-			// useDefaultSpec = false
+			isDefault = false
 		} else {
 			respSpec = t.op.Responses.Default
 		}
@@ -432,11 +740,33 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		// Nothing specified in the swagger.json. Same as an empty spec.
 		respSpec = &spec.Response{}
 	}
+	return respSpec, isDefault
+}
+
+// ProcessResult decodes the response from the server into a result array
+func (t *Test) ProcessResult(resp *resty.Response) error {
+	if t.err != nil {
+		fmt.Printf("REST call hit the following error: %s\n", t.err.Error())
+		return t.err
+	}
+
+	t.resp = resp
+	status := resp.StatusCode()
+	respSpec, useDefaultSpec := t.getResponseSpec(status)
 
 	respBody := resp.Body()
 	respSchema := (*mqswag.Schema)(respSpec.Schema)
+	t.checkResponseMediaType(resp)
+	// The binary bodies, e.g. images, are checked as a whole instead of against the schema.
+	binary := t.isBinaryResponse(resp)
 	var resultObj interface{}
-	if len(respBody) > 0 {
+	if len(respBody) > 0 && !binary && isXMLMediaType(resp.Header().Get("Content-Type")) {
+		var err error
+		resultObj, err = decodeXML(respBody, respSchema, t.db.Swagger)
+		if err != nil {
+			mqutil.Logger.Printf("%s: %s", t.Name, err.Error())
+		}
+	} else if len(respBody) > 0 && !binary {
 		d := json.NewDecoder(bytes.NewReader(respBody))
 		d.UseNumber()
 		d.Decode(&resultObj)
@@ -445,12 +775,36 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	// Before returning from this function, we should set the test's expect value to that
 	// of actual result. This allows us to print out a result report that is the same format
 	// as the test plan file, but with the expect value that reflects the current ground truth.
+	expectedHeaders, _ := t.Expect[ExpectHeaders].(map[string]interface{})
+	_, expectsSha256 := t.Expect[ExpectBodySha256]
+	minBytes, expectsMinBytes := t.Expect[ExpectMinBytes]
+	bodyMatch, expectsBodyMatch := t.Expect[ExpectBodyMatch]
+	jsonPaths, _ := t.Expect[ExpectJSONPath].(map[string]interface{})
 	setExpect := func() {
 		t.Expect = make(map[string]interface{})
 		t.Expect[ExpectStatus] = status
 		if resultObj != nil {
 			t.Expect[ExpectBody] = resultObj
 		}
+		if expectsSha256 && binary {
+			t.Expect[ExpectBodySha256] = t.bodySha256
+		}
+		if expectsMinBytes {
+			t.Expect[ExpectMinBytes] = minBytes
+		}
+		if expectsBodyMatch {
+			t.Expect[ExpectBodyMatch] = bodyMatch
+		}
+		if len(jsonPaths) > 0 {
+			t.Expect[ExpectJSONPath] = jsonPaths
+		}
+		if len(expectedHeaders) > 0 {
+			headers := make(map[string]interface{})
+			for name := range expectedHeaders {
+				headers[name] = resp.Header().Get(name)
+			}
+			t.Expect[ExpectHeaders] = headers
+		}
 	}
 
 	if mqutil.Verbose {
@@ -458,7 +812,7 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	}
 	// success based on return status
 	success := (status >= 200 && status < 300)
-	tag := mqswag.GetMeqaTag(respSpec.Description)
+	tag := mqswag.GetTag(respSpec)
 	if tag != nil && tag.Flags&mqswag.FlagFail != 0 {
 		success = false
 	}
@@ -472,6 +826,10 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		} else if expectedStatusNum, ok := expectedStatus.(int); ok {
 			testSuccess = (expectedStatusNum == status)
 		}
+		if t.violation != nil && expectedStatus == "fail" {
+			// The server should reject the value, not break on it.
+			testSuccess = status >= 400 && status < 500
+		}
 	}
 
 	greenSuccess := fmt.Sprintf("%vSuccess%v", mqutil.GREEN, mqutil.END)
@@ -479,33 +837,118 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	yellowFail := fmt.Sprintf("%vFail%v", mqutil.YELLOW, mqutil.END)
 	if testSuccess {
 		fmt.Printf("... expecting status: %v got status: %d. %v\n", expectedStatus, status, greenSuccess)
-		if t.Expect != nil && t.Expect[ExpectBody] != nil {
-			testSuccess = mqutil.InterfaceEquals(t.Expect[ExpectBody], resultObj)
+		if t.Expect != nil && t.Expect[ExpectBody] != nil && !binary {
+			expectedBody, err := t.ResolveExpectBody()
+			if err != nil {
+				fmt.Printf("... resolving test's expect value. Fail\n")
+				setExpect()
+				return err
+			}
+			if expectsBodyMatch {
+				testSuccess = len(mqutil.InterfaceMatchDiff(expectedBody, resultObj, bodyMatch == BodyMatchExact)) == 0
+			} else {
+				testSuccess = mqutil.InterfaceEquals(expectedBody, resultObj)
+			}
 			if testSuccess {
 				fmt.Printf("... checking body against test's expect value. Success\n")
 			} else {
-				mqutil.InterfacePrint(map[string]interface{}{"... expecting body": t.Expect[ExpectBody]}, true)
-				fmt.Printf("... actual response body: %s\n", respBody)
+				// The bodies and the differences are printed, logged and reported with the secrets masked.
+				maskedExpected := maskValue(expectedBody, respSchema, t.db.Swagger)
+				maskedResult := maskValue(resultObj, respSchema, t.db.Swagger)
+				var diffs []string
+				if expectsBodyMatch {
+					diffs = mqutil.InterfaceMatchDiff(maskedExpected, maskedResult, bodyMatch == BodyMatchExact)
+				} else {
+					diffs = mqutil.InterfaceDiff(maskedExpected, maskedResult)
+				}
+				if len(diffs) == 0 {
+					diffs = []string{"(body): a masked value doesn't match"}
+				}
+				for _, diff := range diffs {
+					fmt.Printf("... %s\n", diff)
+				}
+				ejson, _ := json.Marshal(maskedExpected)
+				gotBody := maskedJson(resultObj, respSchema, t.db.Swagger, string(respBody))
+				// The whole bodies are only printed with -v, they are always in the log and the report.
+				if mqutil.Verbose {
+					mqutil.InterfacePrint(map[string]interface{}{"... expecting body": maskedExpected}, true)
+					fmt.Printf("... actual response body: %s\n", gotBody)
+				}
+				mqutil.Logger.Printf("%s: expecting body:\n%s\ngot body:\n%s", t.Name, ejson, gotBody)
 				fmt.Printf("... checking body against test's expect value. Fail\n")
-				ejson, _ := json.Marshal(t.Expect[ExpectBody])
+				t.expectedBody, t.gotBody = string(ejson), gotBody
+				setExpect()
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+					"=== test failed, the body doesn't match the expected one:\n%s\n===", strings.Join(diffs, "\n")))
+			}
+		}
+		if len(jsonPaths) > 0 && !binary {
+			if diffs := checkJSONPaths(jsonPaths, resultObj); len(diffs) > 0 {
+				for _, diff := range diffs {
+					fmt.Printf("... %s\n", diff)
+				}
+				fmt.Printf("... checking jsonPath against test's expect value. Fail\n")
+				setExpect()
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+					"=== test failed, the body doesn't match the jsonPath:\n%s\n===", strings.Join(diffs, "\n")))
+			}
+			fmt.Printf("... checking jsonPath against test's expect value. Success\n")
+		}
+		// Header names are case insensitive, Get canonicalizes the name.
+		for name, value := range expectedHeaders {
+			expectedValue := fmt.Sprint(value)
+			if actualValue := resp.Header().Get(name); actualValue != expectedValue {
+				fmt.Printf("... checking header %s against test's expect value. Fail\n", name)
 				setExpect()
 				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
-					"=== test failed, expecting body: \n%s\ngot body:\n%s\n===", string(ejson), respBody))
+					"=== test failed, expecting header %s: %s, got: %s ===", name, expectedValue, actualValue))
 			}
 		}
 	} else {
 		t.responseError = resp
 		fmt.Printf("... expecting status: %v got status: %d. %v\n", expectedStatus, status, redFail)
 		setExpect()
+		if t.violation != nil && status >= 500 {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+				"=== test failed, server error %d for a value breaking %s, expecting a 4xx ===", status, t.violation))
+		}
+		if t.violation != nil {
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+				"=== test failed, response code %d for a value breaking %s, expecting a 4xx ===", status, t.violation))
+		}
 		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, response code %d ===", status))
 	}
 
+	if binary {
+		needsContent := success && status != 204 && t.Method != mqswag.MethodHead
+		err := t.checkBinaryBody(respBody, resp.Header().Get("Content-Type"), needsContent)
+		if err != nil {
+			fmt.Printf("... checking the binary body. %v\n%s\n", redFail, mqutil.ErrorMessage(err))
+			t.responseError = mqutil.ErrorMessage(err)
+			setExpect()
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, %s ===", mqutil.ErrorMessage(err)))
+		}
+		fmt.Printf("... checking the binary body, %d bytes. %v\n", t.bodySize, greenSuccess)
+		setExpect()
+		return nil
+	}
+
 	// Check if the response obj and respSchema match
 	collection := make(map[string][]interface{})
 	objMatchesSchema := false
 	if resultObj != nil && respSchema != nil {
 		fmt.Printf("... verifying response against openapi schema. ")
-		err := respSchema.Parses("", resultObj, collection, true, t.db.Swagger)
+		err := respSchema.Parses("", resultObj, collection, true, t.Strict, t.db.Swagger)
+		// A value that's not one of its enum values, or with the wrong format, is a server bug even when the
+		// rest of the response matches.
+		_, isFormatErr := err.(*mqswag.FormatError)
+		_, isEnumErr := err.(*mqswag.EnumError)
+		if (isFormatErr && !t.FormatWarnings) || isEnumErr {
+			fmt.Printf("%v\n%s\n", redFail, err.Error())
+			t.responseError = err.Error()
+			setExpect()
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("=== test failed, %s ===", err.Error()))
+		}
 		if err != nil {
 			fmt.Printf("%v\n", yellowFail)
 			objMatchesSchema = true
@@ -519,26 +962,36 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 			}
 
 			// We ignore this if the response is success, and the spec we used is the default. This is a strong
-			// indicator that the author didn't spec out all the success cases.
-			/* Don't treat this as a hard failure for now. Too common.
-			if !(useDefaultSpec && success) {
+			// indicator that the author didn't spec out all the success cases. With strictDefault, the author
+			// tells us the default response is the success response, so the mismatch is a real failure.
+			if useDefaultSpec && success && t.StrictDefault {
+				t.responseError = err.Error()
 				setExpect()
-				return err
+				return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+					"=== test failed, the response doesn't match the default response: %s ===", err.Error()))
 			}
-			*/
 		} else {
 			fmt.Printf("%v\n", greenSuccess)
 		}
 	}
+	if resultObj != nil && respSchema != nil {
+		if fields := respSchema.FindWriteOnly("", resultObj, t.db.Swagger); len(fields) > 0 {
+			fmt.Printf("... checking response for write-only fields. %v\n", redFail)
+			t.responseError = fmt.Sprintf("Write-only fields returned: %s\n", strings.Join(fields, ", "))
+			setExpect()
+			return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+				"=== test failed, write-only fields returned: %s ===", strings.Join(fields, ", ")))
+		}
+	}
 	if resultObj != nil && len(collection) == 0 && t.tag != nil && len(t.tag.Class) > 0 {
 		// try to resolve collection from the hint on the operation's description field.
 		classSchema := t.db.GetSchema(t.tag.Class)
 		if classSchema != nil {
-			if classSchema.Matches(resultObj, t.db.Swagger) {
+			if classSchema.Matches(resultObj, t.Strict, t.db.Swagger) {
 				collection[t.tag.Class] = append(collection[t.tag.Class], resultObj)
 			} else {
 				callback := func(value map[string]interface{}) error {
-					if classSchema.Matches(value, t.db.Swagger) {
+					if classSchema.Matches(value, t.Strict, t.db.Swagger) {
 						collection[t.tag.Class] = append(collection[t.tag.Class], value)
 					}
 					return nil
@@ -567,6 +1020,19 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 		return nil
 	}
 
+	// The server never returns the write-only fields, so we don't keep them in the client DB.
+	for className, compList := range t.comparisons {
+		classSchema := t.db.GetSchema(className)
+		if classSchema == nil {
+			continue
+		}
+		for _, comp := range compList {
+			if comp.new != nil {
+				comp.new = classSchema.RemoveWriteOnly(comp.new, t.db.Swagger)
+			}
+		}
+	}
+
 	// Sometimes the server will return more data than requested. For instance, the server may generate
 	// a uuid that the client didn't send. So for post and puts, we first go through the collection.
 	// The assumption is that if the server returned an object of matching type, we should use that
@@ -579,10 +1045,12 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 	// For posts, it's possible that the server has replaced certain fields (such as uuid). We should just
 	// use the server's result.
 	if method == mqswag.MethodPost || method == mqswag.MethodPut {
+		// The ids the server assigned to the objects it created, by class, to check they keep increasing.
+		assignedIds := make(map[string][]interface{})
 		var propertyCollection map[string][]interface{}
 		if objMatchesSchema {
 			propertyCollection = make(map[string][]interface{})
-			respSchema.Parses("", resultObj, propertyCollection, false, t.db.Swagger)
+			respSchema.Parses("", resultObj, propertyCollection, false, t.Strict, t.db.Swagger)
 		}
 
 		for className, compList := range t.comparisons {
@@ -594,6 +1062,9 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 					for _, entry := range classList {
 						c := Comparison{nil, nil, entry.(map[string]interface{}), nil}
 						newcompList = append(newcompList, &c)
+						if id := c.new[t.Monotonic]; len(t.Monotonic) > 0 && id != nil {
+							assignedIds[className] = append(assignedIds[className], id)
+						}
 					}
 					collection[className] = nil
 					if t.Strict {
@@ -627,17 +1098,32 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 						keyAr := strings.Split(k, ".")
 						if len(keyAr) == 2 && keyAr[0] == className && len(v) == 1 {
 							compList[0].new[keyAr[1]] = v[0]
+							if len(t.Monotonic) > 0 && keyAr[1] == t.Monotonic && v[0] != nil {
+								assignedIds[className] = append(assignedIds[className], v[0])
+							}
 						}
 					}
 				}
 			}
 		}
 		for className, resultArray := range collection {
-			objTag := mqswag.MeqaTag{className, "", "", 0}
+			objTag := mqswag.MeqaTag{Class: className}
 			for _, c := range resultArray {
 				t.AddObjectComparison(&objTag, c.(map[string]interface{}), (*spec.Schema)(t.db.GetSchema(className)))
 			}
 		}
+		if method == mqswag.MethodPost && t.suite != nil {
+			for className, ids := range assignedIds {
+				for _, id := range ids {
+					if err := t.suite.CheckMonotonicId(className, id); err != nil {
+						fmt.Printf("... checking the id assigned by the server. %v\n", redFail)
+						t.responseError = mqutil.ErrorMessage(err)
+						setExpect()
+						return err
+					}
+				}
+			}
+		}
 	}
 
 	// Associations are only for the objects that has one for each class and has an old object.
@@ -685,56 +1171,192 @@ func (t *Test) ProcessResult(resp *resty.Response) error {
 // SetRequestParameters sets the parameters. Returns the new request path.
 func (t *Test) SetRequestParameters(req *resty.Request) string {
 	files := make(map[string]string)
+	uploads := make(map[string]*UploadFile)
 	for _, p := range t.op.Parameters {
 		if p.Type == "file" && t.FormParams[p.Name] != nil {
 			// for swagger 2 file type can only be in formData
-			if fname, ok := t.FormParams[p.Name].(string); ok {
-				files[p.Name] = fname
+			switch f := t.FormParams[p.Name].(type) {
+			case string:
+				files[p.Name] = f
+				delete(t.FormParams, p.Name)
+			case *UploadFile:
+				uploads[p.Name] = f
 				delete(t.FormParams, p.Name)
 			}
 		}
 	}
-	if len(files) > 0 {
-		req.SetFiles(files)
-	}
-	if len(t.FormParams) > 0 {
-		req.SetFormData(mqutil.MapInterfaceToMapString(t.FormParams))
-		mqutil.InterfacePrint(map[string]interface{}{"formParams": t.FormParams}, mqutil.Verbose)
+	if len(uploads) > 0 {
+		// resty uploads the files on disk, the generated ones are sent in a multipart body of our own.
+		for k, fname := range files {
+			content, err := ioutil.ReadFile(fname)
+			if err != nil {
+				mqutil.Logger.Printf("%s: can't read the file %s to upload: %s", t.Name, fname, err.Error())
+				continue
+			}
+			uploads[k] = &UploadFile{filepath.Base(fname), len(content), content}
+		}
+		body, contentType := multipartForm(t.paramValues(t.FormParams, "formData"), uploads)
+		req.SetBody(body)
+		req.SetHeader("Content-Type", contentType)
+		mqutil.InterfacePrint(map[string]interface{}{"formParams": t.maskParams(t.FormParams, "formData")}, mqutil.Verbose)
+	} else {
+		if len(files) > 0 {
+			req.SetFiles(files)
+		}
+		if len(t.FormParams) > 0 {
+			for k, values := range t.paramValues(t.FormParams, "formData") {
+				for _, v := range values {
+					req.FormData.Add(k, v)
+				}
+			}
+			mqutil.InterfacePrint(map[string]interface{}{"formParams": t.maskParams(t.FormParams, "formData")}, mqutil.Verbose)
+		}
 	}
 	for k, v := range files {
 		t.FormParams[k] = v
 	}
+	for k, v := range uploads {
+		if _, onDisk := files[k]; !onDisk {
+			t.FormParams[k] = v
+		}
+	}
 
 	if len(t.QueryParams) > 0 {
-		req.SetQueryParams(mqutil.MapInterfaceToMapString(t.QueryParams))
-		mqutil.InterfacePrint(map[string]interface{}{"queryParams": t.QueryParams}, mqutil.Verbose)
-	}
-	if t.BodyParams != nil {
-		req.SetBody(t.BodyParams)
-		mqutil.InterfacePrint(map[string]interface{}{"bodyParams": t.BodyParams}, mqutil.Verbose)
+		for k, values := range t.paramValues(t.QueryParams, "query") {
+			for _, v := range values {
+				req.QueryParam.Add(k, v)
+			}
+		}
+		mqutil.InterfacePrint(map[string]interface{}{"queryParams": t.maskParams(t.QueryParams, "query")}, mqutil.Verbose)
 	}
 	if len(t.HeaderParams) > 0 {
-		req.SetHeaders(mqutil.MapInterfaceToMapString(t.HeaderParams))
-		mqutil.InterfacePrint(map[string]interface{}{"headerParams": t.HeaderParams}, mqutil.Verbose)
+		req.SetHeaders(t.paramStrings(t.HeaderParams, "header"))
+		mqutil.InterfacePrint(map[string]interface{}{"headerParams": t.maskParams(t.HeaderParams, "header")}, mqutil.Verbose)
 	}
+	if t.BodyParams != nil {
+		t.setBody(req)
+		mqutil.InterfacePrint(map[string]interface{}{"bodyParams": t.maskBody(t.BodyParams)}, mqutil.Verbose)
+	}
+	t.setMediaTypes(req)
 	path := t.Path
 	if len(t.PathParams) > 0 {
-		PathParamsStr := mqutil.MapInterfaceToMapString(t.PathParams)
+		PathParamsStr := t.paramStrings(t.PathParams, "path")
 		for k, v := range PathParamsStr {
 			path = strings.Replace(path, "{"+k+"}", v, -1)
 		}
-		mqutil.InterfacePrint(map[string]interface{}{"pathParams": t.PathParams}, mqutil.Verbose)
+		mqutil.InterfacePrint(map[string]interface{}{"pathParams": t.maskParams(t.PathParams, "path")}, mqutil.Verbose)
 	}
 	return path
 }
 
+// paramValues converts the parameters in the location, e.g. query or formData, to the values to send. The
+// arrays are serialized according to the collectionFormat of their parameter in the spec, csv by default.
+func (t *Test) paramValues(params map[string]interface{}, location string) url.Values {
+	collectionFormats := make(map[string]string)
+	if t.op != nil {
+		for _, p := range t.op.Parameters {
+			if p.In == location {
+				collectionFormats[p.Name] = p.CollectionFormat
+				if location == "header" {
+					// Header names are case insensitive.
+					collectionFormats[strings.ToLower(p.Name)] = p.CollectionFormat
+				}
+			}
+		}
+	}
+	values := url.Values{}
+	for k, v := range params {
+		if f, ok := v.(*UploadFile); ok {
+			values.Add(k, f.Name)
+			continue
+		}
+		ar, ok := v.([]interface{})
+		if !ok {
+			values.Add(k, mqutil.InterfaceToJsonString(v))
+			continue
+		}
+		var entries []string
+		for _, entry := range ar {
+			entries = append(entries, mqutil.InterfaceToJsonString(entry))
+		}
+		format, exist := collectionFormats[k]
+		if !exist && location == "header" {
+			format = collectionFormats[strings.ToLower(k)]
+		}
+		switch format {
+		case "multi":
+			values[k] = entries
+		case "ssv":
+			values.Add(k, strings.Join(entries, " "))
+		case "tsv":
+			values.Add(k, strings.Join(entries, "\t"))
+		case "pipes":
+			values.Add(k, strings.Join(entries, "|"))
+		default:
+			values.Add(k, strings.Join(entries, ","))
+		}
+	}
+	return values
+}
+
+// paramStrings converts the path or header parameters to the strings to send. The arrays are joined according
+// to the collectionFormat of their parameter, csv by default, multi isn't allowed in these locations.
+func (t *Test) paramStrings(params map[string]interface{}, location string) map[string]string {
+	strs := make(map[string]string)
+	for k, values := range t.paramValues(params, location) {
+		strs[k] = strings.Join(values, ",")
+	}
+	return strs
+}
+
+// splitCollection splits the value of an array parameter given as a string, e.g. "a,b", into its entries
+// according to the collectionFormat of the parameter. The entries that parse as the items type are converted,
+// so they compare equal to what the server stores. Other values are returned as is.
+func splitCollection(paramSpec *spec.Parameter, value interface{}) interface{} {
+	str, ok := value.(string)
+	if !ok || paramSpec.Type != gojsonschema.TYPE_ARRAY {
+		return value
+	}
+	if len(str) == 0 {
+		return []interface{}{}
+	}
+	var entries []string
+	switch paramSpec.CollectionFormat {
+	case "multi":
+		entries = []string{str}
+	case "ssv":
+		entries = strings.Split(str, " ")
+	case "tsv":
+		entries = strings.Split(str, "\t")
+	case "pipes":
+		entries = strings.Split(str, "|")
+	default:
+		entries = strings.Split(str, ",")
+	}
+	ar := make([]interface{}, 0, len(entries))
+	for _, entry := range entries {
+		var v interface{} = entry
+		if paramSpec.Items != nil && len(paramSpec.Items.Type) > 0 && paramSpec.Items.Type != gojsonschema.TYPE_STRING {
+			var parsed interface{}
+			if json.Unmarshal([]byte(entry), &parsed) == nil {
+				v = parsed
+			}
+		}
+		ar = append(ar, v)
+	}
+	return ar
+}
+
 func (t *Test) CopyParent(parentTest *Test) {
 	if parentTest != nil {
-		t.Strict = parentTest.Strict
+		// The parent's settings win over the test's own.
+		settings := parentTest.TestSettings
+		settings.inherit(&t.TestSettings)
+		t.TestSettings = settings
 		t.Expect = mqutil.MapCopy(parentTest.Expect)
 		t.QueryParams = mqutil.MapAdd(t.QueryParams, parentTest.QueryParams)
 		t.PathParams = mqutil.MapAdd(t.PathParams, parentTest.PathParams)
-		t.HeaderParams = mqutil.MapAdd(t.HeaderParams, parentTest.HeaderParams)
+		t.HeaderParams = mqutil.HeaderAdd(t.HeaderParams, parentTest.HeaderParams)
 		t.FormParams = mqutil.MapAdd(t.FormParams, parentTest.FormParams)
 
 		if parentTest.BodyParams != nil {
@@ -762,11 +1384,17 @@ func (t *Test) Run(tc *TestSuite) error {
 
 	mqutil.Logger.Print("\n--- " + t.Name)
 	fmt.Printf("\nRunning test case: %s\n", t.Name)
+	if len(t.Steps) > 0 {
+		return t.RunSteps(tc)
+	}
 	err := t.ResolveParameters(tc)
 	if err != nil {
 		fmt.Printf("... Fail\n... %s\n", err.Error())
 		return err
 	}
+	if t.skipped {
+		return nil
+	}
 
 	req := resty.R()
 	if len(tc.ApiToken) > 0 {
@@ -778,6 +1406,9 @@ func (t *Test) Run(tc *TestSuite) error {
 	path := GetBaseURL(t.db.Swagger) + t.SetRequestParameters(req)
 	var resp *resty.Response
 
+	if tc.plan != nil {
+		tc.plan.waitForRate()
+	}
 	t.startTime = time.Now()
 	switch t.Method {
 	case mqswag.MethodGet:
@@ -804,28 +1435,69 @@ func (t *Test) Run(tc *TestSuite) error {
 		t.err = mqutil.NewError(mqutil.ErrHttp, err.Error())
 	} else {
 		mqutil.Logger.Print(resp.Status())
-		mqutil.Logger.Println(string(resp.Body()))
+		if t.isBinaryResponse(resp) {
+			mqutil.Logger.Printf("<%d bytes of %s>", len(resp.Body()), resp.Header().Get("Content-Type"))
+		} else {
+			mqutil.Logger.Println(t.maskResponseBody(resp))
+		}
 	}
 	err = t.ProcessResult(resp)
+	if err == nil && t.VerifyCreate && t.Method == mqswag.MethodPost {
+		err = t.verifyCreated(tc)
+	}
 	return err
 }
 
+// resolveTemplate looks up the value of one template, e.g. "test1.outputs.id", in the history.
+func resolveTemplate(template string, h *TestHistory) interface{} {
+	ar := strings.Split(strings.Trim(template, " "), ".")
+	if len(ar) < 3 {
+		mqutil.Logger.Printf("invalid parameter: {{%s}}, the format is {{testName.paramSection.paramName}}, e.g. {{test1.output.id}}",
+			template)
+		return nil
+	}
+	t := h.GetTest(ar[0])
+	if t != nil {
+		return t.GetParam(ar[1:])
+	}
+	return nil
+}
+
+// StringParamsResolveWithHistory replaces all the templates in the string with their values in the history.
+// When the string is a single template, the value is returned as is, so it keeps its type. Otherwise the
+// values are put into the string. The templates that can't be resolved are kept. Returns nil if none of
+// the templates can be resolved.
 func StringParamsResolveWithHistory(str string, h *TestHistory) interface{} {
-	begin := strings.Index(str, "{{")
-	end := strings.Index(str, "}}")
-	if end > begin {
-		ar := strings.Split(strings.Trim(str[begin+2:end], " "), ".")
-		if len(ar) < 3 {
-			mqutil.Logger.Printf("invalid parameter: {{%s}}, the format is {{testName.paramSection.paramName}}, e.g. {{test1.output.id}}",
-				str[begin+2:end])
-			return nil
+	resolved := false
+	result := ""
+	rest := str
+	for {
+		begin := strings.Index(rest, "{{")
+		if begin < 0 {
+			break
+		}
+		end := strings.Index(rest[begin:], "}}")
+		if end < 0 {
+			break
 		}
-		t := h.GetTest(ar[0])
-		if t != nil {
-			return t.GetParam(ar[1:])
+		end += begin
+		value := resolveTemplate(rest[begin+2:end], h)
+		if value != nil && begin == 0 && end+2 == len(rest) && len(result) == 0 {
+			return value
 		}
+		result += rest[:begin]
+		if value != nil {
+			resolved = true
+			result += mqutil.InterfaceToJsonString(value)
+		} else {
+			result += rest[begin : end+2]
+		}
+		rest = rest[end+2:]
 	}
-	return nil
+	if !resolved {
+		return nil
+	}
+	return result + rest
 }
 
 func MapParamsResolveWithHistory(paramMap map[string]interface{}, h *TestHistory) {
@@ -865,6 +1537,7 @@ func (t *Test) ResolveHistoryParameters(h *TestHistory) {
 			t.BodyParams = result
 		}
 	}
+	t.resolveOverrides(h)
 }
 
 // ParamsAdd adds the parameters from src to dst if the param doesn't already exist on dst.
@@ -888,28 +1561,56 @@ func ParamsAdd(dst []spec.Parameter, src []spec.Parameter) []spec.Parameter {
 	return dst
 }
 
+// operationParams returns the parameters of the operation, and the ones of its path the operation doesn't
+// redefine. They are a copy, the swagger is shared by the suites running in parallel.
+func operationParams(pathItem *spec.PathItem, op *spec.Operation) []spec.Parameter {
+	params := append([]spec.Parameter(nil), op.Parameters...)
+	if len(params) == 0 {
+		return append(params, pathItem.Parameters...)
+	}
+	return ParamsAdd(params, pathItem.Parameters)
+}
+
 // ResolveParameters fullfills the parameters for the specified request using the in-mem DB.
 // The resolved parameters will be added to test.Parameters map.
 func (t *Test) ResolveParameters(tc *TestSuite) error {
 	pathItem := t.db.Swagger.Paths.Paths[t.Path]
-	t.op = GetOperationByMethod(&pathItem, t.Method)
-	if t.op == nil {
+	op := GetOperationByMethod(&pathItem, t.Method)
+	if op == nil {
 		return mqutil.NewError(mqutil.ErrNotFound, fmt.Sprintf("Path %s not found in swagger file", t.Path))
 	}
+	if op.Deprecated {
+		// A hand-written plan may call a deprecated operation that the generated plans leave out.
+		switch t.deprecatedPolicy() {
+		case DeprecatedSkip:
+			fmt.Printf("... skipped, the operation is deprecated.\n")
+			t.skipped = true
+			return nil
+		case DeprecatedWarn:
+			fmt.Printf("... warning: the operation is deprecated.\n")
+			t.warnings = append(t.warnings, "the operation is deprecated")
+		}
+	}
 	fmt.Printf("... resolving parameters.\n")
+	t.genNodes, t.genDepth, t.genCapped, t.genFrames, t.genRefs = 0, 0, false, 0, nil
+	t.omitOptional = t.OptionalParams == OptionalParamsCoverage && t.countOptionalRun()%2 == 1
 
 	// There can be parameters at the path level. We merge these with the operation parameters.
-	t.op.Parameters = ParamsAdd(t.op.Parameters, pathItem.Parameters)
+	opCopy := *op
+	opCopy.Parameters = operationParams(&pathItem, op)
+	t.op = &opCopy
 
-	t.tag = mqswag.GetMeqaTag(t.op.Description)
+	t.tag = mqswag.GetTag(t.op)
 
 	var paramsMap map[string]interface{}
 	var globalParamsMap map[string]interface{}
 	var err error
 	var genParam interface{}
+	var bodySchema *mqswag.Schema
 	for _, params := range t.op.Parameters {
 		fmt.Printf("        %s (in %s): ", params.Name, params.In)
 		if params.In == "body" {
+			bodySchema = (*mqswag.Schema)(params.Schema)
 			var bodyMap map[string]interface{}
 			bodyIsMap := false
 			if t.BodyParams != nil {
@@ -917,7 +1618,7 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 			}
 			if t.BodyParams != nil && !bodyIsMap {
 				// Body is not map, we use it directly.
-				paramTag, schema := t.db.Swagger.GetSchemaRootType((*mqswag.Schema)(params.Schema), mqswag.GetMeqaTag(params.Description))
+				paramTag, schema := t.db.Swagger.GetSchemaRootType((*mqswag.Schema)(params.Schema), mqswag.GetTag(&params))
 				if schema != nil && paramTag != nil {
 					objarray, _ := t.BodyParams.([]interface{})
 					for _, obj := range objarray {
@@ -972,18 +1673,44 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 			}
 
 			// If there is a parameter passed in, just use it. Otherwise generate one.
-			_, inLocal := paramsMap[params.Name]
-			_, inGlobal := globalParamsMap[params.Name]
+			name := params.Name
+			globalName := params.Name
+			if params.In == "header" {
+				// Header names are case insensitive. We send the header under the name the user used.
+				name, _ = mqutil.HeaderKey(paramsMap, params.Name)
+				globalName, _ = mqutil.HeaderKey(globalParamsMap, params.Name)
+			}
+			_, inLocal := paramsMap[name]
+			_, inGlobal := globalParamsMap[globalName]
 			if !inLocal && inGlobal {
-				paramsMap[params.Name] = globalParamsMap[params.Name]
+				name = globalName
+				paramsMap[name] = globalParamsMap[globalName]
 			}
-			if _, ok := paramsMap[params.Name]; ok {
-				t.AddBasicComparison(mqswag.GetMeqaTag(params.Description), &params, paramsMap[params.Name])
+			if _, ok := paramsMap[name]; ok {
+				t.AddBasicComparison(mqswag.GetTag(&params), &params, splitCollection(&params, paramsMap[name]))
 				fmt.Print("provided\n")
 				continue
 			}
+			_, atBoundary := t.boundaries[params.Name]
+			_, enumPicked := t.enumValues[params.Name]
+			broken := t.violation != nil && t.violation.param == params.Name
+			if !params.Required && !atBoundary && !enumPicked && !broken && !t.includeOptional() {
+				// Not generating the value also leaves out its comparison, the server's default applies.
+				mqutil.Logger.Printf("%s: omitting the optional parameter %s (in %s), optionalParams is %s",
+					t.Name, params.Name, params.In, t.OptionalParams)
+				fmt.Print("omitted\n")
+				continue
+			}
 			genParam, err = t.GenerateParameter(&params, t.db)
-			paramsMap[params.Name] = genParam
+			if params.Required && (err != nil || genParam == nil) {
+				if value, ok := requiredParamDefault(tc, &params); ok {
+					genParam, err = value, nil
+				} else if err != nil {
+					return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+						"required parameter %s (in %s) missing and could not be generated: %s", params.Name, params.In, err.Error()))
+				}
+			}
+			paramsMap[name] = genParam
 		}
 		if err != nil {
 			return err
@@ -991,20 +1718,68 @@ func (t *Test) ResolveParameters(tc *TestSuite) error {
 	}
 	paramMaps := []*map[string]interface{}{&t.PathParams, &t.QueryParams, &t.HeaderParams, &t.FormParams}
 	for _, m := range paramMaps {
-		removeNulls(m)
+		removeNulls(m, nil)
 	}
 	if t.BodyParams != nil {
 		bodyMap := t.BodyParams.(map[string]interface{})
-		removeNulls(&bodyMap)
+		// The nulls of the nullable properties are sent on purpose.
+		var properties map[string]spec.Schema
+		if bodySchema != nil {
+			properties = bodySchema.GetProperties(t.db.Swagger)
+		}
+		removeNulls(&bodyMap, func(k string) bool {
+			p, ok := properties[k]
+			return ok && ((*mqswag.Schema)(&p)).IsNullable()
+		})
 		t.BodyParams = bodyMap
 	}
+	t.resolveMediaTypes()
+	return t.checkRequiredParams()
+}
+
+// requiredParamDefault finds the value in the plan's requiredParamDefaults for a required parameter.
+func requiredParamDefault(tc *TestSuite, params *spec.Parameter) (interface{}, bool) {
+	name := params.Name
+	if params.In == "header" {
+		name, _ = mqutil.HeaderKey(tc.ParamDefaults, params.Name)
+	}
+	value, ok := tc.ParamDefaults[name]
+	return value, ok && value != nil
+}
+
+// checkRequiredParams makes sure every required parameter of the operation, including the ones declared
+// at the path level, has a value before the call is made.
+func (t *Test) checkRequiredParams() error {
+	for _, params := range t.op.Parameters {
+		if !params.Required {
+			continue
+		}
+		found := false
+		switch params.In {
+		case "body":
+			found = t.BodyParams != nil
+		case "path":
+			_, found = t.PathParams[params.Name]
+		case "query":
+			_, found = t.QueryParams[params.Name]
+		case "header":
+			_, found = mqutil.HeaderKey(t.HeaderParams, params.Name)
+		case "formData":
+			_, found = t.FormParams[params.Name]
+		}
+		if !found {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+				"required parameter %s (in %s) missing and could not be generated", params.Name, params.In))
+		}
+	}
 	return nil
 }
 
-func removeNulls(inputMap *map[string]interface{}) {
+// removeNulls removes the null values from the map, except for the keys that keepNull returns true for.
+func removeNulls(inputMap *map[string]interface{}, keepNull func(k string) bool) {
 	filteredMap := make(map[string]interface{})
 	for k, v := range *inputMap {
-		if v != nil {
+		if v != nil || (keepNull != nil && keepNull(k)) {
 			filteredMap[k] = v
 		}
 	}
@@ -1033,11 +1808,34 @@ func GetOperationByMethod(item *spec.PathItem, method string) *spec.Operation {
 
 // GenerateParameter generates paramter value based on the spec.
 func (t *Test) GenerateParameter(paramSpec *spec.Parameter, db *mqswag.DB) (interface{}, error) {
-	tag := mqswag.GetMeqaTag(paramSpec.Description)
+	tag := mqswag.GetTag(paramSpec)
+	if t.violation != nil && t.violation.param == paramSpec.Name {
+		return t.generateViolation(paramSpec, tag, db)
+	}
+	if value, ok := t.enumValues[paramSpec.Name]; ok && paramSpec.Schema == nil {
+		fmt.Print("enum\n")
+		t.AddBasicComparison(tag, paramSpec, value)
+		return value, nil
+	}
+	if b, ok := t.boundaries[paramSpec.Name]; ok && paramSpec.Schema == nil {
+		value, err := t.generateBoundary(paramSpec, b, db)
+		if err == nil {
+			t.AddBasicComparison(tag, paramSpec, value)
+		}
+		return value, err
+	}
 	if paramSpec.Schema != nil {
+		if obj, ok := t.reuseObject(paramSpec, tag, db); ok {
+			return obj, nil
+		}
 		return t.GenerateSchema("", tag, paramSpec.Schema, db, 3)
 	}
 	if len(paramSpec.Enum) != 0 {
+		if t.useDefault(paramSpec.Default) {
+			fmt.Print("default\n")
+			t.AddBasicComparison(tag, paramSpec, paramSpec.Default)
+			return paramSpec.Default, nil
+		}
 		fmt.Print("enum\n")
 		return generateEnum(paramSpec.Enum)
 	}
@@ -1051,7 +1849,12 @@ func (t *Test) GenerateParameter(paramSpec *spec.Parameter, db *mqswag.DB) (inte
 		return t.generateObject("", tag, schema, db, 3)
 	}
 	if paramSpec.Type == gojsonschema.TYPE_ARRAY {
-		return t.generateArray("", tag, schema, db, 3)
+		ar, err := t.generateArray("", tag, schema, db, 3)
+		if err == nil {
+			// The entries are compared one by one, however the array is serialized in the request.
+			t.AddBasicComparison(tag, paramSpec, ar)
+		}
+		return ar, err
 	}
 
 	return t.generateByType(schema, paramSpec.Name, tag, paramSpec, true)
@@ -1061,7 +1864,7 @@ func (t *Test) GenerateParameter(paramSpec *spec.Parameter, db *mqswag.DB) (inte
 // 1) directly called from GenerateParameter, now we know the type is a parameter, and we want to add to comparison
 // 2) called at bottom level, here we know the object will be added to comparison and not the type primitives.
 func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.MeqaTag, paramSpec *spec.Parameter, print bool) (interface{}, error) {
-	tag := mqswag.GetMeqaTag(s.Description)
+	tag := mqswag.GetTag(s)
 	if tag == nil {
 		tag = parentTag
 	}
@@ -1078,21 +1881,45 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 				}
 			}
 			// Get one from in-mem db and populate the comparison structure.
-			ar := t.suite.db.Find(tag.Class, nil, nil, mqswag.MatchAlways, 5)
-			if len(ar) == 0 {
-				ar = t.db.Find(tag.Class, nil, nil, mqswag.MatchAlways, 5)
-			}
+			ar := t.findObjects(tag.Class, 5)
 			if len(ar) > 0 {
-				obj := ar[rand.Intn(len(ar))].(map[string]interface{})
-				comp := &Comparison{obj, make(map[string]interface{}), nil, (*spec.Schema)(t.db.GetSchema(tag.Class))}
-				comp.oldUsed[tag.Property] = comp.old[tag.Property]
-				t.comparisons[tag.Class] = append(t.comparisons[tag.Class], comp)
+				obj := ar[random.Intn(len(ar))].(map[string]interface{})
+				if tag.Flags&mqswag.FlagNoCompare == 0 {
+					comp := &Comparison{obj, make(map[string]interface{}), nil, (*spec.Schema)(t.db.GetSchema(tag.Class))}
+					comp.oldUsed[tag.Property] = comp.old[tag.Property]
+					t.comparisons[tag.Class] = append(t.comparisons[tag.Class], comp)
+				}
 				if print {
 					fmt.Printf("found %s.%s\n", tag.Class, tag.Property)
 				}
 				return obj[tag.Property], nil
 			}
+			if tag.Flags&mqswag.FlagWeak == 0 {
+				mqutil.Logger.Printf("%s: no %s in the DB for %s, generating a new value", t.Name, tag.Class, paramSpec.Name)
+			}
+		}
+	}
+
+	if t.useDefault(s.Default) {
+		if print {
+			fmt.Print("default\n")
+		}
+		if paramSpec != nil {
+			t.AddBasicComparison(tag, paramSpec, s.Default)
+		}
+		return s.Default, nil
+	}
+
+	if provider := t.getValueProvider(s, tag, prefix); provider != nil {
+		result, err := provider(s)
+		if err != nil {
+			return nil, err
+		}
+		if print {
+			fmt.Print("provider\n")
 		}
+		t.AddBasicComparison(tag, paramSpec, result)
+		return result, nil
 	}
 
 	if len(s.Type) != 0 {
@@ -1105,13 +1932,24 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 		case gojsonschema.TYPE_BOOLEAN:
 			result, err = generateBool(s)
 		case gojsonschema.TYPE_INTEGER:
-			result, err = generateInt(s)
+			result, err = generateInt(t.withNumberRange(s))
 		case gojsonschema.TYPE_NUMBER:
-			result, err = generateFloat(s)
+			result, err = generateFloat(t.withNumberRange(s))
 		case gojsonschema.TYPE_STRING:
-			result, err = generateString(s, prefix)
+			if isUnique(s, prefix) {
+				var ok bool
+				if result, ok, err = generateUnique(s, prefix); ok {
+					break
+				}
+			}
+			if str, ok := t.generateFake(s, prefix, tag); ok {
+				result = str
+			} else {
+				result, err = generateString(t.withDateRange(t.withStringLength(s)), prefix)
+			}
 		case "file":
-			return nil, errors.New("can not automatically upload a file, parameter of file type must be manually set\n")
+			// The files aren't compared, the server doesn't return them as part of an object.
+			return t.generateFile(prefix), nil
 		}
 		if result != nil && err == nil {
 			t.AddBasicComparison(tag, paramSpec, result)
@@ -1122,66 +1960,301 @@ func (t *Test) generateByType(s *spec.Schema, prefix string, parentTag *mqswag.M
 	return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("unrecognized type: %s", s.Type))
 }
 
+// findObjects returns up to count objects of the class, from the suite's DB, the test's DB, or the plan's DB
+// that's seeded with the fixtures. The plan's objects are copied, as the suites may run in parallel.
+func (t *Test) findObjects(class string, count int) []interface{} {
+	var found []interface{}
+	if t.suite != nil && t.suite.db != nil {
+		found = t.suite.db.Find(class, nil, nil, mqswag.MatchAlways, count)
+	}
+	if len(found) == 0 && t.db != nil {
+		found = t.db.Find(class, nil, nil, mqswag.MatchAlways, count)
+	}
+	if len(found) == 0 && t.suite != nil && t.suite.plan != nil && t.suite.plan.db != nil {
+		for _, obj := range t.suite.plan.db.Find(class, nil, nil, mqswag.MatchAlways, count) {
+			found = append(found, mqutil.InterfaceCopy(obj))
+		}
+	}
+	return found
+}
+
+// findReference returns the value of a property that refers to another class's property, e.g. Order.petId
+// tagged with Pet.id, taken from one of the existing objects of that class.
+func (t *Test) findReference(tag *mqswag.MeqaTag, objTag *mqswag.MeqaTag) (interface{}, bool) {
+	if tag == nil || len(tag.Class) == 0 || len(tag.Property) == 0 || (objTag != nil && objTag.Class == tag.Class) {
+		return nil, false
+	}
+	ar := t.findObjects(tag.Class, 5)
+	if len(ar) == 0 {
+		return nil, false
+	}
+	obj, ok := ar[random.Intn(len(ar))].(map[string]interface{})
+	if !ok || obj[tag.Property] == nil {
+		return nil, false
+	}
+	return obj[tag.Property], true
+}
+
 // RandomTime generate a random time in the range of [t - r, t).
 func RandomTime(t time.Time, r time.Duration) time.Time {
-	return t.Add(-time.Duration(float64(r) * rand.Float64()))
+	return t.Add(-time.Duration(float64(r) * random.Float64()))
 }
 
-// TODO we need to make it context aware. Based on different contexts we should generate different
-// date ranges. Prefix is a prefix to use when generating strings. It's only used when there is
-// no specified pattern in the swagger.json
+// generateString generates a string for the schema. The dates are generated in the range of the schema's
+// x-meqa-dateRange, or the last 30 days. Prefix is a prefix to use when generating strings. It's only used when
+// there is no specified pattern in the swagger.json
 func generateString(s *spec.Schema, prefix string) (string, error) {
-	if s.Format == "date-time" {
-		t := RandomTime(time.Now(), time.Hour*24*30)
-		return t.Format(time.RFC3339), nil
+	minLength, maxLength := 0, -1
+	if s.MinLength != nil {
+		minLength = int(*s.MinLength)
+	}
+	if s.MaxLength != nil {
+		maxLength = int(*s.MaxLength)
 	}
-	if s.Format == "date" {
-		t := RandomTime(time.Now(), time.Hour*24*30)
-		return t.Format("2006-01-02"), nil
+	if maxLength >= 0 && minLength > maxLength {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("minLength %d is greater than maxLength %d",
+			minLength, maxLength))
 	}
-	if s.Format == "uuid" {
+	var str string
+	switch s.Format {
+	case "date-time", "date":
+		from, to, err := schemaDateRange(s, time.Now())
+		if err != nil {
+			return "", err
+		}
+		t := RandomTime(to, to.Sub(from))
+		if s.Format == "date" {
+			str = t.Format("2006-01-02")
+		} else {
+			str = t.Format(time.RFC3339)
+		}
+	case "uuid":
 		u, err := uuid.NewV4()
-		return u.String(), err
+		if err != nil {
+			return "", err
+		}
+		str = u.String()
+	case "email":
+		str = generateEmail(minLength, maxLength)
+	case "hostname":
+		str = generateHostname(minLength, maxLength)
+	case "ipv4":
+		str = fmt.Sprintf("%d.%d.%d.%d", 1+random.Intn(223), random.Intn(256), random.Intn(256), 1+random.Intn(254))
+	case "ipv6":
+		groups := make([]string, 8)
+		for i := range groups {
+			groups[i] = fmt.Sprintf("%x", random.Intn(0x10000))
+		}
+		str = strings.Join(groups, ":")
+	case "phone":
+		str = fmt.Sprintf("+1%d%02d%07d", 2+random.Intn(8), random.Intn(100), random.Intn(10000000))
+	default:
+		return generatePatternString(s, prefix, minLength, maxLength)
+	}
+	// The lengths of the formats above are (nearly) fixed, so a value that doesn't fit is a problem in the spec.
+	return str, checkLength(s.Format, str, minLength, maxLength)
+}
+
+// checkLength returns an error if the generated value isn't between minLength and maxLength characters long.
+func checkLength(format string, str string, minLength int, maxLength int) error {
+	if maxLength >= 0 && len(str) > maxLength {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't generate a %s value within maxLength %d",
+			format, maxLength))
 	}
-	if s.Format == "email" {
-		s.Pattern = "^[a-z0-9]+@[a-z_]+?\\.[a-z]{2,3}$"
+	if len(str) < minLength {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't generate a %s value of minLength %d",
+			format, minLength))
 	}
+	return nil
+}
 
-	// If no pattern is specified, we use the field name + some numbers as pattern
+// generatePatternString generates a string from the schema's pattern, or from the prefix if there is no
+// pattern, then encodes it for the schema's format. The result is between minLength and maxLength characters
+// long, unless maxLength is negative. The whole string matches the pattern, so it's accepted whether or not
+// the server anchors the pattern.
+func generatePatternString(s *spec.Schema, prefix string, minLength int, maxLength int) (string, error) {
 	var pattern string
+	var whole *regexp.Regexp
 	length := 0
 	if len(s.Pattern) != 0 {
-		pattern = s.Pattern
+		pattern = patternCore(s.Pattern)
 		length = len(s.Pattern) * 2
+		var err error
+		whole, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+		}
+	}
+
+	// How long the generated string can be, so it fits between minLength and maxLength once it's encoded
+	// for the format.
+	var encode func(string) string
+	room, minRoom := maxLength, minLength
+	switch s.Format {
+	case "", "password":
+	case "byte":
+		encode = func(str string) string { return base64.StdEncoding.EncodeToString([]byte(str)) }
+		room = maxLength / 4 * 3
+		minRoom = (minLength + 3) / 4 * 3
+	case "binary":
+		encode = func(str string) string { return hex.EncodeToString([]byte(str)) }
+		room = maxLength / 2
+		minRoom = (minLength + 1) / 2
+	case "uri", "url":
+		uriPrefix := "https://www.google.com/search?q="
+		encode = func(str string) string { return uriPrefix + str }
+		room = maxLength - len(uriPrefix)
+		minRoom = minLength - len(uriPrefix)
+	default:
+		mqutil.Logger.Printf("unknown string format %s, generating the value from the pattern", s.Format)
+	}
+	if maxLength >= 0 && room < 0 {
+		room = 0
+	}
+
+	var str string
+	if whole == nil {
+		// If no pattern is specified, we use the field name + some numbers.
+		str = generatePrefixString(prefix, minRoom, room)
 	} else {
-		pattern = prefix + "\\d+"
-		length = len(prefix) + 5
+		if length < minRoom {
+			length = minRoom
+		}
+		// Try a few times for a string that matches the whole pattern and fits.
+		for i := 0; i < 10; i++ {
+			var err error
+			str, err = reggen.Generate(pattern, length)
+			if err != nil {
+				return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+			}
+			if whole.MatchString(str) && (maxLength < 0 || len(str) <= room) && len(str) >= minRoom {
+				break
+			}
+		}
+		if maxLength >= 0 && len(str) > room {
+			str = str[:room]
+		}
+		if len(str) < minRoom {
+			// Pad by repeating the last character, which keeps most patterns like [a-z]+ matching.
+			pad := "x"
+			if len(str) > 0 {
+				pad = str[len(str)-1:]
+			}
+			str += strings.Repeat(pad, minRoom-len(str))
+		}
+		if !whole.MatchString(str) {
+			mqutil.Logger.Printf("the value %s generated for the pattern %s doesn't match it", str, s.Pattern)
+		}
 	}
-	str, err := reggen.Generate(pattern, length)
-	if err != nil {
-		return "", mqutil.NewError(mqutil.ErrInvalid, err.Error())
+	if encode != nil {
+		str = encode(str)
+	}
+	return str, checkLength(s.Format, str, minLength, maxLength)
+}
+
+// generatePrefixString generates the prefix followed by some digits, between minLength and maxLength
+// characters long. When it's too long the prefix is cut first, so the random digits that keep the values
+// apart survive. When it's too short zeros are added at the end.
+func generatePrefixString(prefix string, minLength int, maxLength int) string {
+	number := randomString(digits, 1+random.Intn(len(prefix)+5))
+	if maxLength >= 0 {
+		if len(number) > maxLength {
+			number = number[:maxLength]
+		}
+		if len(prefix)+len(number) > maxLength {
+			prefix = prefix[:maxLength-len(number)]
+		}
+	}
+	if n := minLength - len(prefix) - len(number); n > 0 {
+		number += strings.Repeat("0", n)
+	}
+	return prefix + number
+}
+
+// patternCore strips the ^ and $ anchors at the ends of the pattern. The values are generated from what's left.
+func patternCore(pattern string) string {
+	pattern = strings.TrimPrefix(pattern, "^")
+	if strings.HasSuffix(pattern, "$") {
+		// A $ after an odd number of backslashes is escaped.
+		backslashes := len(pattern) - 1 - len(strings.TrimRight(pattern[:len(pattern)-1], "\\"))
+		if backslashes%2 == 0 {
+			pattern = pattern[:len(pattern)-1]
+		}
 	}
+	return pattern
+}
+
+const (
+	lowerLetters = "abcdefghijklmnopqrstuvwxyz"
+	digits       = "0123456789"
+)
 
-	if len(s.Format) == 0 || s.Format == "password" || s.Format == "email" {
-		return str, nil
+func randomString(chars string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[random.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// generateHostname generates a hostname of minLength to maxLength characters. A negative maxLength means the
+// hostname's own limit of 253 characters. The first label is padded to reach minLength, up to the label limit
+// of 63 characters.
+func generateHostname(minLength int, maxLength int) string {
+	if maxLength < 0 || maxLength > 253 {
+		maxLength = 253
+	}
+	host := randomString(lowerLetters, 2+random.Intn(2))
+	for i := 0; i < 2; i++ {
+		label := randomString(lowerLetters, 1) + randomString(lowerLetters+digits, random.Intn(10))
+		if len(label)+1+len(host) > maxLength {
+			break
+		}
+		host = label + "." + host
+	}
+	if n := minLength - len(host); n > 0 {
+		first := strings.Index(host, ".")
+		if first < 0 {
+			first = len(host)
+		}
+		if first+n > 63 {
+			n = 63 - first
+		}
+		host = host[:first] + strings.Repeat("a", n) + host[first:]
 	}
-	if s.Format == "byte" {
-		return base64.StdEncoding.EncodeToString([]byte(str)), nil
+	return host
+}
+
+// generateEmail generates an email address of minLength to maxLength characters. A negative maxLength means
+// the address's own limit of 254 characters. The part before the @ is padded to reach minLength, up to its
+// limit of 64 characters.
+func generateEmail(minLength int, maxLength int) string {
+	if maxLength < 0 || maxLength > 254 {
+		maxLength = 254
 	}
-	if s.Format == "binary" {
-		return hex.EncodeToString([]byte(str)), nil
+	// Leave room for the @ and at least one character before it.
+	host := generateHostname(0, maxLength-2)
+	local := randomString(lowerLetters+digits, 1+random.Intn(10))
+	if room := maxLength - 1 - len(host); room >= 1 && len(local) > room {
+		local = local[:room]
 	}
-	if s.Format == "uri" || s.Format == "url" {
-		return "https://www.google.com/search?q=" + str, nil
+	if n := minLength - len(local) - 1 - len(host); n > 0 {
+		if len(local)+n > 64 {
+			n = 64 - len(local)
+		}
+		local += strings.Repeat("0", n)
 	}
-	return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Invalid format string: %s", s.Format))
+	return local + "@" + host
 }
 
 func generateBool(s *spec.Schema) (interface{}, error) {
-	return rand.Intn(2) == 0, nil
+	return random.Intn(2) == 0, nil
 }
 
 func generateFloat(s *spec.Schema) (float64, error) {
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		return generateMultiple(s)
+	}
 	var realmin float64
 	if s.Minimum != nil {
 		realmin = *s.Minimum
@@ -1210,24 +2283,215 @@ func generateFloat(s *spec.Schema) (float64, error) {
 				*s.Minimum, *s.Maximum))
 		}
 	}
-	return rand.Float64()*(realmax-realmin) + realmin, nil
+	return random.Float64()*(realmax-realmin) + realmin, nil
 }
 
+// The number of multiples of multipleOf the values are picked from when the schema has neither a minimum nor a
+// maximum, on either side of 0, and when it only has one of them.
+const defaultMultiples = 100
+
+// generateMultiple generates a multiple of the schema's multipleOf within its minimum and maximum.
+func generateMultiple(s *spec.Schema) (float64, error) {
+	m := *s.MultipleOf
+	var low, high float64
+	if s.Minimum != nil {
+		var onBound bool
+		if low, onBound = multipleIndex(*s.Minimum/m, math.Ceil); onBound && s.ExclusiveMinimum {
+			low++
+		}
+	}
+	if s.Maximum != nil {
+		var onBound bool
+		if high, onBound = multipleIndex(*s.Maximum/m, math.Floor); onBound && s.ExclusiveMaximum {
+			high--
+		}
+	}
+	switch {
+	case s.Minimum == nil && s.Maximum == nil:
+		low, high = -defaultMultiples, defaultMultiples
+	case s.Maximum == nil:
+		high = low + defaultMultiples
+	case s.Minimum == nil:
+		low = high - defaultMultiples
+	}
+	if low > high {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("no multiple of %v within minimum %v and maximum %v",
+			m, floatOrNil(s.Minimum), floatOrNil(s.Maximum)))
+	}
+	k := low + math.Floor(random.Float64()*(high-low+1))
+	if k > high {
+		k = high
+	}
+	// Round away the error of the multiplication, so 0.01 * 29 is 0.29 and not 0.29000000000000004.
+	value := k * m
+	if text := strconv.FormatFloat(m, 'f', -1, 64); strings.Contains(text, ".") {
+		if decimals := len(text) - strings.Index(text, ".") - 1; decimals <= 15 {
+			scale := math.Pow10(decimals)
+			value = math.Round(value*scale) / scale
+		}
+	}
+	return value, nil
+}
+
+// multipleIndex rounds the quotient of a bound and multipleOf to a whole number with the round function, and
+// tells whether it's already one but for the floating point error, e.g. 0.3 / 0.1 is 2.9999999999999996.
+func multipleIndex(q float64, round func(float64) float64) (float64, bool) {
+	if r := math.Round(q); math.Abs(q-r) <= 1e-9*math.Max(1, math.Abs(q)) {
+		return r, true
+	}
+	return round(q), false
+}
+
+// intStep returns the smallest positive integer that's a multiple of multipleOf, e.g. 1 for 0.5 and 3 for 1.5.
+func intStep(multipleOf float64) (int64, bool) {
+	for n := 1.0; n <= 1000; n++ {
+		if step, whole := multipleIndex(n*multipleOf, math.Round); whole {
+			if step >= math.MaxInt64 {
+				return 0, false
+			}
+			return int64(step), true
+		}
+	}
+	return 0, false
+}
+
+// floorDiv and ceilDiv divide a by b > 0, rounding down and up.
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func ceilDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && a > 0 {
+		q++
+	}
+	return q
+}
+
+// The range of the integers generated when the schema has neither a minimum nor a maximum, and the width of the
+// range when it only has one of them.
+const (
+	defaultIntMin   = 0
+	defaultIntRange = 1000000
+)
+
+// generateInt generates an integer within the schema's minimum and maximum, honoring the exclusive flags. It works
+// in int64 so the large bounds don't lose precision, and stays within the range of the format, int32 or int64.
 func generateInt(s *spec.Schema) (int64, error) {
-	// Give a default range if there isn't one
-	if s.Maximum == nil && s.Minimum == nil {
-		maxf := 1000000.0
-		s.Maximum = &maxf
+	formatMin, formatMax := int64(math.MinInt64), int64(math.MaxInt64)
+	if s.Format == "int32" {
+		formatMin, formatMax = math.MinInt32, math.MaxInt32
+	}
+	var low, high int64
+	switch {
+	case s.Minimum == nil && s.Maximum == nil:
+		low, high = defaultIntMin, defaultIntMin+defaultIntRange
+	case s.Minimum != nil && s.Maximum != nil:
+		low, high = intMinimum(s), intMaximum(s)
+	case s.Minimum != nil:
+		low = intMinimum(s)
+		high = low + defaultIntRange
+		if high < low {
+			// overflow
+			high = math.MaxInt64
+		}
+	default:
+		high = intMaximum(s)
+		low = high - defaultIntRange
+		if low > high {
+			low = math.MinInt64
+		}
 	}
-	f, err := generateFloat(s)
-	if err != nil {
-		return 0, err
+	if low < formatMin {
+		low = formatMin
 	}
-	i := int64(f)
-	if s.Minimum != nil && i <= int64(*s.Minimum) {
-		i++
+	if high > formatMax {
+		high = formatMax
+	}
+	if low > high {
+		return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"no %s integer within minimum %v and maximum %v", s.Format, floatOrNil(s.Minimum), floatOrNil(s.Maximum)))
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		step, ok := intStep(*s.MultipleOf)
+		if !ok {
+			return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("no integer is a multiple of %v", *s.MultipleOf))
+		}
+		if step > 1 {
+			kLow, kHigh := ceilDiv(low, step), floorDiv(high, step)
+			if kLow > kHigh {
+				return 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+					"no multiple of %v within minimum %v and maximum %v",
+					*s.MultipleOf, floatOrNil(s.Minimum), floatOrNil(s.Maximum)))
+			}
+			return (kLow + int64(randUint64n(uint64(kHigh-kLow)+1))) * step, nil
+		}
 	}
-	return i, nil
+	// The span can be all of the uint64 values.
+	span := uint64(high) - uint64(low)
+	if span == math.MaxUint64 {
+		return int64(random.Uint64()), nil
+	}
+	return int64(uint64(low) + randUint64n(span+1)), nil
+}
+
+// intMinimum returns the smallest integer the schema's minimum allows.
+func intMinimum(s *spec.Schema) int64 {
+	min := math.Ceil(*s.Minimum)
+	if s.ExclusiveMinimum && min == *s.Minimum {
+		min++
+	}
+	return floatToInt64(min)
+}
+
+// intMaximum returns the biggest integer the schema's maximum allows.
+func intMaximum(s *spec.Schema) int64 {
+	max := math.Floor(*s.Maximum)
+	if s.ExclusiveMaximum && max == *s.Maximum {
+		max--
+	}
+	return floatToInt64(max)
+}
+
+// floatToInt64 converts the whole number to int64, clamped to the range of int64.
+func floatToInt64(f float64) int64 {
+	if f >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	if f <= math.MinInt64 {
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+func floatOrNil(f *float64) interface{} {
+	if f == nil {
+		return nil
+	}
+	return *f
+}
+
+// randUint64n returns a random number in [0, n), n > 0.
+func randUint64n(n uint64) uint64 {
+	if n <= math.MaxInt64 {
+		return uint64(random.Int63n(int64(n)))
+	}
+	// Reject the values past the last whole multiple of n, they would make the small results more likely.
+	limit := math.MaxUint64 - math.MaxUint64%n
+	for {
+		if v := random.Uint64(); v < limit {
+			return v % n
+		}
+	}
+}
+
+// parseArraySize parses the arraySize of the plan, a number of items, e.g. 3, or a range, e.g. 1-5.
+func parseArraySize(size string) (int, int, error) {
+	return parseSizeRange("arraySize", size, 1)
 }
 
 func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spec.Schema, db *mqswag.DB, level int) (interface{}, error) {
@@ -1251,9 +2515,13 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 		if maxDiff <= 0 {
 			maxDiff = 1
 		}
-		numItems = rand.Intn(int(maxDiff)) + minItems
+		numItems = random.Intn(int(maxDiff)) + minItems
+	} else if size := t.planSize(t.ArraySize, func(plan *TestPlan) string { return plan.ArraySize }); len(size) > 0 {
+		// The size was checked when the plan was loaded.
+		minSize, maxSize, _ := parseArraySize(size)
+		numItems = minSize + random.Intn(maxSize-minSize+1)
 	} else {
-		numItems = rand.Intn(10)
+		numItems = random.Intn(10)
 	}
 	if numItems <= 0 {
 		numItems = 1
@@ -1265,7 +2533,7 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 	} else {
 		itemSchema = schema.Items.Schema
 	}
-	tag := mqswag.GetMeqaTag(schema.Description)
+	tag := mqswag.GetTag(schema)
 	if tag == nil {
 		tag = parentTag
 	}
@@ -1276,7 +2544,13 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 		hash = make(map[interface{}]interface{})
 	}
 
+	nullableItems := itemSchema != nil && ((*mqswag.Schema)(itemSchema)).IsNullable() && hash == nil
 	generateOneEntry := func() error {
+		if nullableItems && random.Float64() < NullProbability {
+			// Send a null item sometimes, to see how the server handles it.
+			ar = append(ar, nil)
+			return nil
+		}
 		entry, err := t.GenerateSchema(name, tag, itemSchema, db, level)
 		if err != nil {
 			return err
@@ -1294,21 +2568,83 @@ func (t *Test) generateArray(name string, parentTag *mqswag.MeqaTag, schema *spe
 		return nil
 	}
 
+	t.genDepth++
+	defer func() { t.genDepth-- }()
+	minItems := 0
+	if schema.MinItems != nil {
+		minItems = int(*schema.MinItems)
+	}
+	ar = []interface{}{}
+	if t.overGenerationCap() {
+		// Past the cap, the array only gets the entries it must have.
+		for i := 0; i < minItems; i++ {
+			if err := generateOneEntry(); err == errRefCycle {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		return ar, nil
+	}
+
 	// we only print one entry
 	err := generateOneEntry()
+	if err == errRefCycle {
+		// The items refer back to a definition being generated, the array stays empty.
+		return ar, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	level = 0 // this will supress prints
-	for i := 0; i < numItems; i++ {
+	for i := 1; i < numItems; i++ {
+		if len(ar) >= minItems && t.overGenerationCap() {
+			break
+		}
 		err = generateOneEntry()
-		if err != nil {
+		if err != nil && err != errRefCycle {
 			return nil, err
 		}
 	}
 	return ar, nil
 }
 
+// The caps on the values generated for one request, when neither the test nor meqa_init sets maxNodes or maxDepth. Past
+// either, the arrays only get their minItems entries, and the objects only their required properties.
+var (
+	DefaultMaxNodes = 1000
+	DefaultMaxDepth = 10
+)
+
+// overGenerationCap returns whether the values generated for the request so far have reached the cap on their
+// number or their nesting depth. The first time a test reaches it, it's logged.
+func (t *Test) overGenerationCap() bool {
+	maxNodes := t.planLimit(t.MaxNodes, func(plan *TestPlan) int { return plan.MaxNodes }, DefaultMaxNodes)
+	maxDepth := t.planLimit(t.MaxDepth, func(plan *TestPlan) int { return plan.MaxDepth }, DefaultMaxDepth)
+	if t.genNodes < maxNodes && t.genDepth <= maxDepth {
+		return false
+	}
+	if !t.genCapped {
+		t.genCapped = true
+		mqutil.Logger.Printf("%s: generated %d values at depth %d, over the cap of %d values or depth %d. "+
+			"The arrays get their minItems entries and the objects their required properties from now on.",
+			t.Name, t.genNodes, t.genDepth, maxNodes, maxDepth)
+	}
+	return true
+}
+
+// The probability of sending null for an optional property that is nullable.
+var NullProbability = 0.1
+
+func isRequired(schema *spec.Schema, name string) bool {
+	for _, r := range schema.Required {
+		if r == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *spec.Schema, db *mqswag.DB, level int) (interface{}, error) {
 	obj := make(map[string]interface{})
 	var spaces string
@@ -1320,7 +2656,26 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *sp
 	if level != 0 {
 		fmt.Println("")
 	}
-	for k, v := range schema.Properties {
+	t.genDepth++
+	defer func() { t.genDepth-- }()
+	tag := mqswag.GetTag(schema)
+	if tag == nil {
+		tag = parentTag
+	}
+	// Go through the properties in a fixed order, so the same seed generates the same object.
+	var names []string
+	for k := range schema.Properties {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		v := schema.Properties[k]
+		if !isRequired(schema, k) && t.overGenerationCap() {
+			continue
+		}
+		if !isRequired(schema, k) && t.OptionalProps == OptionalPropsNever && !hasClassTag(&v) {
+			continue
+		}
 		if level != 0 {
 			fmt.Printf("%s%s . ", spaces, k)
 		}
@@ -1331,16 +2686,61 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *sp
 				continue
 			}
 		}
+		if v.ReadOnly && !t.IncludeReadOnly {
+			// The server sets the readOnly properties, and may reject the request if we send them.
+			if level != 0 {
+				fmt.Println("readOnly")
+			}
+			continue
+		}
+		if o, found := t.propertyOverride(tag, k); found {
+			// The plan or the test fixes the property's value.
+			if level != 0 {
+				fmt.Println("override")
+			}
+			obj[k] = o
+			continue
+		}
+		if ((*mqswag.Schema)(&v)).IsNullable() && !isRequired(schema, k) && random.Float64() < NullProbability {
+			// Send null sometimes, to see how the server handles it.
+			if level != 0 {
+				fmt.Println("null")
+			}
+			obj[k] = nil
+			continue
+		}
+		if o, found := t.findReference(mqswag.GetTag(&v), tag); found {
+			// The property refers to an existing object, use its value.
+			if level != 0 {
+				fmt.Println("found")
+			}
+			obj[k] = o
+			continue
+		}
 		o, err := t.GenerateSchema(k+"_", nil, &v, db, nextLevel)
+		if err == errRefCycle {
+			// Leave the property out, or null if it can be.
+			if ((*mqswag.Schema)(&v)).IsNullable() {
+				obj[k] = nil
+			}
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
 		obj[k] = o
 	}
-
-	tag := mqswag.GetMeqaTag(schema.Description)
-	if tag == nil {
-		tag = parentTag
+	err := t.generatePatternProperties(obj, schema, db, nextLevel)
+	if err != nil {
+		return nil, err
+	}
+	err = t.generateMapEntries(name, obj, schema, db, nextLevel)
+	if err != nil {
+		return nil, err
+	}
+	err = t.fitPropertyCount(name, obj, schema, db, nextLevel)
+	if err != nil {
+		return nil, err
 	}
 
 	if tag != nil {
@@ -1349,12 +2749,160 @@ func (t *Test) generateObject(name string, parentTag *mqswag.MeqaTag, schema *sp
 	return obj, nil
 }
 
+// generatePatternProperties adds one or two keys for each of the schema's patternProperties, generated from the
+// pattern, with values of the pattern's schema.
+func (t *Test) generatePatternProperties(obj map[string]interface{}, schema *spec.Schema, db *mqswag.DB, level int) error {
+	var patterns []string
+	for pattern := range schema.PatternProperties {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		core := patternCore(pattern)
+		whole, err := regexp.Compile("^(?:" + core + ")$")
+		if err != nil {
+			mqutil.Logger.Printf("%s: invalid patternProperties pattern %s: %s", t.Name, pattern, err.Error())
+			continue
+		}
+		want := 1 + random.Intn(2)
+		for added, attempts := 0, 0; added < want && attempts < 10 && !t.overGenerationCap(); attempts++ {
+			k, err := reggen.Generate(core, 10)
+			if err != nil || !whole.MatchString(k) {
+				continue
+			}
+			if _, exist := obj[k]; exist {
+				continue
+			}
+			if _, exist := schema.Properties[k]; exist {
+				continue
+			}
+			v := schema.PatternProperties[pattern]
+			o, err := t.GenerateSchema(k+"_", nil, &v, db, level)
+			if err == errRefCycle {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			obj[k] = o
+			added++
+		}
+	}
+	return nil
+}
+
+// mapKey returns the i-th key generated for a map, named after the property like the generated strings, e.g.
+// labels_1.
+func mapKey(name string, i int) string {
+	if len(name) == 0 {
+		name = "key_"
+	}
+	return fmt.Sprintf("%s%d", name, i)
+}
+
+// generateMapEntries fills an object that is a map, i.e. has an additionalProperties schema and no fixed properties,
+// with between minProperties and maxProperties keys. Without the bounds, it gets one to three keys.
+func (t *Test) generateMapEntries(name string, obj map[string]interface{}, schema *spec.Schema, db *mqswag.DB, level int) error {
+	if len(schema.Properties) > 0 || len(schema.PatternProperties) > 0 || schema.AdditionalProperties == nil ||
+		schema.AdditionalProperties.Schema == nil {
+		return nil
+	}
+	low := 1
+	if schema.MinProperties != nil {
+		low = int(*schema.MinProperties)
+	}
+	high := low + 2
+	if schema.MaxProperties != nil && int(*schema.MaxProperties) < high {
+		high = int(*schema.MaxProperties)
+	}
+	if high < low {
+		high = low
+	}
+	count := low + random.Intn(high-low+1)
+	for i := 1; len(obj) < count; i++ {
+		if len(obj) >= low && t.overGenerationCap() {
+			break
+		}
+		k := mapKey(name, i)
+		if _, exist := obj[k]; exist {
+			continue
+		}
+		o, err := t.GenerateSchema(k+"_", nil, schema.AdditionalProperties.Schema, db, level)
+		if err == errRefCycle {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		obj[k] = o
+	}
+	return nil
+}
+
+// fitPropertyCount keeps the number of keys of the generated object within the schema's minProperties and
+// maxProperties. It drops optional keys to stay within maxProperties, and adds keys of the additionalProperties
+// type to reach minProperties. The required keys are never dropped.
+func (t *Test) fitPropertyCount(name string, obj map[string]interface{}, schema *spec.Schema, db *mqswag.DB, level int) error {
+	if schema.MaxProperties != nil && int64(len(obj)) > *schema.MaxProperties {
+		var optional []string
+		for k := range obj {
+			if !isRequired(schema, k) {
+				optional = append(optional, k)
+			}
+		}
+		sort.Strings(optional)
+		for int64(len(obj)) > *schema.MaxProperties && len(optional) > 0 {
+			i := random.Intn(len(optional))
+			delete(obj, optional[i])
+			optional = append(optional[:i], optional[i+1:]...)
+		}
+	}
+	if schema.MinProperties == nil || int64(len(obj)) >= *schema.MinProperties {
+		return nil
+	}
+	// Without an additionalProperties schema, any value is allowed unless additionalProperties is false.
+	extraSchema := spec.StringProperty()
+	if schema.AdditionalProperties != nil {
+		if schema.AdditionalProperties.Schema != nil {
+			extraSchema = schema.AdditionalProperties.Schema
+		} else if !schema.AdditionalProperties.Allows {
+			return nil
+		}
+	}
+	for i := 1; int64(len(obj)) < *schema.MinProperties; i++ {
+		k := mapKey(name, i)
+		if _, exist := obj[k]; exist {
+			continue
+		}
+		if _, exist := schema.Properties[k]; exist {
+			continue
+		}
+		o, err := t.GenerateSchema(k+"_", nil, extraSchema, db, level)
+		if err == errRefCycle {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		obj[k] = o
+	}
+	return nil
+}
+
 // The parentTag passed in is what the higher level thinks this schema object should be.
 func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *spec.Schema, db *mqswag.DB, level int) (interface{}, error) {
 	swagger := db.Swagger
+	t.genNodes++
+	t.genFrames++
+	defer func() { t.genFrames-- }()
+	if maxRecursion := t.maxRecursion(); t.genFrames > maxRecursion {
+		mqutil.Logger.Printf("%s: the generation is nested more than %d levels deep, stopped descending into %s",
+			t.Name, maxRecursion, name)
+		return nil, errRefCycle
+	}
 
 	// The tag that's closest to the object takes priority, much like child class can override parent class.
-	tag := mqswag.GetMeqaTag(schema.Description)
+	tag := mqswag.GetTag(schema)
 	if tag == nil {
 		tag = parentTag
 	}
@@ -1368,9 +2916,13 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 		if len(name) > 0 {
 			// This the the field of an object. Instead of generating a new object, we try to get one
 			// from the DB. If we can't find one, we put in null.
-			found := t.suite.db.Find(referenceName, nil, nil, mqswag.MatchAlways, 1)
-			if len(found) == 0 {
-				found = t.db.Find(referenceName, nil, nil, mqswag.MatchAlways, 1)
+			found := t.findObjects(referenceName, 1)
+			// The objects of the subtypes can be used as well.
+			for _, subtype := range db.GetSubtypes(referenceName) {
+				if len(found) > 0 {
+					break
+				}
+				found = t.findObjects(subtype, 1)
 			}
 			if len(found) > 0 {
 				if level != 0 {
@@ -1383,10 +2935,22 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 			}
 			return nil, nil
 		}
-		return t.GenerateSchema(name, &mqswag.MeqaTag{referenceName, "", "", 0}, (*spec.Schema)(referredSchema), db, level)
+		if subtypes := db.GetSubtypes(referenceName); len(subtypes) > 0 {
+			// Don't generate the abstract base, generate one of its subtypes. The subtype's allOf sets
+			// the discriminator to the subtype's name.
+			subtype := pickSubtype(tag, subtypes)
+			return t.generateReferred(name, &mqswag.MeqaTag{Class: subtype}, (*spec.Schema)(swagger.FindSchemaByName(subtype)), db, level)
+		}
+		return t.generateReferred(name, &mqswag.MeqaTag{Class: referenceName}, (*spec.Schema)(referredSchema), db, level)
 	}
 
 	if len(schema.Enum) != 0 {
+		if t.useDefault(schema.Default) {
+			if level != 0 {
+				fmt.Print("default\n")
+			}
+			return schema.Default, nil
+		}
 		if level != 0 {
 			fmt.Print("enum\n")
 		}
@@ -1397,7 +2961,13 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 		combined := make(map[string]interface{})
 		discriminator := ""
 		for _, s := range schema.AllOf {
-			m, err := t.GenerateSchema(name, nil, &s, db, level)
+			var m interface{}
+			if referenceName, referredSchema, _ := swagger.GetReferredSchema((*mqswag.Schema)(&s)); referredSchema != nil {
+				// Generate the base itself, not one of its subtypes.
+				m, err = t.generateReferred(name, &mqswag.MeqaTag{Class: referenceName}, (*spec.Schema)(referredSchema), db, level)
+			} else {
+				m, err = t.GenerateSchema(name, nil, &s, db, level)
+			}
 			if err != nil {
 				return nil, err
 			}
@@ -1426,6 +2996,18 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 		return combined, nil
 	}
 
+	if alternatives, _ := (*mqswag.Schema)(schema).GetAlternatives(); len(alternatives) > 0 {
+		altTag, altSchema, err := pickAlternative(tag, alternatives, swagger)
+		if err != nil {
+			return nil, err
+		}
+		if altTag != nil && altTag != tag && swagger.FindSchemaByName(altTag.Class) != nil {
+			// The alternative is a definition.
+			return t.generateReferred(name, altTag, altSchema, db, level)
+		}
+		return t.GenerateSchema(name, altTag, altSchema, db, level)
+	}
+
 	if len(schema.Type) == 0 {
 		// return nil, mqutil.NewError(mqutil.ErrInvalid, "Parameter doesn't have type")
 		return t.generateObject(name, tag, schema, db, level)
@@ -1440,6 +3022,233 @@ func (t *Test) GenerateSchema(name string, parentTag *mqswag.MeqaTag, schema *sp
 	return t.generateByType(schema, name, tag, nil, level != 0)
 }
 
+// errRefCycle is returned when generating a value would never end, as its schema refers back to a definition
+// that's being generated further up. The object or array that contains the value leaves it out.
+var errRefCycle = errors.New("circular $ref")
+
+// generateReferred generates the definition the tag names, unless the definition is already being generated further
+// up the chain of $refs, in which case it returns errRefCycle.
+func (t *Test) generateReferred(name string, tag *mqswag.MeqaTag, schema *spec.Schema, db *mqswag.DB, level int) (interface{}, error) {
+	for _, class := range t.genRefs {
+		if class == tag.Class {
+			mqutil.Logger.Printf("%s: %s refers back to itself through %s, stopped descending",
+				t.Name, tag.Class, strings.Join(t.genRefs, " -> "))
+			return nil, errRefCycle
+		}
+	}
+	t.genRefs = append(t.genRefs, tag.Class)
+	defer func() { t.genRefs = t.genRefs[:len(t.genRefs)-1] }()
+	return t.GenerateSchema(name, tag, schema, db, level)
+}
+
+// The cap on the nesting of the schemas generated for a request, when meqa_init doesn't set maxRecursion. It
+// catches what the detection of the circular $refs misses.
+var DefaultMaxRecursion = 100
+
+func (t *Test) maxRecursion() int {
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.MaxRecursion > 0 {
+		return t.suite.plan.MaxRecursion
+	}
+	return DefaultMaxRecursion
+}
+
+// pickSubtype picks the subtype the tag names, or a random one if the tag doesn't name any.
+func pickSubtype(tag *mqswag.MeqaTag, subtypes []string) string {
+	if tag != nil {
+		for _, subtype := range subtypes {
+			if tag.Class == subtype {
+				return subtype
+			}
+		}
+	}
+	return subtypes[random.Intn(len(subtypes))]
+}
+
+// pickAlternative picks one of the oneOf/anyOf schemas to generate. If the tag names the class of one of
+// them we pick that one, otherwise we pick randomly. A $ref is replaced by the schema it refers to, and the
+// returned tag names the referred class, so the generated object is filed under the right class.
+func pickAlternative(tag *mqswag.MeqaTag, alternatives []spec.Schema, swagger *mqswag.Swagger) (*mqswag.MeqaTag, *spec.Schema, error) {
+	var tags []*mqswag.MeqaTag
+	var schemas []*spec.Schema
+	for i := range alternatives {
+		altSchema := &alternatives[i]
+		altTag := mqswag.GetTag(altSchema)
+		if altTag == nil {
+			altTag = tag
+		}
+		referenceName, referredSchema, err := swagger.GetReferredSchema((*mqswag.Schema)(altSchema))
+		if err != nil {
+			return nil, nil, err
+		}
+		if referredSchema != nil {
+			altSchema = (*spec.Schema)(referredSchema)
+			altTag = &mqswag.MeqaTag{Class: referenceName}
+			if tag != nil {
+				altTag.Operation = tag.Operation
+			}
+		}
+		if tag != nil && altTag != nil && len(tag.Class) > 0 && tag.Class == altTag.Class {
+			return altTag, altSchema, nil
+		}
+		tags = append(tags, altTag)
+		schemas = append(schemas, altSchema)
+	}
+	i := random.Intn(len(schemas))
+	return tags[i], schemas[i], nil
+}
+
+// The policies of using the default values declared in the spec instead of generating random ones.
+const (
+	UseDefaultsAlways    = "always"
+	UseDefaultsSometimes = "sometimes"
+	UseDefaultsNever     = "never"
+)
+
+// useDefault decides whether to use the declared default value, according to the test's useDefaults policy.
+// Without a policy the defaults aren't used.
+func (t *Test) useDefault(def interface{}) bool {
+	if def == nil {
+		return false
+	}
+	switch t.UseDefaults {
+	case UseDefaultsAlways:
+		return true
+	case UseDefaultsSometimes:
+		return random.Intn(2) == 0
+	}
+	return false
+}
+
+// The policies of sending the optional parameters a test doesn't provide. Besides these, the policy can be the
+// probability of sending each one, e.g. 0.3.
+const (
+	OptionalParamsAlways    = "always"
+	OptionalParamsSometimes = "sometimes"
+	OptionalParamsNever     = "never"
+	OptionalParamsCoverage  = "coverage" // the runs of an operation alternate between sending them all and none
+)
+
+// The policies of generating the optional properties of the objects. With never, only the required properties and
+// the ones with a meqa tag, which link the objects, are generated.
+const (
+	OptionalPropsAlways = "always"
+	OptionalPropsNever  = "never"
+)
+
+// hasClassTag returns whether the property has a meqa tag naming a class, which links it to another object.
+func hasClassTag(s *spec.Schema) bool {
+	tag := mqswag.GetTag(s)
+	return tag != nil && len(tag.Class) > 0
+}
+
+// checkOptionalProps returns an error if the optionalProperties policy isn't valid.
+func checkOptionalProps(policy string) error {
+	switch policy {
+	case "", OptionalPropsAlways, OptionalPropsNever:
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid optionalProperties %s, expecting always or never",
+		policy))
+}
+
+// checkOptionalParams returns an error if the optionalParams policy isn't valid.
+func checkOptionalParams(policy string) error {
+	switch policy {
+	case "", OptionalParamsAlways, OptionalParamsSometimes, OptionalParamsNever, OptionalParamsCoverage:
+		return nil
+	}
+	if p, err := strconv.ParseFloat(policy, 64); err == nil && p >= 0 && p <= 1 {
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+		"invalid optionalParams %s, expecting always, sometimes, never, coverage or a probability between 0 and 1", policy))
+}
+
+// countOptionalRun returns how many times the test's operation resolved its parameters before in the plan with
+// the coverage policy, and counts this time.
+func (t *Test) countOptionalRun() int {
+	if t.suite == nil || t.suite.plan == nil {
+		return 0
+	}
+	plan := t.suite.plan
+	plan.optionalMutex.Lock()
+	defer plan.optionalMutex.Unlock()
+	if plan.optionalRuns == nil {
+		plan.optionalRuns = make(map[string]int)
+	}
+	key := t.Method + " " + t.Path
+	n := plan.optionalRuns[key]
+	plan.optionalRuns[key] = n + 1
+	return n
+}
+
+// includeOptional decides whether to send an optional parameter the test doesn't provide, according to the
+// test's optionalParams policy. Without a policy they are always sent.
+func (t *Test) includeOptional() bool {
+	switch t.OptionalParams {
+	case "", OptionalParamsAlways:
+		return true
+	case OptionalParamsNever:
+		return false
+	case OptionalParamsSometimes:
+		return random.Intn(2) == 0
+	case OptionalParamsCoverage:
+		return !t.omitOptional
+	}
+	p, _ := strconv.ParseFloat(t.OptionalParams, 64)
+	return random.Float64() < p
+}
+
+// The policies for the deprecated operations.
+const (
+	DeprecatedSkip = "skip" // leave them out of the generated plans, and skip the tests that call them
+	DeprecatedWarn = "warn" // test them, with a warning in the results
+	DeprecatedTest = "test" // test them like the other operations
+)
+
+// Deprecated is the policy for the deprecated operations when generating plans, and when running the plans
+// that don't set their own.
+var Deprecated = DeprecatedTest
+
+// CheckDeprecated returns an error if the deprecated policy isn't valid.
+func CheckDeprecated(policy string) error {
+	switch policy {
+	case "", DeprecatedSkip, DeprecatedWarn, DeprecatedTest:
+		return nil
+	}
+	return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+		"invalid deprecated %s, expecting skip, warn or test", policy))
+}
+
+// SetDeprecated checks the policy and makes it the default one. skipDeprecated is the shorthand for the skip
+// policy, and takes precedence over the policy given.
+func SetDeprecated(policy string, skipDeprecated bool) error {
+	if err := CheckDeprecated(policy); err != nil {
+		return err
+	}
+	if skipDeprecated {
+		policy = DeprecatedSkip
+	}
+	if len(policy) == 0 {
+		policy = DeprecatedTest
+	}
+	Deprecated = policy
+	return nil
+}
+
+// deprecatedPolicy returns the test's policy for the deprecated operations, or the default one.
+func (t *Test) deprecatedPolicy() string {
+	if len(t.Deprecated) > 0 {
+		return t.Deprecated
+	}
+	return Deprecated
+}
+
 func generateEnum(e []interface{}) (interface{}, error) {
-	return e[rand.Intn(len(e))], nil
+	if len(e) == 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, "can't generate a value from an empty enum")
+	}
+	// The enum values may be objects or arrays. Copy the one picked, so changing the generated value doesn't
+	// change the spec.
+	return mqutil.InterfaceCopy(e[random.Intn(len(e))]), nil
 }
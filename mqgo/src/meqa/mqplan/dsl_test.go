@@ -0,0 +1,1853 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+)
+
+func TestGenerateEnum(t *testing.T) {
+	v, err := generateEnum([]interface{}{"available"})
+	if err != nil || v != "available" {
+		t.Errorf("expecting available, got %v, err %v", v, err)
+	}
+
+	v, err = generateEnum([]interface{}{})
+	if err == nil {
+		t.Fatalf("expecting an error for empty enum, got %v", v)
+	}
+	if e, ok := err.(mqutil.Error); !ok || e.Type() != mqutil.ErrInvalid {
+		t.Errorf("expecting ErrInvalid, got %v", err)
+	}
+}
+
+const petSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {},
+	"definitions": {
+		"Cat": {"type": "object", "required": ["meow"], "properties": {"meow": {"type": "string"}}},
+		"Dog": {"type": "object", "required": ["bark"], "properties": {"bark": {"type": "integer"}}},
+		"Pet": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]},
+		"Pets": {"type": "array", "items": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]}}
+	}
+}`
+
+func createPetTest(t *testing.T) (*Test, *mqswag.DB) {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(petSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	test := &Test{Method: mqswag.MethodPost}
+	test.suite = &TestSuite{db: db}
+	test.db = db
+	test.comparisons = make(map[string]([]*Comparison))
+	return test, db
+}
+
+func TestGenerateOneOf(t *testing.T) {
+	test, db := createPetTest(t)
+	pet := (*spec.Schema)(db.Swagger.FindSchemaByName("Pet"))
+	for i := 0; i < 10; i++ {
+		obj, err := test.GenerateSchema("", nil, pet, db, 0)
+		if err != nil {
+			t.Fatalf("generating oneOf failed: %v", err)
+		}
+		if !db.GetSchema("Pet").Matches(obj, false, db.Swagger) {
+			t.Errorf("generated object %v doesn't match", obj)
+		}
+	}
+	if len(test.comparisons["Cat"])+len(test.comparisons["Dog"]) != 10 {
+		t.Errorf("generated objects aren't filed under Cat or Dog: %v", test.comparisons)
+	}
+
+	// The tag picks the branch.
+	test.comparisons = make(map[string]([]*Comparison))
+	obj, err := test.GenerateSchema("", &mqswag.MeqaTag{Class: "Dog"}, pet, db, 0)
+	if err != nil || !db.GetSchema("Dog").Matches(obj, false, db.Swagger) || len(test.comparisons["Dog"]) != 1 {
+		t.Errorf("expecting a Dog, got %v, err %v", obj, err)
+	}
+}
+
+func TestGenerateOneOfInArray(t *testing.T) {
+	test, db := createPetTest(t)
+	pets := (*spec.Schema)(db.Swagger.FindSchemaByName("Pets"))
+	obj, err := test.GenerateSchema("", nil, pets, db, 0)
+	if err != nil {
+		t.Fatalf("generating array of oneOf failed: %v", err)
+	}
+	if !db.GetSchema("Pets").Matches(obj, false, db.Swagger) {
+		t.Errorf("generated array %v doesn't match", obj)
+	}
+	if len(test.comparisons["Cat"])+len(test.comparisons["Dog"]) != len(obj.([]interface{})) {
+		t.Errorf("array entries aren't filed under Cat or Dog: %v", test.comparisons)
+	}
+}
+
+const strictSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {"/pet": {"get": {"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}}}},
+	"definitions": {
+		"Cat": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "meow": {"type": "string"}}},
+		"Dog": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}, "bark": {"type": "integer"}}},
+		"Pet": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]}
+	}
+}`
+
+func TestStrictOneOf(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "rex"}`))
+	}))
+	defer server.Close()
+
+	// The response matches both the oneOf schemas, which is a mismatch in the tests that are strict.
+	cases := map[string]bool{
+		"":                 false,
+		"  strict: true\n": true,
+	}
+	tests := map[string]string{
+		"- name: getPet\n  path: /pet\n  method: get\n":                                    "",
+		"- name: getPet\n  path: /pet\n  method: get\n  strict: true\n":                    "test",
+		"- name: meqa_init\n  strict: true\n- name: getPet\n  path: /pet\n  method: get\n": "suite",
+	}
+	for init, planStrict := range cases {
+		for suite, level := range tests {
+			plan := newTestPlan(t, strictSwagger, server.URL, init)
+			if err := plan.AddFromString("pets:\n" + suite); err != nil {
+				t.Fatalf("can't load plan: %v", err)
+			}
+			plan.Run("pets", nil)
+			strict := planStrict || len(level) > 0
+			if len(plan.resultList) != 1 || (plan.resultList[0].schemaError != nil) != strict {
+				t.Errorf("plan strict %v, %s strict: expecting a schema mismatch %v", planStrict, level, strict)
+			}
+		}
+	}
+}
+
+const headerSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "headers", "version": "1.0"},
+	"paths": {
+		"/pets": {"get": {"parameters": [{"name": "X-API-Key", "in": "header", "type": "string"}], "responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+func TestHeaderParamsCaseInsensitive(t *testing.T) {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(headerSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	plan.HeaderParams = map[string]interface{}{"x-api-key": "plan"}
+
+	tc := CreateTestSuite("headers", nil, plan)
+	tc.db = db
+	(&tc.TestParams).Copy(&TestParams{HeaderParams: map[string]interface{}{"X-Api-Key": "suite"}})
+	if len(tc.HeaderParams) != 1 || tc.HeaderParams["X-Api-Key"] != "suite" {
+		t.Errorf("suite headers should override plan headers, got %v", tc.HeaderParams)
+	}
+
+	test := &Test{Name: "getPets_1", Path: "/pets", Method: mqswag.MethodGet, suite: tc}
+	test.HeaderParams = map[string]interface{}{"x-API-KEY": "test"}
+	dup := test.Duplicate()
+	err = dup.ResolveParameters(tc)
+	if err != nil {
+		t.Fatalf("resolving parameters failed: %v", err)
+	}
+	if len(dup.HeaderParams) != 1 || dup.HeaderParams["x-API-KEY"] != "test" {
+		t.Errorf("expecting only the test's header, got %v", dup.HeaderParams)
+	}
+	if v := dup.GetParam([]string{"headerParams", "X-API-Key"}); v != "test" {
+		t.Errorf("expecting to find the header by the spec's name, got %v", v)
+	}
+
+	dup = (&Test{Name: "getPets_2", Path: "/pets", Method: mqswag.MethodGet, suite: tc}).Duplicate()
+	err = dup.ResolveParameters(tc)
+	if err != nil {
+		t.Fatalf("resolving parameters failed: %v", err)
+	}
+	if len(dup.HeaderParams) != 1 || dup.HeaderParams["X-Api-Key"] != "suite" {
+		t.Errorf("expecting only the suite's header, got %v", dup.HeaderParams)
+	}
+}
+
+const resolvedSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "resolved", "version": "1.0"},
+	"paths": {
+		"/pets/{id}": {"put": {"parameters": [
+			{"name": "id", "in": "path", "required": true, "type": "integer"},
+			{"name": "dryRun", "in": "query", "required": true, "type": "boolean"},
+			{"name": "X-Trace", "in": "header", "required": true, "type": "string"},
+			{"name": "pet", "in": "body", "required": true, "schema": {"type": "object", "required": ["name"],
+				"properties": {"name": {"type": "string"}, "tags": {"type": "array", "items": {"type": "string"}}}}}
+		], "responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+func TestResolvedParams(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(resolvedSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	tc := CreateTestSuite("resolved", nil, plan)
+	tc.db = db
+
+	test := &Test{Name: "putPet", Path: "/pets/{id}", Method: mqswag.MethodPut, suite: tc}
+	test.HeaderParams = map[string]interface{}{"X-Trace": "abc"}
+	test.BodyParams = map[string]interface{}{"tags": []interface{}{"small"}}
+	dup := test.Duplicate()
+	if err = dup.ResolveParameters(tc); err != nil {
+		t.Fatalf("resolving parameters failed: %v", err)
+	}
+
+	params := dup.ResolvedParams()
+	if params.PathParams["id"] == nil || params.PathParams["id"] != dup.ResolvedPath()["id"] {
+		t.Errorf("expecting the generated id, got %v", params.PathParams)
+	}
+	if _, ok := dup.ResolvedQuery()["dryRun"].(bool); !ok {
+		t.Errorf("expecting the generated dryRun, got %v", dup.ResolvedQuery())
+	}
+	if dup.ResolvedHeaders()["X-Trace"] != "abc" || len(dup.ResolvedForm()) != 0 {
+		t.Errorf("expecting the given header and no form, got %v, %v", dup.ResolvedHeaders(), dup.ResolvedForm())
+	}
+	body, _ := dup.ResolvedBody().(map[string]interface{})
+	if _, ok := body["name"].(string); !ok || !mqutil.DeepEquals(body["tags"], []interface{}{"small"}) {
+		t.Errorf("expecting the generated name and the given tags, got %v", body)
+	}
+
+	// The accessors return copies, and the original test isn't changed by resolving its duplicate.
+	body["tags"].([]interface{})[0] = "huge"
+	params.PathParams["id"] = "changed"
+	if !mqutil.DeepEquals(dup.BodyParams.(map[string]interface{})["tags"], []interface{}{"small"}) ||
+		dup.PathParams["id"] == "changed" {
+		t.Errorf("expecting the accessors to return copies, got %v, %v", dup.BodyParams, dup.PathParams)
+	}
+	if len(test.PathParams) != 0 || len(test.QueryParams) != 0 || len(test.BodyParams.(map[string]interface{})) != 1 {
+		t.Errorf("expecting the original test unchanged, got %v", test.TestParams)
+	}
+}
+
+func TestExpectHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Request-ID", "abc")
+	}))
+	defer server.Close()
+
+	for expected, pass := range map[string]bool{"abc": true, "xyz": false} {
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = &spec.Operation{}
+		test.Expect = map[string]interface{}{ExpectHeaders: map[string]interface{}{"x-request-id": expected}}
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if pass != (err == nil) {
+			t.Errorf("expecting header %s, pass %v, got err %v", expected, pass, err)
+		}
+	}
+}
+
+func TestExpectBodyDiff(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "rex", "owner": {"name": "ann", "age": 30}, "tag": "dog"}`))
+	}))
+	defer server.Close()
+
+	test, _ := createPetTest(t)
+	test.Method = mqswag.MethodGet
+	test.op = &spec.Operation{}
+	test.Expect = map[string]interface{}{ExpectBody: map[string]interface{}{
+		"id": 1.0, "name": "rex", "owner": map[string]interface{}{"name": "bob", "age": 30.0},
+		"color": "brown", "tag": nil}}
+	resp, err := resty.R().Get(server.URL)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	err = test.ProcessResult(resp)
+	if err == nil {
+		t.Fatal("expecting the body not to match")
+	}
+	// The message without the back trace.
+	message := mqutil.ErrorMessage(err)
+	for _, diff := range []string{`color: expected brown, missing`, `owner.name: expected bob, got ann`,
+		`tag: expected null, got dog`} {
+		if !strings.Contains(message, diff) {
+			t.Errorf("expecting %s in the error, got %s", diff, message)
+		}
+	}
+	if strings.Contains(message, "id:") || strings.Contains(message, "age") {
+		t.Errorf("expecting only the differing fields in the error, got %s", message)
+	}
+	if !strings.Contains(test.gotBody, `"age": 30`) {
+		t.Errorf("expecting the whole body to be kept, got %s", test.gotBody)
+	}
+}
+
+func TestExpectBodyMatch(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "rex", "tags": [{"name": "dog", "id": 7}, {"name": "small"}]}`))
+	}))
+	defer server.Close()
+
+	tags := func(names ...string) []interface{} {
+		var list []interface{}
+		for _, name := range names {
+			list = append(list, map[string]interface{}{"name": name})
+		}
+		return list
+	}
+	for _, c := range []struct {
+		match  string
+		body   map[string]interface{}
+		errors []string
+	}{
+		// The extra id, and the extra id of the first tag, are ignored.
+		{BodyMatchSubset, map[string]interface{}{"name": "rex", "tags": tags("dog", "small")}, nil},
+		{BodyMatchSubset, map[string]interface{}{"name": "rex", "tags": tags("dog", "big")},
+			[]string{"tags[1].name: expected big, got small"}},
+		{BodyMatchSubset, map[string]interface{}{"tags": tags("dog")}, []string{"tags: expected 1 items, got 2"}},
+		{BodyMatchSubset, map[string]interface{}{"color": "brown"}, []string{"color: expected brown, missing"}},
+		{BodyMatchExact, map[string]interface{}{"name": "rex", "tags": tags("dog", "small")},
+			[]string{"id: unexpected 1", "tags[0].id: unexpected 7"}},
+		// Without bodyMatch, the arrays aren't compared.
+		{"", map[string]interface{}{"name": "rex", "tags": tags("cat")}, nil},
+	} {
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = &spec.Operation{}
+		test.Expect = map[string]interface{}{ExpectBody: c.body}
+		if len(c.match) > 0 {
+			test.Expect[ExpectBodyMatch] = c.match
+		}
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if (err == nil) != (len(c.errors) == 0) {
+			t.Errorf("%s match of %v, expecting errors %v, got %v", c.match, c.body, c.errors, err)
+			continue
+		}
+		for _, diff := range c.errors {
+			if !strings.Contains(mqutil.ErrorMessage(err), diff) {
+				t.Errorf("expecting %s in the error, got %s", diff, mqutil.ErrorMessage(err))
+			}
+		}
+		if test.Expect[ExpectBodyMatch] != nil != (len(c.match) > 0) {
+			t.Errorf("expecting the bodyMatch to be kept in the result, got %v", test.Expect)
+		}
+	}
+
+	test, _ := createPetTest(t)
+	test.Expect = map[string]interface{}{ExpectBodyMatch: "partial"}
+	if err := test.checkMatchers(); err == nil {
+		t.Errorf("expecting an error for an unknown bodyMatch")
+	}
+}
+
+func TestExpectJSONPath(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"count": 3, "data": [{"id": 7, "name": "rex"}, {"id": 8, "name": "tom", "owner": {"id": 1}}],
+			"next.page": null}`))
+	}))
+	defer server.Close()
+
+	exists := func(b bool) interface{} { return map[string]interface{}{ExpectJSONPathExists: b} }
+	for _, c := range []struct {
+		path     string
+		expected interface{}
+		err      string
+	}{
+		{"$.count", 3, ""},
+		{"$.count", 4, "$.count: expected 4, got 3"},
+		{"$.data[0].id", exists(true), ""},
+		{"$.data[2].id", exists(true), "$.data[2].id: expected $exists true, got 0 values"},
+		{"$.data[-1]['name']", "tom", ""},
+		{"$.data[*].name", []interface{}{"rex", "tom"}, ""},
+		{"$..id", []interface{}{7, 8, 1}, ""},
+		{"$.data[0].owner", exists(false), ""},
+		{"$.data[0].owner", nil, "$.data[0].owner: expected null, missing"},
+		{"$['next.page']", exists(true), ""},
+		{"$.data[0].name", map[string]interface{}{mqutil.MatcherKey: "caseInsensitive", "value": "REX"}, ""},
+	} {
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = &spec.Operation{}
+		test.Expect = map[string]interface{}{ExpectJSONPath: map[string]interface{}{c.path: c.expected}}
+		if err := test.checkMatchers(); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.path, err)
+		}
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if len(c.err) == 0 && err != nil ||
+			len(c.err) > 0 && (err == nil || !strings.Contains(mqutil.ErrorMessage(err), c.err)) {
+			t.Errorf("%s: expecting error %q, got %v", c.path, c.err, err)
+		}
+	}
+
+	for _, path := range []string{"count", "$.data[?(@.id > 7)]", "$.data[0", "$."} {
+		test, _ := createPetTest(t)
+		test.Expect = map[string]interface{}{ExpectJSONPath: map[string]interface{}{path: 1}}
+		if err := test.checkMatchers(); err == nil {
+			t.Errorf("expecting an error for the JSONPath %s", path)
+		}
+	}
+}
+
+func TestGenerateDiscriminatorSubtype(t *testing.T) {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "animals", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"Animal": {"type": "object", "discriminator": "petType", "required": ["petType"],
+				"properties": {"name": {"type": "string"}, "petType": {"type": "string"}}},
+			"Cat": {"allOf": [{"$ref": "#/definitions/Animal"},
+				{"type": "object", "properties": {"meow": {"type": "string"}}}]},
+			"Dog": {"allOf": [{"$ref": "#/definitions/Animal"},
+				{"type": "object", "properties": {"bark": {"type": "integer"}}}]}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	test := &Test{Method: mqswag.MethodPost, db: db, suite: &TestSuite{db: db}}
+	test.comparisons = make(map[string]([]*Comparison))
+
+	animalRef := &spec.Schema{}
+	animalRef.Ref = spec.MustCreateRef("#/definitions/Animal")
+	for i := 0; i < 5; i++ {
+		obj, err := test.GenerateSchema("", nil, animalRef, db, 0)
+		if err != nil {
+			t.Fatalf("generating animal failed: %v", err)
+		}
+		objMap := obj.(map[string]interface{})
+		petType := objMap["petType"]
+		if petType != "Cat" && petType != "Dog" {
+			t.Errorf("expecting a Cat or Dog, got %v", obj)
+		}
+		if _, hasBark := objMap["bark"]; hasBark != (petType == "Dog") {
+			t.Errorf("subtype isn't generated fully: %v", obj)
+		}
+	}
+
+	obj, err := test.GenerateSchema("", &mqswag.MeqaTag{Class: "Cat"}, animalRef, db, 0)
+	if err != nil || obj.(map[string]interface{})["petType"] != "Cat" {
+		t.Errorf("expecting a Cat, got %v, err %v", obj, err)
+	}
+}
+
+func TestGenerateSkipsReadOnly(t *testing.T) {
+	for _, includeReadOnly := range []bool{false, true} {
+		test, db := createPetTest(t)
+		test.IncludeReadOnly = includeReadOnly
+		schema := spec.Schema{}
+		err := json.Unmarshal([]byte(`{"type": "object", "description": "<meqa Cat>", "properties": {
+			"id": {"type": "integer", "readOnly": true}, "meow": {"type": "string"}}}`), &schema)
+		if err != nil {
+			t.Fatalf("can't load schema: %v", err)
+		}
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		_, hasId := v.(map[string]interface{})["id"]
+		if hasId != includeReadOnly {
+			t.Errorf("includeReadOnly %v, got %v", includeReadOnly, v)
+		}
+		comps := test.comparisons["Cat"]
+		if len(comps) != 1 {
+			t.Fatalf("expecting one Cat comparison, got %v", test.comparisons)
+		}
+		if _, ok := comps[0].new["id"]; ok != includeReadOnly {
+			t.Errorf("includeReadOnly %v, got comparison %v", includeReadOnly, comps[0].new)
+		}
+	}
+}
+
+func TestGeneratePropertyCount(t *testing.T) {
+	for i := 0; i < 20; i++ {
+		test, db := createPetTest(t)
+		schema := spec.Schema{}
+		err := json.Unmarshal([]byte(`{"type": "object", "maxProperties": 2, "required": ["a", "b"], "properties": {
+			"a": {"type": "string"}, "b": {"type": "string"}, "c": {"type": "string"}, "d": {"type": "string"}}}`), &schema)
+		if err != nil {
+			t.Fatalf("can't load schema: %v", err)
+		}
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj := v.(map[string]interface{})
+		_, hasA := obj["a"]
+		_, hasB := obj["b"]
+		if len(obj) != 2 || !hasA || !hasB {
+			t.Errorf("expecting only the required properties within maxProperties, got %v", obj)
+		}
+
+		schema = spec.Schema{}
+		err = json.Unmarshal([]byte(`{"type": "object", "minProperties": 3, "properties": {"a": {"type": "string"}},
+			"additionalProperties": {"type": "integer", "minimum": 1, "maximum": 9}}`), &schema)
+		if err != nil {
+			t.Fatalf("can't load schema: %v", err)
+		}
+		v, err = test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj = v.(map[string]interface{})
+		if len(obj) != 3 {
+			t.Fatalf("expecting extra properties to reach minProperties, got %v", obj)
+		}
+		for k, value := range obj {
+			if _, isString := value.(string); k != "a" && isString {
+				t.Errorf("expecting the extra properties of the additionalProperties type, got %v", obj)
+			}
+		}
+
+		for _, bounds := range []string{`"minProperties": 2, "maxProperties": 4,`, ""} {
+			schema = spec.Schema{}
+			err = json.Unmarshal([]byte(`{"type": "object", `+bounds+` "additionalProperties": {"type": "string"}}`), &schema)
+			if err != nil {
+				t.Fatalf("can't load schema: %v", err)
+			}
+			v, err = test.GenerateSchema("labels_", nil, &schema, db, 0)
+			if err != nil {
+				t.Fatalf("generating failed: %v", err)
+			}
+			obj = v.(map[string]interface{})
+			low, high := 1, 3
+			if len(bounds) > 0 {
+				low, high = 2, 4
+			}
+			if len(obj) < low || len(obj) > high {
+				t.Errorf("expecting the map to have between minProperties and maxProperties keys, got %v", obj)
+			}
+			for k := range obj {
+				if !strings.HasPrefix(k, "labels_") {
+					t.Errorf("expecting the keys to be named after the property, got %v", obj)
+				}
+			}
+			if !((*mqswag.Schema)(&schema)).Matches(obj, false, db.Swagger) {
+				t.Errorf("generated map %v doesn't match", obj)
+			}
+		}
+	}
+}
+
+func TestStringParamsResolveWithHistory(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	h := &TestHistory{}
+	h.Append(&Test{Name: "login", TestParams: TestParams{HeaderParams: map[string]interface{}{"token": "abc"}}})
+	h.Append(&Test{Name: "addPet", TestParams: TestParams{PathParams: map[string]interface{}{"id": 12}}})
+
+	cases := map[string]interface{}{
+		"{{addPet.pathParams.id}}":                               12,
+		"Bearer {{login.headerParams.token}}":                    "Bearer abc",
+		"{{login.headerParams.token}}-{{addPet.pathParams.id}}":  "abc-12",
+		"{{login.headerParams.token}}-{{missing.pathParams.id}}": "abc-{{missing.pathParams.id}}",
+		"no template":               nil,
+		"{{missing.pathParams.id}}": nil,
+	}
+	for str, expected := range cases {
+		if v := StringParamsResolveWithHistory(str, h); v != expected {
+			t.Errorf("%s: expecting %v, got %v", str, expected, v)
+		}
+	}
+}
+
+func TestGetParamNested(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	test := &Test{Name: "createUser", Expect: map[string]interface{}{ExpectBody: map[string]interface{}{
+		"address": map[string]interface{}{"zip": "94105"},
+		"pets":    []interface{}{map[string]interface{}{"name": "tom"}, map[string]interface{}{"name": "jerry"}},
+	}}}
+	h := &TestHistory{}
+	h.Append(test)
+
+	cases := map[string]interface{}{
+		"{{createUser.outputs.address.zip}}":  "94105",
+		"{{createUser.outputs.pets.1.name}}":  "jerry",
+		"{{createUser.outputs.pets.2.name}}":  nil,
+		"{{createUser.outputs.address.city}}": nil,
+	}
+	for str, expected := range cases {
+		if v := StringParamsResolveWithHistory(str, h); v != expected {
+			t.Errorf("%s: expecting %v, got %v", str, expected, v)
+		}
+	}
+}
+
+func TestWriteOnlyFields(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	body := `{"name": "tom"}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "users", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"User": {"type": "object", "properties": {"name": {"type": "string"},
+				"password": {"type": "string", "x-meqa-writeOnly": true}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	op := &spec.Operation{}
+	op.Responses = &spec.Responses{}
+	op.Responses.StatusCodeResponses = map[int]spec.Response{200: *spec.NewResponse().WithSchema(spec.RefSchema("#/definitions/User"))}
+
+	for _, body = range []string{`{"name": "tom"}`, `{"name": "tom", "password": "secret"}`} {
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		test := &Test{Method: mqswag.MethodPost, op: op, db: db}
+		test.suite = &TestSuite{db: db}
+		user := map[string]interface{}{"name": "tom", "password": "secret"}
+		test.comparisons = map[string]([]*Comparison){"User": {{nil, nil, user, nil}}}
+		resp, err := resty.R().Post(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		users := db.Find("User", nil, nil, mqswag.MatchAlways, -1)
+		if strings.Contains(body, "password") {
+			if err == nil || len(users) != 0 {
+				t.Errorf("expecting the returned password to fail the test, got err %v, users %v", err, users)
+			}
+			continue
+		}
+		if err != nil || len(users) != 1 || users[0].(map[string]interface{})["password"] != nil {
+			t.Errorf("expecting the user without the password in the DB, got err %v, users %v", err, users)
+		}
+	}
+}
+
+func TestCompareGetResultSkipsWriteOnly(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "users", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"User": {"type": "object", "properties": {"name": {"type": "string"},
+				"password": {"type": "string", "x-meqa-writeOnly": true}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	db.Insert("User", map[string]interface{}{"name": "tom", "age": 3, "password": "secret"}, nil)
+	users := db.Find("User", nil, nil, mqswag.MatchAlways, -1)
+	if len(users) != 1 || users[0].(map[string]interface{})["password"] != nil {
+		t.Errorf("expecting the user without the password in the DB, got %v", users)
+	}
+
+	test := &Test{Method: mqswag.MethodGet, db: db, TestSettings: TestSettings{Strict: true}}
+	test.suite = &TestSuite{db: db}
+	comp := &Comparison{}
+	comp.SetForOp(mqswag.MethodGet, "name", "tom")
+	comp.SetForOp(mqswag.MethodGet, "password", "secret")
+	test.comparisons = map[string]([]*Comparison){"User": {comp}}
+	err = test.CompareGetResult("User", nil, []interface{}{map[string]interface{}{"name": "tom", "age": 3}})
+	if err != nil {
+		t.Errorf("expecting the result to match without the password, got %v", err)
+	}
+	err = test.CompareGetResult("User", nil, []interface{}{map[string]interface{}{"name": "tom", "age": 4}})
+	if err == nil {
+		t.Error("expecting the DB object not to be found in the result")
+	}
+}
+
+func TestGenerateNullable(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	defer func(p float64) { NullProbability = p }(NullProbability)
+	NullProbability = 1
+
+	test, db := createPetTest(t)
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "required": ["color"], "properties": {
+		"nick": {"type": "string", "x-nullable": true},
+		"color": {"type": "string", "x-nullable": true},
+		"meow": {"type": "string"}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	v, err := test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	obj := v.(map[string]interface{})
+	nick, hasNick := obj["nick"]
+	if !hasNick || nick != nil || obj["color"] == nil || obj["meow"] == nil {
+		t.Errorf("expecting only the optional nullable property to be null, got %v", obj)
+	}
+
+	removeNulls(&obj, func(k string) bool { return k == "nick" })
+	if _, ok := obj["nick"]; !ok {
+		t.Errorf("expecting the null to be kept, got %v", obj)
+	}
+
+	// The items of an array can be null too, and so can the schemas using the OpenAPI 3 nullable keyword.
+	schema = spec.Schema{}
+	err = json.Unmarshal([]byte(`{"type": "array", "minItems": 2, "maxItems": 4,
+		"items": {"type": "string", "nullable": true}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	v, err = test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	ar := v.([]interface{})
+	if len(ar) < 2 {
+		t.Fatalf("expecting the array to keep its null items, got %v", ar)
+	}
+	for _, item := range ar {
+		if item != nil {
+			t.Errorf("expecting only null items, got %v", ar)
+		}
+	}
+}
+
+func TestFormatWarnings(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"born": "yesterday"}`))
+	}))
+	defer server.Close()
+
+	mqswag.CheckFormat = true
+	defer func() { mqswag.CheckFormat = false }()
+	op := &spec.Operation{}
+	op.Responses = &spec.Responses{}
+	born := spec.DateTimeProperty()
+	op.Responses.StatusCodeResponses = map[int]spec.Response{
+		200: *spec.NewResponse().WithSchema(new(spec.Schema).Typed("object", "").SetProperty("born", *born))}
+
+	for _, warnings := range []bool{false, true} {
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = op
+		test.FormatWarnings = warnings
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if warnings != (err == nil) || test.schemaError == nil && warnings {
+			t.Errorf("format warnings %v, got err %v, schema error %v", warnings, err, test.schemaError)
+		}
+	}
+}
+
+func TestResponseEnum(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	op := &spec.Operation{}
+	op.Responses = &spec.Responses{}
+	status := spec.StringProperty().WithEnum("ACTIVE", "INACTIVE")
+	op.Responses.StatusCodeResponses = map[int]spec.Response{
+		200: *spec.NewResponse().WithSchema(new(spec.Schema).Typed("object", "").SetProperty("status", *status))}
+
+	for _, c := range []struct {
+		body string
+		err  string
+	}{
+		{`{"status": "ACTIVE"}`, ""},
+		{`{"status": "ACTIV"}`, `property status: "ACTIV" is not one of the enum values ["ACTIVE","INACTIVE"]`},
+	} {
+		body = c.body
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = op
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if len(c.err) == 0 && err != nil || len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: expecting error %q, got %v", c.body, c.err, err)
+		}
+	}
+}
+
+func TestStrictDefault(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": true}`))
+	}))
+	defer server.Close()
+
+	// Only the default response is specified, and the 200 response doesn't match it.
+	op := &spec.Operation{}
+	op.Responses = &spec.Responses{}
+	op.Responses.Default = spec.NewResponse().WithSchema(
+		new(spec.Schema).Typed("object", "").SetProperty("name", *spec.StringProperty()))
+
+	for _, strict := range []bool{false, true} {
+		test, _ := createPetTest(t)
+		test.Method = mqswag.MethodGet
+		test.op = op
+		test.StrictDefault = strict
+		resp, err := resty.R().Get(server.URL)
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		err = test.ProcessResult(resp)
+		if strict != (err != nil) {
+			t.Errorf("strict default %v, got err %v", strict, err)
+		}
+		if test.schemaError == nil {
+			t.Errorf("strict default %v, expecting a schema error", strict)
+		}
+	}
+}
+
+func TestGenerateStringFormats(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	for _, format := range []string{"uuid", "email", "hostname", "ipv4", "ipv6", "phone", "uri", "byte", "date", "date-time", "unknown"} {
+		for i := 0; i < 20; i++ {
+			str, err := generateString(spec.StrFmtProperty(format), "name")
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", format, err)
+			}
+			if err := mqswag.CheckStringFormat(format, str); err != nil {
+				t.Errorf("generated an invalid %s: %v", format, err)
+			}
+			if format == "uuid" && str[14] != '4' {
+				t.Errorf("expecting a v4 uuid, got %s", str)
+			}
+			if format == "hostname" && len(str) > 253 {
+				t.Errorf("hostname %s is too long", str)
+			}
+		}
+	}
+
+	for _, format := range []string{"", "email", "hostname", "uri", "byte", "unknown"} {
+		s := spec.StrFmtProperty(format).WithMaxLength(40)
+		for i := 0; i < 20; i++ {
+			str, err := generateString(s, "averyveryverylongpropertynamethatdoesnotfit")
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", format, err)
+			}
+			if len(str) > 40 {
+				t.Errorf("%s %s is longer than maxLength", format, str)
+			}
+			if err := mqswag.CheckStringFormat(format, str); err != nil {
+				t.Errorf("generated an invalid %s: %v", format, err)
+			}
+		}
+	}
+	if _, err := generateString(spec.StrFmtProperty("uuid").WithMaxLength(10), "id"); err == nil {
+		t.Errorf("expecting an error for a uuid that can't fit in maxLength")
+	}
+}
+
+func TestGenerateStringLength(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	for _, format := range []string{"", "email", "hostname", "uri", "byte", "binary"} {
+		s := spec.StrFmtProperty(format).WithMinLength(30).WithMaxLength(40)
+		for i := 0; i < 20; i++ {
+			str, err := generateString(s, "name")
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", format, err)
+			}
+			if len(str) < 30 || len(str) > 40 {
+				t.Errorf("%s %s isn't between minLength and maxLength", format, str)
+			}
+			if err := mqswag.CheckStringFormat(format, str); err != nil {
+				t.Errorf("generated an invalid %s: %v", format, err)
+			}
+		}
+	}
+
+	// The prefix is cut before the digits.
+	str, err := generateString(spec.StringProperty().WithMaxLength(3), "averylongname")
+	if err != nil || len(str) == 0 || len(str) > 3 || !regexp.MustCompile("^(a|av)?[0-9]+$").MatchString(str) {
+		t.Errorf("expecting the prefix cut first, got %s, %v", str, err)
+	}
+
+	s := spec.StringProperty().WithPattern("^[a-z]{1,3}$").WithMinLength(5)
+	str, err = generateString(s, "code")
+	if err != nil || len(str) != 5 {
+		t.Errorf("expecting the value padded to 5 characters, got %s, %v", str, err)
+	}
+
+	for _, s := range []*spec.Schema{
+		spec.StrFmtProperty("uuid").WithMinLength(40),
+		spec.StrFmtProperty("date").WithMaxLength(8),
+		spec.StringProperty().WithMinLength(10).WithMaxLength(5),
+	} {
+		if _, err := generateString(s, "id"); err == nil {
+			t.Errorf("expecting an error for impossible length constraints")
+		}
+	}
+}
+
+func TestGeneratePatternAnchoring(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	patterns := map[string]string{
+		"[0-9]{4}":            "^[0-9]{4}$",
+		"^[a-z]{2}-[0-9]{3}$": "^[a-z]{2}-[0-9]{3}$",
+		"^price\\$[0-9]+\\$$": "^price\\$[0-9]+\\$$",
+	}
+	for pattern, whole := range patterns {
+		re := regexp.MustCompile(whole)
+		for i := 0; i < 20; i++ {
+			str, err := generateString(&spec.Schema{SchemaProps: spec.SchemaProps{Pattern: pattern}}, "code")
+			if err != nil {
+				t.Fatalf("unexpected error for %s: %v", pattern, err)
+			}
+			if !re.MatchString(str) {
+				t.Errorf("%s doesn't match the whole pattern %s", str, pattern)
+			}
+		}
+	}
+
+	s := spec.StringProperty().WithPattern("[a-z]{1,10}").WithMaxLength(5)
+	for i := 0; i < 20; i++ {
+		str, err := generateString(s, "code")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(str) == 0 || len(str) > 5 || !regexp.MustCompile("^[a-z]+$").MatchString(str) {
+			t.Errorf("expecting 1 to 5 letters, got %s", str)
+		}
+	}
+	if core := patternCore("^a\\\\$"); core != "a\\\\" {
+		t.Errorf("expecting the anchors stripped, got %s", core)
+	}
+}
+
+func TestGeneratePatternProperties(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	test, db := createPetTest(t)
+	schema := &spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "additionalProperties": false,
+		"properties": {"host": {"type": "string"}},
+		"patternProperties": {"^cpu_[a-z]+$": {"type": "number"}, "mem_[0-9]": {"type": "integer"}}}`), schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		obj, err := test.GenerateSchema("", nil, schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating the object failed: %v", err)
+		}
+		cpu, mem := 0, 0
+		for k := range obj.(map[string]interface{}) {
+			if strings.HasPrefix(k, "cpu_") {
+				cpu++
+			} else if strings.HasPrefix(k, "mem_") {
+				mem++
+			}
+		}
+		if cpu < 1 || cpu > 2 || mem < 1 || mem > 2 {
+			t.Errorf("expecting one or two keys for each pattern, got %v", obj)
+		}
+		if !((*mqswag.Schema)(schema)).Matches(obj, false, db.Swagger) {
+			t.Errorf("generated object %v doesn't match", obj)
+		}
+	}
+}
+
+func TestGenerateInt(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	cases := []struct {
+		format       string
+		min, max     *float64
+		exMin, exMax bool
+		low, high    int64
+		fails        bool
+	}{
+		{"", nil, nil, false, false, 0, 1000000, false},
+		{"int32", nil, nil, false, false, 0, 1000000, false},
+		{"", f(5), nil, false, false, 5, 1000005, false},
+		{"", f(5), nil, true, false, 6, 1000006, false},
+		{"", nil, f(-5), false, false, -1000005, -5, false},
+		{"", nil, f(-5), false, true, -1000006, -6, false},
+		{"", f(1), f(2), false, false, 1, 2, false},
+		{"", f(1), f(2), true, false, 2, 2, false},
+		{"", f(1), f(2), false, true, 1, 1, false},
+		{"", f(1), f(3), true, true, 2, 2, false},
+		{"", f(1), f(2), true, true, 0, 0, true},
+		{"", f(3), f(2), false, false, 0, 0, true},
+		{"", f(0.5), f(2.5), true, true, 1, 2, false},
+		{"int32", f(2147483600), nil, false, false, 2147483600, math.MaxInt32, false},
+		{"int32", f(-1e12), f(1e12), false, false, math.MinInt32, math.MaxInt32, false},
+		{"int32", f(3e9), nil, false, false, 0, 0, true},
+		{"int64", f(-9.3e18), f(9.3e18), false, false, math.MinInt64, math.MaxInt64, false},
+		{"int64", f(1 << 60), f(1<<60 + 512), false, false, 1 << 60, 1<<60 + 512, false},
+		{"int64", nil, f(9.3e18), false, true, math.MaxInt64 - 1000000, math.MaxInt64, false},
+	}
+	for i, c := range cases {
+		s := &spec.Schema{}
+		s.Format, s.Minimum, s.Maximum, s.ExclusiveMinimum, s.ExclusiveMaximum = c.format, c.min, c.max, c.exMin, c.exMax
+		for j := 0; j < 200; j++ {
+			v, err := generateInt(s)
+			if c.fails {
+				if err == nil {
+					t.Errorf("case %d: expecting an error, got %d", i, v)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("case %d: unexpected error %v", i, err)
+			}
+			if v < c.low || v > c.high {
+				t.Fatalf("case %d: %d is out of [%d, %d]", i, v, c.low, c.high)
+			}
+		}
+		if s.Minimum != c.min || s.Maximum != c.max {
+			t.Errorf("case %d: the schema's bounds were changed", i)
+		}
+	}
+}
+
+func TestGenerateObjectEnum(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	test, db := createPetTest(t)
+	schema := &spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {"config": {"type": "object",
+		"enum": [{"mode": "fast", "level": 1}]}, "steps": {"type": "array", "items": {"type": "integer"},
+		"enum": [[1, 2, 3]]}}, "required": ["config", "steps"]}`), schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		obj, err := test.GenerateSchema("", nil, schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating the enums failed: %v", err)
+		}
+		if !(*mqswag.Schema)(schema).Matches(obj, false, db.Swagger) {
+			t.Errorf("generated object %v doesn't match", obj)
+		}
+		// The server echoes the object back, with the numbers as json.Number.
+		body, _ := json.Marshal(obj)
+		decoder := json.NewDecoder(strings.NewReader(string(body)))
+		decoder.UseNumber()
+		var echoed interface{}
+		decoder.Decode(&echoed)
+		if !mqutil.InterfaceEquals(obj, echoed) || !(*mqswag.Schema)(schema).Matches(echoed, false, db.Swagger) {
+			t.Errorf("expecting %v to match the echoed %v", obj, echoed)
+		}
+
+		// Changing the generated values doesn't change the enums in the spec.
+		m := obj.(map[string]interface{})
+		m["config"].(map[string]interface{})["mode"] = "changed"
+		m["steps"].([]interface{})[0] = 100
+	}
+	if config := schema.Properties["config"].Enum[0].(map[string]interface{}); config["mode"] != "fast" {
+		t.Errorf("expecting the enum in the spec unchanged, got %v", config)
+	}
+	if steps := schema.Properties["steps"].Enum[0].([]interface{}); steps[0] != 1.0 {
+		t.Errorf("expecting the enum in the spec unchanged, got %v", steps)
+	}
+}
+
+func TestGenerateMultipleOf(t *testing.T) {
+	f := func(v float64) *float64 { return &v }
+	cases := []struct {
+		typ          string
+		multipleOf   float64
+		min, max     *float64
+		exMin, exMax bool
+		low, high    float64
+		fails        bool
+	}{
+		{"integer", 5, nil, nil, false, false, 0, 1000000, false},
+		{"integer", 5, f(-12), f(10), true, true, -10, 5, false},
+		{"integer", 5, f(-10), f(10), true, true, -5, 5, false},
+		{"integer", 5, f(1), f(4), false, false, 0, 0, true},
+		{"integer", 5, f(5), f(10), true, true, 0, 0, true},
+		{"integer", 1.5, f(1), f(4), false, false, 3, 3, false},
+		{"integer", 0.5, f(-3), f(3), false, false, -3, 3, false},
+		{"number", 0.01, nil, nil, false, false, -1, 1, false},
+		{"number", 0.01, f(0), f(0.05), true, true, 0.01, 0.04, false},
+		{"number", 0.1, f(0.3), f(0.5), true, true, 0.4, 0.4, false},
+		{"number", 0.1, f(0.3), f(0.4), true, true, 0, 0, true},
+		{"number", 5, f(1), nil, false, false, 5, 505, false},
+		{"number", 5, nil, f(-1), false, true, -505, -5, false},
+		{"number", 5, f(1), f(4), false, false, 0, 0, true},
+	}
+	for i, c := range cases {
+		s := new(spec.Schema).Typed(c.typ, "")
+		s.MultipleOf, s.Minimum, s.Maximum, s.ExclusiveMinimum, s.ExclusiveMaximum = &c.multipleOf, c.min, c.max, c.exMin, c.exMax
+		for j := 0; j < 200; j++ {
+			var v float64
+			var err error
+			if c.typ == "integer" {
+				var n int64
+				n, err = generateInt(s)
+				v = float64(n)
+			} else {
+				v, err = generateFloat(s)
+			}
+			if c.fails {
+				if err == nil {
+					t.Errorf("case %d: expecting an error, got %v", i, v)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("case %d: unexpected error %v", i, err)
+			}
+			if v < c.low || v > c.high {
+				t.Fatalf("case %d: %v is out of [%v, %v]", i, v, c.low, c.high)
+			}
+			if !mqswag.IsMultipleOf(v, c.multipleOf) {
+				t.Fatalf("case %d: %v is not a multiple of %v", i, v, c.multipleOf)
+			}
+			if text := strconv.FormatFloat(v, 'f', -1, 64); c.multipleOf == 0.01 && len(text) > 5 {
+				t.Fatalf("case %d: %s has too many decimals", i, text)
+			}
+		}
+	}
+}
+
+func TestCollectionFormat(t *testing.T) {
+	var query, form url.Values
+	var header http.Header
+	var path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		query = r.URL.Query()
+		form = r.PostForm
+		header = r.Header
+		path = r.URL.Path
+	}))
+	defer server.Close()
+
+	test, _ := createPetTest(t)
+	test.op = &spec.Operation{}
+	for _, format := range []string{"", "csv", "ssv", "tsv", "pipes", "multi"} {
+		p := spec.QueryParam("q"+format).CollectionOf(spec.NewItems().Typed("string", ""), format)
+		test.op.Parameters = append(test.op.Parameters, *p)
+	}
+	test.op.Parameters = append(test.op.Parameters,
+		*spec.FormDataParam("tags").CollectionOf(spec.NewItems().Typed("string", ""), "multi"),
+		*spec.FormDataParam("ids").CollectionOf(spec.NewItems().Typed("integer", ""), "pipes"),
+		*spec.PathParam("names").CollectionOf(spec.NewItems().Typed("string", ""), "pipes"),
+		*spec.HeaderParam("X-Tags").CollectionOf(spec.NewItems().Typed("string", ""), "ssv"))
+	abc := []interface{}{"a", "b", "c"}
+	test.Path = "/pets/{names}"
+	test.PathParams = map[string]interface{}{"names": abc}
+	test.HeaderParams = map[string]interface{}{"x-tags": abc, "X-Ids": []interface{}{1, 2}}
+	test.QueryParams = map[string]interface{}{
+		"q": abc, "qcsv": abc, "qssv": abc, "qtsv": abc, "qpipes": abc, "qmulti": abc, "other": "x"}
+	test.FormParams = map[string]interface{}{"tags": abc, "ids": []interface{}{1, 2}}
+
+	req := resty.R()
+	reqPath := test.SetRequestParameters(req)
+	if _, err := req.Post(server.URL + reqPath); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	expected := map[string][]string{
+		"q": {"a,b,c"}, "qcsv": {"a,b,c"}, "qssv": {"a b c"}, "qtsv": {"a\tb\tc"}, "qpipes": {"a|b|c"},
+		"qmulti": {"a", "b", "c"}, "other": {"x"}}
+	for k, v := range expected {
+		if strings.Join(query[k], ";") != strings.Join(v, ";") {
+			t.Errorf("query param %s: expecting %q, got %q", k, v, query[k])
+		}
+	}
+	if strings.Join(form["tags"], ";") != "a;b;c" || strings.Join(form["ids"], ";") != "1|2" {
+		t.Errorf("unexpected form data %v", form)
+	}
+	if path != "/pets/a|b|c" {
+		t.Errorf("expecting the path param joined with pipes, got %s", path)
+	}
+	if header.Get("X-Tags") != "a b c" || header.Get("X-Ids") != "1,2" {
+		t.Errorf("expecting the headers joined per their collectionFormat, got %v", header)
+	}
+}
+
+const formArraySwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "form arrays", "version": "1.0"},
+	"paths": {
+		"/pets": {"post": {
+			"consumes": ["multipart/form-data"],
+			"parameters": [
+				{"name": "tags", "in": "formData", "type": "array", "collectionFormat": "multi", "required": true,
+					"items": {"type": "string"}, "description": "<meqa Pet.tags>"},
+				{"name": "ids", "in": "formData", "type": "array", "collectionFormat": "pipes", "required": true,
+					"items": {"type": "integer"}, "description": "<meqa Pet.ids>"},
+				{"name": "photo", "in": "formData", "type": "file", "required": true}],
+			"responses": {"200": {"description": "ok"}}}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "properties": {
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"ids": {"type": "array", "items": {"type": "integer"}}}}
+	}
+}`
+
+func TestFormArrayParams(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var form map[string][]string
+	var photo string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ParseMultipartForm(1<<20) != nil {
+			return
+		}
+		form = r.MultipartForm.Value
+		if files := r.MultipartForm.File["photo"]; len(files) > 0 {
+			photo = files[0].Filename
+		}
+	}))
+	defer server.Close()
+
+	file, err := ioutil.TempFile("", "photo")
+	if err != nil {
+		t.Fatalf("can't create the file: %v", err)
+	}
+	file.WriteString("not really a photo")
+	file.Close()
+	defer os.Remove(file.Name())
+
+	swagger := &mqswag.Swagger{}
+	err = json.Unmarshal([]byte(formArraySwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	tc := CreateTestSuite("forms", nil, plan)
+	tc.db = db
+
+	test := &Test{Name: "postPets", Path: "/pets", Method: mqswag.MethodPost, suite: tc}
+	test.FormParams = map[string]interface{}{"photo": file.Name(), "ids": "1|2|3"}
+	dup := test.Duplicate()
+	if err = dup.ResolveParameters(tc); err != nil {
+		t.Fatalf("resolving parameters failed: %v", err)
+	}
+	req := resty.R()
+	path := dup.SetRequestParameters(req)
+	if _, err = req.Post(server.URL + path); err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+
+	tags, _ := dup.FormParams["tags"].([]interface{})
+	if len(tags) == 0 || len(form["tags"]) != len(tags) {
+		t.Errorf("expecting the tags %v as repeated fields, got %v", tags, form)
+	}
+	if strings.Join(form["ids"], ";") != "1|2|3" {
+		t.Errorf("expecting the ids as given, got %v", form["ids"])
+	}
+	if len(photo) == 0 || dup.FormParams["photo"] != file.Name() {
+		t.Errorf("expecting the photo to be uploaded along with the fields, got %q", photo)
+	}
+
+	// The comparison has the individual values, not the serialized ones.
+	comps := dup.comparisons["Pet"]
+	if len(comps) != 1 {
+		t.Fatalf("expecting one Pet comparison, got %v", comps)
+	}
+	compTags, _ := comps[0].new["tags"].([]interface{})
+	if len(compTags) != len(tags) || compTags[0] != tags[0] {
+		t.Errorf("expecting the tags %v in the comparison, got %v", tags, comps[0].new["tags"])
+	}
+	compIds, _ := comps[0].new["ids"].([]interface{})
+	if len(compIds) != 3 || compIds[0] != float64(1) || compIds[2] != float64(3) {
+		t.Errorf("expecting the ids split in the comparison, got %v", comps[0].new["ids"])
+	}
+}
+
+// nestedTreeSchema returns an object schema with a children array of the same object, nested depth times.
+func nestedTreeSchema(depth int) string {
+	node := `{"type": "object", "properties": {"name": {"type": "string"}}}`
+	for i := 0; i < depth; i++ {
+		node = `{"type": "object", "properties": {"name": {"type": "string"},
+			"children": {"type": "array", "minItems": 0, "maxItems": 10, "items": ` + node + `}}}`
+	}
+	return node
+}
+
+func countNodes(v interface{}) int {
+	n := 1
+	switch o := v.(type) {
+	case map[string]interface{}:
+		for _, e := range o {
+			n += countNodes(e)
+		}
+	case []interface{}:
+		for _, e := range o {
+			n += countNodes(e)
+		}
+	}
+	return n
+}
+
+func TestGenerationCap(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	test, db := createPetTest(t)
+	schema := &spec.Schema{}
+	if err := json.Unmarshal([]byte(nestedTreeSchema(5)), schema); err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+
+	test.suite.plan = &TestPlan{TestSettings: TestSettings{MaxNodes: 50}}
+	for i := 0; i < 10; i++ {
+		test.genNodes, test.genCapped = 0, false
+		obj, err := test.GenerateSchema("", nil, schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating the tree failed: %v", err)
+		}
+		if n := countNodes(obj); n > 50 {
+			t.Errorf("expecting at most 50 nodes, got %d", n)
+		}
+	}
+
+	// Past maxDepth the objects only have their required properties, none here.
+	test.suite.plan = &TestPlan{TestSettings: TestSettings{MaxDepth: 2}}
+	test.genNodes, test.genCapped = 0, false
+	obj, err := test.GenerateSchema("", nil, schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating the tree failed: %v", err)
+	}
+	children, _ := obj.(map[string]interface{})["children"].([]interface{})
+	for _, c := range children {
+		if len(c.(map[string]interface{})) != 0 {
+			t.Errorf("expecting the children past depth 2 to be empty, got %v", c)
+		}
+	}
+}
+
+const cycleSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "cycles", "version": "1.0"},
+	"paths": {},
+	"definitions": {
+		"A": {"type": "object", "required": ["name"], "properties": {
+			"name": {"type": "string"},
+			"b": {"allOf": [{"$ref": "#/definitions/B"}]}}},
+		"B": {"type": "object", "properties": {
+			"a": {"allOf": [{"$ref": "#/definitions/A"}]},
+			"owner": {"oneOf": [{"$ref": "#/definitions/A"}], "x-nullable": true},
+			"friends": {"type": "array", "items": {"allOf": [{"$ref": "#/definitions/A"}]}}}}
+	}
+}`
+
+func TestGenerateRefCycle(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(cycleSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	test := &Test{Method: mqswag.MethodPost}
+	test.suite = &TestSuite{db: db}
+	test.db = db
+	test.comparisons = make(map[string]([]*Comparison))
+
+	schema := spec.RefSchema("#/definitions/A")
+	obj, err := test.GenerateSchema("", nil, schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating A failed: %v", err)
+	}
+	b, ok := obj.(map[string]interface{})["b"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("expecting A to have a B, got %v", obj)
+	}
+	if _, exist := b["a"]; exist {
+		t.Errorf("expecting B.a to be left out, got %v", b)
+	}
+	if owner, exist := b["owner"]; !exist || owner != nil {
+		t.Errorf("expecting the nullable B.owner to be null, got %v", b)
+	}
+	if friends, _ := b["friends"].([]interface{}); friends == nil || len(friends) != 0 {
+		t.Errorf("expecting B.friends to be empty, got %v", b["friends"])
+	}
+
+	// The cap on the nesting stops where the cycle detection doesn't look.
+	test.suite.plan = &TestPlan{PlanSettings: PlanSettings{MaxRecursion: 3}}
+	obj, err = test.GenerateSchema("", nil, schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating A failed: %v", err)
+	}
+	if a := obj.(map[string]interface{}); len(a) != 1 || a["name"] == nil {
+		t.Errorf("expecting only the name of A, got %v", a)
+	}
+}
+
+func TestGenerateFromOpenAPI3(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	defer server.Close()
+
+	doc, err := mqswag.ConvertOpenAPI3([]byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"servers": [{"url": "` + server.URL + `/v1"}],
+		"paths": {"/pets": {"post": {
+			"requestBody": {"content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}},
+			"responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}}}},
+		"components": {"schemas": {"Pet": {"type": "object", "required": ["name"],
+			"properties": {"name": {"type": "string"}, "age": {"type": "integer", "minimum": 1, "maximum": 20}}}}}
+	}`))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	swagger := &mqswag.Swagger{}
+	if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load the converted document: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	if err = plan.AddFromString("pets:\n- name: addPet\n  path: /pets\n  method: post\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	if _, err = plan.Run("pets", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if body == nil || body["name"] == nil || !db.GetSchema("Pet").Matches(body, false, swagger) {
+		t.Errorf("expecting a generated Pet in the request, got %v", body)
+	}
+}
+
+func TestUseDefaults(t *testing.T) {
+	test, db := createPetTest(t)
+	limit := spec.QueryParam("limit").Typed("integer", "").WithDefault(20)
+	sort := spec.QueryParam("sort").Typed("string", "").WithDefault("name").WithEnum("name", "age")
+	item := spec.StringProperty().WithDefault("cat")
+	schema := new(spec.Schema).Typed("object", "").
+		SetProperty("kind", *spec.StringProperty().WithDefault("pet")).
+		SetProperty("tags", *spec.ArrayProperty(item))
+
+	test.UseDefaults = UseDefaultsAlways
+	for i := 0; i < 10; i++ {
+		if v, _ := test.GenerateParameter(limit, db); v != 20 {
+			t.Errorf("expecting the default 20, got %v", v)
+		}
+		if v, _ := test.GenerateParameter(sort, db); v != "name" {
+			t.Errorf("expecting the default name, got %v", v)
+		}
+		obj, err := test.GenerateSchema("", nil, schema, db, 0)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		m := obj.(map[string]interface{})
+		if m["kind"] != "pet" {
+			t.Errorf("expecting the default of the property, got %v", m)
+		}
+		for _, tag := range m["tags"].([]interface{}) {
+			if tag != "cat" {
+				t.Errorf("expecting the default of the array items, got %v", m)
+			}
+		}
+	}
+
+	test.UseDefaults = UseDefaultsNever
+	randomized := false
+	for i := 0; i < 10; i++ {
+		if v, _ := test.GenerateParameter(limit, db); v != 20 {
+			randomized = true
+		}
+	}
+	if !randomized {
+		t.Errorf("expecting random values when the defaults aren't used")
+	}
+}
+
+func TestTagFlags(t *testing.T) {
+	var log strings.Builder
+	mqutil.NewLogger(&log)
+	defer mqutil.NewLogger(ioutil.Discard)
+
+	for _, c := range []struct {
+		desc        string
+		compared    bool
+		missingLogs bool
+	}{
+		{"<meqa Cat.meow>", true, true},
+		{"<meqa Cat.meow.get.nocompare>", false, true},
+		{"<meqa Cat.meow.get.weak,nocompare>", false, false},
+		{"<meqa Cat.meow weak>", true, false},
+	} {
+		test, db := createPetTest(t)
+		test.Name = "getCat"
+		log.Reset()
+		param := spec.QueryParam("meow").Typed("string", "")
+		param.Description = c.desc
+		if _, err := test.GenerateParameter(param, db); err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.desc, err)
+		}
+		if (len(test.comparisons["Cat"]) > 0) != c.compared {
+			t.Errorf("%s: expecting compared %v, got %v", c.desc, c.compared, test.comparisons)
+		}
+		if strings.Contains(log.String(), "no Cat in the DB") != c.missingLogs {
+			t.Errorf("%s: expecting the missing Cat logged %v, got %s", c.desc, c.missingLogs, log.String())
+		}
+
+		// With a Cat in the DB, its value is used, and only compared without nocompare.
+		db.Insert("Cat", map[string]interface{}{"meow": "purr"}, nil)
+		test.comparisons = make(map[string]([]*Comparison))
+		if v, _ := test.GenerateParameter(param, db); v != "purr" {
+			t.Errorf("%s: expecting the Cat's value, got %v", c.desc, v)
+		}
+		if (len(test.comparisons["Cat"]) > 0) != c.compared {
+			t.Errorf("%s: expecting compared %v with a Cat, got %v", c.desc, c.compared, test.comparisons)
+		}
+	}
+}
+
+func TestArraySize(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	unconstrained := spec.ArrayProperty(spec.StringProperty())
+	constrained := spec.ArrayProperty(spec.StringProperty()).WithMaxItems(1)
+	for _, c := range []struct {
+		size     string
+		min, max int
+	}{{"3", 3, 3}, {"2-4", 2, 4}} {
+		test, db := createPetTest(t)
+		plan := &TestPlan{}
+		plan.Init(db.Swagger, db)
+		if err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  arraySize: " + c.size + "\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		test.suite.plan = plan
+		for i := 0; i < 20; i++ {
+			v, err := test.GenerateSchema("tags", nil, unconstrained, db, 0)
+			if n := len(v.([]interface{})); err != nil || n < c.min || n > c.max {
+				t.Errorf("arraySize %s, got %d items, err %v", c.size, n, err)
+			}
+			// The schema's maxItems wins.
+			v, err = test.GenerateSchema("tags", nil, constrained, db, 0)
+			if n := len(v.([]interface{})); err != nil || n != 1 {
+				t.Errorf("expecting maxItems to win over arraySize %s, got %d items, err %v", c.size, n, err)
+			}
+		}
+	}
+
+	for _, size := range []string{"0", "5-2", "many"} {
+		plan := &TestPlan{}
+		test, db := createPetTest(t)
+		plan.Init(test.db.Swagger, db)
+		if err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  arraySize: " + size + "\n"); err == nil {
+			t.Errorf("expecting an error for arraySize %s", size)
+		}
+	}
+}
+
+func TestGenerateNumericExclusiveBounds(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	doc, err := mqswag.ConvertOpenAPI3([]byte(`{
+		"openapi": "3.1.0",
+		"info": {"title": "bounds", "version": "1.0"},
+		"paths": {},
+		"components": {"schemas": {"Rating": {"type": "object", "required": ["stars", "weight"], "properties": {
+			"stars": {"type": "integer", "exclusiveMinimum": 0, "exclusiveMaximum": 3},
+			"weight": {"type": "number", "exclusiveMinimum": 0, "maximum": 1}}}}}
+	}`))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	swagger := &mqswag.Swagger{}
+	if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load the converted document: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	test := &Test{db: db, suite: &TestSuite{db: db}, comparisons: make(map[string]([]*Comparison))}
+	rating := (*spec.Schema)(swagger.FindSchemaByName("Rating"))
+	for i := 0; i < 50; i++ {
+		v, err := test.GenerateSchema("", nil, rating, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj := v.(map[string]interface{})
+		if stars := obj["stars"].(int64); stars != 1 && stars != 2 {
+			t.Errorf("expecting stars within the exclusive bounds 0 and 3, got %d", stars)
+		}
+		if weight := obj["weight"].(float64); weight <= 0 || weight > 1 {
+			t.Errorf("expecting a weight above the exclusive minimum 0, got %v", weight)
+		}
+	}
+}
+
+func TestGenerationSizes(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	test, db := createPetTest(t)
+	plan := &TestPlan{}
+	plan.Init(db.Swagger, db)
+	if err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  stringLength: 30-40\n  numberRange: 5-10\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	test.suite.plan = plan
+	for i := 0; i < 20; i++ {
+		v, err := test.GenerateSchema("name", nil, spec.StringProperty(), db, 0)
+		if n := len(v.(string)); err != nil || n < 30 || n > 40 {
+			t.Errorf("stringLength 30-40, got %v, err %v", v, err)
+		}
+		// The schema's maxLength narrows the range, and the patterns keep their own lengths.
+		v, err = test.GenerateSchema("name", nil, spec.StringProperty().WithMaxLength(32), db, 0)
+		if n := len(v.(string)); err != nil || n < 30 || n > 32 {
+			t.Errorf("expecting maxLength 32 to narrow stringLength, got %v, err %v", v, err)
+		}
+		v, err = test.GenerateSchema("code", nil, spec.StringProperty().WithPattern("^[a-z]{3}$"), db, 0)
+		if err != nil || len(v.(string)) != 3 {
+			t.Errorf("expecting the pattern to win over stringLength, got %v, err %v", v, err)
+		}
+		v, err = test.GenerateSchema("count", nil, spec.Int64Property(), db, 0)
+		if n := v.(int64); err != nil || n < 5 || n > 10 {
+			t.Errorf("numberRange 5-10, got %v, err %v", v, err)
+		}
+		v, err = test.GenerateSchema("price", nil, spec.Float64Property(), db, 0)
+		if f := v.(float64); err != nil || f < 5 || f > 10 {
+			t.Errorf("numberRange 5-10, got %v, err %v", v, err)
+		}
+		v, err = test.GenerateSchema("count", nil, spec.Int64Property().WithMinimum(100, false), db, 0)
+		if n := v.(int64); err != nil || n < 100 {
+			t.Errorf("expecting the minimum to win over numberRange, got %v, err %v", v, err)
+		}
+	}
+
+	// The test's own sizes win over the plan's.
+	test.StringLength, test.NumberRange = "3", "-2--1"
+	v, err := test.GenerateSchema("name", nil, spec.StringProperty(), db, 0)
+	if err != nil || len(v.(string)) != 3 {
+		t.Errorf("expecting the test's stringLength 3, got %v, err %v", v, err)
+	}
+	v, err = test.GenerateSchema("count", nil, spec.Int64Property(), db, 0)
+	if n := v.(int64); err != nil || n < -2 || n > -1 {
+		t.Errorf("expecting the test's numberRange -2--1, got %v, err %v", v, err)
+	}
+
+	for _, size := range []string{"stringLength: many", "numberRange: 10-5", "numberRange: 5"} {
+		plan := &TestPlan{}
+		plan.Init(db.Swagger, db)
+		if err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  " + size + "\n"); err == nil {
+			t.Errorf("expecting an error for %s", size)
+		}
+		if err := plan.AddFromString("suite:\n- name: big\n  path: /pets\n  method: post\n  " + size + "\n"); err == nil {
+			t.Errorf("expecting an error for %s in a test", size)
+		}
+	}
+}
+
+func TestOptionalProperties(t *testing.T) {
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "required": ["name", "owner"], "properties": {
+		"name": {"type": "string"},
+		"nickname": {"type": "string"},
+		"categoryId": {"type": "integer", "description": "<meqa Category.id>"},
+		"owner": {"type": "object", "required": ["id"], "properties": {
+			"id": {"type": "integer"},
+			"email": {"type": "string"}}}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	for policy, expected := range map[string][]string{
+		"":                 {"categoryId", "name", "nickname", "owner", "owner.email", "owner.id"},
+		OptionalPropsNever: {"categoryId", "name", "owner", "owner.id"},
+	} {
+		test, db := createPetTest(t)
+		test.OptionalProps = policy
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		var keys []string
+		for k, value := range v.(map[string]interface{}) {
+			keys = append(keys, k)
+			if owner, ok := value.(map[string]interface{}); ok {
+				for ownerKey := range owner {
+					keys = append(keys, k+"."+ownerKey)
+				}
+			}
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, expected) {
+			t.Errorf("optionalProperties %q, expecting %v, got %v", policy, expected, keys)
+		}
+	}
+	if err = checkOptionalProps("sometimes"); err == nil {
+		t.Errorf("expecting an error for an unknown optionalProperties")
+	}
+}
+
+// Duplicate relies on MapCopy to give each copy of a test its own maps and arrays, while sharing the other values.
+func TestDuplicateCopiesParams(t *testing.T) {
+	tag := &mqswag.MeqaTag{Class: "Pet"}
+	test := &Test{Name: "addPet", Expect: map[string]interface{}{"status": 200}, suite: &TestSuite{}}
+	test.QueryParams = map[string]interface{}{}
+	test.BodyParams = map[string]interface{}{
+		"name":  "rex",
+		"owner": map[string]interface{}{"name": "ann"},
+		"tags":  []interface{}{"small", map[string]interface{}{"name": "dog"}},
+		"attrs": map[string]interface{}{},
+		"notes": []interface{}{},
+		"tag":   tag,
+	}
+
+	dup := test.Duplicate()
+	if dup.QueryParams != nil || dup.PathParams != nil {
+		t.Errorf("expecting the empty and the nil params to be nil, got %v and %v", dup.QueryParams, dup.PathParams)
+	}
+	if !reflect.DeepEqual(dup.BodyParams, test.BodyParams) || !reflect.DeepEqual(dup.Expect, test.Expect) {
+		t.Errorf("expecting an equal copy, got %v", dup.BodyParams)
+	}
+	body := dup.BodyParams.(map[string]interface{})
+	if attrs, ok := body["attrs"].(map[string]interface{}); !ok || attrs == nil {
+		t.Errorf("expecting an empty nested map to stay empty, got %#v", body["attrs"])
+	}
+	if notes, ok := body["notes"].([]interface{}); !ok || notes == nil {
+		t.Errorf("expecting an empty nested array to stay empty, got %#v", body["notes"])
+	}
+	if body["tag"] != tag {
+		t.Errorf("expecting the values other than maps and arrays to be shared")
+	}
+
+	body["name"] = "max"
+	body["owner"].(map[string]interface{})["name"] = "bob"
+	body["tags"].([]interface{})[1].(map[string]interface{})["name"] = "cat"
+	dup.Expect["status"] = 404
+	original := test.BodyParams.(map[string]interface{})
+	if original["name"] != "rex" || original["owner"].(map[string]interface{})["name"] != "ann" ||
+		original["tags"].([]interface{})[1].(map[string]interface{})["name"] != "dog" || test.Expect["status"] != 200 {
+		t.Errorf("expecting the original test unchanged, got %v and %v", original, test.Expect)
+	}
+}
+
+func TestOperationParams(t *testing.T) {
+	// The operation's slice has room for more, which an append would write into.
+	op := &spec.Operation{}
+	op.Parameters = append(make([]spec.Parameter, 0, 4), spec.Parameter{ParamProps: spec.ParamProps{Name: "id", In: "query"}})
+	pathItem := &spec.PathItem{}
+	pathItem.Parameters = []spec.Parameter{{ParamProps: spec.ParamProps{Name: "id", In: "query", Description: "path"}},
+		{ParamProps: spec.ParamProps{Name: "tenant", In: "header"}}}
+
+	params := operationParams(pathItem, op)
+	if len(params) != 2 || params[0].Description == "path" || params[1].Name != "tenant" {
+		t.Errorf("expecting the operation's id and the path's tenant, got %v", params)
+	}
+	params[0].Name = "changed"
+	if len(op.Parameters) != 1 || op.Parameters[0].Name != "id" || op.Parameters[:2][1].Name != "" {
+		t.Errorf("expecting the operation's parameters unchanged, got %v", op.Parameters[:2])
+	}
+
+	// Without parameters of its own, the operation gets a copy of the path's.
+	params = operationParams(pathItem, &spec.Operation{})
+	params[1].Name = "changed"
+	if len(params) != 2 || pathItem.Parameters[1].Name != "tenant" {
+		t.Errorf("expecting the path's parameters unchanged, got %v", pathItem.Parameters)
+	}
+}
+
+func TestResolveExpectBody(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	plan := newTestPlan(t, petSwagger, "", "")
+	suite := CreateTestSuite("pets", nil, plan)
+	for _, cat := range []map[string]interface{}{
+		{"meow": "loud"}, {"meow": "soft", "name": "tom"}, {"meow": "soft", "name": "kit"}} {
+		if err := plan.db.Insert("Cat", cat, nil); err != nil {
+			t.Fatalf("can't insert %v: %v", cat, err)
+		}
+	}
+	resolve := func(body interface{}) (interface{}, error) {
+		test := &Test{Name: "getCat", Expect: map[string]interface{}{ExpectBody: body}}
+		test.Init(suite)
+		return test.ResolveExpectBody()
+	}
+	db := func(db interface{}) interface{} { return map[string]interface{}{ExpectDB: db} }
+
+	// A body without $db is expected as is.
+	if body, err := resolve(map[string]interface{}{"meow": "loud"}); err != nil || body.(map[string]interface{})["meow"] != "loud" {
+		t.Errorf("expecting the body as is, got %v, %v", body, err)
+	}
+	body, err := resolve(db(map[string]interface{}{"class": "Cat", "match": map[string]interface{}{"meow": "loud"}}))
+	if err != nil || body.(map[string]interface{})["meow"] != "loud" {
+		t.Errorf("expecting the loud cat, got %v, %v", body, err)
+	}
+
+	errors := map[string]interface{}{
+		"must be a map":                      db("Cat"),
+		"doesn't refer to a known class":     db(map[string]interface{}{"class": "Cow"}),
+		"match in test getCat must be a map": db(map[string]interface{}{"class": "Cat", "match": "loud"}),
+		"found 0":                            db(map[string]interface{}{"class": "Cat", "match": map[string]interface{}{"meow": "none"}}),
+		"found 2":                            db(map[string]interface{}{"class": "Cat", "match": map[string]interface{}{"meow": "soft"}}),
+		"found 3":                            db(map[string]interface{}{"class": "Cat"}),
+	}
+	for message, body := range errors {
+		if _, err := resolve(body); err == nil || !strings.Contains(err.Error(), message) {
+			t.Errorf("expecting an error with %q, got %v", message, err)
+
+		}
+	}
+}
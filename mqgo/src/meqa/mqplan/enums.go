@@ -0,0 +1,90 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// A random pick from an enum takes many runs to hit all its values, and the server often handles each of them
+// differently. With allEnums in meqa_init, or the allenums flag in the tag of a parameter, a test runs once per
+// value of the enum instead, and once per combination of the values when several parameters have enums. Each run
+// is a test of its own, with its own comparisons and objects.
+
+// DefaultEnumLimit is the number of tests a test expands to with allEnums, when meqa_init doesn't set enumLimit.
+var DefaultEnumLimit = 20
+
+// enumValue is a value of a parameter's enum.
+type enumValue struct {
+	param string
+	value interface{}
+}
+
+// ExpandEnums returns one test per combination of the enum values of the test's parameters, up to the plan's
+// enumLimit. Only the parameters with the allenums flag are expanded, unless the plan sets allEnums. The
+// parameters the test or the suite sets keep their values. A test without such parameters is returned as is.
+func (t *Test) ExpandEnums() []*Test {
+	var params []spec.Parameter
+	if t.db != nil && t.db.Swagger != nil && t.db.Swagger.Paths != nil {
+		pathItem := t.db.Swagger.Paths.Paths[t.Path]
+		if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+			params = operationParams(&pathItem, op)
+		}
+	}
+	allEnums := t.suite != nil && t.suite.plan != nil && t.suite.plan.AllEnums
+	var lists [][]enumValue
+	for i := range params {
+		p := &params[i]
+		if p.In == "body" || len(p.Enum) == 0 || t.paramIsSet(p) {
+			continue
+		}
+		if tag := mqswag.GetTag(p); !allEnums && (tag == nil || tag.Flags&mqswag.FlagAllEnums == 0) {
+			continue
+		}
+		var values []enumValue
+		for _, v := range p.Enum {
+			values = append(values, enumValue{p.Name, v})
+		}
+		lists = append(lists, values)
+	}
+	if len(lists) == 0 {
+		return []*Test{t}
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i][0].param < lists[j][0].param })
+
+	limit := DefaultEnumLimit
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.EnumLimit > 0 {
+		limit = t.suite.plan.EnumLimit
+	}
+	total := 1
+	for _, list := range lists {
+		total *= len(list)
+	}
+	if total > limit {
+		mqutil.Logger.Printf("warning: %s: %d combinations of enum values, running the first %d, set enumLimit to run "+
+			"more", t.Name, total, limit)
+		total = limit
+	}
+
+	var tests []*Test
+	for n := 0; n < total; n++ {
+		test := *t
+		test.enumValues = make(map[string]interface{})
+		var names []string
+		// The last parameter's values change first.
+		index := n
+		for i := len(lists) - 1; i >= 0; i-- {
+			e := lists[i][index%len(lists[i])]
+			index /= len(lists[i])
+			test.enumValues[e.param] = e.value
+			names = append([]string{fmt.Sprintf("%s=%v", e.param, e.value)}, names...)
+		}
+		test.Name = fmt.Sprintf("%s[%s]", t.Name, strings.Join(names, ","))
+		tests = append(tests, &test)
+	}
+	return tests
+}
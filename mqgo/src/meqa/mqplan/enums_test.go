@@ -0,0 +1,70 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const enumSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "enums", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets": {"get": {
+			"parameters": [
+				{"name": "status", "in": "query", "required": true, "type": "string",
+					"enum": ["available", "pending", "sold"], "description": "<meqa allenums>"},
+				{"name": "kind", "in": "query", "type": "string", "enum": ["cat", "dog"]}
+			],
+			"responses": {"200": {"description": "ok"}}
+		}}
+	}
+}`
+
+func TestExpandEnums(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("status")+","+r.URL.Query().Get("kind"))
+	}))
+	defer server.Close()
+
+	run := func(init string, test string) (map[string]int, []*Test) {
+		plan := newTestPlan(t, enumSwagger, server.URL, init)
+		if err := plan.AddFromString("suite:\n- name: getPets\n  path: /pets\n  method: get\n" + test); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		queries = nil
+		counts, err := plan.Run("suite", nil)
+		if err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+		return counts, plan.resultList
+	}
+
+	// Only the flagged parameter is expanded, the optional kind is sent or not as usual.
+	counts, results := run("  optionalParams: never\n", "")
+	if strings.Join(queries, " ") != "available, pending, sold," || counts[mqutil.Passed] != 3 {
+		t.Errorf("expecting a run per status, got %v %v", queries, counts)
+	}
+	if len(results) != 3 || results[1].Name != "getPets[status=pending]" {
+		t.Errorf("expecting the runs to be named after their values, got %v", results)
+	}
+
+	// With allEnums, the combinations of both are run, up to the enumLimit. The status changes first, it comes
+	// after the kind.
+	counts, _ = run("  allEnums: true\n  enumLimit: 4\n", "")
+	if strings.Join(queries, " ") != "available,cat pending,cat sold,cat available,dog" || counts[mqutil.Total] != 4 {
+		t.Errorf("expecting the first 4 combinations, got %v %v", queries, counts)
+	}
+
+	// The values the test sets aren't expanded.
+	run("  allEnums: true\n", "  queryParams:\n    status: sold\n")
+	if strings.Join(queries, " ") != "sold,cat sold,dog" {
+		t.Errorf("expecting a run per kind with the status set, got %v", queries)
+	}
+}
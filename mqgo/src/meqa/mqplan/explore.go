@@ -0,0 +1,155 @@
+package mqplan
+
+import (
+	"fmt"
+	"math/rand"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// exploreTarget is an operation and one of the status codes it declares.
+type exploreTarget struct {
+	op       *mqswag.DAGNode
+	status   string
+	declared []string // all the status codes the operation declares
+	attempts int
+}
+
+// Explorer keeps picking the least covered operation and status combination, and runs a test suite
+// that calls the operation, until the time budget runs out. The test suites it runs are added to the
+// plan, so the plan can be dumped and replayed afterwards.
+type Explorer struct {
+	plan     *TestPlan
+	coverage *Coverage
+	rand     *rand.Rand
+	targets  []*exploreTarget
+	parents  map[*mqswag.DAGNode]mqswag.NodeList
+}
+
+// NewExplorer creates an explorer for the operations in the dag. The seed makes the choices between
+// equally covered targets reproducible.
+func NewExplorer(plan *TestPlan, dag *mqswag.DAG, coverage *Coverage, seed int64) *Explorer {
+	e := &Explorer{plan, coverage, rand.New(rand.NewSource(seed)), nil, make(map[*mqswag.DAGNode]mqswag.NodeList)}
+
+	// Go through the nodes in a fixed order so the same seed always gives the same choices.
+	var names []string
+	for name := range dag.NameMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		node := dag.NameMap[name]
+		for _, child := range node.Children {
+			e.parents[child] = append(e.parents[child], node)
+		}
+		if node.GetType() != mqswag.TypeOp {
+			continue
+		}
+		declared := getDeclaredStatuses(node.Data.(*spec.Operation))
+		for _, status := range declared {
+			e.targets = append(e.targets, &exploreTarget{node, status, declared, 0})
+		}
+	}
+	return e
+}
+
+func getDeclaredStatuses(op *spec.Operation) []string {
+	var statuses []string
+	if op.Responses != nil {
+		for code := range op.Responses.StatusCodeResponses {
+			statuses = append(statuses, strconv.Itoa(code))
+		}
+		sort.Strings(statuses)
+		if op.Responses.Default != nil {
+			statuses = append(statuses, "default")
+		}
+	}
+	if len(statuses) == 0 {
+		statuses = append(statuses, "default")
+	}
+	return statuses
+}
+
+// pick returns the target that has been covered the least. Targets that we tried but never hit are
+// tried less and less often. Ties are broken randomly.
+func (e *Explorer) pick() *exploreTarget {
+	var best []*exploreTarget
+	bestCount, bestAttempts := 0, 0
+	for _, target := range e.targets {
+		count := e.coverage.Count(target.op.GetMethod(), target.op.GetName(), target.status, target.declared)
+		if len(best) == 0 || count < bestCount || (count == bestCount && target.attempts < bestAttempts) {
+			best = []*exploreTarget{target}
+			bestCount, bestAttempts = count, target.attempts
+		} else if count == bestCount && target.attempts == bestAttempts {
+			best = append(best, target)
+		}
+	}
+	return best[e.rand.Intn(len(best))]
+}
+
+// prerequisites returns the create operations that have to run before the operation, so that the
+// objects it needs are in the DB. Operations run first are listed first.
+func (e *Explorer) prerequisites(op *mqswag.DAGNode, visited map[*mqswag.DAGNode]bool) mqswag.NodeList {
+	var ops mqswag.NodeList
+	visited[op] = true
+	for _, def := range e.parents[op] {
+		if def.GetType() != mqswag.TypeDef {
+			continue
+		}
+		for _, create := range e.parents[def] {
+			if create.GetType() != mqswag.TypeOp || !OperationMatches(create, mqswag.MethodPost) {
+				continue
+			}
+			if !visited[create] {
+				ops = append(ops, e.prerequisites(create, visited)...)
+				ops = append(ops, create)
+			}
+			break
+		}
+	}
+	return ops
+}
+
+// Run explores until the budget expires. The coverage is updated with the results of all the tests run.
+func (e *Explorer) Run(budget time.Duration) error {
+	if len(e.targets) == 0 {
+		return mqutil.NewError(mqutil.ErrNotFound, "no operations to explore")
+	}
+	start := time.Now()
+	for i := 1; time.Since(start) < budget; i++ {
+		target := e.pick()
+		target.attempts++
+
+		namer := NewTestNamer()
+		name := fmt.Sprintf("explore %d -- %s %s -- %s", i, target.op.GetMethod(), target.op.GetName(), target.status)
+		testSuite := CreateTestSuite(name, nil, e.plan)
+		testSuite.comment = fmt.Sprintf("Exploring status %s of %s %s", target.status, target.op.GetMethod(), target.op.GetName())
+		for _, op := range e.prerequisites(target.op, make(map[*mqswag.DAGNode]bool)) {
+			testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(op, namer))
+		}
+		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(target.op, namer))
+		for _, t := range testSuite.Tests {
+			t.Init(testSuite)
+		}
+		err := e.plan.Add(testSuite)
+		if err != nil {
+			return err
+		}
+
+		mqutil.Logger.Printf("\n---\nTest suite: %s\n", name)
+		fmt.Printf("\n---\nTest suite: %s\n", name)
+		resultStart := len(e.plan.resultList)
+		counts, err := e.plan.Run(name, nil)
+		mqutil.Logger.Printf("err:\n%v", err)
+		for k := range counts {
+			e.plan.ResultCounts[k] += counts[k]
+		}
+		e.coverage.RecordTests(e.plan.resultList[resultStart:])
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+const exploreSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {
+		"/pet": {"post": {
+			"operationId": "addPet",
+			"parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}, "400": {"description": "bad"}}
+		}},
+		"/pet/{petId}": {"get": {
+			"operationId": "getPet",
+			"parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer"}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}, "404": {"description": "missing"}}
+		}}
+	},
+	"definitions": {"Pet": {"type": "object", "required": ["name"], "properties": {
+		"id": {"type": "integer", "readOnly": true},
+		"name": {"type": "string", "maxLength": 10},
+		"age": {"type": "integer", "minimum": 0, "maximum": 20}
+	}}}
+}`
+
+// exploreServer records the requests it gets. It creates the pets, and never finds them.
+type exploreServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []string
+	delay    time.Duration
+}
+
+func newExploreServer(delay time.Duration) *exploreServer {
+	s := &exploreServer{delay: delay}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		s.mutex.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path+" "+string(body))
+		s.mutex.Unlock()
+		time.Sleep(s.delay)
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			w.Write([]byte(`{"id": 1, "name": "rex"}`))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	return s
+}
+
+func (s *exploreServer) sent() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func newExplorePlan(t *testing.T, serverURL string) (*TestPlan, *mqswag.DAG) {
+	plan := newTestPlan(t, exploreSwagger, serverURL, "")
+	plan.ResultCounts = make(map[string]int)
+	dag := mqswag.NewDAG()
+	if err := plan.swagger.AddToDAG(dag); err != nil {
+		t.Fatalf("can't create the DAG: %v", err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	return plan, dag
+}
+
+func TestExplorerPick(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	plan, dag := newExplorePlan(t, "")
+	coverage := NewCoverage()
+	coverage.Record("post", "/pet", 200)
+	coverage.Record("post", "/pet", 400)
+	coverage.Record("get", "/pet/{petId}", 200)
+	coverage.Record("get", "/pet/{petId}", 200)
+	e := NewExplorer(plan, dag, coverage, 1)
+	if len(e.targets) != 4 {
+		t.Fatalf("expecting a target per declared status, got %d", len(e.targets))
+	}
+
+	// The only status never returned is picked.
+	if target := e.pick(); target.op.GetName() != "/pet/{petId}" || target.status != "404" {
+		t.Errorf("expecting get 404 to be picked, got %s %s", target.op.GetMethod(), target.status)
+	}
+
+	// Between the statuses returned as often, the one tried the least is picked.
+	coverage.Record("get", "/pet/{petId}", 404)
+	for _, target := range e.targets {
+		if target.status != "200" || target.op.GetName() != "/pet" {
+			target.attempts = 1
+		}
+	}
+	if target := e.pick(); target.op.GetName() != "/pet" || target.status != "200" {
+		t.Errorf("expecting post 200 to be picked, got %s %s", target.op.GetMethod(), target.status)
+	}
+}
+
+func TestExplorerRun(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := newExploreServer(10 * time.Millisecond)
+	defer server.Close()
+
+	// Without a budget nothing runs.
+	plan, dag := newExplorePlan(t, server.URL)
+	if err := NewExplorer(plan, dag, NewCoverage(), 1).Run(0); err != nil || len(plan.SuiteList) != 0 {
+		t.Fatalf("expecting nothing to run, got %d suites, %v", len(plan.SuiteList), err)
+	}
+
+	// The exploration stops once the budget runs out, and covers every operation.
+	coverage := NewCoverage()
+	start := time.Now()
+	if err := NewExplorer(plan, dag, coverage, 1).Run(200 * time.Millisecond); err != nil {
+		t.Fatalf("can't explore: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expecting the exploration to stop after the budget, took %v", elapsed)
+	}
+	if len(plan.SuiteList) < 2 {
+		t.Fatalf("expecting a suite per exploration, got %d", len(plan.SuiteList))
+	}
+	if coverage.Count("post", "/pet", "200", nil) == 0 || coverage.Count("get", "/pet/{petId}", "404", nil) == 0 {
+		t.Errorf("expecting both operations covered, got %v", coverage.Operations)
+	}
+	explored := server.sent()
+
+	// The result file replays the same requests.
+	dir, err := ioutil.TempDir("", "explore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "result.yml")
+	if err = plan.WriteResultToFile(path); err != nil {
+		t.Fatalf("can't write the result: %v", err)
+	}
+	replay, _ := newExplorePlan(t, server.URL)
+	if err = replay.InitFromFile(path, replay.db); err != nil {
+		t.Fatalf("can't load the result: %v", err)
+	}
+	server.mutex.Lock()
+	server.requests = nil
+	server.delay = 0
+	server.mutex.Unlock()
+	History.Reset()
+	for _, suite := range replay.SuiteList {
+		replay.Run(suite.Name, nil)
+	}
+	if replayed := server.sent(); !reflect.DeepEqual(replayed, explored) {
+		t.Errorf("expecting the replay to send\n%v\ngot\n%v", explored, replayed)
+	}
+}
+
+func TestExplorerSeed(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	explore := func(seed int64) []string {
+		server := newExploreServer(0)
+		defer server.Close()
+		plan, dag := newExplorePlan(t, server.URL)
+		History.Reset()
+		Seed(seed)
+		if err := NewExplorer(plan, dag, NewCoverage(), seed).Run(50 * time.Millisecond); err != nil {
+			t.Fatalf("can't explore: %v", err)
+		}
+		return server.sent()
+	}
+
+	// The same seed picks the same operations and sends the same values, as far as both runs got.
+	first, second := explore(7), explore(7)
+	n := len(first)
+	if len(second) < n {
+		n = len(second)
+	}
+	if n < 2 || !reflect.DeepEqual(first[:n], second[:n]) {
+		t.Errorf("expecting the same requests with the same seed, got\n%v\n%v", first, second)
+	}
+	if other := explore(8); reflect.DeepEqual(other[:2], first[:2]) {
+		t.Errorf("expecting other requests with another seed, got %v", other[:2])
+	}
+}
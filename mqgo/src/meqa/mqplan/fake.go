@@ -0,0 +1,167 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// With realisticData in meqa_init, the strings without a pattern, a format or an enum get plausible fake values
+// picked by the name of their property or parameter, e.g. an email for contactEmail, instead of a random string the
+// server may reject. The realisticNames of meqa_init map more names to the kinds of values below. A property opts
+// out with the nofake flag of its meqa tag.
+
+// fakeGenerators generate the kinds of fake values.
+var fakeGenerators = map[string]func() string{
+	"email": func() string {
+		return fmt.Sprintf("%s.%s%d@%s", strings.ToLower(fakePick(fakeFirstNames)), strings.ToLower(fakePick(fakeLastNames)),
+			random.Intn(100), fakePick(fakeDomains))
+	},
+	"phone": func() string {
+		return fmt.Sprintf("+1%d%02d%07d", 2+random.Intn(8), random.Intn(100), random.Intn(10000000))
+	},
+	"firstName": func() string { return fakePick(fakeFirstNames) },
+	"lastName":  func() string { return fakePick(fakeLastNames) },
+	"name":      func() string { return fakePick(fakeFirstNames) + " " + fakePick(fakeLastNames) },
+	"username": func() string {
+		return fmt.Sprintf("%s%d", strings.ToLower(fakePick(fakeFirstNames)), random.Intn(1000))
+	},
+	"street":      func() string { return fmt.Sprintf("%d %s", 1+random.Intn(9999), fakePick(fakeStreets)) },
+	"city":        func() string { return fakePick(fakeCities) },
+	"state":       func() string { return fakePick(fakeStates) },
+	"zip":         func() string { return fmt.Sprintf("%05d", 1000+random.Intn(98000)) },
+	"country":     func() string { return fakePick(fakeCountries)[3:] },
+	"countryCode": func() string { return fakePick(fakeCountries)[:2] },
+	"url": func() string {
+		return fmt.Sprintf("https://www.%s/%s", fakePick(fakeDomains), strings.ToLower(fakePick(fakeLastNames)))
+	},
+	"company": func() string { return fakePick(fakeLastNames) + " " + fakePick(fakeCompanySuffixes) },
+}
+
+// fakeNames map the property and parameter names to the kinds of fake values. A name matches if it contains the
+// key, ignoring the case, the underscores and the dashes. The longest key that matches wins, so firstName is a
+// first name, not a name. The keys starting with = must match the whole name.
+var fakeNames = map[string]string{
+	"email":        "email",
+	"phone":        "phone",
+	"mobile":       "phone",
+	"firstname":    "firstName",
+	"givenname":    "firstName",
+	"lastname":     "lastName",
+	"surname":      "lastName",
+	"familyname":   "lastName",
+	"fullname":     "name",
+	"=name":        "name",
+	"username":     "username",
+	"login":        "username",
+	"street":       "street",
+	"=address":     "street",
+	"addressline":  "street",
+	"emailaddress": "email",
+	"city":         "city",
+	"=state":       "state",
+	"province":     "state",
+	"zip":          "zip",
+	"postalcode":   "zip",
+	"postcode":     "zip",
+	"country":      "country",
+	"countrycode":  "countryCode",
+	"url":          "url",
+	"website":      "url",
+	"homepage":     "url",
+	"company":      "company",
+	"organization": "company",
+}
+
+var fakeFirstNames = []string{"James", "Mary", "Robert", "Patricia", "John", "Jennifer", "Michael", "Linda",
+	"David", "Elizabeth", "William", "Susan", "Maria", "Wei", "Aisha", "Carlos", "Yuki", "Olga", "Priya", "Lars"}
+var fakeLastNames = []string{"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis",
+	"Rodriguez", "Martinez", "Wilson", "Anderson", "Taylor", "Thomas", "Moore", "Chen", "Nguyen", "Patel", "Kim"}
+var fakeDomains = []string{"example.com", "example.org", "example.net"}
+var fakeStreets = []string{"Main Street", "Oak Avenue", "Maple Drive", "Cedar Lane", "Park Road", "Pine Street",
+	"Elm Street", "Washington Avenue", "Lake View Drive", "Hill Road"}
+var fakeCities = []string{"Springfield", "Portland", "Austin", "Denver", "Boston", "Seattle", "Chicago",
+	"San Diego", "Nashville", "Columbus"}
+var fakeStates = []string{"California", "Texas", "New York", "Florida", "Illinois", "Ohio", "Oregon",
+	"Washington", "Colorado", "Georgia"}
+
+// The country codes and the names, split at the third character.
+var fakeCountries = []string{"US United States", "CA Canada", "GB United Kingdom", "DE Germany", "FR France",
+	"JP Japan", "AU Australia", "BR Brazil", "IN India", "MX Mexico"}
+var fakeCompanySuffixes = []string{"Inc", "LLC", "Group", "Partners", "Holdings", "Labs"}
+
+func fakePick(list []string) string {
+	return list[random.Intn(len(list))]
+}
+
+func normalizeFakeName(name string) string {
+	return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(name))
+}
+
+// fakeKind returns the kind of fake value for the name, from the plan's names or else the built-in ones.
+func fakeKind(name string, planNames map[string]string) string {
+	name = normalizeFakeName(name)
+	for _, names := range []map[string]string{planNames, fakeNames} {
+		var keys []string
+		for k := range names {
+			keys = append(keys, k)
+		}
+		// The longest key wins, then the first in alphabetical order, so the pick doesn't depend on map order.
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) {
+				return len(keys[i]) > len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		for _, k := range keys {
+			key := normalizeFakeName(strings.TrimPrefix(k, "="))
+			if len(key) == 0 {
+				continue
+			}
+			if strings.HasPrefix(k, "=") && name == key || !strings.HasPrefix(k, "=") && strings.Contains(name, key) {
+				return names[k]
+			}
+		}
+	}
+	return ""
+}
+
+// checkRealisticNames returns an error if the plan's realisticNames map a name to an unknown kind of value.
+func checkRealisticNames(names map[string]string) error {
+	for name, kind := range names {
+		if fakeGenerators[kind] == nil {
+			var kinds []string
+			for k := range fakeGenerators {
+				kinds = append(kinds, k)
+			}
+			sort.Strings(kinds)
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("realisticNames maps %s to %s, expecting one of %s",
+				name, kind, strings.Join(kinds, ", ")))
+		}
+	}
+	return nil
+}
+
+// generateFake returns a fake value for the string schema of the property or parameter, if the plan asks for
+// realistic data and the name is of a known kind. The value must fit the schema's lengths.
+func (t *Test) generateFake(s *spec.Schema, name string, tag *mqswag.MeqaTag) (string, bool) {
+	if t.suite == nil || t.suite.plan == nil || !t.suite.plan.RealisticData {
+		return "", false
+	}
+	if len(s.Pattern) > 0 || len(s.Format) > 0 || len(s.Enum) > 0 || tag != nil && tag.Flags&mqswag.FlagNoFake != 0 {
+		return "", false
+	}
+	generator := fakeGenerators[fakeKind(strings.TrimSuffix(name, "_"), t.suite.plan.RealisticNames)]
+	if generator == nil {
+		return "", false
+	}
+	str := generator()
+	if s.MaxLength != nil && int64(len(str)) > *s.MaxLength || s.MinLength != nil && int64(len(str)) < *s.MinLength {
+		return "", false
+	}
+	return str, true
+}
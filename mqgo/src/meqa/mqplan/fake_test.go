@@ -0,0 +1,79 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestRealisticData(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"contactEmail": {"type": "string"},
+		"first_name": {"type": "string"},
+		"zipCode": {"type": "string"},
+		"countryCode": {"type": "string"},
+		"handle": {"type": "string"},
+		"city": {"type": "string", "description": "<meqa nofake>"},
+		"website": {"type": "string", "maxLength": 5},
+		"phone": {"type": "string", "pattern": "^[0-9]{4}$"}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+
+	for _, realistic := range []bool{false, true} {
+		test, db := createPetTest(t)
+		plan := &TestPlan{}
+		plan.Init(db.Swagger, db)
+		init := "meqa_init:\n- name: meqa_init\n  realisticNames:\n    handle: username\n"
+		if realistic {
+			init += "  realisticData: true\n"
+		}
+		if err = plan.AddFromString(init); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		test.suite.plan = plan
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj := v.(map[string]interface{})
+		email := regexp.MustCompile(`^[a-z]+\.[a-z]+[0-9]*@example\.(com|org|net)$`).MatchString(obj["contactEmail"].(string))
+		if email != realistic {
+			t.Errorf("realisticData %v, got email %v", realistic, obj["contactEmail"])
+		}
+		if !realistic {
+			continue
+		}
+		if name := obj["first_name"].(string); !strings.Contains(strings.Join(fakeFirstNames, ","), name) {
+			t.Errorf("expecting a first name, got %s", name)
+		}
+		if !regexp.MustCompile(`^[0-9]{5}$`).MatchString(obj["zipCode"].(string)) || len(obj["countryCode"].(string)) != 2 {
+			t.Errorf("expecting a zip code and a country code, got %v", obj)
+		}
+		if !regexp.MustCompile(`^[a-z]+[0-9]+$`).MatchString(obj["handle"].(string)) {
+			t.Errorf("expecting the plan's name to map handle to a username, got %v", obj["handle"])
+		}
+		// The tag opts out, the fake value doesn't fit, and the pattern wins.
+		if strings.Contains(strings.Join(fakeCities, ","), obj["city"].(string)) || len(obj["website"].(string)) > 5 ||
+			!regexp.MustCompile(`^[0-9]{4}$`).MatchString(obj["phone"].(string)) {
+			t.Errorf("expecting random values for city, website and phone, got %v", obj)
+		}
+	}
+
+	for name, kind := range map[string]string{"emailAddress": "email", "name": "name", "fileName": "",
+		"lastName": "lastName", "billing_address": "", "address": "street", "country_code": "countryCode"} {
+		if k := fakeKind(name, nil); k != kind {
+			t.Errorf("expecting %s to be %q, got %q", name, kind, k)
+		}
+	}
+	if err = checkRealisticNames(map[string]string{"sku": "barcode"}); err == nil {
+		t.Errorf("expecting an error for an unknown kind of value")
+	}
+}
@@ -50,24 +50,82 @@ func GetLastPathParam(name string) string {
 	return ""
 }
 
-func CreateTestFromOp(opNode *mqswag.DAGNode, testId int) *Test {
+// CreateTestFromOp creates a test that calls the operation. The namer hands out the test's name.
+func CreateTestFromOp(opNode *mqswag.DAGNode, namer *TestNamer) *Test {
 	op := opNode.Data.((*spec.Operation))
 	t := &Test{}
 	t.Path = opNode.GetName()
 	t.Method = opNode.GetMethod()
-	opId := op.ID
-	if len(opId) == 0 {
-		opId = GetLastPathElement(t.Path)
-	}
-	t.Name = fmt.Sprintf("%s_%s_%d", t.Method, opId, testId)
+	t.Name = namer.Next(t.Method, t.Path, op.ID)
+
+	return t
+}
 
+// createTestFromOp creates a test that calls the operation, with the notes explaining how the operation is
+// linked to the classes.
+func (plan *TestPlan) createTestFromOp(opNode *mqswag.DAGNode, namer *TestNamer) *Test {
+	return plan.createTest(opNode.GetMethod(), opNode.GetName(), opNode.Data.(*spec.Operation), namer)
+}
+
+// createTest creates a test that calls the operation at the path, with the notes explaining how the operation is
+// linked to the classes.
+func (plan *TestPlan) createTest(method string, path string, op *spec.Operation, namer *TestNamer) *Test {
+	t := &Test{}
+	t.Path = path
+	t.Method = method
+	t.Name = namer.Next(method, path, op.ID)
+	if op.Deprecated {
+		t.addNote("the operation is deprecated, it's left out of the plan when deprecated is skip")
+	}
+	annotateOperation(t, op, plan.swagger)
 	return t
 }
 
+// addRequiredOnlyVariant adds a test that calls the create operation with only the required properties of its
+// body, after the test that sends them all, if the body has optional properties. The server's defaults for the
+// properties left out are then exercised as well.
+func (plan *TestPlan) addRequiredOnlyVariant(testSuite *TestSuite, opNode *mqswag.DAGNode, namer *TestNamer) {
+	op, ok := opNode.Data.(*spec.Operation)
+	if !ok || op == nil || !hasOptionalBodyProperties(op, plan.swagger) {
+		return
+	}
+	fullTest := testSuite.Tests[len(testSuite.Tests)-1]
+	requiredTest := plan.createTestFromOp(opNode, namer)
+	requiredTest.OptionalProps = OptionalPropsNever
+	requiredTest.addNote("required-only variant of %s: the body only has the required properties, and the ones "+
+		"with a meqa tag", fullTest.Name)
+	testSuite.Tests = append(testSuite.Tests, requiredTest)
+}
+
+// hasOptionalBodyProperties returns whether the operation's body is an object with optional properties.
+func hasOptionalBodyProperties(op *spec.Operation, swagger *mqswag.Swagger) bool {
+	for _, p := range op.Parameters {
+		if p.In != "body" || p.Schema == nil || !isObjectSchema(p.Schema, swagger) {
+			continue
+		}
+		_, schema := swagger.GetSchemaRootType((*mqswag.Schema)(p.Schema), nil)
+		if schema == nil {
+			continue
+		}
+		for name := range schema.Properties {
+			if !isRequired((*spec.Schema)(schema), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipOperation returns whether the generated plans leave out the operation, because it's deprecated.
+func skipOperation(node *mqswag.DAGNode) bool {
+	op, ok := node.Data.(*spec.Operation)
+	return ok && op != nil && op.Deprecated && Deprecated == DeprecatedSkip
+}
+
 func OperationMatches(node *mqswag.DAGNode, method string) bool {
 	op, ok := node.Data.(*spec.Operation)
 	if ok && op != nil {
-		tag := mqswag.GetMeqaTag(op.Description)
+		tag := mqswag.GetTag(op)
 		if (tag != nil && tag.Operation == method) || ((tag == nil || len(tag.Operation) == 0) && node.GetMethod() == method) {
 			return true
 		}
@@ -88,18 +146,24 @@ func GenerateTestsForObject(create *mqswag.DAGNode, obj *mqswag.DAGNode, plan *T
 	objName := obj.GetName()
 
 	// A loop where we go through all the child operations
-	testId := 1
+	namer := NewTestNamer()
 	testSuite := CreateTestSuite(fmt.Sprintf("%s -- %s -- all", createPath, objName), nil, plan)
-	testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, testId))
+	createTest := plan.createTestFromOp(create, namer)
+	createTest.addNote("runs first: it creates the %s that the other tests use", objName)
+	testSuite.Tests = append(testSuite.Tests, createTest)
+	plan.addRequiredOnlyVariant(testSuite, create, namer)
 	for _, child := range obj.Children {
-		if child.GetType() != mqswag.TypeOp {
+		if child.GetType() != mqswag.TypeOp || skipOperation(child) {
 			continue
 		}
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(child, testId))
+		childTest := plan.createTestFromOp(child, namer)
+		childTest.addNote("runs after %s: it uses %s, which %s creates (dependency %s -> %s -> %s)", createTest.Name,
+			objName, createTest.Name, create.ToString(), objName, child.ToString())
+		testSuite.Tests = append(testSuite.Tests, childTest)
 		if OperationMatches(child, mqswag.MethodDelete) {
-			testId++
-			testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, testId))
+			createTest = plan.createTestFromOp(create, namer)
+			createTest.addNote("creates %s again, as %s deleted it", objName, childTest.Name)
+			testSuite.Tests = append(testSuite.Tests, createTest)
 		}
 	}
 	if len(testSuite.Tests) > 0 {
@@ -109,7 +173,7 @@ func GenerateTestsForObject(create *mqswag.DAGNode, obj *mqswag.DAGNode, plan *T
 	// a loop where we pick random operations and pair it with the create operation.
 	// This would generate a few objects.
 	/* disable random stuff during development
-	testId = 0
+	namer.Reset()
 	testSuite = &TestSuite{nil, fmt.Sprintf("%s -- %s -- random", createPath, objName)}
 	for i := 0; i < 2*len(obj.Children); i++ {
 		j := rand.Intn(len(obj.Children))
@@ -118,10 +182,8 @@ func GenerateTestsForObject(create *mqswag.DAGNode, obj *mqswag.DAGNode, plan *T
 			mqutil.Logger.Printf("unexpected: (%s) has a child (%s) that's not an operation", obj.Name, child.Name)
 			continue
 		}
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, testId))
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(child, testId))
+		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(create, namer))
+		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(child, namer))
 	}
 	if len(testSuite.Tests) > 0 {
 		plan.Add(testSuite)
@@ -141,14 +203,14 @@ then exercise REST calls that use that object as an input.
 	addInitTestSuite(testPlan)
 
 	genFunc := func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
-		if current.GetType() != mqswag.TypeOp {
+		if current.GetType() != mqswag.TypeOp || skipOperation(current) {
 			return nil
 		}
 
 		// Exercise the function by itself.
 		/*
 			testSuite := CreateTestSuite(current.GetName()+" "+current.GetMethod(), nil, testPlan)
-			testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(current, 1))
+			testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(current, NewTestNamer()))
 			testPlan.Add(testSuite)
 		*/
 
@@ -178,19 +240,25 @@ func GeneratePathTestSuite(operations mqswag.NodeList, plan *TestPlan) {
 
 	pathName := operations[0].GetName()
 	sort.Sort(mqswag.ByMethodPriority(operations))
-	testId := 0
+	namer := NewTestNamer()
 	testSuite := CreateTestSuite(fmt.Sprintf("%s", pathName), nil, plan)
 	createTest := &Test{}
 	idTag := "id"
-	for _, o := range operations {
-		testId++
-		currentTest := CreateTestFromOp(o, testId)
+	for i, o := range operations {
+		currentTest := plan.createTestFromOp(o, namer)
+		if i > 0 {
+			currentTest.addNote("runs after %s: the operations on the path run in the order post, get, "+
+				"put and patch, then delete", testSuite.Tests[len(testSuite.Tests)-1].Name)
+		}
 		testSuite.Tests = append(testSuite.Tests, currentTest)
 		if OperationMatches(o, mqswag.MethodPost) {
 			createTest = currentTest
+			plan.addRequiredOnlyVariant(testSuite, o, namer)
 		} else if strings.Contains(o.GetName(), idTag) {
 			currentTest.PathParams = make(map[string]interface{})
 			currentTest.PathParams[idTag] = fmt.Sprintf("{{%s.outputs.%s}}", createTest.Name, idTag)
+			currentTest.addNote("path param %s: the output %s of %s, as the path has an %s param", idTag, idTag,
+				createTest.Name, idTag)
 		}
 		if OperationMatches(o, mqswag.MethodDelete) {
 			lastTest := testSuite.Tests[len(testSuite.Tests)-1]
@@ -201,8 +269,9 @@ func GeneratePathTestSuite(operations mqswag.NodeList, plan *TestPlan) {
 					if lastParam == GetLastPathParam(repeatOp.GetName()) &&
 						!OperationMatches(repeatOp, mqswag.MethodDelete) &&
 						!OperationMatches(repeatOp, mqswag.MethodPost) {
-						testId++
-						repeatTest := CreateTestFromOp(repeatOp, testId)
+						repeatTest := plan.createTestFromOp(repeatOp, namer)
+						repeatTest.addNote("negative variant: uses the %s that %s deleted, and expects a failure",
+							lastParam, lastTest.Name)
 						repeatTest.PathParams = make(map[string]interface{})
 						repeatTest.Expect = make(map[string]interface{})
 						repeatTest.PathParams[lastParam] = fmt.Sprintf("{{%s.pathParams.%s}}", lastTest.Name, lastParam)
@@ -254,7 +323,7 @@ parameters by default.
 	pathWeight := make(map[string]int)
 
 	addFunc := func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
-		if current.GetType() != mqswag.TypeOp {
+		if current.GetType() != mqswag.TypeOp || skipOperation(current) {
 			return nil
 		}
 		name := current.GetName()
@@ -307,21 +376,25 @@ func GenerateSimpleTestPlan(swagger *mqswag.Swagger, dag *mqswag.DAG) (*TestPlan
 	testPlan.Init(swagger, nil)
 	addInitTestSuite(testPlan)
 
-	testId := 0
+	testCount := 0
+	namer := NewTestNamer()
 	testSuite := CreateTestSuite(fmt.Sprintf("simple test suite"), nil, testPlan)
 	testSuite.comment = "The meqa_init task within a test suite initializes parameters that are applied to all tests within this suite"
 	testSuite.Tests = append(testSuite.Tests, createInitTask())
 	addFunc := func(previous *mqswag.DAGNode, current *mqswag.DAGNode) error {
-		if testId >= 10 {
+		if testCount >= 10 {
 			return mqutil.NewError(mqutil.ErrOK, "done")
 		}
 
-		if current.GetType() != mqswag.TypeOp {
+		if current.GetType() != mqswag.TypeOp || skipOperation(current) {
 			return nil
 		}
 
-		testId++
-		testSuite.Tests = append(testSuite.Tests, CreateTestFromOp(current, testId))
+		testCount++
+		t := testPlan.createTestFromOp(current, namer)
+		t.addNote("sampled in the order of DAG weight (%d), the operations that others depend on come first",
+			current.Weight)
+		testSuite.Tests = append(testSuite.Tests, t)
 
 		return nil
 	}
@@ -0,0 +1,156 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"io"
+	"os"
+	"strings"
+)
+
+// diffLine is a line of the diff between the expected and the actual body. Op is "=" for a line in both, "-" for
+// a line only in the expected body, and "+" for a line only in the actual body.
+type diffLine struct {
+	Op   string
+	Text string
+}
+
+// indentJSON returns the JSON indented, with the keys sorted, so the bodies can be compared line by line. It
+// returns the string unchanged if it isn't JSON.
+func indentJSON(s string) string {
+	var obj interface{}
+	d := json.NewDecoder(bytes.NewReader([]byte(s)))
+	d.UseNumber()
+	if d.Decode(&obj) != nil {
+		return s
+	}
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return s
+	}
+	return string(data)
+}
+
+// diffLines diffs the lines of the two strings using their longest common subsequence.
+func diffLines(expected string, got string) []diffLine {
+	a := strings.Split(expected, "\n")
+	b := strings.Split(got, "\n")
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var result []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			result = append(result, diffLine{"=", a[i]})
+			i++
+			j++
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			result = append(result, diffLine{"-", a[i]})
+			i++
+		} else {
+			result = append(result, diffLine{"+", b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		result = append(result, diffLine{"-", a[i]})
+	}
+	for ; j < len(b); j++ {
+		result = append(result, diffLine{"+", b[j]})
+	}
+	return result
+}
+
+// htmlResult is a test result with the diff of its bodies, as rendered in the HTML report.
+type htmlResult struct {
+	TestResult
+	Diff []diffLine
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>meqa test report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.passed { color: #080; }
+.failed { color: #c00; }
+.servererror { color: #fff; background: #c00; padding: 0 4px; }
+pre { margin: 0; }
+.diff .del { background: #fdd; }
+.diff .add { background: #dfd; }
+</style>
+</head>
+<body>
+<h1>meqa test report</h1>
+<p>{{.Passed}} passed, {{.Failed}} failed.</p>
+{{if .Skipped}}<p>Not saved, the artifacts would exceed the budget:{{range .Skipped}} {{.}}{{end}}</p>
+{{end}}<table>
+<tr><th>Test</th><th>Request</th><th>Status</th><th>Duration (ms)</th><th>Result</th></tr>
+{{range .Results}}<tr>
+<td>{{if .Suite}}{{.Suite}} / {{end}}{{.Name}}</td>
+<td>{{.Method}} {{.Request.URL}}</td>
+<td>{{if .Status}}{{.Status}}{{end}}</td>
+<td>{{printf "%.1f" .Duration}}</td>
+<td>{{if .Passed}}<span class="passed">passed</span>{{else}}<span class="failed">failed</span>{{if .ServerError}} <span class="servererror">server error</span>{{end}}
+{{if .Diff}}<pre class="diff">{{range .Diff}}{{if eq .Op "-"}}<span class="del">- {{.Text}}</span>
+{{else if eq .Op "+"}}<span class="add">+ {{.Text}}</span>
+{{else}}  {{.Text}}
+{{end}}{{end}}</pre>{{else}}<pre>{{.Error}}</pre>{{end}}{{end}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTMLReport writes the results as an HTML page. For a test whose body didn't match the expected body, the
+// page shows the diff of the expected and the actual body. The page notes the artifacts of the run skipped because
+// of the budget.
+func WriteHTMLReport(w io.Writer, results []TestResult, skipped []string) error {
+	data := struct {
+		Results        []htmlResult
+		Passed, Failed int
+		Skipped        []string
+	}{Skipped: skipped}
+	for _, r := range results {
+		hr := htmlResult{TestResult: r}
+		if len(r.ExpectedBody) > 0 || len(r.GotBody) > 0 {
+			hr.Diff = diffLines(indentJSON(r.ExpectedBody), indentJSON(r.GotBody))
+		}
+		data.Results = append(data.Results, hr)
+		if r.Passed {
+			data.Passed++
+		} else {
+			data.Failed++
+		}
+	}
+	return htmlReportTemplate.Execute(w, data)
+}
+
+// WriteHTMLReportToFile writes the results of the run to the file as an HTML report.
+func (plan *TestPlan) WriteHTMLReportToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteHTMLReport(f, plan.Results(), nil)
+}
@@ -0,0 +1,75 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqutil"
+	"sort"
+)
+
+// checkExpectJSONPath returns an error if the jsonPath of an expect isn't a map of valid JSONPath expressions.
+func checkExpectJSONPath(jsonPaths interface{}) error {
+	if jsonPaths == nil {
+		return nil
+	}
+	m, ok := jsonPaths.(map[string]interface{})
+	if !ok {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("expecting jsonPath to map the expressions to "+
+			"the values, got %v", jsonPaths))
+	}
+	for path, expected := range m {
+		if err := mqutil.CheckJSONPath(path); err != nil {
+			return err
+		}
+		if err := mqutil.CheckMatchers(expected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkJSONPaths evaluates the JSONPath expressions against the response body, and returns a line for each one
+// that doesn't select the expected value. When an expression selects several values, e.g. with a wildcard, the
+// expected value is compared with the array of them.
+func checkJSONPaths(jsonPaths map[string]interface{}, body interface{}) []string {
+	var diffs []string
+	for path, expected := range jsonPaths {
+		found, err := mqutil.JSONPath(body, path)
+		if err != nil {
+			diffs = append(diffs, mqutil.ErrorMessage(err))
+			continue
+		}
+		if m, ok := expected.(map[string]interface{}); ok && len(m) == 1 && m[ExpectJSONPathExists] != nil {
+			if exists := len(found) > 0; exists != (m[ExpectJSONPathExists] == true) {
+				diffs = append(diffs, fmt.Sprintf("%s: expected %s %v, got %d values", path, ExpectJSONPathExists,
+					m[ExpectJSONPathExists], len(found)))
+			}
+			continue
+		}
+		var actual interface{}
+		switch len(found) {
+		case 0:
+			diffs = append(diffs, fmt.Sprintf("%s: expected %s, missing", path, mqutil.InterfaceToJsonString(expected)))
+			continue
+		case 1:
+			actual = found[0]
+		default:
+			actual = found
+		}
+		if !jsonPathEquals(expected, actual) {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %s, got %s", path, mqutil.InterfaceToJsonString(expected),
+				mqutil.InterfaceToJsonString(actual)))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// jsonPathEquals compares the value a JSONPath expression selects with the expected one. The numbers are compared
+// by value, and the maps and the arrays as with bodyMatch subset.
+func jsonPathEquals(expected interface{}, actual interface{}) bool {
+	switch expected.(type) {
+	case map[string]interface{}, []interface{}:
+		return len(mqutil.InterfaceMatchDiff(expected, actual, false)) == 0
+	}
+	return mqutil.DeepEquals(expected, actual) || mqutil.TimeCompare(expected, actual)
+}
@@ -0,0 +1,161 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"meqa/mqswag"
+	"reflect"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+)
+
+// This file masks the secrets, e.g. the generated passwords, in the parameters that are logged and printed, and in
+// the JSON and HTML reports. The values sent to the server, and the ones written to the result file to replay the
+// tests, aren't masked.
+
+// MaskedNames are the names of the parameters and properties whose values are masked, besides the ones with the
+// password format, e.g. token or secret. A name matches if it contains one of them, ignoring the case.
+var MaskedNames []string
+
+const maskedValue = "***"
+
+func isMaskedName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, masked := range MaskedNames {
+		masked = strings.ToLower(strings.TrimSpace(masked))
+		if len(masked) > 0 && strings.Contains(lower, masked) {
+			return true
+		}
+	}
+	return false
+}
+
+// isPassword returns whether the schema, or the one it refers to, has the password format.
+func isPassword(schema *mqswag.Schema, swagger *mqswag.Swagger) bool {
+	if schema == nil {
+		return false
+	}
+	if swagger != nil {
+		if _, referredSchema, _ := swagger.GetReferredSchema(schema); referredSchema != nil {
+			schema = referredSchema
+		}
+	}
+	return schema.Format == "password"
+}
+
+// maskParams returns a copy of the parameters in the location, e.g. query, with the values of the secrets masked.
+func (t *Test) maskParams(params map[string]interface{}, location string) map[string]interface{} {
+	passwords := make(map[string]bool)
+	if t.op != nil {
+		for _, p := range t.op.Parameters {
+			if p.In == location && p.Format == "password" {
+				// Header names are case insensitive, and so are the other names here, to be safe.
+				passwords[strings.ToLower(p.Name)] = true
+			}
+		}
+	}
+	masked := make(map[string]interface{})
+	for k, v := range params {
+		if passwords[strings.ToLower(k)] || isMaskedName(k) {
+			masked[k] = maskedValue
+		} else {
+			masked[k] = v
+		}
+	}
+	return masked
+}
+
+// maskBody returns a copy of the body with the values of the secret properties masked, at any depth.
+func (t *Test) maskBody(body interface{}) interface{} {
+	var schema *mqswag.Schema
+	if t.op != nil {
+		for _, p := range t.op.Parameters {
+			if p.In == "body" {
+				schema = (*mqswag.Schema)(p.Schema)
+			}
+		}
+	}
+	var swagger *mqswag.Swagger
+	if t.db != nil {
+		swagger = t.db.Swagger
+	}
+	return maskValue(body, schema, swagger)
+}
+
+// maskResponseBody returns the response body to log, with the values of the secret properties masked. The body is
+// returned as is, unless it's JSON or XML with secrets in it, which is then returned as the masked JSON.
+func (t *Test) maskResponseBody(resp *resty.Response) string {
+	body := resp.Body()
+	respSpec, _ := t.getResponseSpec(resp.StatusCode())
+	schema := (*mqswag.Schema)(respSpec.Schema)
+	var swagger *mqswag.Swagger
+	if t.db != nil {
+		swagger = t.db.Swagger
+	}
+	var obj interface{}
+	if isXMLMediaType(resp.Header().Get("Content-Type")) {
+		obj, _ = decodeXML(body, schema, swagger)
+	} else {
+		d := json.NewDecoder(bytes.NewReader(body))
+		d.UseNumber()
+		d.Decode(&obj)
+	}
+	return maskedJson(obj, schema, swagger, string(body))
+}
+
+// maskedJson returns the value with its secrets masked as JSON, or the unmasked string if there's nothing to mask.
+func maskedJson(value interface{}, schema *mqswag.Schema, swagger *mqswag.Swagger, unmasked string) string {
+	if value == nil {
+		return unmasked
+	}
+	masked := maskValue(value, schema, swagger)
+	if reflect.DeepEqual(masked, value) {
+		return unmasked
+	}
+	maskedBytes, err := json.Marshal(masked)
+	if err != nil {
+		return maskedValue
+	}
+	return string(maskedBytes)
+}
+
+func maskValue(value interface{}, schema *mqswag.Schema, swagger *mqswag.Swagger) interface{} {
+	if schema != nil && swagger != nil {
+		if _, referredSchema, _ := swagger.GetReferredSchema(schema); referredSchema != nil {
+			schema = referredSchema
+		}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var properties map[string]spec.Schema
+		if schema != nil && swagger != nil {
+			properties = schema.GetProperties(swagger)
+		}
+		masked := make(map[string]interface{})
+		for k, field := range v {
+			var fieldSchema *mqswag.Schema
+			if s, ok := properties[k]; ok {
+				fieldSchema = (*mqswag.Schema)(&s)
+			}
+			if isMaskedName(k) || isPassword(fieldSchema, swagger) {
+				masked[k] = maskedValue
+			} else {
+				masked[k] = maskValue(field, fieldSchema, swagger)
+			}
+		}
+		return masked
+	case []interface{}:
+		var itemsSchema *mqswag.Schema
+		if schema != nil && schema.Items != nil {
+			itemsSchema = (*mqswag.Schema)(schema.Items.Schema)
+		}
+		masked := make([]interface{}, len(v))
+		for i, item := range v {
+			masked[i] = maskValue(item, itemsSchema, swagger)
+		}
+		return masked
+	}
+	return value
+}
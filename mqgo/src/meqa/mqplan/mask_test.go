@@ -0,0 +1,164 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/resty.v0"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	var log strings.Builder
+	mqutil.NewLogger(&log)
+	defer mqutil.NewLogger(ioutil.Discard)
+	MaskedNames = []string{"token", " Secret"}
+	defer func() { MaskedNames = nil }()
+
+	test, db := createPetTest(t)
+	db.Swagger.Definitions["Login"] = *new(spec.Schema).Typed("object", "").
+		SetProperty("username", *spec.StringProperty()).
+		SetProperty("password", *spec.StrFmtProperty("password"))
+	body := spec.BodyParam("login", new(spec.Schema).Typed("object", "").
+		SetProperty("user", *spec.RefSchema("#/definitions/Login")).
+		SetProperty("history", *spec.ArrayProperty(spec.RefSchema("#/definitions/Login"))))
+	pin := spec.QueryParam("pin").Typed("string", "password")
+	test.op = &spec.Operation{}
+	test.op.Parameters = []spec.Parameter{*body, *pin}
+	test.Path = "/login"
+	test.QueryParams = map[string]interface{}{"pin": "4321", "lang": "en"}
+	test.HeaderParams = map[string]interface{}{"X-Api-Token": "abc123"}
+	test.BodyParams = map[string]interface{}{
+		"user":     map[string]interface{}{"username": "alice", "password": "hunter2"},
+		"history":  []interface{}{map[string]interface{}{"username": "bob", "password": "letmein"}},
+		"mySecret": "s3cr3t",
+	}
+
+	test.SetRequestParameters(resty.R())
+	logged := log.String()
+	for _, secret := range []string{"4321", "abc123", "hunter2", "letmein", "s3cr3t"} {
+		if strings.Contains(logged, secret) {
+			t.Errorf("expecting %s to be masked, got %s", secret, logged)
+		}
+	}
+	for _, shown := range []string{"alice", "bob", "lang: en", "password: '***'", "pin: '***'", "X-Api-Token: '***'"} {
+		if !strings.Contains(logged, shown) {
+			t.Errorf("expecting %s in the log, got %s", shown, logged)
+		}
+	}
+
+	// Nor in the report, or the objects logged without a known schema.
+	test.FormParams = map[string]interface{}{"secretCode": "c0d3"}
+	report, _ := json.Marshal(test.Result())
+	test.AddObjectComparison(&mqswag.MeqaTag{}, map[string]interface{}{"apiToken": "t0k3n"}, nil)
+	for _, secret := range []string{"4321", "abc123", "hunter2", "letmein", "s3cr3t", "c0d3"} {
+		if strings.Contains(string(report), secret) {
+			t.Errorf("expecting %s to be masked in the report, got %s", secret, report)
+		}
+	}
+	if !strings.Contains(string(report), "alice") {
+		t.Errorf("expecting the other values in the report, got %s", report)
+	}
+	if logged = log.String(); !strings.Contains(logged, "Can't find a known schema") || strings.Contains(logged, "t0k3n") {
+		t.Errorf("expecting the object without a schema logged masked, got %s", logged)
+	}
+
+	// The values sent are not masked.
+	bodyBytes, _ := json.Marshal(test.BodyParams)
+	if !strings.Contains(string(bodyBytes), "hunter2") || test.QueryParams["pin"] != "4321" {
+		t.Errorf("expecting the parameters to be kept, got %s %v", bodyBytes, test.QueryParams)
+	}
+}
+
+const maskSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "login", "version": "1.0"},
+	"paths": {
+		"/login": {"get": {"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Login"}}}}}
+	},
+	"definitions": {
+		"Login": {"type": "object", "properties": {
+			"username": {"type": "string"},
+			"password": {"type": "string", "format": "password"},
+			"apiToken": {"type": "string"}
+		}}
+	}
+}`
+
+func TestMaskResponseBodies(t *testing.T) {
+	var log strings.Builder
+	mqutil.NewLogger(&log)
+	defer mqutil.NewLogger(ioutil.Discard)
+	MaskedNames = []string{"token"}
+	defer func() { MaskedNames = nil }()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"username": "alice", "password": "hunter2", "apiToken": "t0k3n"}`))
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, maskSwagger, server.URL, "")
+	// Only the password differs, the other values are shown.
+	err := plan.AddFromString(`suite:
+- name: login
+  path: /login
+  method: get
+  expect:
+    body:
+      username: bob
+      password: swordfish
+      apiToken: t0k3n
+secret:
+- name: login
+  path: /login
+  method: get
+  expect:
+    body:
+      username: alice
+      password: swordfish
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("suite", nil)
+	results := plan.Results()
+	if len(results) != 1 || results[0].Passed {
+		t.Fatalf("expecting the body not to match, got %v", results)
+	}
+
+	secrets := []string{"hunter2", "swordfish", "t0k3n"}
+	report, _ := json.Marshal(results)
+	for _, secret := range secrets {
+		if strings.Contains(log.String(), secret) {
+			t.Errorf("expecting %s to be masked in the log, got %s", secret, log.String())
+		}
+		if strings.Contains(string(report), secret) {
+			t.Errorf("expecting %s to be masked in the report, got %s", secret, report)
+		}
+	}
+	for _, shown := range []string{"alice", "bob", `\"password\":\"***\"`} {
+		if !strings.Contains(string(report), shown) {
+			t.Errorf("expecting %s in the report, got %s", shown, report)
+		}
+	}
+	if !strings.Contains(log.String(), `{"apiToken":"***","password":"***","username":"alice"}`) {
+		t.Errorf("expecting the masked response body in the log, got %s", log.String())
+	}
+	if !strings.Contains(results[0].Error, "username: expected bob, got alice") {
+		t.Errorf("expecting the difference in the error, got %s", results[0].Error)
+	}
+
+	// When only a secret differs, the difference is reported without the values.
+	plan.Run("secret", nil)
+	results = plan.Results()
+	if len(results) != 2 || !strings.Contains(results[1].Error, "a masked value doesn't match") ||
+		strings.Contains(results[1].Error, "swordfish") {
+		t.Errorf("expecting the masked difference, got %v", results)
+	}
+}
@@ -0,0 +1,413 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"meqa/mqswag"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// MockServer answers the calls of a meqa tagged spec from an in-memory store, so that meqa itself can be tested
+// without a real server. The parameters are checked against the spec, and a call that breaks them gets a 400. The
+// objects in the bodies are stored under the class of their meqa tag. A get with a path parameter tagged
+// Class.property returns the object with that property, and the other gets return all the objects of the class
+// of the response's items, filtered by the query parameters. A delete removes the object. When the ApiToken is
+// set, the operations that have security requirements need it as a bearer token.
+type MockServer struct {
+	ApiToken string
+
+	swagger     *mqswag.Swagger
+	definitions map[string]interface{}
+	routes      []mockRoute
+	mutex       sync.Mutex
+	objects     map[string][]map[string]interface{} // the class name to its objects
+}
+
+// mockRoute is an operation and the regular expression that matches its path.
+type mockRoute struct {
+	re        *regexp.Regexp
+	names     []string // the path parameters, in the order of the regular expression's groups
+	method    string
+	operation *spec.Operation
+	params    []spec.Parameter
+}
+
+var pathParamRe = regexp.MustCompile(`\{[^}]+\}`)
+
+// NewMockServer creates the mock server of the spec.
+func NewMockServer(swagger *mqswag.Swagger, apiToken string) *MockServer {
+	m := &MockServer{ApiToken: apiToken, swagger: swagger, objects: make(map[string][]map[string]interface{})}
+	data, _ := json.Marshal(swagger.Definitions)
+	json.Unmarshal(data, &m.definitions)
+
+	for path, item := range swagger.Paths.Paths {
+		var names []string
+		full := swagger.BasePath + path
+		expr := "^"
+		last := 0
+		for _, loc := range pathParamRe.FindAllStringIndex(full, -1) {
+			expr += regexp.QuoteMeta(full[last:loc[0]]) + "([^/]+)"
+			names = append(names, full[loc[0]+1:loc[1]-1])
+			last = loc[1]
+		}
+		re := regexp.MustCompile(expr + regexp.QuoteMeta(full[last:]) + "$")
+		operations := map[string]*spec.Operation{mqswag.MethodGet: item.Get, mqswag.MethodPut: item.Put,
+			mqswag.MethodPost: item.Post, mqswag.MethodDelete: item.Delete, mqswag.MethodPatch: item.Patch,
+			mqswag.MethodHead: item.Head, mqswag.MethodOptions: item.Options}
+		for method, op := range operations {
+			if op == nil {
+				continue
+			}
+			params := append(append([]spec.Parameter(nil), item.Parameters...), op.Parameters...)
+			m.routes = append(m.routes, mockRoute{re, names, method, op, params})
+		}
+	}
+	// The literal paths, e.g. /pet/findByStatus, come before the ones with parameters, e.g. /pet/{petId}.
+	sort.SliceStable(m.routes, func(i, j int) bool { return len(m.routes[i].names) < len(m.routes[j].names) })
+	return m
+}
+
+// mockError sends the status with the message as the body.
+func mockError(w http.ResponseWriter, status int, format string, a ...interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	data, _ := json.Marshal(map[string]interface{}{"code": status, "message": fmt.Sprintf(format, a...)})
+	w.Write(data)
+}
+
+func (m *MockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var route *mockRoute
+	var pathValues map[string]string
+	pathFound := false
+	for i := range m.routes {
+		match := m.routes[i].re.FindStringSubmatch(r.URL.Path)
+		if match == nil {
+			continue
+		}
+		pathFound = true
+		if m.routes[i].method != strings.ToLower(r.Method) {
+			continue
+		}
+		route = &m.routes[i]
+		pathValues = make(map[string]string)
+		for j, name := range route.names {
+			pathValues[name] = match[j+1]
+		}
+		break
+	}
+	if route == nil {
+		if pathFound {
+			mockError(w, http.StatusMethodNotAllowed, "%s isn't allowed on %s", r.Method, r.URL.Path)
+		} else {
+			mockError(w, http.StatusNotFound, "unknown path %s", r.URL.Path)
+		}
+		return
+	}
+	security := route.operation.Security
+	if security == nil {
+		security = m.swagger.Security
+	}
+	if len(m.ApiToken) > 0 && len(security) > 0 && r.Header.Get("Authorization") != "Bearer "+m.ApiToken {
+		mockError(w, http.StatusUnauthorized, "missing or wrong bearer token")
+		return
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.ParseMultipartForm(1 << 20)
+	} else {
+		r.ParseForm()
+	}
+
+	values := make(map[string]interface{})
+	var body interface{}
+	var bodyParam *spec.Parameter
+	for i := range route.params {
+		p := &route.params[i]
+		if p.In == "body" {
+			bodyParam = p
+			if r.ContentLength == 0 {
+				if p.Required {
+					mockError(w, http.StatusBadRequest, "missing body")
+					return
+				}
+				continue
+			}
+			d := json.NewDecoder(r.Body)
+			d.UseNumber()
+			if err := d.Decode(&body); err != nil {
+				mockError(w, http.StatusBadRequest, "invalid body: %s", err.Error())
+				return
+			}
+			if err := m.validate(p.Schema, body); err != nil {
+				mockError(w, http.StatusBadRequest, "body: %s", err.Error())
+				return
+			}
+			continue
+		}
+		if p.Type == "file" {
+			continue
+		}
+		var raw []string
+		switch p.In {
+		case "path":
+			raw = []string{pathValues[p.Name]}
+		case "query":
+			raw = r.URL.Query()[p.Name]
+		case "header":
+			raw = r.Header[http.CanonicalHeaderKey(p.Name)]
+		case "formData":
+			raw = r.PostForm[p.Name]
+			if r.MultipartForm != nil && len(raw) == 0 {
+				raw = r.MultipartForm.Value[p.Name]
+			}
+		}
+		if len(raw) == 0 {
+			if p.Required {
+				mockError(w, http.StatusBadRequest, "missing %s parameter %s", p.In, p.Name)
+				return
+			}
+			continue
+		}
+		value := mockParamValue(p, raw)
+		schema := mqswag.CreateSchemaFromSimple(&p.SimpleSchema, &p.CommonValidations)
+		if err := m.validate((*spec.Schema)(schema), value); err != nil {
+			mockError(w, http.StatusBadRequest, "%s: %s", p.Name, err.Error())
+			return
+		}
+		values[p.Name] = value
+	}
+
+	status, response := m.respond(route, bodyParam, body, values)
+	if status >= 300 {
+		mockError(w, status, "not found")
+		return
+	}
+	if response == nil {
+		w.WriteHeader(status)
+		return
+	}
+	data, _ := json.Marshal(response)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// mockParamValue converts the strings of a parameter to the values of its type. A string that doesn't convert is
+// kept as is, for the validation to reject.
+func mockParamValue(p *spec.Parameter, raw []string) interface{} {
+	convert := func(s string, t string) interface{} {
+		switch t {
+		case "integer":
+			if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+				return i
+			}
+		case "number":
+			if f, err := strconv.ParseFloat(s, 64); err == nil {
+				return f
+			}
+		case "boolean":
+			if b, err := strconv.ParseBool(s); err == nil {
+				return b
+			}
+		}
+		return s
+	}
+	if p.Type != "array" {
+		return convert(raw[0], p.Type)
+	}
+	items := raw
+	if p.CollectionFormat != "multi" {
+		separator := map[string]string{"ssv": " ", "tsv": "\t", "pipes": "|"}[p.CollectionFormat]
+		if len(separator) == 0 {
+			separator = ","
+		}
+		items = strings.Split(raw[0], separator)
+	}
+	var itemType string
+	if p.Items != nil {
+		itemType = p.Items.Type
+	}
+	var array []interface{}
+	for _, s := range items {
+		array = append(array, convert(s, itemType))
+	}
+	return array
+}
+
+// validate checks the value against the schema, whose $refs point to the spec's definitions.
+func (m *MockServer) validate(schema *spec.Schema, value interface{}) error {
+	if schema == nil {
+		return nil
+	}
+	var schemaDoc map[string]interface{}
+	data, _ := json.Marshal(schema)
+	json.Unmarshal(data, &schemaDoc)
+	schemaDoc["definitions"] = m.definitions
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schemaDoc), gojsonschema.NewGoLoader(value))
+	if err != nil {
+		return err
+	}
+	if !result.Valid() {
+		var messages []string
+		for _, e := range result.Errors() {
+			messages = append(messages, e.String())
+		}
+		return fmt.Errorf("%s", strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+// successResponse returns the status and the schema of the operation's success response.
+func successResponse(op *spec.Operation) (int, *spec.Schema) {
+	if op.Responses == nil {
+		return http.StatusOK, nil
+	}
+	for status := 200; status < 300; status++ {
+		if resp, ok := op.Responses.StatusCodeResponses[status]; ok {
+			return status, resp.Schema
+		}
+	}
+	if op.Responses.Default != nil {
+		return http.StatusOK, op.Responses.Default.Schema
+	}
+	return http.StatusOK, nil
+}
+
+// schemaClass returns the class of the objects of the schema, from its $ref, or from the $ref of its items.
+func schemaClass(schema *spec.Schema) string {
+	if schema == nil {
+		return ""
+	}
+	if schema.Items != nil && schema.Items.Schema != nil {
+		return schemaClass(schema.Items.Schema)
+	}
+	ref := schema.Ref.String()
+	if strings.HasPrefix(ref, "#/definitions/") {
+		return strings.TrimPrefix(ref, "#/definitions/")
+	}
+	return ""
+}
+
+// respond carries out the operation on the store, and returns the status and the body of the response.
+func (m *MockServer) respond(route *mockRoute, bodyParam *spec.Parameter, body interface{},
+	values map[string]interface{}) (int, interface{}) {
+
+	status, schema := successResponse(route.operation)
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// The path parameter tagged Class.property picks the object.
+	var class, property string
+	var key interface{}
+	for _, p := range route.params {
+		tag := mqswag.GetMeqaTag(p.Description)
+		if p.In == "path" && tag != nil && len(tag.Class) > 0 && len(tag.Property) > 0 {
+			class, property, key = tag.Class, tag.Property, values[p.Name]
+		}
+	}
+	find := func() int {
+		for i, obj := range m.objects[class] {
+			if fmt.Sprint(obj[property]) == fmt.Sprint(key) {
+				return i
+			}
+		}
+		return -1
+	}
+
+	if bodyParam != nil && body != nil {
+		bodyClass := schemaClass(bodyParam.Schema)
+		if tag := mqswag.GetMeqaTag(bodyParam.Description); tag != nil && len(tag.Class) > 0 {
+			bodyClass = tag.Class
+		}
+		objects, isArray := body.([]interface{})
+		if !isArray {
+			objects = []interface{}{body}
+		}
+		for _, o := range objects {
+			obj, ok := o.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			replaced := false
+			for i, existing := range m.objects[bodyClass] {
+				if obj["id"] != nil && fmt.Sprint(existing["id"]) == fmt.Sprint(obj["id"]) {
+					m.objects[bodyClass][i] = obj
+					replaced = true
+				}
+			}
+			if !replaced {
+				m.objects[bodyClass] = append(m.objects[bodyClass], obj)
+			}
+		}
+		if schema != nil {
+			return status, body
+		}
+		return status, nil
+	}
+
+	if len(class) > 0 {
+		i := find()
+		if i < 0 {
+			return http.StatusNotFound, nil
+		}
+		obj := m.objects[class][i]
+		switch route.method {
+		case mqswag.MethodDelete:
+			m.objects[class] = append(m.objects[class][:i], m.objects[class][i+1:]...)
+		case mqswag.MethodPost, mqswag.MethodPut, mqswag.MethodPatch:
+			// The form parameters tagged with the class's properties update the object.
+			for _, p := range route.params {
+				tag := mqswag.GetMeqaTag(p.Description)
+				if v, ok := values[p.Name]; ok && p.In == "formData" && tag != nil && tag.Class == class {
+					obj[tag.Property] = v
+				}
+			}
+		}
+		if schema == nil {
+			return status, nil
+		}
+		if schemaClass(schema) == class && schema.Items == nil {
+			return status, obj
+		}
+	}
+
+	if schema == nil {
+		return status, nil
+	}
+	if schema.Type.Contains("array") {
+		list := []interface{}{}
+	objects:
+		for _, obj := range m.objects[schemaClass(schema)] {
+			for name, value := range values {
+				v, ok := obj[name]
+				if !ok {
+					continue
+				}
+				wanted, isArray := value.([]interface{})
+				if !isArray {
+					wanted = []interface{}{value}
+				}
+				matched := false
+				for _, w := range wanted {
+					matched = matched || fmt.Sprint(w) == fmt.Sprint(v)
+				}
+				if !matched {
+					continue objects
+				}
+			}
+			list = append(list, obj)
+		}
+		return status, list
+	}
+	if schema.Type.Contains("string") {
+		return status, "ok"
+	}
+	return status, map[string]interface{}{}
+}
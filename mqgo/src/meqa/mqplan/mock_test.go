@@ -0,0 +1,109 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const mockSwagger = `{
+  "swagger": "2.0",
+  "info": {"title": "pets", "version": "1.0"},
+  "basePath": "/v1",
+  "paths": {
+    "/pets": {
+      "post": {
+        "parameters": [{"name": "body", "in": "body", "required": true, "description": "<meqa Pet>",
+          "schema": {"$ref": "#/definitions/Pet"}}],
+        "responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}},
+        "security": [{"token": []}]
+      },
+      "get": {
+        "parameters": [{"name": "kind", "in": "query", "type": "string", "enum": ["cat", "dog"]}],
+        "responses": {"200": {"description": "ok", "schema": {"type": "array", "items": {"$ref": "#/definitions/Pet"}}}}
+      }
+    },
+    "/pets/mine": {
+      "get": {"responses": {"200": {"description": "ok", "schema": {"type": "string"}}}}
+    },
+    "/pets/{petId}": {
+      "get": {
+        "parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer", "description": "<meqa Pet.id>"}],
+        "responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}
+      },
+      "delete": {
+        "parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer", "description": "<meqa Pet.id>"}],
+        "responses": {"204": {"description": "deleted"}}
+      }
+    }
+  },
+  "securityDefinitions": {"token": {"type": "apiKey", "name": "Authorization", "in": "header"}},
+  "definitions": {
+    "Pet": {"type": "object", "required": ["id", "kind"],
+      "properties": {"id": {"type": "integer"}, "kind": {"type": "string", "enum": ["cat", "dog"]}}}
+  }
+}`
+
+func TestMockServer(t *testing.T) {
+	swagger := &mqswag.Swagger{}
+	if err := json.Unmarshal([]byte(mockSwagger), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	server := httptest.NewServer(NewMockServer(swagger, "secret"))
+	defer server.Close()
+
+	call := func(method string, path string, token string, body string) (int, string) {
+		req, _ := http.NewRequest(method, server.URL+"/v1"+path, strings.NewReader(body))
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(data))
+	}
+
+	cases := []struct {
+		method string
+		path   string
+		token  string
+		body   string
+		status int
+		result string
+	}{
+		{"POST", "/pets", "", `{"id": 1, "kind": "cat"}`, 401, ""},
+		{"POST", "/pets", "wrong", `{"id": 1, "kind": "cat"}`, 401, ""},
+		{"POST", "/pets", "secret", `{"id": 1, "kind": "cow"}`, 400, ""},
+		{"POST", "/pets", "secret", `{"kind": "cat"}`, 400, ""},
+		{"POST", "/pets", "secret", `{"id": 1, "kind": "cat"}`, 200, `{"id":1,"kind":"cat"}`},
+		{"POST", "/pets", "secret", `{"id": 2, "kind": "dog"}`, 200, `{"id":2,"kind":"dog"}`},
+		{"GET", "/pets/2", "", "", 200, `{"id":2,"kind":"dog"}`},
+		{"GET", "/pets/two", "", "", 400, ""},
+		{"GET", "/pets/mine", "", "", 200, `"ok"`},
+		{"GET", "/pets?kind=cat", "", "", 200, `[{"id":1,"kind":"cat"}]`},
+		{"GET", "/pets?kind=cow", "", "", 400, ""},
+		{"DELETE", "/pets/1", "", "", 204, ""},
+		{"DELETE", "/pets/1", "", "", 404, ""},
+		{"GET", "/pets", "", "", 200, `[{"id":2,"kind":"dog"}]`},
+		{"PUT", "/pets", "", "", 405, ""},
+		{"GET", "/owners", "", "", 404, ""},
+	}
+	for _, c := range cases {
+		status, result := call(c.method, c.path, c.token, c.body)
+		if status != c.status || status < 300 && result != c.result {
+			t.Errorf("%s %s: expecting %d %s, got %d %s", c.method, c.path, c.status, c.result, status, result)
+		}
+	}
+}
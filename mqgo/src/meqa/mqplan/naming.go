@@ -0,0 +1,189 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// TestNamer hands out the names of generated tests. A test is named after the operationId of the
+// REST call it makes, or the method and path when there is no operationId, followed by the ordinal
+// of the operation within the test suite. For instance the second addPet call in a suite is always
+// named addPet_2, no matter where in the suite it is, so the names stay the same between generator
+// runs and don't shift when tests are added or removed.
+type TestNamer struct {
+	counts map[string]int
+}
+
+func NewTestNamer() *TestNamer {
+	return &TestNamer{make(map[string]int)}
+}
+
+// Reset starts the ordinals over. Every test suite should start with a fresh namer.
+func (n *TestNamer) Reset() {
+	n.counts = make(map[string]int)
+}
+
+// Next returns the name for the next test that calls the operation.
+func (n *TestNamer) Next(method string, path string, opId string) string {
+	base := GetTestBaseName(method, path, opId)
+	n.counts[base]++
+	return fmt.Sprintf("%s_%d", base, n.counts[base])
+}
+
+// GetTestBaseName returns the test name without the ordinal. Characters that have special
+// meanings in the {{testName.paramSection.paramName}} templates are replaced with '_'.
+func GetTestBaseName(method string, path string, opId string) string {
+	if len(opId) > 0 {
+		return sanitizeName(opId)
+	}
+	name := sanitizeName(method + "_" + path)
+	for strings.Contains(name, "__") {
+		name = strings.Replace(name, "__", "_", -1)
+	}
+	return strings.Trim(name, "_")
+}
+
+func sanitizeName(name string) string {
+	mapping := func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}
+	return strings.Map(mapping, name)
+}
+
+// getNameOrdinal returns the number at the end of the test name, or 0 if there isn't one.
+func getNameOrdinal(name string) int {
+	i := strings.LastIndex(name, "_")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// renameInString replaces the test names in all the {{testName.paramSection.paramName}} templates
+// found in the string.
+func renameInString(str string, mapping map[string]string) string {
+	result := ""
+	for {
+		begin := strings.Index(str, "{{")
+		if begin < 0 {
+			break
+		}
+		end := strings.Index(str[begin:], "}}")
+		if end < 0 {
+			break
+		}
+		end += begin
+		template := strings.Trim(str[begin+2:end], " ")
+		ar := strings.SplitN(template, ".", 2)
+		if newName, ok := mapping[ar[0]]; ok && len(ar) == 2 {
+			template = newName + "." + ar[1]
+		}
+		result += str[:begin] + "{{" + template + "}}"
+		str = str[end+2:]
+	}
+	return result + str
+}
+
+func renameInInterface(in interface{}, mapping map[string]string) interface{} {
+	if str, ok := in.(string); ok {
+		return renameInString(str, mapping)
+	}
+	if m, ok := in.(map[string]interface{}); ok {
+		for k, v := range m {
+			m[k] = renameInInterface(v, mapping)
+		}
+		return m
+	}
+	if a, ok := in.([]interface{}); ok {
+		for i, v := range a {
+			a[i] = renameInInterface(v, mapping)
+		}
+		return a
+	}
+	return in
+}
+
+func (t *Test) renameReferences(mapping map[string]string) {
+	paramMaps := []map[string]interface{}{t.PathParams, t.QueryParams, t.HeaderParams, t.FormParams}
+	for _, m := range paramMaps {
+		renameInInterface(m, mapping)
+	}
+	t.BodyParams = renameInInterface(t.BodyParams, mapping)
+}
+
+// MigrateTestNames renames the tests that were named by the old generator (method_operation_position)
+// to the stable names handed out by TestNamer, and updates the templates that refer to them. It works
+// on both test plans and result files. A result file holds the tests of all the suites in one list,
+// we know a new suite starts when the position at the end of the old name stops increasing.
+// Returns the old name to new name mapping.
+func (plan *TestPlan) MigrateTestNames() map[string]string {
+	mapping := make(map[string]string)
+	for _, testSuite := range plan.SuiteList {
+		namer := NewTestNamer()
+		lastOrdinal := 0
+		// Templates can only refer to tests that ran before, so we keep a running mapping and always
+		// resolve to the latest test with the old name, just like TestHistory does.
+		current := make(map[string]string)
+		for _, t := range testSuite.Tests {
+			if t.Name == MeqaInit || len(t.Ref) > 0 {
+				continue
+			}
+			t.renameReferences(current)
+			ordinal := getNameOrdinal(t.Name)
+			if ordinal <= lastOrdinal {
+				namer.Reset()
+			}
+			lastOrdinal = ordinal
+
+			opId := ""
+			if plan.swagger != nil && plan.swagger.Paths != nil {
+				pathItem := plan.swagger.Paths.Paths[t.Path]
+				if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+					opId = op.ID
+				}
+			}
+			newName := namer.Next(t.Method, t.Path, opId)
+			current[t.Name] = newName
+			mapping[t.Name] = newName
+			t.Name = newName
+		}
+	}
+	return mapping
+}
+
+// MigrateTestPlanFile loads the test plan or result file at inPath, migrates the test names and
+// writes the result to outPath.
+func MigrateTestPlanFile(inPath string, outPath string, db *mqswag.DB) (map[string]string, error) {
+	plan := &TestPlan{}
+	err := plan.InitFromFile(inPath, db)
+	if err != nil {
+		return nil, err
+	}
+	mapping := plan.MigrateTestNames()
+
+	// The meqa_init section was folded into the plan's parameters when loading. Put it back as it was.
+	if plan.initTest != nil {
+		initSuite := CreateTestSuite(MeqaInit, []*Test{plan.initTest}, plan)
+		plan.SuiteMap[MeqaInit] = initSuite
+		plan.SuiteList = append([]*TestSuite{initSuite}, plan.SuiteList...)
+	}
+
+	os.Remove(outPath)
+	err = plan.DumpToFile(outPath)
+	if err != nil {
+		mqutil.Logger.Printf("failed to write %s: %s", outPath, err.Error())
+		return nil, err
+	}
+	return mapping, nil
+}
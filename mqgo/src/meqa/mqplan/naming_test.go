@@ -0,0 +1,232 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const namingSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {
+		"/pet": {"post": {"operationId": "addPet", "responses": {"200": {"description": "ok"}}}},
+		"/pet/{petId}": {"get": {
+			"parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer"}],
+			"responses": {"200": {"description": "ok"}}
+		}}
+	}
+}`
+
+func newNamingDB(t *testing.T) *mqswag.DB {
+	swagger := &mqswag.Swagger{}
+	if err := json.Unmarshal([]byte(namingSwagger), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	return db
+}
+
+func TestTestNamer(t *testing.T) {
+	namer := NewTestNamer()
+	names := []string{
+		namer.Next("post", "/pet", "addPet"),
+		namer.Next("get", "/pet/{petId}", ""),
+		namer.Next("post", "/pet", "addPet"),
+	}
+	if !reflect.DeepEqual(names, []string{"addPet_1", "get_pet_petId_1", "addPet_2"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	namer.Reset()
+	if name := namer.Next("post", "/pet", "addPet"); name != "addPet_1" {
+		t.Errorf("expecting the ordinals to start over after a reset, got %s", name)
+	}
+}
+
+func TestGetTestBaseName(t *testing.T) {
+	cases := []struct {
+		method, path, opId, name string
+	}{
+		{"post", "/pet", "addPet", "addPet"},
+		{"post", "/pet", "pet.add{x}", "pet_add_x_"},
+		{"get", "/pet/{petId}/photos", "", "get_pet_petId_photos"},
+		{"delete", "/store/order-items/", "", "delete_store_order-items"},
+	}
+	for _, c := range cases {
+		if name := GetTestBaseName(c.method, c.path, c.opId); name != c.name {
+			t.Errorf("%s %s %s: expecting %s, got %s", c.method, c.path, c.opId, c.name, name)
+		}
+	}
+}
+
+func TestRenameInString(t *testing.T) {
+	mapping := map[string]string{"post_pet_1": "addPet_1"}
+	cases := map[string]string{
+		"{{post_pet_1.bodyParams.id}}":            "{{addPet_1.bodyParams.id}}",
+		"/pet/{{ post_pet_1.bodyParams.id }}/x":   "/pet/{{addPet_1.bodyParams.id}}/x",
+		"{{other_1.bodyParams.id}}":               "{{other_1.bodyParams.id}}",
+		"{{post_pet_1}} and {{post_pet_1.a.b}}":   "{{post_pet_1}} and {{addPet_1.a.b}}",
+		"no template":                             "no template",
+		"{{post_pet_1.bodyParams.id":              "{{post_pet_1.bodyParams.id",
+		"{{post_pet_1.a}}{{post_pet_1.b}} {{ }}.": "{{addPet_1.a}}{{addPet_1.b}} {{}}.",
+	}
+	for in, out := range cases {
+		if s := renameInString(in, mapping); s != out {
+			t.Errorf("%s: expecting %s, got %s", in, out, s)
+		}
+	}
+}
+
+func TestMigrateTestNames(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	db := newNamingDB(t)
+	plan := &TestPlan{}
+	plan.Init(db.Swagger, db)
+	// A result file holds the tests of all the suites in one list, the second post_pet_1 starts a new suite.
+	err := plan.AddFromString(`results:
+- name: post_pet_1
+  path: /pet
+  method: post
+- name: get_pet_2
+  path: /pet/{petId}
+  method: get
+  pathParams:
+    petId: '{{post_pet_1.bodyParams.id}}'
+- name: post_pet_3
+  path: /pet
+  method: post
+- name: post_pet_1
+  path: /pet
+  method: post
+- name: ref_1
+  ref: other
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	mapping := plan.MigrateTestNames()
+
+	var names []string
+	for _, test := range plan.SuiteMap["results"].Tests {
+		names = append(names, test.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"addPet_1", "get_pet_petId_1", "addPet_2", "addPet_1", "ref_1"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+	if id := plan.SuiteMap["results"].Tests[1].PathParams["petId"]; id != "{{addPet_1.bodyParams.id}}" {
+		t.Errorf("expecting the template to refer to the new name, got %v", id)
+	}
+	if mapping["get_pet_2"] != "get_pet_petId_1" || mapping["post_pet_3"] != "addPet_2" || len(mapping) != 3 {
+		t.Errorf("unexpected mapping %v", mapping)
+	}
+}
+
+func TestMigrateTestPlanFile(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "naming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inPath := filepath.Join(dir, "in.yml")
+	outPath := filepath.Join(dir, "out.yml")
+	init := "meqa_init:\n- name: meqa_init\n  maxNodes: 5\n  strictDefault: true\n  requiredParamDefaults:\n    petId: 3\n---\n"
+	suite := "pet:\n- name: post_pet_1\n  path: /pet\n  method: post\n"
+	if err = ioutil.WriteFile(inPath, []byte(init+suite), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := MigrateTestPlanFile(inPath, outPath, newNamingDB(t))
+	if err != nil || mapping["post_pet_1"] != "addPet_1" {
+		t.Fatalf("unexpected mapping %v %v", mapping, err)
+	}
+
+	migrated := &TestPlan{}
+	if err = migrated.InitFromFile(outPath, newNamingDB(t)); err != nil {
+		t.Fatalf("can't load the migrated plan: %v", err)
+	}
+	if migrated.MaxNodes != 5 || !migrated.StrictDefault || migrated.ParamDefaults["petId"] != 3 {
+		t.Errorf("expecting the meqa_init settings to be kept, got %d %v %v",
+			migrated.MaxNodes, migrated.StrictDefault, migrated.ParamDefaults)
+	}
+	if len(migrated.SuiteMap["pet"].Tests) != 1 || migrated.SuiteMap["pet"].Tests[0].Name != "addPet_1" {
+		t.Errorf("expecting the test to be renamed")
+	}
+
+	// Without a meqa_init the migrated plan doesn't get one.
+	if err = ioutil.WriteFile(inPath, []byte(suite), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = MigrateTestPlanFile(inPath, outPath, newNamingDB(t)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(outPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), MeqaInit) {
+		t.Errorf("expecting no meqa_init in the migrated plan, got\n%s", data)
+	}
+}
+
+func TestMigrateTestPlanFileSettings(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "naming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	inPath := filepath.Join(dir, "in.yml")
+	outPath := filepath.Join(dir, "out.yml")
+	init := `meqa_init:
+- name: meqa_init
+  includeReadOnly: true
+  formatWarnings: true
+  strictDefault: true
+  requiredParamDefaults:
+    petId: 3
+  server: staging
+  serverVariables:
+    region: eu-west-1
+  fileSize: 64
+  fileContent: hello
+  maxNodes: 5
+  maxDepth: 2
+  maxRecursion: 1
+  reuseObjects: true
+  verifyCreate: true
+  rateLimit: 10
+---
+`
+	if err = ioutil.WriteFile(inPath, []byte(init+"pet:\n- name: post_pet_1\n  path: /pet\n  method: post\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = MigrateTestPlanFile(inPath, outPath, newNamingDB(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	original := &TestPlan{}
+	if err = original.InitFromFile(inPath, newNamingDB(t)); err != nil {
+		t.Fatal(err)
+	}
+	migrated := &TestPlan{}
+	if err = migrated.InitFromFile(outPath, newNamingDB(t)); err != nil {
+		t.Fatalf("can't load the migrated plan: %v", err)
+	}
+	if !reflect.DeepEqual(original.initTest, migrated.initTest) {
+		t.Errorf("expecting the same meqa_init, got %+v, was %+v", migrated.initTest, original.initTest)
+	}
+	if !migrated.IncludeReadOnly || !migrated.FormatWarnings || migrated.Server != "staging" ||
+		migrated.ServerVariables["region"] != "eu-west-1" || migrated.FileSize != 64 || migrated.FileContent != "hello" ||
+		migrated.MaxDepth != 2 || migrated.MaxRecursion != 1 || migrated.RateLimit != 10 {
+		t.Errorf("expecting the meqa_init settings to be kept, got %+v", migrated.initTest)
+	}
+}
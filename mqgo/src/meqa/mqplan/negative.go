@@ -0,0 +1,250 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// In the negative mode, a test is followed by one test per constraint of its parameters, each sending a value that
+// breaks that one constraint and expecting the request to fail: a value of the wrong type, a number past its
+// minimum or maximum, a string shorter than its minLength or longer than its maxLength, a value that isn't in the
+// enum, or a malformed date. The properties of an object body are broken one at a time the same way, and each of
+// its required properties is left out, and set to null unless it's nullable. The readOnly properties are left
+// alone. A negative test that the server accepts points at the validation the server is missing, and one that gets
+// a server error at a value the server doesn't handle.
+
+// violation is a value that breaks one constraint of a parameter, or of a property of the body.
+type violation struct {
+	param      string
+	property   string // the property of the body, if the parameter is the body
+	constraint string // e.g. maximum, or type
+	value      interface{}
+	omit       bool // the property is left out of the body
+}
+
+// String describes the violation, e.g. "body.age: maximum".
+func (v *violation) String() string {
+	if len(v.property) > 0 {
+		return fmt.Sprintf("%s.%s: %s", v.param, v.property, v.constraint)
+	}
+	return fmt.Sprintf("%s: %s", v.param, v.constraint)
+}
+
+// malformedFormats are the values that don't parse as their format.
+var malformedFormats = map[string]string{
+	"date":      "2021-13-45",
+	"date-time": "2021-13-45T25:61:00",
+	"email":     "not-an-email",
+	"uuid":      "not-a-uuid",
+}
+
+// schemaViolations returns the values that break the constraints of the schema, one constraint each. The strings
+// don't have a wrong type unless stringsHaveType, as everything is a string in a path or a query.
+func schemaViolations(s *spec.Schema, stringsHaveType bool) []violation {
+	if len(s.Type) == 0 {
+		return nil
+	}
+	var found []violation
+	add := func(constraint string, value interface{}) {
+		found = append(found, violation{constraint: constraint, value: value})
+	}
+	if len(s.Enum) > 0 {
+		add("enum", notInEnum(s.Enum))
+	}
+	switch s.Type[0] {
+	case "integer", "number":
+		add("type", "abc")
+		if s.Maximum != nil {
+			v := *s.Maximum
+			if !s.ExclusiveMaximum {
+				v++
+			}
+			add("maximum", numberValue(v, s.Type[0]))
+		}
+		if s.Minimum != nil {
+			v := *s.Minimum
+			if !s.ExclusiveMinimum {
+				v--
+			}
+			add("minimum", numberValue(v, s.Type[0]))
+		}
+	case "boolean":
+		add("type", "abc")
+	case "string":
+		if stringsHaveType {
+			add("type", 12345)
+		}
+		if len(s.Enum) > 0 {
+			break
+		}
+		if malformed, ok := malformedFormats[s.Format]; ok {
+			add("format", malformed)
+		} else if len(s.Format) > 0 {
+			break
+		}
+		if s.MinLength != nil && *s.MinLength > 0 {
+			add("minLength", strings.Repeat("a", int(*s.MinLength-1)))
+		}
+		if s.MaxLength != nil {
+			add("maxLength", strings.Repeat("a", int(*s.MaxLength+1)))
+		}
+	}
+	return found
+}
+
+func numberValue(v float64, typeName string) interface{} {
+	if typeName == "integer" {
+		return int64(v)
+	}
+	return v
+}
+
+// notInEnum returns a value of the enum's type that isn't one of its values.
+func notInEnum(enum []interface{}) interface{} {
+	if _, ok := enum[0].(string); !ok {
+		// The numbers of the spec are decoded as float64.
+		var max float64
+		for i, e := range enum {
+			if f, ok := e.(float64); ok && (i == 0 || f > max) {
+				max = f
+			}
+		}
+		return max + 1
+	}
+	value := "not_in_enum"
+	for i := 1; ; i++ {
+		found := false
+		for _, e := range enum {
+			if e == value {
+				found = true
+			}
+		}
+		if !found {
+			return value
+		}
+		value = fmt.Sprintf("not_in_enum%d", i)
+	}
+}
+
+// ExpandNegatives returns one test per constraint of the test's parameters, each breaking that constraint and
+// expecting a failure. The parameters and the body properties the test or the suite sets aren't broken.
+func (t *Test) ExpandNegatives() []*Test {
+	var params []spec.Parameter
+	if t.db != nil && t.db.Swagger != nil && t.db.Swagger.Paths != nil {
+		pathItem := t.db.Swagger.Paths.Paths[t.Path]
+		if op := GetOperationByMethod(&pathItem, t.Method); op != nil {
+			params = operationParams(&pathItem, op)
+		}
+	}
+	var found []violation
+	for i := range params {
+		p := &params[i]
+		if p.In != "body" {
+			if t.paramIsSet(p) {
+				continue
+			}
+			schema := (*spec.Schema)(mqswag.CreateSchemaFromSimple(&p.SimpleSchema, &p.CommonValidations))
+			for _, v := range schemaViolations(schema, false) {
+				v.param = p.Name
+				found = append(found, v)
+			}
+			continue
+		}
+		if p.Schema == nil {
+			continue
+		}
+		_, schema := t.db.Swagger.GetSchemaRootType((*mqswag.Schema)(p.Schema), nil)
+		if schema == nil || !isObjectSchema(p.Schema, t.db.Swagger) {
+			continue
+		}
+		var names []string
+		for name := range schema.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if t.bodyPropertyIsSet(name) {
+				continue
+			}
+			prop := schema.Properties[name]
+			if prop.ReadOnly {
+				continue
+			}
+			if isRequired((*spec.Schema)(schema), name) {
+				found = append(found, violation{param: p.Name, property: name, constraint: "missing", omit: true})
+				if !((*mqswag.Schema)(&prop)).IsNullable() {
+					found = append(found, violation{param: p.Name, property: name, constraint: "null"})
+				}
+			}
+			if _, referred, _ := t.db.Swagger.GetReferredSchema((*mqswag.Schema)(&prop)); referred != nil {
+				prop = spec.Schema(*referred)
+			}
+			for _, v := range schemaViolations(&prop, true) {
+				v.param, v.property = p.Name, name
+				found = append(found, v)
+			}
+		}
+	}
+
+	var tests []*Test
+	for i := range found {
+		test := *t
+		test.violation = &found[i]
+		test.Expect = mqutil.MapCopy(t.Expect)
+		if test.Expect == nil {
+			test.Expect = make(map[string]interface{})
+		}
+		test.Expect[ExpectStatus] = "fail"
+		delete(test.Expect, ExpectBody)
+		name := found[i].param
+		if len(found[i].property) > 0 {
+			name += "." + found[i].property
+		}
+		test.Name = fmt.Sprintf("%s[%s:%s]", t.Name, name, found[i].constraint)
+		tests = append(tests, &test)
+	}
+	return tests
+}
+
+// bodyPropertyIsSet returns whether the test or its suite sets the property of the body.
+func (t *Test) bodyPropertyIsSet(name string) bool {
+	sections := []*TestParams{&t.TestParams}
+	if t.suite != nil {
+		sections = append(sections, &t.suite.TestParams)
+	}
+	for _, section := range sections {
+		if m, ok := section.BodyParams.(map[string]interface{}); ok {
+			if _, exist := m[name]; exist {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generateViolation generates the parameter with the test's violation. A body is generated as usual, with the
+// property that's broken replaced. The value isn't compared, the request is expected to fail.
+func (t *Test) generateViolation(paramSpec *spec.Parameter, tag *mqswag.MeqaTag, db *mqswag.DB) (interface{}, error) {
+	v := t.violation
+	fmt.Printf("breaking %s\n", v)
+	if len(v.property) == 0 {
+		return v.value, nil
+	}
+	body, err := t.GenerateSchema("", tag, paramSpec.Schema, db, 3)
+	if err != nil {
+		return nil, err
+	}
+	if obj, ok := body.(map[string]interface{}); ok {
+		if v.omit {
+			delete(obj, v.property)
+		} else {
+			obj[v.property] = v.value
+		}
+	}
+	return body, nil
+}
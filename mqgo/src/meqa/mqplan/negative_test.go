@@ -0,0 +1,103 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const negativeSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "negative", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets": {"post": {
+			"parameters": [
+				{"name": "dryRun", "in": "query", "type": "boolean"},
+				{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "required": ["id", "name", "age", "owner"], "properties": {
+			"id": {"type": "integer", "readOnly": true},
+			"name": {"type": "string", "minLength": 1, "maxLength": 5},
+			"owner": {"type": "object", "x-nullable": true},
+			"age": {"type": "integer", "minimum": 1, "maximum": 20},
+			"status": {"type": "string", "enum": ["available", "sold"]},
+			"born": {"type": "string", "format": "date"}}}
+	}
+}`
+
+func TestNegativeData(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	// The server checks the age and the query, and nothing else. It breaks on a status that isn't a string.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var pet map[string]interface{}
+		json.Unmarshal(body, &pet)
+		if _, ok := pet["status"].(string); !ok && pet["status"] != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		age, ok := pet["age"].(float64)
+		dryRun := r.URL.Query().Get("dryRun")
+		if !ok || age < 1 || age > 20 || len(dryRun) > 0 && dryRun != "true" && dryRun != "false" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, negativeSwagger, server.URL, "")
+	if err := plan.AddFromString("suite:\n- name: create\n  path: /pets\n  method: post\n  generate: negative\n" +
+		"  queryParams:\n    dryRun: false\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("suite", nil)
+
+	results := make(map[string]TestResult)
+	for _, r := range plan.Results() {
+		results[r.Name] = r
+	}
+	// The readOnly id isn't broken, and the nullable owner isn't set to null.
+	expected := map[string]bool{"create": true, "create[body.age:missing]": true, "create[body.age:null]": true,
+		"create[body.age:type]": true, "create[body.age:maximum]": true, "create[body.age:minimum]": true,
+		"create[body.name:missing]": false, "create[body.name:null]": false, "create[body.name:type]": false,
+		"create[body.name:minLength]": false, "create[body.name:maxLength]": false, "create[body.owner:missing]": false,
+		"create[body.status:type]": false, "create[body.status:enum]": false, "create[body.born:type]": false,
+		"create[body.born:format]": false}
+	if len(results) != len(expected) {
+		t.Errorf("expecting %d tests, got %v", len(expected), results)
+	}
+	for name, passed := range expected {
+		r, ok := results[name]
+		if !ok || r.Passed != passed {
+			t.Errorf("expecting %s to pass: %v, got %+v", name, passed, r)
+			continue
+		}
+		if name != "create" && (!strings.Contains(name, strings.Split(r.Violation, ":")[0]) ||
+			!passed && !strings.Contains(r.Error, r.Violation)) {
+			t.Errorf("expecting %s to name the constraint it breaks, got %+v", name, r)
+		}
+	}
+
+	if r := results["create[body.status:type]"]; !r.ServerError || !strings.Contains(r.Error, "server error 500") {
+		t.Errorf("expecting the 500 to be flagged, got %+v", r)
+	}
+	if r := results["create[body.name:missing]"]; r.ServerError || r.Request.Body.(map[string]interface{})["name"] != nil {
+		t.Errorf("expecting the name to be left out, got %+v", r)
+	}
+
+	// Only the pet of the positive test is in the DB, the negative tests the server accepted don't add theirs.
+	last := plan.resultList[len(plan.resultList)-1]
+	if pets := last.db.Find("Pet", nil, nil, mqswag.MatchAlways, -1); len(pets) != 1 {
+		t.Errorf("expecting one pet in the DB, got %v", pets)
+	}
+}
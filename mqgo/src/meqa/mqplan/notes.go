@@ -0,0 +1,196 @@
+package mqplan
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"meqa/mqswag"
+	"regexp"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"gopkg.in/yaml.v2"
+)
+
+// The generator explains its choices for each test, e.g. why the test runs after another one, in the YAML
+// comments right above the test. The explanation is a managed block that is rewritten every time the plan is
+// generated. The other comments right above a test are notes added by hand, and are kept when the plan is
+// loaded and written again, or generated again over the existing file.
+const (
+	notesBegin = "meqa generated notes begin"
+	notesEnd   = "meqa generated notes end"
+)
+
+// addNote adds an explanation of a generated choice to the test.
+func (t *Test) addNote(format string, args ...interface{}) {
+	t.notes = append(t.notes, fmt.Sprintf(format, args...))
+}
+
+// annotateOperation explains how the test's operation is linked to the classes, and where the values of its
+// parameters come from.
+func annotateOperation(t *Test, op *spec.Operation, swagger *mqswag.Swagger) {
+	if swagger == nil || op == nil {
+		return
+	}
+	if tag := mqswag.GetTag(op); tag != nil && len(tag.Class) > 0 {
+		t.addNote("the %s tag on the operation links it to %s", tag.ToString(), tag.Class)
+	}
+	params := op.Parameters
+	if pathItem, ok := swagger.Paths.Paths[t.Path]; ok {
+		params = append(params, pathItem.Parameters...)
+	}
+	for _, p := range params {
+		tag := mqswag.GetTag(&p)
+		if p.Schema != nil {
+			if rootTag, _ := swagger.GetSchemaRootType((*mqswag.Schema)(p.Schema), tag); rootTag != nil && len(rootTag.Class) > 0 {
+				if tag == nil {
+					tag = mqswag.GetTag(p.Schema)
+				}
+				if tag != nil {
+					t.addNote("%s param %s: the %s tag links it to %s", p.In, p.Name, tag.ToString(), rootTag.Class)
+				} else {
+					t.addNote("%s param %s: its schema refers to %s", p.In, p.Name, rootTag.Class)
+				}
+			}
+		} else if tag != nil && len(tag.Class) > 0 {
+			t.addNote("%s param %s: the %s tag links it to %s", p.In, p.Name, tag.ToString(), tag.Class)
+		}
+		if p.Default != nil {
+			t.addNote("%s param %s: the declared default %v is sent when useDefaults is always or sometimes, "+
+				"otherwise the value is random", p.In, p.Name, p.Default)
+		} else if len(p.Enum) > 0 {
+			t.addNote("%s param %s: the value is picked from the enum %v", p.In, p.Name, p.Enum)
+		}
+	}
+}
+
+// testNotes are the comments right above a test in a plan file.
+type testNotes struct {
+	name      string
+	notes     []string // in the managed block
+	handNotes []string // outside the managed block
+}
+
+var noteNameRegexp = regexp.MustCompile(`^(?:- |  )name:(.*)$`)
+
+// readNotes collects the comments right above each test in the plan file, by suite name.
+func readNotes(data string) map[string][]*testNotes {
+	result := make(map[string][]*testNotes)
+	suite := ""
+	var current *testNotes
+	var notes, handNotes []string
+	inBlock := false
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimRight(line, "\r")
+		switch {
+		case line == "---":
+			suite, current, notes, handNotes = "", nil, nil, nil
+		case strings.HasPrefix(line, "#"):
+			text := strings.TrimPrefix(strings.TrimPrefix(line, "#"), " ")
+			if text == notesBegin {
+				inBlock = true
+			} else if text == notesEnd {
+				inBlock = false
+			} else if inBlock {
+				notes = append(notes, text)
+			} else if len(suite) > 0 {
+				handNotes = append(handNotes, text)
+			}
+		case len(line) == 0 || line[0] == ' ' && current == nil:
+		case line[0] != ' ' && line[0] != '-':
+			var key map[string]interface{}
+			if yaml.Unmarshal([]byte(line), &key) == nil {
+				for k := range key {
+					suite = k
+				}
+			}
+			notes, handNotes = nil, nil
+		case strings.HasPrefix(line, "- ") && len(suite) > 0:
+			current = &testNotes{notes: notes, handNotes: handNotes}
+			result[suite] = append(result[suite], current)
+			notes, handNotes = nil, nil
+			fallthrough
+		default:
+			if m := noteNameRegexp.FindStringSubmatch(line); m != nil && current != nil && len(current.name) == 0 {
+				var name string
+				if yaml.Unmarshal([]byte(m[1]), &name) == nil {
+					current.name = name
+				}
+			}
+		}
+	}
+	return result
+}
+
+// loadNotes puts the comments right above the tests in the plan file into the plan's tests.
+func (plan *TestPlan) loadNotes(data string) {
+	for suiteName, suiteNotes := range readNotes(data) {
+		testSuite := plan.SuiteMap[suiteName]
+		if testSuite == nil || len(testSuite.Tests) != len(suiteNotes) {
+			continue
+		}
+		for i, t := range testSuite.Tests {
+			t.notes, t.handNotes = suiteNotes[i].notes, suiteNotes[i].handNotes
+		}
+	}
+}
+
+// KeepHandNotes copies the notes added by hand to the tests in the existing plan file over to the tests of the
+// same suite and name, so generating the plan again doesn't lose them.
+func (plan *TestPlan) KeepHandNotes(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for suiteName, suiteNotes := range readNotes(string(data)) {
+		testSuite := plan.SuiteMap[suiteName]
+		if testSuite == nil {
+			continue
+		}
+		byName := make(map[string][]string)
+		for _, n := range suiteNotes {
+			if _, exist := byName[n.name]; !exist {
+				byName[n.name] = n.handNotes
+			}
+		}
+		for _, t := range testSuite.Tests {
+			if len(t.handNotes) == 0 {
+				t.handNotes = byName[t.Name]
+			}
+		}
+	}
+	return nil
+}
+
+// writeSuite writes the suite's tests, each with the comments right above it.
+func writeSuite(w io.Writer, testSuite *TestSuite) error {
+	key, err := yaml.Marshal(testSuite.Name)
+	if err != nil {
+		return err
+	}
+	if len(testSuite.Tests) == 0 {
+		_, err = io.WriteString(w, strings.TrimSuffix(string(key), "\n")+": []\n")
+		return err
+	}
+	io.WriteString(w, strings.TrimSuffix(string(key), "\n")+":\n")
+	for _, t := range testSuite.Tests {
+		var comments []string
+		comments = append(comments, t.handNotes...)
+		if len(t.notes) > 0 {
+			comments = append(comments, notesBegin)
+			comments = append(comments, t.notes...)
+			comments = append(comments, notesEnd)
+		}
+		for _, c := range comments {
+			io.WriteString(w, strings.TrimRight("# "+c, " ")+"\n")
+		}
+		testBytes, err := yaml.Marshal([]*Test{t})
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write(testBytes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const notesSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {
+		"/pets": {"post": {"operationId": "addPet",
+			"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}}},
+		"/pets/{id}": {
+			"get": {"operationId": "getPet", "parameters": [{"name": "id", "in": "path", "required": true, "type": "integer"},
+				{"name": "verbose", "in": "query", "type": "boolean", "default": false}],
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}},
+			"delete": {"operationId": "deletePet", "parameters": [{"name": "id", "in": "path", "required": true, "type": "integer"}],
+				"responses": {"200": {"description": "ok"}}}}
+	},
+	"definitions": {"Pet": {"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}}}
+}`
+
+func generateNotesPlan(t *testing.T) *TestPlan {
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(notesSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	dag := mqswag.NewDAG()
+	if err = swagger.AddToDAG(dag); err != nil {
+		t.Fatalf("can't create the DAG: %v", err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+	plan, err := GeneratePathTestPlan(swagger, dag, nil)
+	if err != nil {
+		t.Fatalf("can't generate the plan: %v", err)
+	}
+	return plan
+}
+
+func TestPlanNotes(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "notes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "path.yml")
+	plan := generateNotesPlan(t)
+	if err = plan.DumpToFile(path); err != nil {
+		t.Fatalf("can't write the plan: %v", err)
+	}
+	data, _ := ioutil.ReadFile(path)
+	for _, note := range []string{
+		"# body param body: its schema refers to Pet",
+		"# query param verbose: the declared default false is sent",
+		"# path param id: the output id of addPet_1, as the path has an id param",
+		"# runs after getPet_1: the operations on the path run in the order",
+		"# negative variant: uses the id that deletePet_1 deleted, and expects a failure",
+		"# required-only variant of addPet_1: the body only has the required properties",
+		"optionalProperties: never",
+	} {
+		if !strings.Contains(string(data), note) {
+			t.Errorf("expecting the note %q in the plan:\n%s", note, data)
+		}
+	}
+
+	// A note added by hand above a test survives loading and writing the plan.
+	handNote := "# the shelter's pets have ids above 1000\n"
+	edited := strings.Replace(string(data), "# meqa generated notes begin\n# runs after getPet_1", handNote+
+		"# meqa generated notes begin\n# runs after getPet_1", 1)
+	if err = ioutil.WriteFile(path, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+	loaded := &TestPlan{}
+	if err = loaded.InitFromFile(path, &mqswag.DB{}); err != nil {
+		t.Fatalf("can't load the plan with the notes: %v", err)
+	}
+	rewritten := filepath.Join(dir, "rewritten.yml")
+	if err = loaded.DumpToFile(rewritten); err != nil {
+		t.Fatalf("can't write the plan: %v", err)
+	}
+	data, _ = ioutil.ReadFile(rewritten)
+	if !strings.Contains(string(data), handNote+"# meqa generated notes begin\n# runs after getPet_1") {
+		t.Errorf("expecting the hand note and the generated notes after rewriting:\n%s", data)
+	}
+
+	// Generating the plan again keeps the hand note, and rewrites the managed block.
+	plan = generateNotesPlan(t)
+	if err = plan.KeepHandNotes(path); err != nil {
+		t.Fatalf("can't read the notes: %v", err)
+	}
+	if err = plan.DumpToFile(path); err != nil {
+		t.Fatalf("can't write the plan: %v", err)
+	}
+	data, _ = ioutil.ReadFile(path)
+	if strings.Count(string(data), handNote) != 1 || strings.Count(string(data), "# runs after getPet_1") != 1 {
+		t.Errorf("expecting the hand note and the generated note once:\n%s", data)
+	}
+}
+
+func TestGenerateDeprecated(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	defer func() { Deprecated = DeprecatedTest }()
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(strings.Replace(notesSwagger, `"delete": {`, `"delete": {"deprecated": true, `, 1)),
+		(*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	dag := mqswag.NewDAG()
+	if err = swagger.AddToDAG(dag); err != nil {
+		t.Fatalf("can't create the DAG: %v", err)
+	}
+	dag.Sort()
+	dag.CheckWeight()
+
+	for _, policy := range []string{DeprecatedTest, DeprecatedWarn, DeprecatedSkip} {
+		Deprecated = policy
+		for _, generate := range []func() (*TestPlan, error){
+			func() (*TestPlan, error) { return GeneratePathTestPlan(swagger, dag, nil) },
+			func() (*TestPlan, error) { return GenerateSimpleTestPlan(swagger, dag) },
+		} {
+			plan, err := generate()
+			if err != nil {
+				t.Fatalf("can't generate the plan: %v", err)
+			}
+			deletes := 0
+			for _, suite := range plan.SuiteList {
+				for _, test := range suite.Tests {
+					if test.Method != mqswag.MethodDelete {
+						continue
+					}
+					deletes++
+					if len(test.notes) == 0 || !strings.Contains(test.notes[0], "deprecated") {
+						t.Errorf("expecting a note on the deprecated operation, got %v", test.notes)
+					}
+				}
+			}
+			if (deletes == 0) != (policy == DeprecatedSkip) {
+				t.Errorf("deprecated %s: generated %d tests of the deprecated operation", policy, deletes)
+			}
+		}
+	}
+}
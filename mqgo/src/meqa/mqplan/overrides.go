@@ -0,0 +1,63 @@
+package mqplan
+
+import (
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"os"
+	"regexp"
+)
+
+// The propertyOverrides of meqa_init, of a suite's meqa_init or of a test fix the values of the properties in all
+// the objects the test generates for its bodies, at any depth, e.g. a tenantId the server requires everywhere.
+// A key is a property name, or Class.property to only override the property of one class. The values can refer to
+// the history, e.g. {{createTenant_1.outputs.id}}, and to environment variables, e.g. ${TENANT_ID}. The test's
+// bodyParams still win over the overrides.
+
+var envVarRe = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces the ${NAME} environment variables in the strings of v. The unset ones are left as is.
+func expandEnv(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case string:
+		return envVarRe.ReplaceAllStringFunc(vv, func(match string) string {
+			name := match[2 : len(match)-1]
+			if value, ok := os.LookupEnv(name); ok {
+				return value
+			}
+			mqutil.Logger.Printf("warning: the environment variable %s isn't set", name)
+			return match
+		})
+	case map[string]interface{}:
+		for k, value := range vv {
+			vv[k] = expandEnv(value)
+		}
+	case []interface{}:
+		for i, value := range vv {
+			vv[i] = expandEnv(value)
+		}
+	}
+	return v
+}
+
+// resolveOverrides resolves the history templates and the environment variables in the test's overrides.
+func (t *Test) resolveOverrides(h *TestHistory) {
+	MapParamsResolveWithHistory(t.PropOverrides, h)
+	for k, v := range t.PropOverrides {
+		t.PropOverrides[k] = expandEnv(v)
+	}
+}
+
+// propertyOverride returns the override of the property of an object of the tag's class, by Class.property
+// first, then by the property name.
+func (t *Test) propertyOverride(tag *mqswag.MeqaTag, name string) (interface{}, bool) {
+	if len(t.PropOverrides) == 0 {
+		return nil, false
+	}
+	if tag != nil && len(tag.Class) > 0 {
+		if v, ok := t.PropOverrides[tag.Class+"."+name]; ok {
+			return mqutil.InterfaceCopy(v), true
+		}
+	}
+	v, ok := t.PropOverrides[name]
+	return mqutil.InterfaceCopy(v), ok
+}
@@ -0,0 +1,110 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+const overrideSwagger = `{
+  "swagger": "2.0",
+  "info": {"title": "orders", "version": "1.0"},
+  "paths": {
+    "/orders": {
+      "post": {
+        "operationId": "addOrder",
+        "parameters": [{"name": "body", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Order"}}],
+        "responses": {"200": {"description": "ok"}}
+      }
+    }
+  },
+  "definitions": {
+    "Order": {
+      "type": "object",
+      "required": ["customer", "lines"],
+      "properties": {
+        "tenantId": {"type": "string"},
+        "note": {"type": "string"},
+        "customer": {
+          "type": "object",
+          "description": "<meqa Customer>",
+          "required": ["tenantId", "name"],
+          "properties": {"tenantId": {"type": "string"}, "name": {"type": "string"}}
+        },
+        "lines": {
+          "type": "array",
+          "minItems": 2,
+          "items": {
+            "type": "object",
+            "description": "<meqa Line>",
+            "required": ["tenantId", "name"],
+            "properties": {"tenantId": {"type": "string"}, "name": {"type": "string"}}
+          }
+        }
+      }
+    },
+    "Customer": {
+      "type": "object",
+      "properties": {"tenantId": {"type": "string"}, "name": {"type": "string"}}
+    },
+    "Line": {
+      "type": "object",
+      "properties": {"tenantId": {"type": "string"}, "name": {"type": "string"}}
+    }
+  }
+}`
+
+func TestPropertyOverrides(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	os.Setenv("MEQA_TEST_TENANT", "acme")
+	defer os.Unsetenv("MEQA_TEST_TENANT")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, overrideSwagger, server.URL, "  propertyOverrides:\n    tenantId: '${MEQA_TEST_TENANT}'\n"+
+		"    Customer.name: ann\n    note: plan note\n")
+	suite := "suite:\n- name: addOrder_1\n  path: /orders\n  method: post\n" +
+		"- name: addOrder_2\n  path: /orders\n  method: post\n  propertyOverrides:\n    Line.name: '{{addOrder_1.bodyParams.note}}'\n" +
+		"  bodyParams:\n    note: test note\n"
+	if err := plan.AddFromString(suite); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+
+	if _, err := plan.Run("suite", nil); err != nil {
+		t.Fatalf("can't run the plan: %v", err)
+	}
+	first := plan.SuiteMap["suite"].getHistory().GetTest("addOrder_1")
+	second := plan.SuiteMap["suite"].getHistory().GetTest("addOrder_2")
+	if first == nil || second == nil {
+		t.Fatalf("expecting both tests in the history")
+	}
+	check := func(test *Test, note string, lineName string) {
+		body, _ := test.BodyParams.(map[string]interface{})
+		if body["tenantId"] != "acme" || body["note"] != note {
+			t.Errorf("%s: expecting the overridden tenantId and note, got %v", test.Name, body)
+		}
+		customer, _ := body["customer"].(map[string]interface{})
+		if customer["tenantId"] != "acme" || customer["name"] != "ann" {
+			t.Errorf("%s: expecting the nested object's properties overridden, got %v", test.Name, customer)
+		}
+		lines, _ := body["lines"].([]interface{})
+		if len(lines) < 2 {
+			t.Fatalf("%s: expecting the lines to be generated, got %v", test.Name, body["lines"])
+		}
+		for _, l := range lines {
+			line, _ := l.(map[string]interface{})
+			if line["tenantId"] != "acme" || len(lineName) > 0 && line["name"] != lineName ||
+				len(lineName) == 0 && line["name"] == "ann" {
+				t.Errorf("%s: expecting the array items' properties overridden, got %v", test.Name, line)
+			}
+		}
+	}
+	check(first, "plan note", "")
+	check(second, "test note", "plan note")
+}
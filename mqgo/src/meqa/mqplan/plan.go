@@ -4,8 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"math/rand"
+	"math/big"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -34,7 +35,7 @@ func (dst *TestParams) Copy(src *TestParams) {
 	dst.QueryParams = mqutil.MapCombine(dst.QueryParams, src.QueryParams)
 	dst.FormParams = mqutil.MapCombine(dst.FormParams, src.FormParams)
 	dst.PathParams = mqutil.MapCombine(dst.PathParams, src.PathParams)
-	dst.HeaderParams = mqutil.MapCombine(dst.HeaderParams, src.HeaderParams)
+	dst.HeaderParams = mqutil.HeaderCombine(dst.HeaderParams, src.HeaderParams)
 
 	if caseMap, caseIsMap := dst.BodyParams.(map[string]interface{}); caseIsMap {
 		if testMap, testIsMap := src.BodyParams.(map[string]interface{}); testIsMap {
@@ -51,7 +52,7 @@ func (dst *TestParams) Add(src *TestParams) {
 	dst.QueryParams = mqutil.MapAdd(dst.QueryParams, src.QueryParams)
 	dst.FormParams = mqutil.MapAdd(dst.FormParams, src.FormParams)
 	dst.PathParams = mqutil.MapAdd(dst.PathParams, src.PathParams)
-	dst.HeaderParams = mqutil.MapAdd(dst.HeaderParams, src.HeaderParams)
+	dst.HeaderParams = mqutil.HeaderAdd(dst.HeaderParams, src.HeaderParams)
 
 	if caseMap, caseIsMap := dst.BodyParams.(map[string]interface{}); caseIsMap {
 		if testMap, testIsMap := src.BodyParams.(map[string]interface{}); testIsMap {
@@ -72,15 +73,22 @@ type TestSuite struct {
 
 	// test suite parameters
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
-	Strict     bool
+	TestSettings
 
 	// Authentication
 	Username string
 	Password string
 	ApiToken string
 
-	plan *TestPlan
-	db   *mqswag.DB // objects generated/obtained as part of this suite
+	// The tests that run before and after the suite's tests, set in the suite's meqa_init.
+	Setup    []*Test
+	Teardown []*Test
+
+	plan    *TestPlan
+	running sync.Mutex             // a suite can't run again, e.g. through a ref, until its current run is done
+	history *TestHistory           // the tests run as part of this suite
+	db      *mqswag.DB             // objects generated/obtained as part of this suite
+	lastIds map[string]interface{} // class name to the last id the server assigned
 
 	comment string
 }
@@ -90,7 +98,7 @@ func CreateTestSuite(name string, tests []*Test, plan *TestPlan) *TestSuite {
 	c.Name = name
 	c.Tests = tests
 	(&c.TestParams).Copy(&plan.TestParams)
-	c.Strict = plan.Strict
+	c.TestSettings = plan.TestSettings
 
 	c.Username = plan.Username
 	c.Password = plan.Password
@@ -100,25 +108,68 @@ func CreateTestSuite(name string, tests []*Test, plan *TestPlan) *TestSuite {
 	return &c
 }
 
+// CheckMonotonicId verifies that the id the server assigned to a newly created object is bigger than
+// all the ids assigned to the same class before in this suite. Integer ids are compared as numbers, at any
+// size, the others as strings.
+func (tc *TestSuite) CheckMonotonicId(className string, id interface{}) error {
+	if tc.lastIds == nil {
+		tc.lastIds = make(map[string]interface{})
+	}
+	last, exist := tc.lastIds[className]
+	tc.lastIds[className] = id
+	if !exist {
+		return nil
+	}
+	if compareIds(last, id) >= 0 {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf(
+			"=== test failed, %s id %v assigned by server is not bigger than the previous one %v ===", className, id, last))
+	}
+	return nil
+}
+
+// compareIds returns -1, 0 or 1 if a is less than, equal to or bigger than b.
+func compareIds(a interface{}, b interface{}) int {
+	as := strings.Trim(mqutil.InterfaceToJsonString(a), `"`)
+	bs := strings.Trim(mqutil.InterfaceToJsonString(b), `"`)
+	// The ids can be bigger than a float64 holds exactly, e.g. snowflake ids.
+	ai, aOk := new(big.Int).SetString(as, 10)
+	bi, bOk := new(big.Int).SetString(bs, 10)
+	if aOk && bOk {
+		return ai.Cmp(bi)
+	}
+	return strings.Compare(as, bs)
+}
+
 // Represents all the test suites in the DSL.
 type TestPlan struct {
 	SuiteMap  map[string](*TestSuite)
 	SuiteList [](*TestSuite)
 	db        *mqswag.DB
 	swagger   *mqswag.Swagger
+	path      string // the file the plan is loaded from
 
 	// global parameters
 	TestParams `yaml:",inline,omitempty" json:",inline,omitempty"`
-	Strict     bool
+	TestSettings
+	PlanSettings
 
 	// Authentication
 	Username string
 	Password string
 	ApiToken string
 
+	initTest *Test // the meqa_init test the global parameters are loaded from
+
 	// Run result.
 	resultList   []*Test
 	ResultCounts map[string]int
+	mutex        sync.Mutex // guards the run result when the suites run in parallel
+
+	limiter rateLimiter // spaces the calls by the rate limit
+
+	// The number of runs of each operation with the coverage policy for the optional parameters.
+	optionalRuns  map[string]int
+	optionalMutex sync.Mutex
 
 	comment string
 }
@@ -148,8 +199,14 @@ func (plan *TestPlan) AddFromString(data string) error {
 			// global parameters
 			for _, t := range testList {
 				t.Init(nil)
+				plan.initTest = t
 				(&plan.TestParams).Copy(&t.TestParams)
-				plan.Strict = t.Strict
+				plan.TestSettings = t.TestSettings
+				plan.PlanSettings = t.PlanSettings
+				if err = t.checkOptions(); err != nil {
+					mqutil.Logger.Println(err.Error())
+					return err
+				}
 			}
 
 			continue
@@ -157,6 +214,17 @@ func (plan *TestPlan) AddFromString(data string) error {
 		testSuite := CreateTestSuite(suiteName, testList, plan)
 		for _, t := range testList {
 			t.Init(testSuite)
+			if err = t.checkMatchers(); err != nil {
+				return err
+			}
+			if err = t.checkOptions(); err != nil {
+				mqutil.Logger.Println(err.Error())
+				return err
+			}
+			if t.Name == MeqaInit {
+				testSuite.Setup = t.Setup
+				testSuite.Teardown = t.Teardown
+			}
 		}
 		err = plan.Add(testSuite)
 		if err != nil {
@@ -168,6 +236,7 @@ func (plan *TestPlan) AddFromString(data string) error {
 
 func (plan *TestPlan) InitFromFile(path string, db *mqswag.DB) error {
 	plan.Init(db.Swagger, db)
+	plan.path = path
 
 	data, err := ioutil.ReadFile(path)
 	if err != nil {
@@ -177,11 +246,30 @@ func (plan *TestPlan) InitFromFile(path string, db *mqswag.DB) error {
 	}
 	chunks := strings.Split(string(data), "---")
 	for _, chunk := range chunks {
-		plan.AddFromString(chunk)
+		err = plan.AddFromString(chunk)
+		if err != nil {
+			return err
+		}
+	}
+	plan.loadNotes(string(data))
+	if len(plan.Fixtures) > 0 {
+		err = plan.db.LoadFixtures(plan.getFixturesPath())
+		if err != nil {
+			mqutil.Logger.Println(err.Error())
+			return err
+		}
 	}
 	return nil
 }
 
+// getFixturesPath returns the fixtures file's path. A relative path is relative to the test plan file.
+func (plan *TestPlan) getFixturesPath() string {
+	if filepath.IsAbs(plan.Fixtures) || len(plan.path) == 0 {
+		return plan.Fixtures
+	}
+	return filepath.Join(filepath.Dir(plan.path), plan.Fixtures)
+}
+
 func WriteComment(comment string, f *os.File) {
 	ar := strings.Split(comment, "\n")
 	for _, line := range ar {
@@ -204,19 +292,14 @@ func (plan *TestPlan) DumpToFile(path string) error {
 		if len(testSuite.comment) > 0 {
 			WriteComment(testSuite.comment, f)
 		}
-		count, err := f.WriteString("---\n")
+		_, err := f.WriteString("---\n")
 		if err != nil {
 			return err
 		}
-		testMap := map[string]interface{}{testSuite.Name: testSuite.Tests}
-		caseBytes, err := yaml.Marshal(testMap)
+		err = writeSuite(f, testSuite)
 		if err != nil {
 			return err
 		}
-		count, err = f.Write(caseBytes)
-		if count != len(caseBytes) || err != nil {
-			panic("writing test suite failed")
-		}
 	}
 	return nil
 }
@@ -295,18 +378,57 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 		mqutil.Logger.Println(str)
 		return resultCounts, errors.New(str)
 	}
+	tc.running.Lock()
+	defer tc.running.Unlock()
+	// The templates are resolved with the tests in this suite first. A suite run through a ref sees the
+	// tests of the suite that runs it.
+	parentHistory := &History
+	if parentTest != nil && parentTest.suite != nil && parentTest.suite.history != nil {
+		parentHistory = parentTest.suite.history
+	}
+	tc.history = &TestHistory{parent: parentHistory}
 	tc.db = plan.db.CloneSchema()
+	tc.lastIds = nil
 	defer func() {
 		tc.db = nil
+		tc.history = nil
 	}()
-	resultCounts[mqutil.Total] = len(tc.Tests)
+	resultCounts[mqutil.Total] = len(tc.Tests) + len(tc.Setup) + len(tc.Teardown)
 	resultCounts[mqutil.Failed] = 0
+
+	err := plan.runTests(tc, parentTest, resultCounts)
+	// The teardown tests always run. Their errors don't replace the error of the suite's tests.
+	for _, test := range tc.Teardown {
+		teardownErr := plan.runTest(tc, test, nil, resultCounts)
+		if teardownErr != nil {
+			mqutil.Logger.Printf("teardown test %s failed: %s", test.Name, teardownErr.Error())
+			if err == nil {
+				err = teardownErr
+			}
+		}
+	}
+	if err != nil {
+		resultCounts[mqutil.Skipped] = resultCounts[mqutil.Total] - resultCounts[mqutil.Passed] - resultCounts[mqutil.Failed]
+	}
+	return resultCounts, err
+}
+
+// runTests runs the setup tests, then the suite's tests, until one of them fails. A failed negative test doesn't
+// stop the suite, so all the values the server accepts are found, its error is returned at the end.
+func (plan *TestPlan) runTests(tc *TestSuite, parentTest *Test, resultCounts map[string]int) error {
+	var negativeErr error
+	for _, test := range tc.Setup {
+		err := plan.runTest(tc, test, nil, resultCounts)
+		if err != nil {
+			return err
+		}
+	}
 	for _, test := range tc.Tests {
 		if len(test.Ref) != 0 {
-			test.Strict = tc.Strict
-			resultCounts, err := plan.Run(test.Ref, test)
+			test.TestSettings.inherit(&tc.TestSettings)
+			_, err := plan.Run(test.Ref, test)
 			if err != nil {
-				return resultCounts, err
+				return err
 			}
 			continue
 		}
@@ -314,46 +436,182 @@ func (plan *TestPlan) Run(name string, parentTest *Test) (map[string]int, error)
 		if test.Name == MeqaInit {
 			// Apply the parameters to the test suite.
 			(&tc.TestParams).Copy(&test.TestParams)
-			tc.Strict = test.Strict
+			settings := test.TestSettings
+			settings.inherit(&tc.TestSettings)
+			tc.TestSettings = settings
 			continue
 		}
 
-		dup := test.Duplicate()
-		dup.Strict = tc.Strict
-		if parentTest != nil {
-			dup.CopyParent(parentTest)
+		tests := []*Test{test}
+		if len(test.Dataset) > 0 {
+			// Run the test once per row of the dataset.
+			var err error
+			tests, err = test.ExpandDataset()
+			if err != nil {
+				resultCounts[mqutil.Failed]++
+				return err
+			}
+			resultCounts[mqutil.Total] += len(tests) - 1
 		}
-		dup.ResolveHistoryParameters(&History)
-		History.Append(dup)
-		if parentTest != nil {
-			dup.Name = parentTest.Name // always inherit the name
+		// Run the test once per combination of the enum values of its parameters, with allEnums or the allenums
+		// flag in their tags.
+		var enumTests []*Test
+		for _, t := range tests {
+			enumTests = append(enumTests, t.ExpandEnums()...)
 		}
-		err := dup.Run(tc)
-		dup.err = err
-		plan.resultList = append(plan.resultList, dup)
-		if dup.schemaError != nil {
-			resultCounts[mqutil.SchemaMismatch]++
+		resultCounts[mqutil.Total] += len(enumTests) - len(tests)
+		tests = enumTests
+		if test.Generate == GenerateBoundary || len(test.Generate) == 0 && tc.Generate == GenerateBoundary {
+			// Run the test once per combination of the edge values of its parameters.
+			var expanded []*Test
+			for _, t := range tests {
+				expanded = append(expanded, t.ExpandBoundaries()...)
+			}
+			resultCounts[mqutil.Total] += len(expanded) - len(tests)
+			tests = expanded
 		}
-		if err != nil {
-			resultCounts[mqutil.Failed]++
-			resultCounts[mqutil.Skipped] = len(tc.Tests) - resultCounts[mqutil.Passed] - 1
-			return resultCounts, err
+		if test.Generate == GenerateNegative || len(test.Generate) == 0 && tc.Generate == GenerateNegative {
+			// Follow each test with the ones that break its constraints.
+			var expanded []*Test
+			for _, t := range tests {
+				expanded = append(append(expanded, t), t.ExpandNegatives()...)
+			}
+			resultCounts[mqutil.Total] += len(expanded) - len(tests)
+			tests = expanded
 		}
-		resultCounts[mqutil.Passed]++
+		if test.Repeat > 1 {
+			// Run each test repeat times. Each run is a new copy of the test, so its parameters are generated
+			// afresh, and the templates that refer to the test's name resolve to the last run.
+			var repeated []*Test
+			for _, t := range tests {
+				for i := 0; i < test.Repeat; i++ {
+					repeated = append(repeated, t)
+				}
+			}
+			resultCounts[mqutil.Total] += len(repeated) - len(tests)
+			tests = repeated
+		}
+		for _, t := range tests {
+			err := plan.runTest(tc, t, parentTest, resultCounts)
+			if err != nil && t.violation != nil {
+				if negativeErr == nil {
+					negativeErr = err
+				}
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return negativeErr
+}
+
+// runTest runs a copy of the test and records the result.
+func (plan *TestPlan) runTest(tc *TestSuite, t *Test, parentTest *Test, resultCounts map[string]int) error {
+	dup := t.Duplicate()
+	dup.TestSettings.inherit(&tc.TestSettings)
+	if parentTest != nil {
+		dup.CopyParent(parentTest)
+	}
+	history := tc.getHistory()
+	skip, err := dup.Skipped(history)
+	if err != nil {
+		resultCounts[mqutil.Failed]++
+		return err
+	}
+	if skip {
+		fmt.Printf("\nSkipping test case: %s\n", dup.Name)
+		resultCounts[mqutil.Skipped]++
+		return nil
+	}
+	dup.ResolveHistoryParameters(history)
+	if parentTest != nil {
+		dup.Name = parentTest.Name // always inherit the name
+	}
+	// Score the assertions before running, running sets the expect values to the actual response.
+	dup.Assertions, dup.assertionHint = dup.AssertionStrength()
+	var snapshot *mqswag.DBSnapshot
+	if dup.Isolate {
+		snapshot = tc.db.Snapshot()
+	}
+	err = dup.Run(tc)
+	if snapshot != nil {
+		tc.db.Restore(snapshot)
+	}
+	dup.err = err
+	history.Append(dup)
+	plan.mutex.Lock()
+	plan.resultList = append(plan.resultList, dup)
+	plan.mutex.Unlock()
+	if dup.schemaError != nil {
+		resultCounts[mqutil.SchemaMismatch]++
+	}
+	if dup.skipped {
+		resultCounts[mqutil.Skipped]++
+		return nil
 	}
-	return resultCounts, nil
+	if err != nil {
+		resultCounts[mqutil.Failed]++
+		return err
+	}
+	resultCounts[mqutil.Passed]++
+	return nil
+}
+
+// RunSuites runs the named test suites and adds up their result counts in plan.ResultCounts. Up to
+// workers suites run at the same time. The tests within a suite always run one after another.
+func (plan *TestPlan) RunSuites(names []string, workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	nameChan := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range nameChan {
+				mqutil.Logger.Printf("\n---\nTest suite: %s\n", name)
+				fmt.Printf("\n---\nTest suite: %s\n", name)
+				counts, err := plan.Run(name, nil)
+				mqutil.Logger.Printf("err:\n%v", err)
+				plan.mutex.Lock()
+				for k := range counts {
+					plan.ResultCounts[k] += counts[k]
+				}
+				plan.mutex.Unlock()
+			}
+		}()
+	}
+	for _, name := range names {
+		nameChan <- name
+	}
+	close(nameChan)
+	wg.Wait()
+}
+
+// getHistory returns the history to resolve the templates of the suite's tests with.
+func (tc *TestSuite) getHistory() *TestHistory {
+	if tc == nil || tc.history == nil {
+		return &History
+	}
+	return tc.history
 }
 
 // The current global TestPlan
 var Current TestPlan
 
-// TestHistory records the execution result of all the tests
+// TestHistory records the execution result of all the tests. It's safe to use from the suites running in
+// parallel. A test is only appended once it has finished running, and isn't changed afterwards, so the
+// tests returned by GetTest are stable snapshots.
 type TestHistory struct {
-	tests []*Test
-	mutex sync.Mutex
+	tests  []*Test
+	mutex  sync.Mutex
+	parent *TestHistory // the tests not found here are looked up in the parent
 }
 
-// GetTest gets a test by its name
+// GetTest gets the latest test with the name, looking in the parent history if it's not found here.
 func (h *TestHistory) GetTest(name string) *Test {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
@@ -362,17 +620,31 @@ func (h *TestHistory) GetTest(name string) *Test {
 			return h.tests[i]
 		}
 	}
+	if h.parent != nil {
+		return h.parent.GetTest(name)
+	}
 	return nil
 }
+
+// Append adds a test that has finished running to the history and its parents.
 func (h *TestHistory) Append(t *Test) {
 	h.mutex.Lock()
-	defer h.mutex.Unlock()
 	h.tests = append(h.tests, t)
+	h.mutex.Unlock()
+	if h.parent != nil {
+		h.parent.Append(t)
+	}
+}
+
+// Reset removes all the tests from the history.
+func (h *TestHistory) Reset() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.tests = nil
 }
 
 var History TestHistory
 
 func init() {
-	rand.Seed(int64(time.Now().Second()))
 	resty.SetRedirectPolicy(resty.FlexibleRedirectPolicy(15))
 }
@@ -0,0 +1,752 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+// newTestPlan returns a plan of the swagger that sends the tests to the server, with the meqa_init settings in init,
+// e.g. "  generate: boundary\n". The swagger's host is kept if serverURL is empty.
+func newTestPlan(t *testing.T, swaggerJSON string, serverURL string, init string) *TestPlan {
+	swagger := &mqswag.Swagger{}
+	if err := json.Unmarshal([]byte(swaggerJSON), (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	if len(serverURL) > 0 {
+		swagger.Host = strings.TrimPrefix(serverURL, "http://")
+	}
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	plan.Init(swagger, db)
+	if err := plan.AddFromString("meqa_init:\n- name: meqa_init\n" + init); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	return plan
+}
+
+func TestCheckMonotonicId(t *testing.T) {
+	tc := &TestSuite{}
+	for _, id := range []interface{}{json.Number("1"), json.Number("2"), json.Number("10")} {
+		if err := tc.CheckMonotonicId("Pet", id); err != nil {
+			t.Fatalf("unexpected error for id %v: %v", id, err)
+		}
+	}
+	// Other classes are tracked separately.
+	if err := tc.CheckMonotonicId("Order", json.Number("1")); err != nil {
+		t.Fatalf("unexpected error for Order: %v", err)
+	}
+	if err := tc.CheckMonotonicId("Pet", json.Number("3")); err == nil {
+		t.Errorf("expecting an error for the non-monotonic id sequence 1, 2, 10, 3")
+	}
+	if err := tc.CheckMonotonicId("Order", json.Number("1")); err == nil {
+		t.Errorf("expecting an error for a repeated id")
+	}
+	// The ids above 2^53 are the same as float64s.
+	if err := tc.CheckMonotonicId("Big", json.Number("9007199254740993")); err != nil {
+		t.Fatalf("unexpected error for a big id: %v", err)
+	}
+	if err := tc.CheckMonotonicId("Big", json.Number("9007199254740992")); err == nil {
+		t.Errorf("expecting an error for a smaller big id")
+	}
+}
+
+func TestMonotonicIds(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	run := func(ids []string) (map[string]int, error) {
+		next := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"id": ` + ids[next] + `, "name": "box"}`))
+			next++
+		}))
+		defer server.Close()
+		plan := newTestPlan(t, crudSwagger, server.URL, "")
+		test := "  path: /items\n  method: post\n"
+		err := plan.AddFromString("suite:\n- name: meqa_init\n  monotonic: id\n- name: addItem_1\n" + test +
+			"- name: addItem_2\n" + test)
+		if err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		return plan.Run("suite", nil)
+	}
+
+	if counts, err := run([]string{"9007199254740992", "9007199254740993"}); err != nil || counts[mqutil.Passed] != 2 {
+		t.Errorf("expecting the increasing ids to pass, got %v %v", counts, err)
+	}
+	counts, err := run([]string{"5", "3"})
+	if err == nil || !strings.Contains(err.Error(), "Item id 3 assigned by server is not bigger than the previous one 5") ||
+		counts[mqutil.Failed] != 1 {
+		t.Errorf("expecting the decreasing id to fail the post, got %v %v", counts, err)
+	}
+}
+
+const setupSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "setup", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/login": {"post": {"responses": {"200": {"description": "ok"}}}},
+		"/fail": {"get": {"responses": {"200": {"description": "ok"}}}},
+		"/other": {"get": {"responses": {"200": {"description": "ok"}}}},
+		"/logout": {"post": {"responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+const setupPlan = `
+suite:
+- name: meqa_init
+  setup:
+  - name: login
+    path: /login
+    method: post
+  teardown:
+  - name: logout
+    path: /logout
+    method: post
+- name: fail
+  path: /fail
+  method: get
+- name: other
+  path: /other
+  method: get
+`
+
+func TestSuiteSetupTeardown(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, setupSwagger, server.URL, "")
+	err := plan.AddFromString(setupPlan)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+
+	counts, err := plan.Run("suite", nil)
+	if err == nil || !strings.Contains(err.Error(), "response code 500") {
+		t.Errorf("expecting the error of the failed test, got %v", err)
+	}
+	if strings.Join(calls, " ") != "/login /fail /logout" {
+		t.Errorf("expecting login, fail, then logout, got %v", calls)
+	}
+	if counts[mqutil.Passed] != 2 || counts[mqutil.Failed] != 1 {
+		t.Errorf("expecting 2 passed and 1 failed, got %v", counts)
+	}
+}
+
+const conditionPlan = `
+suite:
+- name: login
+  path: /login
+  method: post
+- name: other
+  path: /other
+  method: get
+  runIf: '{{login.expect.status}} == 200'
+- name: logout
+  path: /logout
+  method: post
+  skipIf: '{{login.expect.status}} != 500'
+`
+
+func TestRunIfSkipIf(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var calls []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, setupSwagger, server.URL, "")
+	err := plan.AddFromString(conditionPlan)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+
+	counts, err := plan.Run("suite", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Join(calls, " ") != "/login /other" {
+		t.Errorf("expecting login and other to run, got %v", calls)
+	}
+	if counts[mqutil.Passed] != 2 || counts[mqutil.Skipped] != 1 {
+		t.Errorf("expecting 2 passed and 1 skipped, got %v", counts)
+	}
+}
+
+const parallelPlan = `
+first:
+- name: login
+  path: /login
+  method: post
+- name: other
+  path: /other
+  method: get
+second:
+- name: login
+  path: /login
+  method: post
+- name: fail
+  path: /fail
+  method: get
+third:
+- name: logout
+  path: /logout
+  method: post
+`
+
+func TestRunSuites(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, setupSwagger, server.URL, "")
+	err := plan.AddFromString(parallelPlan)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+
+	plan.ResultCounts = make(map[string]int)
+	plan.RunSuites([]string{"first", "second", "third"}, 3)
+	if plan.ResultCounts[mqutil.Total] != 5 || plan.ResultCounts[mqutil.Passed] != 4 ||
+		plan.ResultCounts[mqutil.Failed] != 1 {
+		t.Errorf("expecting 5 total, 4 passed and 1 failed, got %v", plan.ResultCounts)
+	}
+	if len(plan.resultList) != 5 {
+		t.Errorf("expecting 5 results, got %d", len(plan.resultList))
+	}
+}
+
+// Run with -race to check the history's synchronization.
+func TestHistoryConcurrent(t *testing.T) {
+	parent := &TestHistory{}
+	var histories []*TestHistory
+	for i := 0; i < 4; i++ {
+		histories = append(histories, &TestHistory{parent: parent})
+	}
+	var wg sync.WaitGroup
+	for i, h := range histories {
+		wg.Add(2)
+		go func(i int, h *TestHistory) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				h.Append(&Test{Name: fmt.Sprintf("test%d_%d", i, j)})
+			}
+		}(i, h)
+		go func(i int, h *TestHistory) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if test := h.GetTest(fmt.Sprintf("test%d_%d", (i+1)%4, j)); test != nil && len(test.Name) == 0 {
+					t.Errorf("got a test without a name")
+				}
+			}
+		}(i, h)
+	}
+	wg.Wait()
+	if len(parent.tests) != 400 {
+		t.Errorf("expecting 400 tests in the parent history, got %d", len(parent.tests))
+	}
+	if histories[0].GetTest("test3_99") == nil || histories[0].GetTest("test0_99") == nil {
+		t.Errorf("expecting the tests of all the histories to be found through the parent")
+	}
+}
+
+const requiredSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "required", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/orders": {
+			"parameters": [{"name": "X-Correlation-Id", "in": "header", "required": true, "type": "string", "pattern": "["}],
+			"get": {"responses": {"200": {"description": "ok"}}}
+		}
+	}
+}`
+
+func TestRequiredParamDefaults(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var correlationId string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		correlationId = r.Header.Get("X-Correlation-Id")
+	}))
+	defer server.Close()
+
+	for _, defaults := range []string{"", "  requiredParamDefaults:\n    x-correlation-id: abc-123\n"} {
+		plan := newTestPlan(t, requiredSwagger, server.URL, "")
+		err := plan.AddFromString("suite:\n- name: meqa_init\n" + defaults + "- name: getOrders\n  path: /orders\n  method: get\n")
+		if err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+
+		correlationId = ""
+		_, err = plan.Run("suite", nil)
+		if len(defaults) == 0 {
+			if err == nil || !strings.Contains(err.Error(), "required parameter X-Correlation-Id (in header) missing") {
+				t.Errorf("expecting the missing parameter to be named, got %v", err)
+			}
+			if correlationId != "" {
+				t.Errorf("expecting no call to be made")
+			}
+		} else if err != nil || correlationId != "abc-123" {
+			t.Errorf("expecting the default to be sent, got %q, err %v", correlationId, err)
+		}
+	}
+}
+
+func TestUnknownMatcher(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	plan := &TestPlan{}
+	plan.Init(&mqswag.Swagger{}, &mqswag.DB{})
+	err := plan.AddFromString(`suite:
+- name: get
+  path: /users
+  method: get
+  expect:
+    body:
+      name: {$matcher: fuzzy, value: tom}
+`)
+	if err == nil || !strings.Contains(err.Error(), "unknown $matcher fuzzy") || !strings.Contains(err.Error(), "geoNear") {
+		t.Errorf("expecting an unknown matcher error with the registered matchers, got %v", err)
+	}
+}
+
+const optionalSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "optional", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets": {"get": {
+			"parameters": [
+				{"name": "q", "in": "query", "required": true, "type": "string"},
+				{"name": "limit", "in": "query", "type": "integer", "minimum": 1, "maximum": 100}
+			],
+			"responses": {"200": {"description": "ok"}}
+		}}
+	}
+}`
+
+func TestOptionalParams(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+	}))
+	defer server.Close()
+
+	// The plan's policy applies unless the test sets its own.
+	for _, c := range []struct {
+		init, test string
+		sent       bool
+	}{
+		{"", "", true},
+		{"never", "", false},
+		{"never", "always", true},
+		{"always", "0", false},
+		{"0.5", "1", true},
+	} {
+		plan := newTestPlan(t, optionalSwagger, server.URL, "")
+		planStr := "suite:\n- name: meqa_init\n  optionalParams: '" + c.init + "'\n" +
+			"- name: getPets\n  path: /pets\n  method: get\n  optionalParams: '" + c.test + "'\n"
+		if err := plan.AddFromString(planStr); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+
+		queries = nil
+		if _, err := plan.Run("suite", nil); err != nil {
+			t.Fatalf("plan failed: %v", err)
+		}
+		if len(queries) != 1 || len(queries[0].Get("q")) == 0 {
+			t.Fatalf("expecting the required parameter to be sent, got %v", queries)
+		}
+		if _, sent := queries[0]["limit"]; sent != c.sent {
+			t.Errorf("plan %q, test %q: expecting the optional parameter sent to be %v, got %v",
+				c.init, c.test, c.sent, queries[0])
+		}
+	}
+
+	plan := &TestPlan{}
+	plan.Init(&mqswag.Swagger{}, &mqswag.DB{})
+	err := plan.AddFromString("suite:\n- name: get\n  path: /pets\n  method: get\n  optionalParams: often\n")
+	if err == nil || !strings.Contains(err.Error(), "invalid optionalParams often") {
+		t.Errorf("expecting an invalid policy error, got %v", err)
+	}
+}
+
+func TestOptionalParamsCoverage(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var queries []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query())
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, optionalSwagger, server.URL, "  optionalParams: coverage\n")
+	var tests string
+	for i := 0; i < 4; i++ {
+		tests += fmt.Sprintf("- name: getPets_%d\n  path: /pets\n  method: get\n", i)
+	}
+	if err := plan.AddFromString("suite:\n" + tests); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	if _, err := plan.Run("suite", nil); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+
+	// The required parameter is always sent, the optional one every other run.
+	if len(queries) != 4 {
+		t.Fatalf("expecting 4 calls, got %v", queries)
+	}
+	for i, query := range queries {
+		if len(query.Get("q")) == 0 {
+			t.Errorf("run %d: expecting the required parameter to be sent, got %v", i, query)
+		}
+		if _, sent := query["limit"]; sent != (i%2 == 0) {
+			t.Errorf("run %d: expecting the optional parameter sent to be %v, got %v", i, i%2 == 0, query)
+		}
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var queries []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Query().Get("q"))
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, optionalSwagger, server.URL, "")
+	err := plan.AddFromString(`suite:
+- name: getPets
+  path: /pets
+  method: get
+  repeat: 3
+- name: again
+  path: /pets
+  method: get
+  queryParams:
+    q: '{{getPets.queryParams.q}}'
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	counts, err := plan.Run("suite", nil)
+	if err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+
+	// Each run generates its own values, and the template refers to the last run.
+	if len(queries) != 4 {
+		t.Fatalf("expecting 4 calls, got %v", queries)
+	}
+	if queries[0] == queries[1] || queries[1] == queries[2] {
+		t.Errorf("expecting each run to generate its own value, got %v", queries)
+	}
+	if queries[3] != queries[2] {
+		t.Errorf("expecting the template to resolve to the last run's %s, got %s", queries[2], queries[3])
+	}
+	if counts[mqutil.Total] != 4 || counts[mqutil.Passed] != 4 {
+		t.Errorf("expecting 4 total and 4 passed, got %v", counts)
+	}
+
+	plan = newTestPlan(t, optionalSwagger, server.URL, "")
+	err = plan.AddFromString("suite:\n- name: getPets\n  path: /pets\n  method: get\n  repeat: -1\n")
+	if err == nil || !strings.Contains(err.Error(), "repeat -1") {
+		t.Errorf("expecting an invalid repeat error, got %v", err)
+	}
+}
+
+func TestResolveServer(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	doc, err := mqswag.ConvertOpenAPI3([]byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"servers": [
+			{"url": "https://api.example.com/v1"},
+			{"url": "https://{region}.staging.example.com/{version}/", "variables": {"version": {"default": "v2"}}},
+			{"url": "/local"}
+		],
+		"paths": {}
+	}`))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	for _, c := range []struct {
+		init     string
+		expected string
+	}{
+		{"", "https://api.example.com/v1"},
+		{"  server: staging\n  serverVariables:\n    region: eu\n", "https://eu.staging.example.com/v2"},
+		{"  server: 2\n", "https://api.example.com/local"},
+	} {
+		swagger := &mqswag.Swagger{}
+		if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+			t.Fatalf("can't load the converted document: %v", err)
+		}
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		plan := &TestPlan{}
+		plan.Init(swagger, db)
+		if err = plan.AddFromString("meqa_init:\n- name: meqa_init\n" + c.init); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		baseURL, err := plan.ResolveServer()
+		if err != nil || baseURL != c.expected || GetBaseURL(swagger) != c.expected {
+			t.Errorf("expecting %s, got %s, err %v", c.expected, baseURL, err)
+		}
+	}
+
+	swagger := &mqswag.Swagger{}
+	json.Unmarshal(doc, (*spec.Swagger)(swagger))
+	plan := &TestPlan{PlanSettings: PlanSettings{Server: "staging"}}
+	plan.Init(swagger, &mqswag.DB{})
+	if _, err = plan.ResolveServer(); err == nil || !strings.Contains(err.Error(), "region") {
+		t.Errorf("expecting an error naming the variable without a value, got %v", err)
+	}
+
+	// The run overrides one variable, the other keeps the plan's value or its default.
+	plan.ServerVariables = map[string]interface{}{"region": "eu", "version": "v3"}
+	if err = plan.SetServerVariables("region=us, "); err != nil {
+		t.Fatalf("can't set the server variables: %v", err)
+	}
+	if baseURL, err := plan.ResolveServer(); err != nil || baseURL != "https://us.staging.example.com/v3" {
+		t.Errorf("expecting the overridden region, got %s, err %v", baseURL, err)
+	}
+	if err = plan.SetServerVariables("region"); err == nil {
+		t.Errorf("expecting an error for a variable without a value")
+	}
+}
+
+const deprecatedSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "deprecated", "version": "1.0"},
+	"paths": {
+		"/old": {"get": {"deprecated": true, "responses": {"200": {"description": "ok"}}}},
+		"/new": {"get": {"responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+func TestDeprecatedOperations(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	defer func() { Deprecated = DeprecatedTest }()
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer server.Close()
+
+	// The plan's policy applies, then the default one.
+	for _, c := range []struct {
+		init, fallback string
+		skipDeprecated bool
+		skipped        bool
+		warned         bool
+	}{
+		{"", DeprecatedTest, false, false, false},
+		{"skip", DeprecatedTest, false, true, false},
+		{"warn", DeprecatedSkip, false, false, true},
+		{"", DeprecatedSkip, false, true, false},
+		{"test", DeprecatedWarn, false, false, false},
+		{"", DeprecatedTest, true, true, false},
+		{"", DeprecatedWarn, true, true, false},
+		{"test", DeprecatedTest, true, false, false},
+	} {
+		if err := SetDeprecated(c.fallback, c.skipDeprecated); err != nil {
+			t.Fatalf("can't set the policy: %v", err)
+		}
+		plan := newTestPlan(t, deprecatedSwagger, server.URL, "  deprecated: '"+c.init+"'\n")
+		if err := plan.AddFromString("suite:\n- name: old\n  path: /old\n  method: get\n- name: new\n  path: /new\n  method: get\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+
+		paths = nil
+		counts, err := plan.Run("suite", nil)
+		if err != nil {
+			t.Fatalf("plan failed: %v", err)
+		}
+		expectedPaths, skips := []string{"/old", "/new"}, 0
+		if c.skipped {
+			expectedPaths, skips = []string{"/new"}, 1
+		}
+		if fmt.Sprint(paths) != fmt.Sprint(expectedPaths) {
+			t.Errorf("plan %q, default %s, skipDeprecated %v: expecting the calls %v, got %v", c.init, c.fallback, c.skipDeprecated, expectedPaths, paths)
+		}
+		results := plan.Results()
+		if len(results) != 2 || results[0].Skipped != c.skipped || results[0].Passed == c.skipped ||
+			(len(results[0].Warnings) > 0) != c.warned || counts[mqutil.Skipped] != skips {
+			t.Errorf("plan %q, default %s, skipDeprecated %v: unexpected results %+v, counts %v", c.init, c.fallback, c.skipDeprecated, results, counts)
+		}
+	}
+
+	plan := &TestPlan{}
+	plan.Init(&mqswag.Swagger{}, &mqswag.DB{})
+	err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  deprecated: ignore\n")
+	if err == nil || !strings.Contains(err.Error(), "invalid deprecated ignore") {
+		t.Errorf("expecting an invalid policy error, got %v", err)
+	}
+	if err = SetDeprecated("ignore", true); err == nil || !strings.Contains(err.Error(), "invalid deprecated ignore") {
+		t.Errorf("expecting an invalid policy error, got %v", err)
+	}
+}
+
+const fixturesSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "fixtures", "version": "1.0"},
+	"paths": {
+		"/pets/{petId}": {"get": {
+			"parameters": [{"name": "petId", "in": "path", "required": true, "type": "integer", "description": "<meqa Pet.id>"}],
+			"responses": {"200": {"description": "ok"}}
+		}},
+		"/orders": {"post": {
+			"parameters": [{"name": "order", "in": "body", "required": true, "schema": {"$ref": "#/definitions/Order"}}],
+			"responses": {"200": {"description": "ok"}}
+		}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "required": ["id", "name"], "properties": {
+			"id": {"type": "integer"}, "name": {"type": "string"}}},
+		"Order": {"type": "object", "required": ["petId"], "properties": {
+			"id": {"type": "integer"}, "petId": {"type": "integer", "description": "<meqa Pet.id>"}}}
+	}
+}`
+
+func TestFixtures(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var petIds []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			petIds = append(petIds, strings.TrimPrefix(r.URL.Path, "/pets/"))
+			return
+		}
+		var order map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&order)
+		petIds = append(petIds, fmt.Sprint(order["petId"]))
+	}))
+	defer server.Close()
+
+	dir, _ := ioutil.TempDir("", "meqa")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "pets.json"), []byte(`{"Pet": [{"id": 101, "name": "fido"}, {"id": 102, "name": "rex"}]}`), 0644)
+	planPath := filepath.Join(dir, "plan.yml")
+	ioutil.WriteFile(planPath, []byte("meqa_init:\n- name: meqa_init\n  fixtures: pets.json\n"+
+		"suite:\n- name: getPet\n  path: /pets/{petId}\n  method: get\n- name: postOrder\n  path: /orders\n  method: post\n"), 0644)
+
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(fixturesSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	swagger.Host = strings.TrimPrefix(server.URL, "http://")
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	plan := &TestPlan{}
+	if err = plan.InitFromFile(planPath, db); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	if _, err = plan.Run("suite", nil); err != nil {
+		t.Fatalf("plan failed: %v", err)
+	}
+	if len(petIds) != 2 {
+		t.Fatalf("expecting 2 calls, got %v", petIds)
+	}
+	for _, id := range petIds {
+		if id != "101" && id != "102" {
+			t.Errorf("expecting the id of one of the fixtures, got %s", id)
+		}
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "pets.json"), []byte(`{"Dog": [{"id": 1}]}`), 0644)
+	db = &mqswag.DB{}
+	db.Init(swagger)
+	err = (&TestPlan{}).InitFromFile(planPath, db)
+	if err == nil || !strings.Contains(err.Error(), "unknown definition Dog") {
+		t.Errorf("expecting an unknown definition error, got %v", err)
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	options := map[string]string{
+		"optionalParams: often":               "optionalParams",
+		"optionalProperties: sometimes":       "optionalProperties",
+		"deprecated: ignore":                  "deprecated",
+		"generate: all":                       "generate",
+		"arraySize: 5-1":                      "arraySize",
+		"stringLength: x":                     "stringLength",
+		"repeat: -2":                          "repeat -2",
+		"reuseChance: 2":                      "reuseChance",
+		"rateLimit: -5":                       "rateLimit",
+		"realisticNames:\n    nick: nickname": "realisticNames",
+	}
+	// The same options are checked in the plan's meqa_init, in a suite's meqa_init and on a test.
+	for option, message := range options {
+		for _, suite := range []string{"meqa_init:\n- name: meqa_init\n", "suite:\n- name: meqa_init\n", "suite:\n- name: getPets\n"} {
+			err := (&TestPlan{}).AddFromString(suite + "  " + option + "\n")
+			if err == nil || !strings.Contains(err.Error(), message) {
+				t.Errorf("%s in %s: expecting an error about %s, got %v", option, suite, message, err)
+			}
+		}
+	}
+}
+
+func TestIsolate(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "order"}`))
+	}))
+	defer server.Close()
+
+	// The second post expects the order the first one created to be the only one in the suite's DB.
+	run := func(settings string) (map[string]int, error) {
+		plan := newTestPlan(t, orderSwagger, server.URL, "")
+		err := plan.AddFromString(`suite:
+- name: meqa_init
+` + settings + `- name: addOrder
+  path: /order
+  method: post
+- name: checkOrder
+  path: /order
+  method: post
+  expect:
+    body:
+      $db:
+        class: Order
+`)
+		if err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		return plan.Run("suite", nil)
+	}
+	if counts, err := run(""); err != nil || counts[mqutil.Passed] != 2 {
+		t.Errorf("expecting the order to be kept, got %v %v", counts, err)
+	}
+	counts, err := run("  isolate: true\n")
+	if err == nil || !strings.Contains(err.Error(), "found 0") || counts[mqutil.Failed] != 1 {
+		t.Errorf("expecting the order to be thrown away, got %v %v", counts, err)
+	}
+}
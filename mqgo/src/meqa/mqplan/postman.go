@@ -0,0 +1,575 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// This file imports a Postman v2.1 collection as a test plan. Each folder with requests becomes a test suite,
+// and each request a test. The requests that aren't in a folder go to a suite named after the collection.
+// It also exports the tests of a run as a collection, with a folder per test suite.
+
+type postmanKeyValue struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Type     string `json:"type,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+type postmanURL struct {
+	Raw      string            `json:"raw"`
+	Protocol string            `json:"protocol,omitempty"`
+	Host     []string          `json:"host,omitempty"`
+	Port     string            `json:"port,omitempty"`
+	Path     []string          `json:"path,omitempty"`
+	Query    []postmanKeyValue `json:"query,omitempty"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+}
+
+// UnmarshalJSON accepts both the url object and the raw url string.
+func (u *postmanURL) UnmarshalJSON(data []byte) error {
+	var raw string
+	if json.Unmarshal(data, &raw) == nil {
+		*u = parsePostmanURL(raw)
+		return nil
+	}
+	type plainURL postmanURL
+	return json.Unmarshal(data, (*plainURL)(u))
+}
+
+// parsePostmanURL splits a raw url like {{baseUrl}}/pets/:petId?limit=10 into its parts.
+func parsePostmanURL(raw string) postmanURL {
+	u := postmanURL{Raw: raw}
+	rest := raw
+	if i := strings.Index(rest, "?"); i >= 0 {
+		for _, kv := range strings.Split(rest[i+1:], "&") {
+			if len(kv) > 0 {
+				pair := strings.SplitN(kv, "=", 2)
+				pair = append(pair, "")
+				u.Query = append(u.Query, postmanKeyValue{Key: pair[0], Value: pair[1]})
+			}
+		}
+		rest = rest[:i]
+	}
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	segments := strings.Split(rest, "/")
+	u.Host = []string{segments[0]}
+	for _, s := range segments[1:] {
+		if len(s) > 0 {
+			u.Path = append(u.Path, s)
+		}
+	}
+	return u
+}
+
+type postmanBody struct {
+	Mode       string            `json:"mode"`
+	Raw        string            `json:"raw,omitempty"`
+	URLEncoded []postmanKeyValue `json:"urlencoded,omitempty"`
+	FormData   []postmanKeyValue `json:"formdata,omitempty"`
+}
+
+type postmanRequest struct {
+	Method string            `json:"method"`
+	Header []postmanKeyValue `json:"header"`
+	URL    postmanURL        `json:"url"`
+	Body   *postmanBody      `json:"body,omitempty"`
+}
+
+type postmanEvent struct {
+	Listen string `json:"listen"`
+	Script struct {
+		Exec []string `json:"exec"`
+	} `json:"script"`
+}
+
+type postmanItem struct {
+	Name    string          `json:"name"`
+	Item    []*postmanItem  `json:"item,omitempty"` // the items of a folder
+	Request *postmanRequest `json:"request,omitempty"`
+	Event   []postmanEvent  `json:"event,omitempty"`
+}
+
+type postmanCollection struct {
+	Info struct {
+		Name   string `json:"name"`
+		Schema string `json:"schema,omitempty"`
+	} `json:"info"`
+	Item     []*postmanItem    `json:"item"`
+	Variable []postmanKeyValue `json:"variable,omitempty"`
+}
+
+const postmanSchema = "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"
+
+var postmanVarRegexp = regexp.MustCompile(`{{\s*([^{}\s]+)\s*}}`)
+
+// The scripts that save a field of the response into a variable, e.g.
+// pm.environment.set("petId", jsonData.id) or postman.setEnvironmentVariable("petId", data.items[0].id)
+var postmanSetRegexp = regexp.MustCompile(`(?:\.set|\.setEnvironmentVariable|\.setGlobalVariable)\(\s*["']([^"']+)["']\s*,\s*[A-Za-z_$][\w$]*((?:\.\w+|\[\d+\])+)\s*\)`)
+
+// postmanImporter keeps the state while the requests are turned into tests in order.
+type postmanImporter struct {
+	swagger   *mqswag.Swagger
+	plan      *TestPlan
+	namer     *TestNamer
+	values    map[string]string // the collection variables with a value
+	templates map[string]string // the variables saved from the responses of the tests so far
+	hostVars  map[string]bool   // the variables that make up the base URL
+	unknown   map[string]bool   // the variables that can't be mapped
+}
+
+// ImportPostmanFile reads the Postman v2.1 collection file and turns it into a test plan. The paths are matched
+// against the swagger when it's not nil.
+func ImportPostmanFile(path string, swagger *mqswag.Swagger) (*TestPlan, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ImportPostman(data, swagger)
+}
+
+// ImportPostman turns the Postman v2.1 collection into a test plan. The variables that make up the base URL,
+// e.g. {{baseUrl}}, are dropped, as the tests are sent to the host in the spec. The other variables are
+// replaced by the collection's value, or by a template that refers to the earlier test whose script saved the
+// variable from its response. The rest are kept as they are.
+func ImportPostman(data []byte, swagger *mqswag.Swagger) (*TestPlan, error) {
+	var collection postmanCollection
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("not a valid Postman collection: %s", err.Error()))
+	}
+	if swagger != nil && swagger.Paths == nil {
+		swagger = nil
+	}
+	plan := &TestPlan{}
+	plan.Init(swagger, nil)
+	addInitTestSuite(plan)
+	im := &postmanImporter{
+		swagger:   swagger,
+		plan:      plan,
+		namer:     NewTestNamer(),
+		values:    make(map[string]string),
+		templates: make(map[string]string),
+		hostVars:  make(map[string]bool),
+		unknown:   make(map[string]bool),
+	}
+	for _, v := range collection.Variable {
+		if len(v.Value) > 0 && !v.Disabled {
+			im.values[v.Key] = v.Value
+		}
+	}
+
+	name := collection.Info.Name
+	if len(name) == 0 {
+		name = "postman"
+	}
+	if err := im.importItems(name, collection.Item, true); err != nil {
+		return nil, err
+	}
+
+	plan.comment = fmt.Sprintf("\nThis test plan is imported from the Postman collection %s.\n", name)
+	var hostVars []string
+	for v := range im.hostVars {
+		hostVars = append(hostVars, v)
+	}
+	sort.Strings(hostVars)
+	for _, v := range hostVars {
+		delete(im.unknown, v)
+		plan.comment += fmt.Sprintf("The base URL variable {{%s}} %s is replaced by the host in the spec.\n", v, im.values[v])
+	}
+	var unknown []string
+	for v := range im.unknown {
+		unknown = append(unknown, v)
+	}
+	sort.Strings(unknown)
+	if len(unknown) > 0 {
+		plan.comment += fmt.Sprintf("The following variables are not mapped and need to be replaced: %s\n",
+			strings.Join(unknown, ", "))
+	}
+	return plan, nil
+}
+
+// importItems adds a suite with the requests in the items, and a suite per folder. The nested folders are
+// named by their path, e.g. users/admin.
+func (im *postmanImporter) importItems(name string, items []*postmanItem, top bool) error {
+	testSuite := CreateTestSuite(name, nil, im.plan)
+	var folders []*postmanItem
+	for _, item := range items {
+		if item.Request == nil {
+			folders = append(folders, item)
+			continue
+		}
+		testSuite.Tests = append(testSuite.Tests, im.importRequest(item))
+	}
+	if len(testSuite.Tests) > 0 {
+		if err := im.plan.Add(testSuite); err != nil {
+			return err
+		}
+	}
+	for _, folder := range folders {
+		folderName := folder.Name
+		if !top {
+			folderName = name + "/" + folder.Name
+		}
+		if err := im.importItems(folderName, folder.Item, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importRequest turns the request into a test.
+func (im *postmanImporter) importRequest(item *postmanItem) *Test {
+	req := item.Request
+	t := &Test{}
+	t.Method = strings.ToLower(req.Method)
+	if len(t.Method) == 0 {
+		t.Method = mqswag.MethodGet
+	}
+	for _, h := range req.URL.Host {
+		for _, match := range postmanVarRegexp.FindAllStringSubmatch(h, -1) {
+			im.hostVars[match[1]] = true
+		}
+	}
+
+	opId := ""
+	t.Path, t.PathParams = im.matchPath(req.URL)
+	if im.swagger != nil {
+		pathItem, ok := im.swagger.Paths.Paths[t.Path]
+		if op := GetOperationByMethod(&pathItem, t.Method); ok && op != nil {
+			opId = op.ID
+		} else {
+			mqutil.Logger.Printf("Postman request %s %s isn't in the spec", t.Method, t.Path)
+		}
+	}
+	t.Name = im.namer.Next(t.Method, t.Path, opId)
+
+	t.QueryParams = im.keyValues(req.URL.Query)
+	t.HeaderParams = im.keyValues(req.Header)
+	if req.Body != nil {
+		switch req.Body.Mode {
+		case "raw":
+			var body interface{}
+			if err := json.Unmarshal([]byte(req.Body.Raw), &body); err == nil {
+				t.BodyParams = im.replaceVarsIn(body)
+			} else if len(strings.TrimSpace(req.Body.Raw)) > 0 {
+				t.BodyParams = im.replaceVars(req.Body.Raw)
+			}
+		case "urlencoded":
+			t.FormParams = im.keyValues(req.Body.URLEncoded)
+		case "formdata":
+			t.FormParams = im.keyValues(req.Body.FormData)
+		}
+	}
+
+	// The later requests can refer to the response fields this request's tests save into variables.
+	for _, event := range item.Event {
+		if event.Listen != "test" {
+			continue
+		}
+		for _, match := range postmanSetRegexp.FindAllStringSubmatch(strings.Join(event.Script.Exec, "\n"), -1) {
+			field := strings.NewReplacer("[", ".", "]", "").Replace(strings.TrimPrefix(match[2], "."))
+			im.templates[match[1]] = fmt.Sprintf("{{%s.outputs.%s}}", t.Name, field)
+		}
+	}
+	return t
+}
+
+// matchPath finds the path in the spec that the url calls, and the values of the path params. The path
+// variables, e.g. :petId, without a value are left for meqa to generate.
+func (im *postmanImporter) matchPath(u postmanURL) (string, map[string]interface{}) {
+	var segments []interface{} // the literal segments are strings, the variables without value nil
+	var names []string         // the names of the variables
+	for _, s := range u.Path {
+		if strings.HasPrefix(s, ":") {
+			var value interface{}
+			for _, v := range u.Variable {
+				if v.Key == s[1:] && len(v.Value) > 0 {
+					value = im.replaceVars(v.Value)
+				}
+			}
+			segments = append(segments, value)
+			names = append(names, s[1:])
+		} else if match := postmanVarRegexp.FindStringSubmatch(s); match != nil && match[0] == s {
+			value := im.replaceVars(s)
+			if value == s {
+				segments = append(segments, nil)
+			} else {
+				segments = append(segments, value)
+			}
+			names = append(names, match[1])
+		} else {
+			segments = append(segments, s)
+			names = append(names, "")
+		}
+	}
+	if im.swagger != nil && len(im.swagger.BasePath) > 0 {
+		// The base path is part of the url when the host isn't a variable.
+		base := strings.Split(strings.Trim(im.swagger.BasePath, "/"), "/")
+		if len(segments) >= len(base) {
+			matched := true
+			for i, b := range base {
+				if segments[i] != b || len(names[i]) > 0 {
+					matched = false
+				}
+			}
+			if matched {
+				segments, names = segments[len(base):], names[len(base):]
+			}
+		}
+	}
+
+	pathParams := make(map[string]interface{})
+	if im.swagger != nil {
+		// Pick the spec path with the most literal segments that matches.
+		var bestPath string
+		bestLiterals := -1
+		for path := range im.swagger.Paths.Paths {
+			specSegments := strings.Split(strings.Trim(path, "/"), "/")
+			if len(specSegments) != len(segments) {
+				continue
+			}
+			literals := 0
+			matched := true
+			for i, specSegment := range specSegments {
+				if strings.HasPrefix(specSegment, "{") {
+					continue
+				}
+				if len(names[i]) > 0 || segments[i] != specSegment {
+					matched = false
+					break
+				}
+				literals++
+			}
+			if matched && (literals > bestLiterals || literals == bestLiterals && path < bestPath) {
+				bestPath, bestLiterals = path, literals
+			}
+		}
+		if bestLiterals >= 0 {
+			for i, specSegment := range strings.Split(strings.Trim(bestPath, "/"), "/") {
+				if strings.HasPrefix(specSegment, "{") && segments[i] != nil {
+					pathParams[strings.Trim(specSegment, "{}")] = segments[i]
+				}
+			}
+			if len(pathParams) == 0 {
+				pathParams = nil
+			}
+			return bestPath, pathParams
+		}
+	}
+
+	// Not in the spec, the variables become the path params.
+	path := ""
+	for i, s := range segments {
+		if len(names[i]) > 0 {
+			path += "/{" + names[i] + "}"
+			if s != nil {
+				pathParams[names[i]] = s
+			}
+		} else {
+			path += "/" + s.(string)
+		}
+	}
+	if len(path) == 0 {
+		path = "/"
+	}
+	if len(pathParams) == 0 {
+		pathParams = nil
+	}
+	return path, pathParams
+}
+
+func (im *postmanImporter) keyValues(kvs []postmanKeyValue) map[string]interface{} {
+	var m map[string]interface{}
+	for _, kv := range kvs {
+		if kv.Disabled || len(kv.Key) == 0 || kv.Type == "file" {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]interface{})
+		}
+		m[kv.Key] = im.replaceVars(kv.Value)
+	}
+	return m
+}
+
+// replaceVars replaces the variables in the string with their values or templates.
+func (im *postmanImporter) replaceVars(s string) string {
+	return postmanVarRegexp.ReplaceAllStringFunc(s, func(v string) string {
+		name := postmanVarRegexp.FindStringSubmatch(v)[1]
+		if template, ok := im.templates[name]; ok {
+			return template
+		}
+		if value, ok := im.values[name]; ok && !im.hostVars[name] {
+			return value
+		}
+		if !im.hostVars[name] {
+			im.unknown[name] = true
+		}
+		return v
+	})
+}
+
+func (im *postmanImporter) replaceVarsIn(in interface{}) interface{} {
+	switch v := in.(type) {
+	case string:
+		return im.replaceVars(v)
+	case map[string]interface{}:
+		for k, value := range v {
+			v[k] = im.replaceVarsIn(value)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = im.replaceVarsIn(value)
+		}
+	}
+	return in
+}
+
+// WritePostmanCollection writes the tests that were sent as a Postman v2.1 collection, with the parameters
+// they were sent with. The tests are put in a folder per test suite. The credentials aren't exported.
+func WritePostmanCollection(w io.Writer, results []*Test) error {
+	var collection postmanCollection
+	collection.Info.Name = "meqa " + time.Now().Format(time.RFC3339)
+	collection.Info.Schema = postmanSchema
+	collection.Item = []*postmanItem{}
+	folders := make(map[string]*postmanItem)
+	for _, t := range results {
+		if len(t.Path) == 0 || t.startTime.IsZero() || t.db == nil || t.db.Swagger == nil {
+			continue
+		}
+		suiteName := ""
+		if t.suite != nil {
+			suiteName = t.suite.Name
+		}
+		folder := folders[suiteName]
+		if folder == nil {
+			folder = &postmanItem{Name: suiteName}
+			folders[suiteName] = folder
+			collection.Item = append(collection.Item, folder)
+		}
+		folder.Item = append(folder.Item, &postmanItem{Name: t.Name, Request: t.postmanRequest()})
+	}
+	data, err := json.MarshalIndent(collection, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// WritePostmanToFile writes the tests of the run as a Postman collection.
+func (plan *TestPlan) WritePostmanToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WritePostmanCollection(f, plan.resultList)
+}
+
+// postmanRequest describes the call the test made.
+func (t *Test) postmanRequest() *postmanRequest {
+	req := &postmanRequest{Method: strings.ToUpper(t.Method), Header: []postmanKeyValue{}}
+	u, query := t.requestURL()
+	req.URL = postmanURL{Raw: u.String(), Protocol: u.Scheme, Port: u.Port()}
+	if len(u.Hostname()) > 0 {
+		req.URL.Host = strings.Split(u.Hostname(), ".")
+	}
+	for _, segment := range strings.Split(strings.Trim(u.Path, "/"), "/") {
+		if len(segment) > 0 {
+			req.URL.Path = append(req.URL.Path, segment)
+		}
+	}
+	req.URL.Query = sortedKeyValues(query)
+
+	headers := t.paramStrings(t.HeaderParams, "header")
+	for k, v := range headers {
+		req.Header = append(req.Header, postmanKeyValue{Key: k, Value: v})
+	}
+	if len(t.FormParams) > 0 {
+		form := sortedKeyValues(t.paramValues(t.FormParams, "formData"))
+		files := make(map[string]bool)
+		if t.op != nil {
+			for _, p := range t.op.Parameters {
+				if p.Type == "file" {
+					files[p.Name] = true
+				}
+			}
+		}
+		req.Body = &postmanBody{Mode: "urlencoded", URLEncoded: form}
+		if len(files) > 0 {
+			for i := range form {
+				if files[form[i].Key] {
+					form[i].Type = "file"
+				} else {
+					form[i].Type = "text"
+				}
+			}
+			req.Body = &postmanBody{Mode: "formdata", FormData: form}
+		}
+	} else if bodyMap, ok := t.BodyParams.(map[string]interface{}); ok && baseMediaType(t.contentType) == mediaTypeFormURLEncoded {
+		req.Body = &postmanBody{Mode: "urlencoded", URLEncoded: sortedKeyValues(formValues(bodyMap))}
+	} else if bodyMap, ok := t.BodyParams.(map[string]interface{}); ok && baseMediaType(t.contentType) == mediaTypeMultipart {
+		form := sortedKeyValues(formValues(bodyMap))
+		for i := range form {
+			form[i].Type = "text"
+		}
+		req.Body = &postmanBody{Mode: "formdata", FormData: form}
+	} else if str, ok := t.BodyParams.(string); ok {
+		req.Body = &postmanBody{Mode: "raw", Raw: str}
+	} else if t.BodyParams != nil {
+		body, _ := json.MarshalIndent(t.BodyParams, "", "    ")
+		req.Body = &postmanBody{Mode: "raw", Raw: string(body)}
+		if _, exist := mqutil.HeaderKey(t.HeaderParams, "Content-Type"); !exist {
+			contentType := t.contentType
+			if len(contentType) == 0 {
+				contentType = mediaTypeJSON
+			}
+			req.Header = append(req.Header, postmanKeyValue{Key: "Content-Type", Value: contentType})
+		}
+	}
+	sort.Slice(req.Header, func(i, j int) bool { return req.Header[i].Key < req.Header[j].Key })
+	return req
+}
+
+// requestURL is the url the test was sent to, with its path and query params.
+func (t *Test) requestURL() (*url.URL, url.Values) {
+	path := t.Path
+	for k, v := range t.paramStrings(t.PathParams, "path") {
+		path = strings.Replace(path, "{"+k+"}", v, -1)
+	}
+	u, err := url.Parse(GetBaseURL(t.db.Swagger) + path)
+	if err != nil {
+		u = &url.URL{Path: path}
+	}
+	query := t.paramValues(t.QueryParams, "query")
+	u.RawQuery = query.Encode()
+	return u, query
+}
+
+func sortedKeyValues(values url.Values) []postmanKeyValue {
+	var keys []string
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var kvs []postmanKeyValue
+	for _, k := range keys {
+		for _, v := range values[k] {
+			kvs = append(kvs, postmanKeyValue{Key: k, Value: v})
+		}
+	}
+	return kvs
+}
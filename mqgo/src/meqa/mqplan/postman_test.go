@@ -0,0 +1,187 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+const postmanSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"basePath": "/v1",
+	"paths": {
+		"/pets": {"post": {"operationId": "addPet", "responses": {"200": {"description": "ok"}}},
+			"get": {"operationId": "listPets", "responses": {"200": {"description": "ok"}}}},
+		"/pets/{petId}": {"get": {"operationId": "getPet", "responses": {"200": {"description": "ok"}}},
+			"delete": {"operationId": "deletePet", "responses": {"200": {"description": "ok"}}}},
+		"/pets/mine": {"get": {"operationId": "getMyPets", "responses": {"200": {"description": "ok"}}}}
+	}
+}`
+
+const postmanPlan = `{
+	"info": {"name": "Pet Store", "schema": "https://schema.getpostman.com/json/collection/v2.1.0/collection.json"},
+	"variable": [{"key": "baseUrl", "value": "https://staging.example.com/v1"}, {"key": "limit", "value": "10"}],
+	"item": [
+		{
+			"name": "Add pet",
+			"request": {
+				"method": "POST",
+				"header": [{"key": "X-Trace", "value": "import"}, {"key": "X-Debug", "value": "1", "disabled": true}],
+				"url": {"raw": "{{baseUrl}}/pets", "host": ["{{baseUrl}}"], "path": ["pets"]},
+				"body": {"mode": "raw", "raw": "{\"name\": \"tom\", \"tag\": \"{{tag}}\"}"}
+			},
+			"event": [{"listen": "test", "script": {"exec": [
+				"var jsonData = pm.response.json();",
+				"pm.environment.set(\"petId\", jsonData.id);"
+			]}}]
+		},
+		{
+			"name": "Pets",
+			"item": [
+				{"name": "List pets", "request": {"method": "GET", "url": "{{baseUrl}}/pets?limit={{limit}}"}},
+				{"name": "Get pet", "request": {"method": "GET",
+					"url": {"raw": "{{baseUrl}}/pets/{{petId}}", "host": ["{{baseUrl}}"], "path": ["pets", "{{petId}}"]}}},
+				{"name": "My pets", "request": {"method": "GET", "url": "https://staging.example.com/v1/pets/mine"}},
+				{"name": "Delete pet", "request": {"method": "DELETE",
+					"url": {"raw": "{{baseUrl}}/pets/:id", "host": ["{{baseUrl}}"], "path": ["pets", ":id"],
+						"variable": [{"key": "id", "value": "42"}]}}}
+			]
+		}
+	]
+}`
+
+func TestImportPostman(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(postmanSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	plan, err := ImportPostman([]byte(postmanPlan), swagger)
+	if err != nil {
+		t.Fatalf("can't import the collection: %v", err)
+	}
+
+	var got []string
+	for _, tc := range plan.SuiteList {
+		for _, test := range tc.Tests {
+			if test.Name != MeqaInit {
+				got = append(got, tc.Name+": "+test.Method+" "+test.Path+" "+test.Name)
+			}
+		}
+	}
+	expected := []string{
+		"Pet Store: post /pets addPet_1",
+		"Pets: get /pets listPets_1",
+		"Pets: get /pets/{petId} getPet_1",
+		"Pets: get /pets/mine getMyPets_1",
+		"Pets: delete /pets/{petId} deletePet_1",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expecting the tests:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+
+	addPet := plan.SuiteMap["Pet Store"].Tests[0]
+	if addPet.HeaderParams["X-Trace"] != "import" || len(addPet.HeaderParams) != 1 {
+		t.Errorf("expecting only the enabled header, got %v", addPet.HeaderParams)
+	}
+	if body, _ := addPet.BodyParams.(map[string]interface{}); body["name"] != "tom" || body["tag"] != "{{tag}}" {
+		t.Errorf("expecting the json body with the unmapped variable kept, got %v", addPet.BodyParams)
+	}
+	pets := plan.SuiteMap["Pets"].Tests
+	if pets[0].QueryParams["limit"] != "10" {
+		t.Errorf("expecting the collection variable's value, got %v", pets[0].QueryParams)
+	}
+	if pets[1].PathParams["petId"] != "{{addPet_1.outputs.id}}" {
+		t.Errorf("expecting the variable saved by addPet_1, got %v", pets[1].PathParams)
+	}
+	if pets[3].PathParams["petId"] != "42" {
+		t.Errorf("expecting the path variable's value, got %v", pets[3].PathParams)
+	}
+	if !strings.Contains(plan.comment, "{{baseUrl}} https://staging.example.com/v1") ||
+		!strings.Contains(plan.comment, "need to be replaced: tag") {
+		t.Errorf("expecting the base URL and the unmapped variables in the comment, got %s", plan.comment)
+	}
+
+	// Without a spec the path variables become path params.
+	plan, err = ImportPostman([]byte(postmanPlan), nil)
+	if err != nil {
+		t.Fatalf("can't import the collection: %v", err)
+	}
+	if deletePet := plan.SuiteMap["Pets"].Tests[3]; deletePet.Path != "/pets/{id}" || deletePet.PathParams["id"] != "42" {
+		t.Errorf("expecting /pets/{id} with id 42, got %s %v", deletePet.Path, deletePet.PathParams)
+	}
+}
+
+func TestWritePostmanCollection(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &mqswag.Swagger{}
+	err := json.Unmarshal([]byte(postmanSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	swagger.Host = "localhost:8080"
+	db := &mqswag.DB{}
+	db.Init(swagger)
+	suite := &TestSuite{Name: "pets"}
+	addPet := &Test{Name: "addPet_1", Path: "/pets", Method: mqswag.MethodPost,
+		BodyParams: map[string]interface{}{"name": "tom", "age": 3.0}}
+	getPet := &Test{Name: "getPet_1", Path: "/pets/{petId}", Method: mqswag.MethodGet,
+		TestParams: TestParams{PathParams: map[string]interface{}{"petId": 42}, HeaderParams: map[string]interface{}{"X-Trace": "abc"}}}
+	listPets := &Test{Name: "listPets_1", Path: "/pets", Method: mqswag.MethodGet,
+		TestParams: TestParams{QueryParams: map[string]interface{}{"limit": 10}}}
+	skipped := &Test{Name: "deletePet_1", Path: "/pets/{petId}", Method: mqswag.MethodDelete}
+	for _, test := range []*Test{addPet, getPet, listPets, skipped} {
+		test.suite, test.db = suite, db
+		if test != skipped {
+			test.startTime = time.Now()
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = WritePostmanCollection(&buf, []*Test{addPet, getPet, listPets, skipped}); err != nil {
+		t.Fatalf("can't write the collection: %v", err)
+	}
+	var collection map[string]interface{}
+	if err = json.Unmarshal(buf.Bytes(), &collection); err != nil {
+		t.Fatalf("the collection isn't valid json: %v", err)
+	}
+	if info, _ := collection["info"].(map[string]interface{}); info["schema"] != postmanSchema {
+		t.Errorf("expecting the v2.1 schema, got %v", collection["info"])
+	}
+	if !strings.Contains(buf.String(), `"raw": "http://localhost:8080/v1/pets?limit=10"`) {
+		t.Errorf("expecting the resolved url with the query, got %s", buf.String())
+	}
+
+	// Importing the collection gives back the tests that were sent.
+	plan, err := ImportPostman(buf.Bytes(), swagger)
+	if err != nil {
+		t.Fatalf("can't import the collection: %v", err)
+	}
+	tests := plan.SuiteMap["pets"].Tests
+	if len(tests) != 3 {
+		t.Fatalf("expecting the 3 tests that were sent, got %d", len(tests))
+	}
+	if tests[0].Method != mqswag.MethodPost || tests[0].Path != "/pets" ||
+		!mqutil.InterfaceEquals(addPet.BodyParams, tests[0].BodyParams) ||
+		tests[0].HeaderParams["Content-Type"] != "application/json" {
+		t.Errorf("expecting post /pets with the body, got %s %s %v %v", tests[0].Method, tests[0].Path,
+			tests[0].BodyParams, tests[0].HeaderParams)
+	}
+	if tests[1].Method != mqswag.MethodGet || tests[1].Path != "/pets/{petId}" || tests[1].PathParams["petId"] != "42" ||
+		tests[1].HeaderParams["X-Trace"] != "abc" {
+		t.Errorf("expecting get /pets/{petId} with petId 42, got %s %s %v %v", tests[1].Method, tests[1].Path,
+			tests[1].PathParams, tests[1].HeaderParams)
+	}
+	if tests[2].QueryParams["limit"] != "10" {
+		t.Errorf("expecting the limit query, got %v", tests[2].QueryParams)
+	}
+}
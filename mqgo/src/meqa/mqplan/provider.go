@@ -0,0 +1,113 @@
+package mqplan
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValueProvider generates a value for the schema, e.g. a real country code or a valid ISBN, where random
+// generation can't produce one the server accepts.
+type ValueProvider func(schema *spec.Schema) (interface{}, error)
+
+var providerMutex sync.RWMutex
+var providerMap = make(map[string]ValueProvider)
+
+// RegisterValueProvider makes the generation use the provider for the values of the format, e.g. "isbn", of the
+// properties and parameters tagged with the name, e.g. <meqa generator:vin>, or of the properties and parameters
+// of the name, e.g. "countryCode". Registering a name again replaces the provider, registering nil removes it.
+func RegisterValueProvider(name string, provider ValueProvider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	if provider == nil {
+		delete(providerMap, name)
+		return
+	}
+	providerMap[name] = provider
+}
+
+// RegisterGenerator registers the generator of a domain specific format or tag, e.g. "iban" or "vin", the same as
+// RegisterValueProvider. The generator gets the schema, so it can keep to its lengths and other constraints.
+func RegisterGenerator(name string, generator ValueProvider) {
+	RegisterValueProvider(name, generator)
+}
+
+// GeneratorTimeout is how long a generator command can take to print a value.
+var GeneratorTimeout = 10 * time.Second
+
+// execGenerator returns a generator that runs the command with sh and reads the value from its output. The
+// command gets the schema as JSON on its stdin. The output of the string schemas is taken as is, without the
+// trailing newline, the others are parsed as JSON.
+func execGenerator(name string, command string) ValueProvider {
+	return func(schema *spec.Schema) (interface{}, error) {
+		schemaJson, err := json.Marshal(schema)
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInternal, fmt.Sprintf("generator %s: %s", name, err.Error()))
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), GeneratorTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", command)
+		cmd.Stdin = bytes.NewReader(schemaJson)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("generator %s failed: %s %s", name,
+				err.Error(), strings.TrimSpace(stderr.String())))
+		}
+		str := strings.TrimRight(string(out), "\r\n")
+		if len(schema.Type) == 0 || schema.Type[0] == gojsonschema.TYPE_STRING {
+			return str, nil
+		}
+		var value interface{}
+		if err = json.Unmarshal([]byte(str), &value); err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("generator %s printed %q, expecting a %s",
+				name, str, schema.Type[0]))
+		}
+		return value, nil
+	}
+}
+
+// getValueProvider returns the provider of the schema's format, or else of the tag's generator name, or else of the
+// field name, or nil. For the format and the generator name, the providers registered from Go come before the
+// commands of the plan's generators. The property names come with the "_" suffix generateObject adds.
+func (t *Test) getValueProvider(s *spec.Schema, tag *mqswag.MeqaTag, fieldName string) ValueProvider {
+	var commands map[string]string
+	if t.suite != nil && t.suite.plan != nil {
+		commands = t.suite.plan.Generators
+	}
+	names := []string{s.Format}
+	if tag != nil {
+		names = append(names, tag.Generator)
+	}
+	providerMutex.RLock()
+	defer providerMutex.RUnlock()
+	for _, name := range names {
+		if len(name) == 0 {
+			continue
+		}
+		if provider := providerMap[name]; provider != nil {
+			return provider
+		}
+		if command := commands[name]; len(command) > 0 {
+			return execGenerator(name, command)
+		}
+	}
+	if tag != nil && len(tag.Generator) > 0 {
+		mqutil.Logger.Printf("warning: %s: no generator %s, generating a random value", t.Name, tag.Generator)
+	}
+	if name := strings.TrimSuffix(fieldName, "_"); len(name) > 0 {
+		return providerMap[name]
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestValueProvider(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	RegisterValueProvider("countryCode", func(*spec.Schema) (interface{}, error) { return "NZ", nil })
+	RegisterValueProvider("isbn", func(*spec.Schema) (interface{}, error) { return "978-0-306-40615-7", nil })
+	defer RegisterValueProvider("countryCode", nil)
+	defer RegisterValueProvider("isbn", nil)
+
+	test, db := createPetTest(t)
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"countryCode": {"type": "string", "pattern": "^[a-z]{5}$"},
+		"book": {"type": "string", "format": "isbn"},
+		"name": {"type": "string"}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	v, err := test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	obj := v.(map[string]interface{})
+	if obj["countryCode"] != "NZ" || obj["book"] != "978-0-306-40615-7" {
+		t.Errorf("expecting the provided values, got %v", obj)
+	}
+	if obj["name"] == "NZ" {
+		t.Errorf("expecting the other properties to be random, got %v", obj)
+	}
+
+	// The format takes priority over the name.
+	RegisterValueProvider("book", func(*spec.Schema) (interface{}, error) { return "by name", nil })
+	defer RegisterValueProvider("book", nil)
+	v, err = test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	if book := v.(map[string]interface{})["book"]; book != "978-0-306-40615-7" {
+		t.Errorf("expecting the format's provider to win, got %v", book)
+	}
+}
+
+func TestRegisterGenerator(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	RegisterGenerator("iban", func(*spec.Schema) (interface{}, error) { return "GB82WEST12345698765432", nil })
+	// The generator keeps to the schema's maxLength.
+	RegisterGenerator("vin", func(s *spec.Schema) (interface{}, error) {
+		vin := "1HGCM82633A004352"
+		if s.MaxLength != nil && int64(len(vin)) > *s.MaxLength {
+			vin = vin[:*s.MaxLength]
+		}
+		return vin, nil
+	})
+	defer RegisterGenerator("iban", nil)
+	defer RegisterGenerator("vin", nil)
+
+	test, db := createPetTest(t)
+	test.suite.plan = &TestPlan{PlanSettings: PlanSettings{Generators: map[string]string{
+		"ulid":  "cat > /dev/null; echo 01ARZ3NDEKTSV4RRFFQ69G5FAV",
+		"count": "grep -q '\"maximum\":9' && echo 9",
+		"vin":   "echo from the command",
+		"fail":  "exit 3",
+	}}}
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"account": {"type": "string", "format": "iban"},
+		"vin": {"type": "string", "maxLength": 10, "description": "<meqa generator:vin>"},
+		"id": {"type": "string", "x-meqa-generator": "ulid"},
+		"count": {"type": "integer", "maximum": 9, "format": "count"},
+		"name": {"type": "string", "description": "<meqa generator:unknown>"}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	v, err := test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	obj := v.(map[string]interface{})
+	if obj["account"] != "GB82WEST12345698765432" || obj["vin"] != "1HGCM82633" {
+		t.Errorf("expecting the registered generators' values, got %v", obj)
+	}
+	// The commands get the schema on their stdin, and print the value.
+	if obj["id"] != "01ARZ3NDEKTSV4RRFFQ69G5FAV" || obj["count"] != float64(9) {
+		t.Errorf("expecting the commands' values, got %v", obj)
+	}
+	if name, ok := obj["name"].(string); !ok || len(name) == 0 {
+		t.Errorf("expecting a random value without the generator, got %v", obj["name"])
+	}
+
+	// The generators and the value providers are one registry, the format comes before the tag and the name.
+	RegisterValueProvider("plate", func(*spec.Schema) (interface{}, error) { return "KA-123", nil })
+	defer RegisterValueProvider("plate", nil)
+	schema = spec.Schema{}
+	json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"plate": {"type": "string", "description": "<meqa generator:vin>"},
+		"car": {"type": "string", "format": "iban", "description": "<meqa generator:plate>"},
+		"other": {"type": "string", "description": "<meqa generator:plate>"}}}`), &schema)
+	v, err = test.GenerateSchema("", nil, &schema, db, 0)
+	if err != nil {
+		t.Fatalf("generating failed: %v", err)
+	}
+	obj = v.(map[string]interface{})
+	if obj["plate"] != "1HGCM82633A004352" || obj["car"] != "GB82WEST12345698765432" || obj["other"] != "KA-123" {
+		t.Errorf("expecting the format, then the tag, then the name, got %v", obj)
+	}
+
+	schema = spec.Schema{}
+	json.Unmarshal([]byte(`{"type": "string", "description": "<meqa generator:fail>"}`), &schema)
+	_, err = test.GenerateSchema("", nil, &schema, db, 0)
+	if err == nil || !strings.Contains(err.Error(), "generator fail failed") {
+		t.Errorf("expecting the failing command to fail the generation, got %v", err)
+	}
+}
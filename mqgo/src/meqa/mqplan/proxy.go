@@ -0,0 +1,104 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"gopkg.in/resty.v0"
+)
+
+// The calls to the server under test can go through a proxy, except the ones to the hosts that match noProxy, a
+// comma separated list in the format of the NO_PROXY environment variable: host names, which match their
+// subdomains as well, e.g. example.com or .example.com, IPs, CIDRs, e.g. 10.0.0.0/8, each with an optional port,
+// or * for all the hosts. The calls to localhost never go through the proxy.
+
+// matchNoProxy returns whether the host, with an optional port, matches noProxy.
+func matchNoProxy(hostPort string, noProxy string) bool {
+	host, port, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		host, port = hostPort, ""
+	}
+	host = strings.ToLower(strings.Trim(host, "[]"))
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, entry := range strings.Split(strings.ToLower(noProxy), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		entryHost, entryPort, err := net.SplitHostPort(entry)
+		if err != nil {
+			entryHost, entryPort = entry, ""
+		}
+		entryHost = strings.Trim(entryHost, "[]")
+		if len(entryHost) == 0 || len(entryPort) > 0 && entryPort != port {
+			continue
+		}
+		if host == strings.TrimPrefix(entryHost, ".") || strings.HasSuffix(host, "."+strings.TrimPrefix(entryHost, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyFunc returns the proxy of each call, or none for the hosts that match noProxy. An empty noProxy is taken
+// from NO_PROXY.
+func proxyFunc(proxyURL string, noProxy string) (func(*http.Request) (*url.URL, error), error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || len(u.Host) == 0 || u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5" {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid proxy %s, expecting a url, e.g. http://proxy.example.com:3128", proxyURL))
+	}
+	if len(noProxy) == 0 {
+		noProxy = os.Getenv("NO_PROXY")
+	}
+	if len(noProxy) == 0 {
+		noProxy = os.Getenv("no_proxy")
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if matchNoProxy(req.URL.Host, noProxy) {
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+// transport is the transport of the client the tests are sent with. resty has no way to get its transport back,
+// so mqplan keeps its own, starting with a copy of the http package's default transport.
+var transport = http.DefaultTransport.(*http.Transport).Clone()
+
+func init() {
+	resty.SetTransport(transport)
+}
+
+// setTransport makes t the transport of the client the tests are sent with.
+func setTransport(t *http.Transport) {
+	transport = t
+	resty.SetTransport(t)
+}
+
+// SetProxy sends the calls to the server under test through the proxy, except the ones to the hosts that match
+// noProxy. The rest of the transport, e.g. the TLS config SetTLS applied, is kept.
+func SetProxy(proxyURL string, noProxy string) error {
+	proxy, err := proxyFunc(proxyURL, noProxy)
+	if err != nil {
+		return err
+	}
+	t := transport.Clone()
+	t.Proxy = proxy
+	setTransport(t)
+	return nil
+}
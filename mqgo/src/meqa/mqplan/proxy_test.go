@@ -0,0 +1,78 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	previous := transport
+	defer setTransport(previous)
+	// The TLS config set before the proxy is kept.
+	if err := SetTLS(&TLSOptions{InsecureSkipVerify: true}); err != nil {
+		t.Fatalf("can't set the TLS options: %v", err)
+	}
+	// The proxy stub answers the calls itself, and records the urls it was asked for.
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.URL.String())
+	}))
+	defer proxy.Close()
+
+	if err := SetProxy(proxy.URL, "10.0.0.0/8"); err != nil {
+		t.Fatalf("can't set the proxy: %v", err)
+	}
+	if transport == previous || transport.TLSClientConfig == nil || !transport.TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("expecting a new transport with the TLS config kept")
+	}
+	// The host doesn't exist, only the proxy can answer.
+	plan := newTestPlan(t, setupSwagger, "http://api.example.test", "")
+	if err := plan.AddFromString("suite:\n- name: other\n  path: /other\n  method: get\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	if _, err := plan.Run("suite", nil); err != nil {
+		t.Fatalf("the call through the proxy failed: %v", err)
+	}
+	if strings.Join(proxied, " ") != "http://api.example.test/other" {
+		t.Errorf("expecting the call to go through the proxy, got %v", proxied)
+	}
+
+	// The hosts that match noProxy, from the option or else NO_PROXY, are called directly.
+	defer os.Setenv("NO_PROXY", os.Getenv("NO_PROXY"))
+	os.Setenv("NO_PROXY", ".example.org")
+	for _, c := range []struct {
+		noProxy, url string
+		proxied      bool
+	}{
+		{"internal.example.test,10.0.0.0/8", "http://api.example.test/pets", true},
+		{"internal.example.test,10.0.0.0/8", "https://api.internal.example.test/pets", false},
+		{"internal.example.test,10.0.0.0/8", "http://10.1.2.3:8080/pets", false},
+		{"internal.example.test,10.0.0.0/8", "http://api.example.org/pets", true},
+		{"", "http://api.example.org/pets", false},
+		{"", "http://localhost:8080/pets", false},
+		{"example.test", "http://notexample.test/pets", true},
+		{"api.example.test:8080", "http://api.example.test:8080/pets", false},
+		{"api.example.test:8080", "http://api.example.test:9090/pets", true},
+		{"*", "http://api.example.test/pets", false},
+	} {
+		proxyOf, err := proxyFunc(proxy.URL, c.noProxy)
+		if err != nil {
+			t.Fatalf("can't make the proxy func: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, c.url, nil)
+		u, err := proxyOf(req)
+		if err != nil || (u != nil) != c.proxied {
+			t.Errorf("noProxy %q, %s: expecting proxied to be %v, got %v %v", c.noProxy, c.url, c.proxied, u, err)
+		}
+	}
+
+	if err := SetProxy("proxy.example.com:3128", ""); err == nil || !strings.Contains(err.Error(), "invalid proxy") {
+		t.Errorf("expecting an invalid proxy error, got %v", err)
+	}
+}
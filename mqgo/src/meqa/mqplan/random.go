@@ -0,0 +1,42 @@
+package mqplan
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The values of the tests are generated with random, so seeding it makes a run repeatable. The global rand can't
+// be seeded since Go 1.24. The values of the patterns are generated by reggen, with the global rand, so they differ
+// between the runs.
+
+// lockedSource is a rand.Source the suites running in parallel can share.
+type lockedSource struct {
+	mutex  sync.Mutex
+	source rand.Source64
+}
+
+func (s *lockedSource) Int63() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.source.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.source.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.source.Seed(seed)
+}
+
+var random = rand.New(&lockedSource{source: rand.NewSource(time.Now().UnixNano()).(rand.Source64)})
+
+// Seed seeds the values the tests generate. Call it before the tests run.
+func Seed(seed int64) {
+	random.Seed(seed)
+}
@@ -0,0 +1,46 @@
+package mqplan
+
+import (
+	"sync"
+	"time"
+)
+
+// Sending the tests too fast trips the rate limiter of the server, which fails them with 429s that have nothing
+// to do with the API. With rateLimit in meqa_init, or -rate on the command line, the calls of a plan are spaced
+// so that no more than rateLimit of them are sent per second, across the suites running in parallel.
+
+// RateLimit is the number of calls per second set on the command line. It overrides the plan's rateLimit.
+var RateLimit float64
+
+// rateLimiter spaces the calls it's asked to wait for by its interval.
+type rateLimiter struct {
+	mutex sync.Mutex
+	next  time.Time // the earliest time the next call can be sent
+}
+
+// wait blocks until a call can be sent at the rate, and books the time slot for it. The calls waiting at the
+// same time get their slots one after another.
+func (l *rateLimiter) wait(rate float64) {
+	if rate <= 0 {
+		return
+	}
+	interval := time.Duration(float64(time.Second) / rate)
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	slot := l.next
+	l.next = slot.Add(interval)
+	l.mutex.Unlock()
+	time.Sleep(slot.Sub(now))
+}
+
+// waitForRate blocks until the plan's rate limit allows the next call.
+func (plan *TestPlan) waitForRate() {
+	rate := plan.RateLimit
+	if RateLimit > 0 {
+		rate = RateLimit
+	}
+	plan.limiter.wait(rate)
+}
@@ -0,0 +1,62 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var mutex sync.Mutex
+	var calls []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		calls = append(calls, time.Now())
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	run := func(init string, workers int) []time.Time {
+		plan := newTestPlan(t, requiredSwagger, server.URL, "  requiredParamDefaults:\n"+
+			"    x-correlation-id: abc-123\n"+init)
+		test := "- name: getOrders\n  path: /orders\n  method: get\n  repeat: 2\n"
+		for _, name := range []string{"suite1", "suite2"} {
+			if err := plan.AddFromString(name + ":\n" + test); err != nil {
+				t.Fatalf("can't load plan: %v", err)
+			}
+		}
+		calls = nil
+		plan.ResultCounts = make(map[string]int)
+		plan.RunSuites([]string{"suite1", "suite2"}, workers)
+		if plan.ResultCounts[mqutil.Passed] != 4 {
+			t.Errorf("expecting all the calls to pass, got %v", plan.ResultCounts)
+		}
+		sort.Slice(calls, func(i, j int) bool { return calls[i].Before(calls[j]) })
+		return calls
+	}
+
+	// 20 calls per second, so the calls are at least 50ms apart, even from the suites running in parallel.
+	interval := 50 * time.Millisecond
+	for _, workers := range []int{1, 2} {
+		times := run("  rateLimit: 20\n", workers)
+		if len(times) != 4 {
+			t.Fatalf("expecting 4 calls, got %d", len(times))
+		}
+		for i := 1; i < len(times); i++ {
+			// Allow for the time between the limiter and the server.
+			if gap := times[i].Sub(times[i-1]); gap < interval-5*time.Millisecond {
+				t.Errorf("%d workers: expecting the calls at least %v apart, got %v", workers, interval, gap)
+			}
+		}
+	}
+
+	if err := (&TestPlan{}).AddFromString("meqa_init:\n- name: meqa_init\n  rateLimit: -1\n"); err == nil {
+		t.Errorf("expecting a negative rateLimit to be rejected")
+	}
+}
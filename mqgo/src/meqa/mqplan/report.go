@@ -0,0 +1,134 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io"
+	"meqa/mqutil"
+	"os"
+)
+
+// TestResult is the outcome of a test that was sent, as listed in the JSON report.
+type TestResult struct {
+	Name        string         `json:"name"`
+	Suite       string         `json:"suite,omitempty"`
+	Method      string         `json:"method"`
+	Path        string         `json:"path"`
+	Request     RequestSummary `json:"request"`
+	Status      int            `json:"status,omitempty"`      // 0 if there was no response
+	ContentType string         `json:"contentType,omitempty"` // the media type of the response
+	Duration    float64        `json:"durationMs"`
+	Passed      bool           `json:"passed"`
+	Skipped     bool           `json:"skipped,omitempty"` // not sent, because the operation is deprecated
+	Error       string         `json:"error,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+	Violation   string         `json:"violation,omitempty"`   // the constraint a negative test breaks, e.g. body.age: maximum
+	ServerError bool           `json:"serverError,omitempty"` // a negative test got a 5xx, the server broke on the value
+
+	// The size and the SHA-256 of the body, when the response is binary.
+	ContentLength int    `json:"contentLength,omitempty"`
+	BodySha256    string `json:"bodySha256,omitempty"`
+
+	// The expected and the actual body as JSON, when the body didn't match the expected body.
+	ExpectedBody string `json:"expectedBody,omitempty"`
+	GotBody      string `json:"gotBody,omitempty"`
+}
+
+// RequestSummary is the request the test sent, with the parameters resolved.
+type RequestSummary struct {
+	URL         string                 `json:"url"`
+	ContentType string                 `json:"contentType,omitempty"` // the media type of the body
+	Accept      string                 `json:"accept,omitempty"`
+	Headers     map[string]interface{} `json:"headers,omitempty"`
+	Form        map[string]interface{} `json:"form,omitempty"`
+	Body        interface{}            `json:"body,omitempty"`
+}
+
+// Result returns the outcome of the test after it ran.
+func (t *Test) Result() TestResult {
+	r := TestResult{
+		Name:     t.Name,
+		Method:   t.Method,
+		Path:     t.Path,
+		Duration: float64(t.stopTime.Sub(t.startTime).Nanoseconds()) / 1e6,
+		Passed:   t.err == nil && !t.skipped,
+		Skipped:  t.skipped,
+		Warnings: t.warnings,
+	}
+	if t.suite != nil {
+		r.Suite = t.suite.Name
+	}
+	if t.violation != nil {
+		r.Violation = t.violation.String()
+	}
+	if t.db != nil && t.db.Swagger != nil {
+		u, _ := t.requestURL()
+		if len(t.QueryParams) > 0 {
+			u.RawQuery = t.paramValues(t.maskParams(t.QueryParams, "query"), "query").Encode()
+		}
+		r.Request.URL = u.String()
+	}
+	// The report is kept and shared, so the secrets are masked as in the logs.
+	if len(t.HeaderParams) > 0 {
+		r.Request.Headers = t.maskParams(t.HeaderParams, "header")
+	}
+	if len(t.FormParams) > 0 {
+		r.Request.Form = t.maskParams(t.FormParams, "formData")
+	}
+	r.Request.Body = t.maskBody(t.BodyParams)
+	r.Request.ContentType = t.contentType
+	r.Request.Accept = t.accept
+	r.ContentType = t.respContentType
+	r.ContentLength, r.BodySha256 = t.bodySize, t.bodySha256
+	if t.resp != nil {
+		r.Status = t.resp.StatusCode()
+		r.ServerError = t.violation != nil && r.Status >= 500
+	}
+	if t.err != nil {
+		r.Error = mqutil.ErrorMessage(t.err)
+		r.ExpectedBody, r.GotBody = t.expectedBody, t.gotBody
+	}
+	return r
+}
+
+// Results returns the outcomes of the tests that were sent, and of the ones skipped because their operation is
+// deprecated, in the order they ran.
+func (plan *TestPlan) Results() []TestResult {
+	plan.mutex.Lock()
+	defer plan.mutex.Unlock()
+	var results []TestResult
+	for _, t := range plan.resultList {
+		if len(t.Path) > 0 && (!t.startTime.IsZero() || t.skipped) {
+			results = append(results, t.Result())
+		}
+	}
+	return results
+}
+
+// JSONReport is the JSON report of a run.
+type JSONReport struct {
+	Results          []TestResult `json:"results"`
+	SkippedArtifacts []string     `json:"skippedArtifacts,omitempty"` // the artifacts of the run over the budget
+}
+
+// WriteJSONReport writes the results, and the artifacts of the run skipped because of the budget, as JSON.
+func WriteJSONReport(w io.Writer, results []TestResult, skipped []string) error {
+	if results == nil {
+		results = []TestResult{}
+	}
+	data, err := json.MarshalIndent(&JSONReport{results, skipped}, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteJSONReportToFile writes the results of the run to the file as a JSON report.
+func (plan *TestPlan) WriteJSONReportToFile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return WriteJSONReport(f, plan.Results(), nil)
+}
@@ -0,0 +1,112 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONReport(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, setupSwagger, server.URL, "")
+	err := plan.AddFromString(`suite:
+- name: login
+  path: /login
+  method: post
+  headerParams:
+    X-Trace: abc
+- name: skipped
+  path: /other
+  method: get
+  skipIf: '{{login.expect.status}} == 200'
+- name: fail
+  path: /fail
+  method: get
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("suite", nil)
+
+	var buf bytes.Buffer
+	if err = WriteJSONReport(&buf, plan.Results(), nil); err != nil {
+		t.Fatalf("can't write the report: %v", err)
+	}
+	var report struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err = json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("the report isn't valid json: %v\n%s", err, buf.String())
+	}
+	results := report.Results
+	if len(results) != 2 {
+		t.Fatalf("expecting an entry per test that was sent, got %s", buf.String())
+	}
+	login, fail := results[0], results[1]
+	request, _ := login["request"].(map[string]interface{})
+	headers, _ := request["headers"].(map[string]interface{})
+	if login["name"] != "login" || login["method"] != "post" || login["path"] != "/login" || login["status"] != 200.0 ||
+		login["passed"] != true || login["error"] != nil || request["url"] != server.URL+"/login" || headers["X-Trace"] != "abc" {
+		t.Errorf("unexpected entry for login: %v", login)
+	}
+	if _, ok := login["durationMs"].(float64); !ok {
+		t.Errorf("expecting the duration of login, got %v", login["durationMs"])
+	}
+	errMsg, _ := fail["error"].(string)
+	if fail["name"] != "fail" || fail["status"] != 500.0 || fail["passed"] != false || len(errMsg) == 0 ||
+		strings.Contains(errMsg, "Backtrace") {
+		t.Errorf("unexpected entry for fail: %v", fail)
+	}
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name": "rex", "age": 3}`))
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, setupSwagger, server.URL, "")
+	err := plan.AddFromString(`suite:
+- name: other
+  path: /other
+  method: get
+  expect:
+    body:
+      name: max
+      age: 3
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("suite", nil)
+
+	results := plan.Results()
+	if len(results) != 1 || results[0].Passed {
+		t.Fatalf("expecting the body comparison to fail, got %v", results)
+	}
+	var buf bytes.Buffer
+	if err = WriteHTMLReport(&buf, results, nil); err != nil {
+		t.Fatalf("can't write the report: %v", err)
+	}
+	page := buf.String()
+	for _, s := range []string{`<pre class="diff">`, `<span class="del">-   &#34;name&#34;: &#34;max&#34;`,
+		`<span class="add">+   &#34;name&#34;: &#34;rex&#34;`, "    &#34;age&#34;: 3", "0 passed, 1 failed"} {
+		if !strings.Contains(page, s) {
+			t.Errorf("expecting %s in the report, got\n%s", s, page)
+		}
+	}
+}
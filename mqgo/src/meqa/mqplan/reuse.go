@@ -0,0 +1,121 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+
+	"github.com/go-openapi/spec"
+)
+
+// With reuseObjects, the body of a put or a patch is an existing object of the body's class, the way a client
+// fetches an object, changes a field and sends the whole thing back, instead of a newly generated object. The
+// object is the one the test already looks up, e.g. by the id in the path, or else one from the DB. One of its
+// writable properties gets a new value, and the test's bodyParams override the rest. The reuseChance in
+// meqa_init makes only some of the puts and the patches reuse an object, so the others still send new ones.
+
+// reuseObject returns the body for the parameter, made from an existing object, if the test reuses the objects.
+func (t *Test) reuseObject(paramSpec *spec.Parameter, tag *mqswag.MeqaTag, db *mqswag.DB) (interface{}, bool) {
+	if !t.ReuseObjects || paramSpec.In != "body" {
+		return nil, false
+	}
+	method := t.Method
+	if tag != nil && len(tag.Operation) > 0 {
+		method = tag.Operation
+	} else if t.tag != nil && len(t.tag.Operation) > 0 {
+		method = t.tag.Operation
+	}
+	if method != mqswag.MethodPut && method != mqswag.MethodPatch {
+		return nil, false
+	}
+	if t.suite != nil && t.suite.plan != nil && t.suite.plan.ReuseChance > 0 &&
+		random.Float64() >= t.suite.plan.ReuseChance {
+		return nil, false
+	}
+	objTag, objSchema := db.Swagger.GetSchemaRootType((*mqswag.Schema)(paramSpec.Schema), tag)
+	if objTag == nil || len(objTag.Class) == 0 || objSchema == nil || !isObjectSchema(paramSpec.Schema, db.Swagger) {
+		return nil, false
+	}
+	class := objTag.Class
+
+	// The object the test looks up, or else one from the DB.
+	var base map[string]interface{}
+	comps := t.comparisons[class]
+	if len(comps) > 0 && comps[len(comps)-1].old != nil && comps[len(comps)-1].new == nil {
+		base = comps[len(comps)-1].old
+	} else if found := t.findObjects(class, 5); len(found) > 0 {
+		base, _ = mqutil.InterfaceCopy(found[random.Intn(len(found))]).(map[string]interface{})
+	}
+	if base == nil {
+		mqutil.Logger.Printf("%s: no %s in the DB to reuse, generating a new one", t.Name, class)
+		return nil, false
+	}
+
+	generated, err := t.GenerateSchema("", tag, paramSpec.Schema, db, 3)
+	obj, ok := generated.(map[string]interface{})
+	if err != nil || !ok {
+		return nil, false
+	}
+	changed := pickChangedProperty(obj, (*spec.Schema)(objSchema), class)
+	// The generated object is in the comparison, so it's changed in place.
+	for k, v := range base {
+		if k == changed {
+			continue
+		}
+		if p, exist := objSchema.Properties[k]; exist && p.ReadOnly && !t.IncludeReadOnly {
+			delete(obj, k)
+			continue
+		}
+		obj[k] = mqutil.InterfaceCopy(v)
+	}
+	if comps = t.comparisons[class]; len(comps) > 0 && comps[len(comps)-1].old == nil {
+		last := comps[len(comps)-1]
+		last.old = base
+		last.oldUsed = make(map[string]interface{})
+		for k, v := range base {
+			if k != changed {
+				last.oldUsed[k] = v
+			}
+		}
+	}
+	fmt.Printf("reused %s, changing %s\n", class, changed)
+	return obj, true
+}
+
+// isObjectSchema returns whether the schema, or the one it refers to, is an object rather than an array.
+func isObjectSchema(schema *spec.Schema, swagger *mqswag.Swagger) bool {
+	s := (*mqswag.Schema)(schema)
+	for s != nil {
+		_, referred, err := swagger.GetReferredSchema(s)
+		if err != nil {
+			return false
+		}
+		if referred == nil {
+			break
+		}
+		s = referred
+	}
+	return s != nil && (s.Type.Contains("object") || len(s.Type) == 0 && len(s.Properties) > 0)
+}
+
+// pickChangedProperty picks the property of the generated object that gets a new value. The readOnly properties
+// and the keys of the object, i.e. id and the properties tagged with the object's own class, keep their values.
+func pickChangedProperty(obj map[string]interface{}, schema *spec.Schema, class string) string {
+	var candidates []string
+	for k := range obj {
+		p := schema.Properties[k]
+		if k == "id" || p.ReadOnly {
+			continue
+		}
+		if pTag := mqswag.GetTag(&p); pTag != nil && pTag.Class == class {
+			continue
+		}
+		candidates = append(candidates, k)
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+	sort.Strings(candidates)
+	return candidates[random.Intn(len(candidates))]
+}
@@ -0,0 +1,105 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const reuseSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "reuse", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/pets": {
+			"post": {
+				"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}},
+			"put": {
+				"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+				"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "required": ["id", "name", "status", "age", "color"], "properties": {
+			"id": {"type": "integer", "format": "int64"},
+			"name": {"type": "string"},
+			"status": {"type": "string"},
+			"age": {"type": "integer"},
+			"color": {"type": "string"}}}
+	}
+}`
+
+func TestReuseObjects(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	bodies := make(map[string]map[string]interface{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var obj map[string]interface{}
+		json.Unmarshal(body, &obj)
+		bodies[r.Method] = obj
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	run := func(init string) {
+		plan := newTestPlan(t, reuseSwagger, server.URL, init)
+		if err := plan.AddFromString("suite:\n- name: create\n  path: /pets\n  method: post\n" +
+			"- name: update\n  path: /pets\n  method: put\n  bodyParams:\n    status: sold\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		bodies = make(map[string]map[string]interface{})
+		if _, err := plan.Run("suite", nil); err != nil {
+			t.Fatalf("run failed: %v", err)
+		}
+	}
+
+	// The put sends the posted pet back, with the status the test sets and at most one other field changed.
+	run("  reuseObjects: true\n")
+	created, updated := bodies[http.MethodPost], bodies[http.MethodPut]
+	if created == nil || updated == nil {
+		t.Fatalf("expecting a post and a put, got %v", bodies)
+	}
+	if created["id"] != updated["id"] || updated["status"] != "sold" {
+		t.Errorf("expecting the put to reuse the pet %v, got %v", created, updated)
+	}
+	changed := 0
+	for _, k := range []string{"name", "age", "color"} {
+		if created[k] != updated[k] {
+			changed++
+		}
+	}
+	if changed > 1 || len(updated) != len(created) {
+		t.Errorf("expecting one field of %v to change, got %v", created, updated)
+	}
+
+	// Without it, the put sends a new pet.
+	run("")
+	if bodies[http.MethodPost]["id"] == bodies[http.MethodPut]["id"] {
+		t.Errorf("expecting a new pet without reuseObjects, got %v", bodies)
+	}
+
+	// With reuseChance, only some of the puts reuse the pet.
+	reused := 0
+	for i := 0; i < 40; i++ {
+		run("  reuseObjects: true\n  reuseChance: 0.5\n")
+		if bodies[http.MethodPost]["id"] == bodies[http.MethodPut]["id"] {
+			reused++
+		}
+	}
+	if reused == 0 || reused == 40 {
+		t.Errorf("expecting some of the puts to reuse the pet, got %d of 40", reused)
+	}
+
+	plan := &TestPlan{}
+	plan.Init(&mqswag.Swagger{}, &mqswag.DB{})
+	err := plan.AddFromString("meqa_init:\n- name: meqa_init\n  reuseChance: 1.5\n")
+	if err == nil || !strings.Contains(err.Error(), "invalid reuseChance 1.5") {
+		t.Errorf("expecting an invalid reuseChance error, got %v", err)
+	}
+}
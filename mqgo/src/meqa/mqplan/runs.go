@@ -0,0 +1,226 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"meqa/mqutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Every run saving its results and reports fills up the disk of the CI machines. With -keep-runs each run saves
+// them in its own directory under meqa_data/runs, and only the last runs are kept. The optional artifacts, the
+// Postman collection and the JSON and HTML reports, are only saved within the size budget of the run.
+
+// RunsDir is the directory under meqa_data that holds a directory for each run.
+const RunsDir = "runs"
+
+// ArtifactsFile is the file in a run's directory listing the artifacts the run saved and skipped.
+const ArtifactsFile = "artifacts.json"
+
+// runDirFormat names a run's directory by the time the run started, so the names sort by time.
+const runDirFormat = "2006-01-02T15-04-05.000"
+
+// ArtifactBudget is the most bytes of optional artifacts a run saves. 0 means no limit.
+var ArtifactBudget int64
+
+// RunArtifacts keeps track of the files a run saved, and of the optional ones skipped because of the budget.
+type RunArtifacts struct {
+	Dir     string   `json:"dir,omitempty"`
+	Budget  int64    `json:"budget,omitempty"`
+	Saved   []string `json:"saved"`
+	Skipped []string `json:"skipped,omitempty"`
+
+	size int64 // the bytes of the optional artifacts saved so far
+}
+
+// NewRunDir creates the directory of a new run under runsDir.
+func NewRunDir(runsDir string) (*RunArtifacts, error) {
+	dir := filepath.Join(runsDir, time.Now().Format(runDirFormat))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &RunArtifacts{Dir: dir, Budget: ArtifactBudget}, nil
+}
+
+// Path returns where the artifact goes. The relative paths are in the run's directory.
+func (a *RunArtifacts) Path(path string) string {
+	if len(a.Dir) == 0 || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(a.Dir, path)
+}
+
+// Save writes the artifact to the path. An optional artifact that would take the run over its budget is skipped,
+// and recorded as such.
+func (a *RunArtifacts) Save(path string, optional bool, write func(io.Writer) error) error {
+	path = a.Path(path)
+	buf := &bytes.Buffer{}
+	if err := write(buf); err != nil {
+		return err
+	}
+	if optional {
+		if !a.fits(a.size, buf.Len()) {
+			a.skip(path)
+			return nil
+		}
+		a.size += int64(buf.Len())
+	}
+	if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	a.Saved = append(a.Saved, path)
+	return nil
+}
+
+// fits returns whether an optional artifact of n bytes fits in the budget, with size bytes saved.
+func (a *RunArtifacts) fits(size int64, n int) bool {
+	return a.Budget <= 0 || size+int64(n) <= a.Budget
+}
+
+// skip records the optional artifact at the path as skipped because of the budget.
+func (a *RunArtifacts) skip(path string) {
+	a.Skipped = append(a.Skipped, path)
+	fmt.Printf("Not saving %s, the artifacts would exceed the budget of %d bytes.\n", path, a.Budget)
+}
+
+// WriteToFile lists the saved and the skipped artifacts in the file.
+func (a *RunArtifacts) WriteToFile(path string) error {
+	data, err := json.MarshalIndent(a, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// SaveArtifacts writes the result file of the run, and the Postman collection and the JSON and HTML reports whose
+// paths aren't empty, within the budget. The list of the artifacts goes next to the result file, when the run has
+// its own directory or an artifact was skipped.
+func (plan *TestPlan) SaveArtifacts(a *RunArtifacts, resultPath, postmanPath, jsonPath, htmlPath string) error {
+	resultPath = a.Path(resultPath)
+	os.Remove(resultPath)
+	if err := plan.WriteResultToFile(resultPath); err != nil {
+		return err
+	}
+	a.Saved = append(a.Saved, resultPath)
+	optional := []struct {
+		path  string
+		write func(w io.Writer, skipped []string) error
+	}{
+		{postmanPath, func(w io.Writer, skipped []string) error { return WritePostmanCollection(w, plan.resultList) }},
+		{jsonPath, func(w io.Writer, skipped []string) error { return WriteJSONReport(w, plan.Results(), skipped) }},
+		{htmlPath, func(w io.Writer, skipped []string) error { return WriteHTMLReport(w, plan.Results(), skipped) }},
+	}
+	// The reports note the artifacts skipped, so the ones that fit in the budget are worked out first. The notes
+	// aren't counted.
+	fit := make([]bool, len(optional))
+	var skipped []string
+	size := a.size
+	for i, artifact := range optional {
+		if len(artifact.path) == 0 {
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if err := artifact.write(buf, nil); err != nil {
+			mqutil.Logger.Printf("Error writing %s: %s", artifact.path, err.Error())
+			continue
+		}
+		if !a.fits(size, buf.Len()) {
+			skipped = append(skipped, a.Path(artifact.path))
+			continue
+		}
+		size += int64(buf.Len())
+		fit[i] = true
+	}
+	for i, artifact := range optional {
+		if !fit[i] {
+			continue
+		}
+		write := artifact.write
+		if err := a.Save(artifact.path, false, func(w io.Writer) error { return write(w, skipped) }); err != nil {
+			mqutil.Logger.Printf("Error writing %s: %s", artifact.path, err.Error())
+		}
+	}
+	for _, path := range skipped {
+		a.skip(path)
+	}
+	a.size = size
+	if len(a.Dir) == 0 && len(a.Skipped) == 0 {
+		return nil
+	}
+	return a.WriteToFile(filepath.Join(filepath.Dir(resultPath), ArtifactsFile))
+}
+
+// CleanRuns removes the run directories under runsDir beyond the newest keep, and the ones older than maxAge.
+// 0 means no limit. The run directory of the baseline is never removed. Returns the directories removed.
+func CleanRuns(runsDir string, keep int, maxAge time.Duration, baseline string) ([]string, error) {
+	if keep < 0 || maxAge < 0 {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, "the number of runs to keep and their age can't be negative")
+	}
+	infos, err := ioutil.ReadDir(runsDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var runs []os.FileInfo
+	for _, info := range infos {
+		if info.IsDir() {
+			runs = append(runs, info)
+		}
+	}
+	// Newest first.
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Name() > runs[j].Name() })
+
+	// The baseline is a run's directory or a file in it, relative to the working directory or to runsDir.
+	var baselinePaths []string
+	if len(baseline) > 0 {
+		paths := []string{baseline}
+		if !filepath.IsAbs(baseline) {
+			paths = append(paths, filepath.Join(runsDir, baseline))
+		}
+		for _, path := range paths {
+			abs, err := filepath.Abs(path)
+			if err != nil {
+				return nil, err
+			}
+			baselinePaths = append(baselinePaths, abs)
+		}
+	}
+	var removed []string
+	for i, info := range runs {
+		dir := filepath.Join(runsDir, info.Name())
+		if holdsBaseline(dir, baselinePaths) {
+			continue
+		}
+		if (keep == 0 || i < keep) && (maxAge == 0 || time.Since(info.ModTime()) <= maxAge) {
+			continue
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
+
+// holdsBaseline returns whether the run directory is one of the baseline paths or holds one.
+func holdsBaseline(dir string, baselinePaths []string) bool {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+	for _, path := range baselinePaths {
+		if path == abs || strings.HasPrefix(path, abs+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
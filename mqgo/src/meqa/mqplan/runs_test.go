@@ -0,0 +1,128 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCleanRuns(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runsDir)
+	names := []string{"2024-01-01T00-00-00.000", "2024-01-02T00-00-00.000", "2024-01-03T00-00-00.000",
+		"2024-01-04T00-00-00.000"}
+	for _, name := range names {
+		if err = os.Mkdir(filepath.Join(runsDir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(filepath.Join(runsDir, names[2]), old, old)
+
+	// The oldest run is the baseline, so it's kept besides the newest two.
+	removed, err := CleanRuns(runsDir, 2, 0, filepath.Join(runsDir, names[0]))
+	if err != nil || len(removed) != 1 || removed[0] != filepath.Join(runsDir, names[1]) {
+		t.Errorf("expecting only %s removed, got %v, %v", names[1], removed, err)
+	}
+	removed, err = CleanRuns(runsDir, 0, 24*time.Hour, "")
+	if err != nil || len(removed) != 1 || removed[0] != filepath.Join(runsDir, names[2]) {
+		t.Errorf("expecting only the old %s removed, got %v, %v", names[2], removed, err)
+	}
+	infos, _ := ioutil.ReadDir(runsDir)
+	if len(infos) != 2 || infos[0].Name() != names[0] || infos[1].Name() != names[3] {
+		t.Errorf("expecting the baseline and the newest run left, got %d runs", len(infos))
+	}
+
+	if _, err = CleanRuns(runsDir, -1, 0, ""); err == nil {
+		t.Errorf("expecting a negative number of runs to be rejected")
+	}
+	if removed, err = CleanRuns(filepath.Join(runsDir, "none"), 1, 0, ""); err != nil || len(removed) != 0 {
+		t.Errorf("expecting nothing to do without the runs directory, got %v, %v", removed, err)
+	}
+}
+
+func TestCleanRunsBaseline(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runsDir)
+	wd, _ := os.Getwd()
+	defer os.Chdir(wd)
+	if err = os.Chdir(filepath.Dir(runsDir)); err != nil {
+		t.Fatal(err)
+	}
+	name := "2024-01-01T00-00-00.000"
+	// The baseline can be the run's directory or its result file, relative to the runs directory, to the working
+	// directory, or absolute.
+	baselines := []string{name, filepath.Join(name, "result.yml"),
+		filepath.Join(filepath.Base(runsDir), name, "result.yml"), filepath.Join(runsDir, name, "result.yml")}
+	for _, baseline := range baselines {
+		for _, n := range []string{name, "2024-01-02T00-00-00.000"} {
+			if err = os.MkdirAll(filepath.Join(runsDir, n), 0755); err != nil {
+				t.Fatal(err)
+			}
+		}
+		removed, err := CleanRuns(runsDir, 0, time.Nanosecond, baseline)
+		if err != nil || len(removed) != 1 || filepath.Base(removed[0]) != "2024-01-02T00-00-00.000" {
+			t.Errorf("%s: expecting only the other run removed, got %v, %v", baseline, removed, err)
+		}
+	}
+}
+
+func TestSaveArtifacts(t *testing.T) {
+	runsDir, err := ioutil.TempDir("", "runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(runsDir)
+	ArtifactBudget = 100
+	defer func() { ArtifactBudget = 0 }()
+	artifacts, err := NewRunDir(runsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The JSON report of no results is small enough, the collection and the HTML report aren't.
+	plan := &TestPlan{}
+	err = plan.SaveArtifacts(artifacts, "result.yml", "run.postman.json", "run.json", "run.html")
+	if err != nil {
+		t.Fatalf("can't save the artifacts: %v", err)
+	}
+	for name, exists := range map[string]bool{"result.yml": true, "run.json": true, "run.postman.json": false,
+		"run.html": false, ArtifactsFile: true} {
+		if _, err = os.Stat(filepath.Join(artifacts.Dir, name)); (err == nil) != exists {
+			t.Errorf("expecting %s to exist: %v", name, exists)
+		}
+	}
+
+	data, _ := ioutil.ReadFile(filepath.Join(artifacts.Dir, ArtifactsFile))
+	listed := &RunArtifacts{}
+	if err = json.Unmarshal(data, listed); err != nil {
+		t.Fatalf("can't read the artifacts: %v", err)
+	}
+	if len(listed.Saved) != 2 || len(listed.Skipped) != 2 || listed.Skipped[0] != filepath.Join(artifacts.Dir, "run.postman.json") ||
+		listed.Skipped[1] != filepath.Join(artifacts.Dir, "run.html") {
+		t.Errorf("expecting the skipped artifacts listed, got %s", data)
+	}
+	data, _ = ioutil.ReadFile(filepath.Join(artifacts.Dir, "run.json"))
+	report := &JSONReport{}
+	if err = json.Unmarshal(data, report); err != nil || !reflect.DeepEqual(report.SkippedArtifacts, listed.Skipped) {
+		t.Errorf("expecting the JSON report to note the skipped artifacts, got %s", data)
+	}
+
+	// The HTML report notes the skipped artifacts as well.
+	var buf bytes.Buffer
+	if err = WriteHTMLReport(&buf, nil, listed.Skipped); err != nil || !strings.Contains(buf.String(), listed.Skipped[0]) {
+		t.Errorf("expecting the HTML report to note the skipped artifacts, got %s", buf.String())
+	}
+}
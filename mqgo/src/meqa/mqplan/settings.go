@@ -0,0 +1,102 @@
+package mqplan
+
+import (
+	"meqa/mqutil"
+)
+
+// TestSettings are the settings a suite inherits from the plan's meqa_init, a test from its suite, including the
+// suite's meqa_init, and a step from its transaction. The ones set lower down win, the flags are on if they're on
+// anywhere up the chain, and the maps are merged.
+type TestSettings struct {
+	Strict          bool                   `yaml:"strict,omitempty"`
+	Monotonic       string                 `yaml:"monotonic,omitempty"`             // the field name of the ids the server assigns in increasing order
+	UseDefaults     string                 `yaml:"useDefaults,omitempty"`           // always, sometimes or never generate the declared defaults
+	OptionalParams  string                 `yaml:"optionalParams,omitempty"`        // always, sometimes, never or the probability to send the optional parameters
+	OptionalProps   string                 `yaml:"optionalProperties,omitempty"`    // always or never generate the optional properties of the objects
+	IncludeReadOnly bool                   `yaml:"includeReadOnly,omitempty"`       // generate the readOnly properties in request bodies
+	ReuseObjects    bool                   `yaml:"reuseObjects,omitempty"`          // send an existing object, with a field changed, as the body of put and patch
+	VerifyCreate    bool                   `yaml:"verifyCreate,omitempty"`          // get the object a post created, and fail the post if it isn't there
+	Isolate         bool                   `yaml:"isolate,omitempty"`               // put the suite's objects back after the test, so what it changes doesn't reach the later tests
+	FormatWarnings  bool                   `yaml:"formatWarnings,omitempty"`        // don't fail the test when response values have the wrong format
+	StrictDefault   bool                   `yaml:"strictDefault,omitempty"`         // fail the test when a success response doesn't match the default response
+	Deprecated      string                 `yaml:"deprecated,omitempty"`            // skip, warn or test the deprecated operations
+	Generate        string                 `yaml:"generate,omitempty"`              // random, or boundary to run the test once per combination of the parameters' edge values
+	ParamDefaults   map[string]interface{} `yaml:"requiredParamDefaults,omitempty"` // the values of the required parameters that can't be generated
+	PropOverrides   map[string]interface{} `yaml:"propertyOverrides,omitempty"`     // the values of the generated body properties, by name or Class.name
+	FileSize        int                    `yaml:"fileSize,omitempty"`              // the size of the files generated for the file parameters
+	MaxNodes        int                    `yaml:"maxNodes,omitempty"`              // the cap on the number of values generated for a request
+	MaxDepth        int                    `yaml:"maxDepth,omitempty"`              // the cap on the nesting depth of the generated values
+	ArraySize       string                 `yaml:"arraySize,omitempty"`             // the number of items, e.g. 3 or 1-5, of the arrays without minItems or maxItems
+	StringLength    string                 `yaml:"stringLength,omitempty"`          // the length, e.g. 10 or 5-20, of the strings without minLength or maxLength
+	NumberRange     string                 `yaml:"numberRange,omitempty"`           // the range, e.g. 0-100, of the numbers without minimum or maximum
+	DateRange       *DateRange             `yaml:"dateRange,omitempty"`             // the range, e.g. from now to +90d, of the generated dates
+}
+
+// inherit fills in the settings that aren't set with the parent's.
+func (s *TestSettings) inherit(parent *TestSettings) {
+	s.Strict = s.Strict || parent.Strict
+	if len(s.Monotonic) == 0 {
+		s.Monotonic = parent.Monotonic
+	}
+	if len(s.UseDefaults) == 0 {
+		s.UseDefaults = parent.UseDefaults
+	}
+	if len(s.OptionalParams) == 0 {
+		s.OptionalParams = parent.OptionalParams
+	}
+	if len(s.OptionalProps) == 0 {
+		s.OptionalProps = parent.OptionalProps
+	}
+	s.IncludeReadOnly = s.IncludeReadOnly || parent.IncludeReadOnly
+	s.ReuseObjects = s.ReuseObjects || parent.ReuseObjects
+	s.VerifyCreate = s.VerifyCreate || parent.VerifyCreate
+	s.Isolate = s.Isolate || parent.Isolate
+	s.FormatWarnings = s.FormatWarnings || parent.FormatWarnings
+	s.StrictDefault = s.StrictDefault || parent.StrictDefault
+	if len(s.Deprecated) == 0 {
+		s.Deprecated = parent.Deprecated
+	}
+	if len(s.Generate) == 0 {
+		s.Generate = parent.Generate
+	}
+	s.ParamDefaults = mqutil.MapCombine(mqutil.MapCopy(parent.ParamDefaults), s.ParamDefaults)
+	s.PropOverrides = mqutil.MapCombine(mqutil.MapCopy(parent.PropOverrides), s.PropOverrides)
+	if s.FileSize == 0 {
+		s.FileSize = parent.FileSize
+	}
+	if s.MaxNodes == 0 {
+		s.MaxNodes = parent.MaxNodes
+	}
+	if s.MaxDepth == 0 {
+		s.MaxDepth = parent.MaxDepth
+	}
+	if len(s.ArraySize) == 0 {
+		s.ArraySize = parent.ArraySize
+	}
+	if len(s.StringLength) == 0 {
+		s.StringLength = parent.StringLength
+	}
+	if len(s.NumberRange) == 0 {
+		s.NumberRange = parent.NumberRange
+	}
+	if s.DateRange == nil {
+		s.DateRange = parent.DateRange
+	}
+}
+
+// PlanSettings are the settings only the plan's meqa_init sets.
+type PlanSettings struct {
+	ReuseChance     float64                `yaml:"reuseChance,omitempty"`     // the probability that a put or a patch reuses an object, with reuseObjects. 0 means always
+	RateLimit       float64                `yaml:"rateLimit,omitempty"`       // the most calls per second, across the parallel suites. 0 means no limit
+	Server          string                 `yaml:"server,omitempty"`          // the index or a url substring of the OpenAPI 3 server to use
+	ServerVariables map[string]interface{} `yaml:"serverVariables,omitempty"` // the values of the server url's variables
+	FileContent     string                 `yaml:"fileContent,omitempty"`     // the content of the files generated for the file parameters
+	MaxRecursion    int                    `yaml:"maxRecursion,omitempty"`    // the cap on the nesting of the generated schemas
+	Fixtures        string                 `yaml:"fixtures,omitempty"`        // the JSON file of the objects to seed the DB with
+	BoundaryLimit   int                    `yaml:"boundaryLimit,omitempty"`   // the cap on the tests a test expands to in the boundary mode
+	AllEnums        bool                   `yaml:"allEnums,omitempty"`        // run the tests once per value of their parameters' enums
+	EnumLimit       int                    `yaml:"enumLimit,omitempty"`       // the cap on the tests a test expands to with allEnums
+	RealisticData   bool                   `yaml:"realisticData,omitempty"`   // generate fake values picked by the property names
+	RealisticNames  map[string]string      `yaml:"realisticNames,omitempty"`  // more property names for realisticData, to kinds of values
+	Generators      map[string]string      `yaml:"generators,omitempty"`      // the commands that print the values of the named generators
+}
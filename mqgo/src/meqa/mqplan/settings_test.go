@@ -0,0 +1,75 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestInheritSettings(t *testing.T) {
+	parent := TestSettings{Strict: true, Monotonic: "id", UseDefaults: "always", Deprecated: "skip", MaxNodes: 50,
+		ArraySize: "2", DateRange: &DateRange{From: "now"}, PropOverrides: map[string]interface{}{"a": 1, "b": 2}}
+	child := TestSettings{Monotonic: "key", FormatWarnings: true, MaxNodes: 10, StringLength: "5",
+		PropOverrides: map[string]interface{}{"b": 3}}
+	child.inherit(&parent)
+
+	expected := TestSettings{Strict: true, Monotonic: "key", UseDefaults: "always", FormatWarnings: true, Deprecated: "skip",
+		MaxNodes: 10, ArraySize: "2", StringLength: "5", DateRange: parent.DateRange,
+		PropOverrides: map[string]interface{}{"a": 1, "b": 3}}
+	if !reflect.DeepEqual(child, expected) {
+		t.Errorf("expecting %+v, got %+v", expected, child)
+	}
+	if len(parent.PropOverrides) != 2 || parent.PropOverrides["b"] != 2 {
+		t.Errorf("expecting the parent's overrides to be kept, got %v", parent.PropOverrides)
+	}
+}
+
+func TestSettingsChain(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var lengths []int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var order map[string]interface{}
+		if r.URL.Path == "/order" && json.NewDecoder(r.Body).Decode(&order) == nil {
+			name, _ := order["name"].(string)
+			lengths = append(lengths, len(name))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 1, "name": "order"}`))
+	}))
+	defer server.Close()
+
+	// The plan's stringLength is taken by the first suite, the second suite has its own in its meqa_init, and
+	// the transaction's is taken by its step.
+	plan := newTestPlan(t, orderSwagger, server.URL, "  stringLength: 7\n")
+	err := plan.AddFromString(`first:
+- name: addOrder
+  path: /order
+  method: post
+- name: placeOrder
+  stringLength: 12
+  steps:
+  - path: /order
+    method: post
+second:
+- name: meqa_init
+  stringLength: 9
+- name: addOrder
+  path: /order
+  method: post
+`)
+	if err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	for _, suite := range []string{"first", "second"} {
+		if _, err = plan.Run(suite, nil); err != nil {
+			t.Fatalf("can't run %s: %v", suite, err)
+		}
+	}
+	if !reflect.DeepEqual(lengths, []int{7, 12, 9}) {
+		t.Errorf("expecting names of 7, 12 and 9 characters, got %v", lengths)
+	}
+}
@@ -0,0 +1,137 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// The sizes of the generated values where the spec is silent are set in meqa_init: arraySize for the arrays
+// without minItems or maxItems, stringLength for the strings without minLength or maxLength, numberRange for the
+// numbers without minimum or maximum, maxNodes and maxDepth for the values generated for a request, and fileSize for
+// the files. A test can set its own, e.g. to send a big payload, which win over the plan's. The constraints of the
+// spec always win.
+
+// parseSizeRange parses a size, a number, e.g. 3, or a range, e.g. 1-5, of values that are at least least.
+func parseSizeRange(knob string, size string, least int) (int, int, error) {
+	parts := strings.SplitN(size, "-", 2)
+	minSize, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	maxSize := minSize
+	if err == nil && len(parts) == 2 {
+		maxSize, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+	}
+	if err != nil || minSize < least || maxSize < minSize {
+		return 0, 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid %s %s, expecting a number, e.g. 3, or a range, e.g. 1-5", knob, size))
+	}
+	return minSize, maxSize, nil
+}
+
+var numberRangeRegexp = regexp.MustCompile(`^(-?[0-9]+(?:\.[0-9]+)?)-(-?[0-9]+(?:\.[0-9]+)?)$`)
+
+// parseNumberRange parses the numberRange, a range of numbers, e.g. 0-100 or -1.5-1.5.
+func parseNumberRange(numberRange string) (float64, float64, error) {
+	m := numberRangeRegexp.FindStringSubmatch(strings.Replace(numberRange, " ", "", -1))
+	if m == nil {
+		return 0, 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid numberRange %s, expecting a range, e.g. 0-100 or -1.5-1.5", numberRange))
+	}
+	low, _ := strconv.ParseFloat(m[1], 64)
+	high, _ := strconv.ParseFloat(m[2], 64)
+	if high <= low {
+		return 0, 0, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"invalid numberRange %s, expecting the minimum below the maximum", numberRange))
+	}
+	return low, high, nil
+}
+
+// checkSizes returns an error if the sizes or the date range the test sets aren't valid.
+func (t *Test) checkSizes() error {
+	if len(t.ArraySize) > 0 {
+		if _, _, err := parseArraySize(t.ArraySize); err != nil {
+			return err
+		}
+	}
+	if len(t.StringLength) > 0 {
+		if _, _, err := parseSizeRange("stringLength", t.StringLength, 0); err != nil {
+			return err
+		}
+	}
+	if len(t.NumberRange) > 0 {
+		if _, _, err := parseNumberRange(t.NumberRange); err != nil {
+			return err
+		}
+	}
+	return checkDateRange(t.DateRange)
+}
+
+// planSize returns the test's own size, or else the plan's.
+func (t *Test) planSize(own string, fromPlan func(plan *TestPlan) string) string {
+	if len(own) > 0 || t.suite == nil || t.suite.plan == nil {
+		return own
+	}
+	return fromPlan(t.suite.plan)
+}
+
+// planLimit returns the test's own limit, or else the plan's, or else the default.
+func (t *Test) planLimit(own int, fromPlan func(plan *TestPlan) int, defaultLimit int) int {
+	if own > 0 {
+		return own
+	}
+	if t.suite != nil && t.suite.plan != nil && fromPlan(t.suite.plan) > 0 {
+		return fromPlan(t.suite.plan)
+	}
+	return defaultLimit
+}
+
+// withStringLength returns the schema with a length picked from the stringLength, if the test or the plan sets
+// one. Only the strings without a pattern, an enum or a format other than password are resized, the others have
+// their own lengths. A minLength or a maxLength of the schema narrows the range.
+func (t *Test) withStringLength(s *spec.Schema) *spec.Schema {
+	size := t.planSize(t.StringLength, func(plan *TestPlan) string { return plan.StringLength })
+	if len(size) == 0 || len(s.Pattern) > 0 || len(s.Enum) > 0 || len(s.Format) > 0 && s.Format != "password" ||
+		s.MinLength != nil && s.MaxLength != nil {
+		return s
+	}
+	// The size was checked when the plan was loaded.
+	minLength, maxLength, _ := parseSizeRange("stringLength", size, 0)
+	if s.MinLength != nil && int(*s.MinLength) > minLength {
+		minLength = int(*s.MinLength)
+		if maxLength < minLength {
+			maxLength = minLength
+		}
+	}
+	if s.MaxLength != nil && int(*s.MaxLength) < maxLength {
+		maxLength = int(*s.MaxLength)
+		if minLength > maxLength {
+			minLength = maxLength
+		}
+	}
+	length := int64(minLength + random.Intn(maxLength-minLength+1))
+	resized := *s
+	resized.MinLength, resized.MaxLength = &length, &length
+	return &resized
+}
+
+// withNumberRange returns the schema with the numberRange as its minimum and maximum where it has none, if the
+// test or the plan sets one. A minimum or a maximum of the schema outside the range wins.
+func (t *Test) withNumberRange(s *spec.Schema) *spec.Schema {
+	numberRange := t.planSize(t.NumberRange, func(plan *TestPlan) string { return plan.NumberRange })
+	if len(numberRange) == 0 || s.Minimum != nil && s.Maximum != nil {
+		return s
+	}
+	// The range was checked when the plan was loaded.
+	low, high, _ := parseNumberRange(numberRange)
+	ranged := *s
+	if s.Minimum == nil && (s.Maximum == nil || *s.Maximum > low) {
+		ranged.Minimum = &low
+	}
+	if s.Maximum == nil && (s.Minimum == nil || *s.Minimum < high) {
+		ranged.Maximum = &high
+	}
+	return &ranged
+}
@@ -0,0 +1,74 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"time"
+)
+
+// This file implements the tests that are made of several calls, e.g. reserve, confirm, then capture.
+// The steps run in order against a copy of the suite's DB, and the copy replaces the suite's objects
+// only when all the steps pass. When a step fails, the onFailure steps run to undo what the server
+// has done so far, and the test fails.
+
+// RunSteps runs the steps of the test. Returns the error of the first step that fails.
+func (t *Test) RunSteps(tc *TestSuite) error {
+	db := t.db.Clone()
+	steps := t.Steps
+	// The steps that ran replace the ones in the plan, so the result file shows what each step did.
+	t.Steps = nil
+	t.startTime = time.Now()
+	defer func() {
+		t.stopTime = time.Now()
+	}()
+	for i, step := range steps {
+		s := t.duplicateStep(step, db, fmt.Sprintf("%s_step%d", t.Name, i+1))
+		t.Steps = append(t.Steps, s)
+		s.err = s.Run(tc)
+		tc.getHistory().Append(s)
+		if s.schemaError != nil && t.schemaError == nil {
+			t.schemaError = s.schemaError
+		}
+		if s.err != nil {
+			t.Steps = append(t.Steps, steps[i+1:]...)
+			t.resp = s.resp
+			t.responseError = s.responseError
+			fmt.Printf("... step %s failed\n", s.Name)
+			t.compensate(tc, db)
+			return s.err
+		}
+	}
+	t.db.Commit(db)
+	return nil
+}
+
+// compensate runs all the onFailure steps. The objects they change are thrown away together with the
+// rest of the failed transaction.
+func (t *Test) compensate(tc *TestSuite, db *mqswag.DB) {
+	steps := t.OnFailure
+	t.OnFailure = nil
+	for i, step := range steps {
+		s := t.duplicateStep(step, db, fmt.Sprintf("%s_onFailure%d", t.Name, i+1))
+		t.OnFailure = append(t.OnFailure, s)
+		s.err = s.Run(tc)
+		tc.getHistory().Append(s)
+		if s.err != nil {
+			fmt.Printf("... compensation step %s failed\n", s.Name)
+			mqutil.Logger.Printf("compensation step %s failed: %s", s.Name, s.err.Error())
+		}
+	}
+}
+
+// duplicateStep makes a copy of the step to run against the DB. Once the step has run it's added to the
+// history, so the steps after it can refer to its parameters and outputs.
+func (t *Test) duplicateStep(step *Test, db *mqswag.DB, name string) *Test {
+	s := step.Duplicate()
+	s.db = db
+	s.TestSettings.inherit(&t.TestSettings)
+	if len(s.Name) == 0 {
+		s.Name = name
+	}
+	s.ResolveHistoryParameters(t.suite.getHistory())
+	return s
+}
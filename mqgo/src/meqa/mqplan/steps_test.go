@@ -0,0 +1,78 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const orderSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "orders", "version": "1.0"},
+	"schemes": ["http"],
+	"paths": {
+		"/order": {"post": {
+			"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Order"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Order"}}}}},
+		"/order/capture": {"post": {"responses": {"200": {"description": "ok"}}}},
+		"/order/{id}": {"delete": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "type": "integer", "description": "<meqa Order.id>"}],
+			"responses": {"200": {"description": "ok"}}}}
+	},
+	"definitions": {
+		"Order": {"type": "object", "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}}
+	}
+}`
+
+func TestRunSteps(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	for _, captureStatus := range []int{http.StatusOK, http.StatusInternalServerError} {
+		deleted := ""
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.Method == "POST" && r.URL.Path == "/order":
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"id": 1, "name": "order"}`))
+			case r.URL.Path == "/order/capture":
+				w.WriteHeader(captureStatus)
+			case r.Method == "DELETE":
+				deleted = r.URL.Path
+			}
+		}))
+
+		plan := newTestPlan(t, orderSwagger, server.URL, "")
+		suite := CreateTestSuite("orders", nil, plan)
+		suite.db = plan.db
+
+		test := &Test{Name: "placeOrder", Steps: []*Test{
+			{Name: "createOrder", Path: "/order", Method: "post", TestParams: TestParams{BodyParams: map[string]interface{}{"name": "order"}}},
+			{Path: "/order/capture", Method: "post"},
+		}, OnFailure: []*Test{
+			{Path: "/order/{id}", Method: "delete", TestParams: TestParams{PathParams: map[string]interface{}{"id": "{{createOrder.outputs.id}}"}}},
+		}}
+		test.Init(suite)
+		dup := test.Duplicate()
+		err := dup.Run(suite)
+		server.Close()
+
+		orders := plan.db.Find("Order", nil, nil, mqswag.MatchAlways, -1)
+		if captureStatus == http.StatusOK {
+			if err != nil || len(orders) != 1 || len(deleted) != 0 {
+				t.Errorf("expecting the order to be committed, got err %v, orders %v, deleted %s", err, orders, deleted)
+			}
+			continue
+		}
+		if err == nil || len(orders) != 0 || deleted != "/order/1" {
+			t.Errorf("expecting the order to be compensated, got err %v, orders %v, deleted %s", err, orders, deleted)
+		}
+		if len(dup.Steps) != 2 || dup.Steps[1].Name != "placeOrder_step2" || dup.Steps[1].Expect[ExpectStatus] != captureStatus {
+			t.Errorf("expecting the failed step in the result, got %v", dup.Steps)
+		}
+		if len(dup.OnFailure) != 1 || dup.OnFailure[0].err != nil {
+			t.Errorf("expecting the compensation step to pass, got %v", dup.OnFailure)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package mqplan
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqutil"
+
+	"gopkg.in/resty.v0"
+)
+
+// TLSOptions are the TLS settings of the calls to the server under test. The server's certificate isn't verified
+// with InsecureSkipVerify, unless a CA bundle is given to verify it with. The client certificate is sent to the
+// servers that ask for one.
+type TLSOptions struct {
+	InsecureSkipVerify bool
+	CAFile             string // the PEM file of the CA certificates the server's certificate is verified with
+	CertFile           string // the PEM file of the client certificate
+	KeyFile            string // the PEM file of the client certificate's private key
+}
+
+// Config returns the TLS config of the options.
+func (o *TLSOptions) Config() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: o.InsecureSkipVerify && len(o.CAFile) == 0}
+	if len(o.CAFile) > 0 {
+		pem, err := ioutil.ReadFile(o.CAFile)
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't read the CA bundle: %s", err.Error()))
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("no PEM certificates in the CA bundle %s",
+				o.CAFile))
+		}
+	}
+	if len(o.CertFile) > 0 || len(o.KeyFile) > 0 {
+		if len(o.CertFile) == 0 || len(o.KeyFile) == 0 {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, "the client certificate needs both a cert and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("can't load the client certificate: %s",
+				err.Error()))
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// SetTLS applies the options to the client the tests are sent with.
+func SetTLS(o *TLSOptions) error {
+	config, err := o.Config()
+	if err != nil {
+		return err
+	}
+	resty.SetTLSClientConfig(config)
+	return nil
+}
@@ -0,0 +1,115 @@
+package mqplan
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// writeClientCert writes a self-signed client certificate and its key to the directory.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "client.pem"), filepath.Join(dir, "client.key")
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSOptions(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer SetTLS(&TLSOptions{InsecureSkipVerify: true})
+
+	// The server has its own CA, and asks for a client certificate.
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	server.StartTLS()
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0600)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	run := func(options *TLSOptions) error {
+		if err := SetTLS(options); err != nil {
+			t.Fatalf("can't set the TLS options: %v", err)
+		}
+		swagger := &mqswag.Swagger{}
+		if err := json.Unmarshal([]byte(setupSwagger), (*spec.Swagger)(swagger)); err != nil {
+			t.Fatalf("can't load swagger: %v", err)
+		}
+		swagger.Schemes = []string{"https"}
+		swagger.Host = strings.TrimPrefix(server.URL, "https://")
+		db := &mqswag.DB{}
+		db.Init(swagger)
+		plan := &TestPlan{}
+		plan.Init(swagger, db)
+		if err := plan.AddFromString("suite:\n- name: other\n  path: /other\n  method: get\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		_, err := plan.Run("suite", nil)
+		return err
+	}
+
+	// The failures come first, so no connection is left open for the later runs to reuse.
+	if err = run(&TLSOptions{}); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("expecting the server's certificate to fail the verification, got %v", err)
+	}
+	if err = run(&TLSOptions{CAFile: caFile}); err == nil {
+		t.Errorf("expecting the server to reject the call without a client certificate")
+	}
+	if err = run(&TLSOptions{InsecureSkipVerify: true, CAFile: caFile, CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Errorf("expecting the call with the CA and the client certificate to pass, got %v", err)
+	}
+
+	for _, c := range []struct {
+		options *TLSOptions
+		err     string
+	}{
+		{&TLSOptions{CertFile: certFile}, "needs both a cert and a key file"},
+		{&TLSOptions{CAFile: keyFile}, "no PEM certificates in the CA bundle"},
+		{&TLSOptions{CAFile: filepath.Join(dir, "missing.pem")}, "can't read the CA bundle"},
+		{&TLSOptions{CertFile: keyFile, KeyFile: certFile}, "can't load the client certificate"},
+	} {
+		if _, err = c.options.Config(); err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("expecting %q for %+v, got %v", c.err, c.options, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// The values of the properties marked x-meqa-unique, and of the ones named in UniqueNames, end with the run's ID
+// and a counter, e.g. username_kx3f9a2bq7 then username_kx3f9a2bq8, so they don't collide with each other, nor
+// with the values earlier runs left in the server's DB. The run's ID is printed, to find and clean up what the run
+// created. The plain strings and the emails are made unique, the uuids already are.
+
+// UniqueNames are the names of the parameters and properties whose generated values are unique, besides the ones
+// marked x-meqa-unique, e.g. username or email. The names are matched ignoring the case.
+var UniqueNames []string
+
+// RunID is in the unique values the run generates: the time the run started, in base 36, and two random characters.
+var RunID = strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 36) + randomString(lowerLetters+digits, 2)
+
+var uniqueCounter uint64
+var printRunID sync.Once
+
+// isUnique returns whether the values generated for the schema must be unique. The property names come with the
+// "_" suffix generateObject adds.
+func isUnique(s *spec.Schema, name string) bool {
+	if (*mqswag.Schema)(s).IsUnique() {
+		return true
+	}
+	name = strings.TrimSuffix(name, "_")
+	for _, unique := range UniqueNames {
+		if len(name) > 0 && strings.EqualFold(strings.TrimSpace(unique), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// generateUnique generates a string that's unique in the run, and across the runs. It returns false for the
+// patterns, the enums and the formats other than email, which are generated as usual.
+func generateUnique(s *spec.Schema, prefix string) (string, bool, error) {
+	if len(s.Pattern) > 0 || len(s.Enum) > 0 || len(s.Format) > 0 && s.Format != "email" {
+		return "", false, nil
+	}
+	printRunID.Do(func() {
+		fmt.Printf("the unique values of this run contain %s\n", RunID)
+		mqutil.Logger.Printf("the unique values of this run contain %s", RunID)
+	})
+	unique := RunID + strconv.FormatUint(atomic.AddUint64(&uniqueCounter, 1), 36)
+	minLength, maxLength := 0, -1
+	if s.MinLength != nil {
+		minLength = int(*s.MinLength)
+	}
+	if s.MaxLength != nil {
+		maxLength = int(*s.MaxLength)
+	}
+	if maxLength >= 0 && len(unique) > maxLength {
+		return "", true, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+			"can't generate a unique value within maxLength %d", maxLength))
+	}
+
+	if s.Format == "email" {
+		// The unique part goes at the end of the part before the @.
+		room := -1
+		if maxLength >= 0 {
+			room = maxLength - len(unique)
+		}
+		email := generateEmail(minLength-len(unique), room)
+		at := strings.Index(email, "@")
+		str := email[:at] + unique + email[at:]
+		return str, true, checkLength(s.Format, str, minLength, maxLength)
+	}
+
+	name := prefix
+	if maxLength >= 0 && len(name)+len(unique) > maxLength {
+		name = name[:maxLength-len(unique)]
+	}
+	if n := minLength - len(name) - len(unique); n > 0 {
+		name += strings.Repeat("0", n)
+	}
+	return name + unique, true, nil
+}
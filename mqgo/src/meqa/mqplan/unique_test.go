@@ -0,0 +1,60 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"meqa/mqutil"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestUniqueValues(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	UniqueNames = []string{"Email"}
+	defer func() { UniqueNames = nil }()
+	schema := spec.Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "required": ["username", "email", "code", "nickname", "name"],
+		"properties": {
+		"username": {"type": "string", "x-meqa-unique": true},
+		"email": {"type": "string", "format": "email", "maxLength": 30},
+		"code": {"type": "string", "x-meqa-unique": true, "minLength": 20, "maxLength": 20},
+		"nickname": {"type": "string", "x-meqa-unique": true, "pattern": "^[a-z]{3}$"},
+		"name": {"type": "string", "maxLength": 3}}}`), &schema)
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+
+	test, db := createPetTest(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 200; i++ {
+		v, err := test.GenerateSchema("", nil, &schema, db, 0)
+		if err != nil {
+			t.Fatalf("generating failed: %v", err)
+		}
+		obj := v.(map[string]interface{})
+		for _, k := range []string{"username", "email", "code"} {
+			str := obj[k].(string)
+			if !strings.Contains(str, RunID) || seen[str] {
+				t.Fatalf("expecting a unique %s with the run ID %s, got %s", k, RunID, str)
+			}
+			seen[str] = true
+		}
+		if email := obj["email"].(string); len(email) > 30 || !strings.Contains(email, RunID) ||
+			strings.Index(email, RunID) > strings.Index(email, "@") {
+			t.Errorf("expecting the run ID before the @ of an email within maxLength, got %s", email)
+		}
+		if code := obj["code"].(string); len(code) != 20 || !strings.HasPrefix(code, "code_") {
+			t.Errorf("expecting a code of 20 characters, got %s", code)
+		}
+		if strings.Contains(obj["nickname"].(string), RunID) || strings.Contains(obj["name"].(string), RunID) {
+			t.Errorf("expecting the patterns and the other names to be generated as usual, got %v", obj)
+		}
+	}
+
+	s := spec.StringProperty().WithMaxLength(5)
+	if _, ok, err := generateUnique(s, "id"); !ok || err == nil || !strings.Contains(err.Error(), "maxLength 5") {
+		t.Errorf("expecting an error for a maxLength shorter than the unique part, got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package mqplan
+
+import (
+	"fmt"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// With verifyCreate, a post that passes is followed by a get of the object it created, to make sure the server
+// kept it. The get is on the item path under the post's path, e.g. /pets/{petId} for /pets, with the id from the
+// post's response, and it expects the object the post returned. The post fails if the get doesn't find the object
+// or returns a different one.
+
+// createdItemPath returns the path that gets the object the test posts, its path param and its get operation.
+// Returns an empty path if the swagger has none.
+func (t *Test) createdItemPath() (string, string, *spec.Operation) {
+	if t.db == nil || t.db.Swagger == nil || t.db.Swagger.Paths == nil {
+		return "", "", nil
+	}
+	prefix := strings.TrimSuffix(t.Path, "/") + "/"
+	var itemPaths []string
+	for path := range t.db.Swagger.Paths.Paths {
+		if strings.HasPrefix(path, prefix) && !strings.Contains(strings.Trim(path[len(prefix):], "/"), "/") &&
+			len(GetLastPathParam(path)) > 0 {
+			itemPaths = append(itemPaths, path)
+		}
+	}
+	sort.Strings(itemPaths)
+	for _, path := range itemPaths {
+		if op := t.db.Swagger.Paths.Paths[path].Get; op != nil {
+			return path, GetLastPathParam(path), op
+		}
+	}
+	return "", "", nil
+}
+
+// createdId returns the id of the created object, the property the path param is tagged with, e.g.
+// <meqa Pet.petId>, or else the property named after the path param, or else id.
+func createdId(created map[string]interface{}, paramName string, params []spec.Parameter) (string, interface{}) {
+	for i := range params {
+		if p := &params[i]; p.In == "path" && p.Name == paramName {
+			if tag := mqswag.GetTag(p); tag != nil && len(tag.Property) > 0 {
+				return tag.Property, created[tag.Property]
+			}
+		}
+	}
+	if id, exist := created[paramName]; exist {
+		return paramName, id
+	}
+	return "id", created["id"]
+}
+
+// verifyCreated gets the object the test created and returns an error if it doesn't match the one the test got
+// back. A post without an item path to get the object from, or without an id in its response, isn't verified.
+func (t *Test) verifyCreated(tc *TestSuite) error {
+	if t.resp == nil || t.resp.StatusCode() < 200 || t.resp.StatusCode() >= 300 {
+		return nil
+	}
+	itemPath, paramName, op := t.createdItemPath()
+	created, _ := t.Expect[ExpectBody].(map[string]interface{})
+	if op == nil || created == nil {
+		mqutil.Logger.Printf("%s: no get of the created object to verify it with", t.Name)
+		return nil
+	}
+	pathItem := t.db.Swagger.Paths.Paths[itemPath]
+	idProperty, id := createdId(created, paramName, operationParams(&pathItem, op))
+	if id == nil {
+		mqutil.Logger.Printf("%s: the created object has no %s to verify it with", t.Name, idProperty)
+		return nil
+	}
+
+	verify := t.duplicateStep(&Test{
+		Path:       itemPath,
+		Method:     mqswag.MethodGet,
+		PathParams: map[string]interface{}{paramName: id},
+		Expect:     map[string]interface{}{ExpectBody: mqutil.InterfaceCopy(created)},
+		suite:      t.suite,
+	}, t.db, t.Name+"_verify")
+	verify.VerifyCreate = false
+	verify.err = verify.Run(tc)
+	tc.getHistory().Append(verify)
+	if verify.err != nil {
+		return mqutil.NewError(mqutil.ErrExpect, fmt.Sprintf("the object %s created, with %s %v, can't be retrieved: %s",
+			t.Name, idProperty, id, mqutil.ErrorMessage(verify.err)))
+	}
+	return nil
+}
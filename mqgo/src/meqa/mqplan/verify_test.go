@@ -0,0 +1,58 @@
+package mqplan
+
+import (
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestVerifyCreate(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	items := itemServer()
+	defer items.Close()
+	// The forgetful server answers the post, but doesn't keep the item, and the other one keeps a different item.
+	forgetful := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": 7, "name": "rex"}`))
+	}))
+	defer forgetful.Close()
+	changing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Write([]byte(`{"id": 7, "name": "max"}`))
+			return
+		}
+		w.Write([]byte(`{"id": 7, "name": "rex"}`))
+	}))
+	defer changing.Close()
+
+	run := func(server *httptest.Server, init string) (map[string]int, error) {
+		plan := newTestPlan(t, crudSwagger, server.URL, init)
+		if err := plan.AddFromString("suite:\n- name: addItem_1\n  path: /items\n  method: post\n"); err != nil {
+			t.Fatalf("can't load plan: %v", err)
+		}
+		return plan.Run("suite", nil)
+	}
+
+	if counts, err := run(items, "  verifyCreate: true\n"); err != nil || counts[mqutil.Passed] != 1 {
+		t.Errorf("expecting the kept item to pass the verification, got %v %v", counts, err)
+	}
+	counts, err := run(forgetful, "  verifyCreate: true\n")
+	if err == nil || !strings.Contains(err.Error(), "addItem_1 created, with id 7, can't be retrieved") ||
+		counts[mqutil.Failed] != 1 {
+		t.Errorf("expecting the forgotten item to fail the verification, got %v %v", counts, err)
+	}
+	if counts, err = run(changing, "  verifyCreate: true\n"); err == nil || counts[mqutil.Failed] != 1 {
+		t.Errorf("expecting the changed item to fail the verification, got %v %v", counts, err)
+	}
+	if counts, err = run(forgetful, ""); err != nil || counts[mqutil.Passed] != 1 {
+		t.Errorf("expecting the post to pass without verifyCreate, got %v %v", counts, err)
+	}
+}
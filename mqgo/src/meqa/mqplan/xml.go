@@ -0,0 +1,355 @@
+package mqplan
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+)
+
+// The bodies of the operations that consume or produce application/xml are encoded and decoded following the xml
+// objects of their schemas. An object is an element with one child element per property, or an attribute for the
+// properties marked attribute. An array is one element per entry, inside a wrapper element when it's wrapped. The
+// decoded responses have the same shape as the JSON ones, with json.Number for the numbers, so they are checked
+// against the schema the same way.
+
+func isXMLMediaType(mediaType string) bool {
+	base := baseMediaType(mediaType)
+	return strings.HasSuffix(base, "/xml") || strings.HasSuffix(base, "+xml")
+}
+
+// xmlSchema resolves the $ref of the schema. Returns the schema and the name of the definition it refers to.
+func xmlSchema(schema *mqswag.Schema, swagger *mqswag.Swagger) (*mqswag.Schema, string) {
+	if schema == nil || swagger == nil {
+		return schema, ""
+	}
+	name, referredSchema, _ := swagger.GetReferredSchema(schema)
+	if referredSchema != nil {
+		return referredSchema, name
+	}
+	return schema, ""
+}
+
+// xmlName returns the element name of the schema's xml object, or the name given.
+func xmlName(schema *mqswag.Schema, name string) string {
+	if schema != nil && schema.XML != nil && len(schema.XML.Name) > 0 {
+		return schema.XML.Name
+	}
+	return name
+}
+
+func xmlItems(schema *mqswag.Schema) *mqswag.Schema {
+	if schema == nil || schema.Items == nil {
+		return nil
+	}
+	return (*mqswag.Schema)(schema.Items.Schema)
+}
+
+func xmlText(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return mqutil.InterfaceToJsonString(value)
+}
+
+// encodeXML encodes the body as XML. The root element is named by the schema's xml object, the definition the
+// schema refers to, or the name given, e.g. the name of the body parameter.
+func encodeXML(body interface{}, name string, schema *mqswag.Schema, swagger *mqswag.Swagger) ([]byte, error) {
+	if resolved, definition := xmlSchema(schema, swagger); len(definition) > 0 {
+		name = xmlName(schema, definition)
+		schema = resolved
+	}
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	e := xml.NewEncoder(&buf)
+	if arr, ok := body.([]interface{}); ok {
+		// An XML document has one root, so an array is always wrapped.
+		if err := writeXMLArray(e, xmlName(schema, name), arr, schema, swagger, true); err != nil {
+			return nil, err
+		}
+	} else if err := writeXMLElement(e, name, body, schema, swagger); err != nil {
+		return nil, err
+	}
+	if err := e.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeXMLElement(e *xml.Encoder, name string, value interface{}, schema *mqswag.Schema,
+	swagger *mqswag.Swagger) error {
+
+	schema, _ = xmlSchema(schema, swagger)
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(schema, name)}}
+	obj, isMap := value.(map[string]interface{})
+	if !isMap {
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+		if value != nil {
+			if err := e.EncodeToken(xml.CharData(xmlText(value))); err != nil {
+				return err
+			}
+		}
+		return e.EncodeToken(start.End())
+	}
+
+	var properties map[string]spec.Schema
+	if schema != nil && swagger != nil {
+		properties = schema.GetProperties(swagger)
+	}
+	var keys []string
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var children []string
+	for _, k := range keys {
+		if obj[k] == nil {
+			continue
+		}
+		var propSchema *mqswag.Schema
+		if s, ok := properties[k]; ok {
+			propSchema = (*mqswag.Schema)(&s)
+		}
+		if propSchema != nil && propSchema.XML != nil && propSchema.XML.Attribute {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: xmlName(propSchema, k)}, Value: xmlText(obj[k])})
+		} else {
+			children = append(children, k)
+		}
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, k := range children {
+		var propSchema *mqswag.Schema
+		if s, ok := properties[k]; ok {
+			propSchema = (*mqswag.Schema)(&s)
+		}
+		var err error
+		if arr, ok := obj[k].([]interface{}); ok {
+			wrapped := propSchema != nil && propSchema.XML != nil && propSchema.XML.Wrapped
+			err = writeXMLArray(e, xmlName(propSchema, k), arr, propSchema, swagger, wrapped)
+		} else {
+			err = writeXMLElement(e, k, obj[k], propSchema, swagger)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// writeXMLArray writes one element per entry, named by the items' xml object or the array's name.
+func writeXMLArray(e *xml.Encoder, name string, arr []interface{}, schema *mqswag.Schema, swagger *mqswag.Swagger,
+	wrapped bool) error {
+
+	schema, _ = xmlSchema(schema, swagger)
+	items := xmlItems(schema)
+	itemName := xmlName(items, name)
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	if wrapped {
+		if err := e.EncodeToken(start); err != nil {
+			return err
+		}
+	}
+	for _, entry := range arr {
+		if err := writeXMLElement(e, itemName, entry, items, swagger); err != nil {
+			return err
+		}
+	}
+	if wrapped {
+		return e.EncodeToken(start.End())
+	}
+	return nil
+}
+
+// xmlBody encodes the test's body as XML, following the schema of the operation's body parameter.
+func (t *Test) xmlBody() ([]byte, error) {
+	name := "body"
+	var schema *mqswag.Schema
+	if t.op != nil {
+		for _, p := range t.op.Parameters {
+			if p.In == "body" {
+				name, schema = p.Name, (*mqswag.Schema)(p.Schema)
+			}
+		}
+	}
+	return encodeXML(t.BodyParams, name, schema, t.db.Swagger)
+}
+
+type xmlNode struct {
+	name     string
+	attrs    []xml.Attr
+	children []*xmlNode
+	text     string
+}
+
+func (node *xmlNode) childrenNamed(name string) []*xmlNode {
+	var found []*xmlNode
+	for _, child := range node.children {
+		if child.name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+func parseXML(data []byte) (*xmlNode, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	var stack []*xmlNode
+	var root *xmlNode
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch tok := token.(type) {
+		case xml.StartElement:
+			node := &xmlNode{name: tok.Name.Local, attrs: tok.Attr}
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root == nil {
+				root = node
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(tok)
+			}
+		}
+	}
+	if root == nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, "the XML document has no element")
+	}
+	return root, nil
+}
+
+// decodeXML decodes the XML body into maps, arrays and scalars, the same as a JSON body, guided by the schema.
+func decodeXML(data []byte, schema *mqswag.Schema, swagger *mqswag.Swagger) (interface{}, error) {
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid XML body: %s", err.Error()))
+	}
+	schema, _ = xmlSchema(schema, swagger)
+	if schema != nil && schema.Type.Contains("array") {
+		// The root of an array is its wrapper.
+		return xmlArrayValue(root.children, schema, swagger), nil
+	}
+	return xmlValue(root, schema, swagger), nil
+}
+
+func xmlArrayValue(nodes []*xmlNode, schema *mqswag.Schema, swagger *mqswag.Swagger) []interface{} {
+	items := xmlItems(schema)
+	arr := make([]interface{}, 0, len(nodes))
+	for _, node := range nodes {
+		arr = append(arr, xmlValue(node, items, swagger))
+	}
+	return arr
+}
+
+func xmlValue(node *xmlNode, schema *mqswag.Schema, swagger *mqswag.Swagger) interface{} {
+	schema, _ = xmlSchema(schema, swagger)
+	var properties map[string]spec.Schema
+	if schema != nil && swagger != nil {
+		properties = schema.GetProperties(swagger)
+	}
+	isObject := schema != nil && (schema.Type.Contains("object") || len(properties) > 0)
+	if !isObject && (schema != nil || len(node.children) == 0 && len(node.attrs) == 0) {
+		return xmlScalar(strings.TrimSpace(node.text), schema)
+	}
+
+	obj := make(map[string]interface{})
+	used := make(map[*xmlNode]bool)
+	usedAttrs := make(map[string]bool)
+	for k, s := range properties {
+		propSchema, _ := xmlSchema((*mqswag.Schema)(&s), swagger)
+		name := xmlName((*mqswag.Schema)(&s), k)
+		if s.XML != nil && s.XML.Attribute {
+			for _, attr := range node.attrs {
+				if attr.Name.Local == name {
+					obj[k] = xmlScalar(attr.Value, propSchema)
+					usedAttrs[name] = true
+				}
+			}
+			continue
+		}
+		if propSchema != nil && propSchema.Type.Contains("array") {
+			var entries []*xmlNode
+			if s.XML != nil && s.XML.Wrapped {
+				for _, wrapper := range node.childrenNamed(name) {
+					used[wrapper] = true
+					entries = append(entries, wrapper.children...)
+				}
+			} else {
+				entries = node.childrenNamed(xmlName(xmlItems(propSchema), name))
+			}
+			if len(entries) > 0 || s.XML != nil && s.XML.Wrapped && len(node.childrenNamed(name)) > 0 {
+				for _, entry := range entries {
+					used[entry] = true
+				}
+				obj[k] = xmlArrayValue(entries, propSchema, swagger)
+			}
+			continue
+		}
+		if found := node.childrenNamed(name); len(found) > 0 {
+			used[found[0]] = true
+			obj[k] = xmlValue(found[0], propSchema, swagger)
+		}
+	}
+	// The elements and attributes the schema doesn't know about are kept, so they are checked too.
+	for _, attr := range node.attrs {
+		if !usedAttrs[attr.Name.Local] && len(attr.Name.Space) == 0 && attr.Name.Local != "xmlns" {
+			obj[attr.Name.Local] = attr.Value
+		}
+	}
+	for _, child := range node.children {
+		if used[child] {
+			continue
+		}
+		value := xmlValue(child, nil, swagger)
+		if existing, exist := obj[child.name]; exist {
+			if arr, ok := existing.([]interface{}); ok {
+				obj[child.name] = append(arr, value)
+			} else {
+				obj[child.name] = []interface{}{existing, value}
+			}
+		} else {
+			obj[child.name] = value
+		}
+	}
+	return obj
+}
+
+// xmlScalar converts the text to the type of the schema. A text that isn't of the type is kept as a string, so
+// the schema check reports it.
+func xmlScalar(text string, schema *mqswag.Schema) interface{} {
+	if schema == nil {
+		return text
+	}
+	switch {
+	case schema.Type.Contains("integer") || schema.Type.Contains("number"):
+		var number json.Number
+		if json.Unmarshal([]byte(text), &number) == nil {
+			return number
+		}
+	case schema.Type.Contains("boolean"):
+		if text == "true" || text == "false" {
+			return text == "true"
+		}
+	}
+	return text
+}
@@ -0,0 +1,85 @@
+package mqplan
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io/ioutil"
+	"meqa/mqswag"
+	"meqa/mqutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+const xmlSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "xml", "version": "1.0"},
+	"schemes": ["http"],
+	"consumes": ["application/xml"],
+	"produces": ["application/xml"],
+	"paths": {
+		"/pets": {"post": {
+			"parameters": [{"name": "body", "in": "body", "schema": {"$ref": "#/definitions/Pet"}}],
+			"responses": {"200": {"description": "ok", "schema": {"$ref": "#/definitions/Pet"}}}}}
+	},
+	"definitions": {
+		"Pet": {"type": "object", "required": ["id", "name", "tags", "age"], "xml": {"name": "pet"}, "properties": {
+			"id": {"type": "integer", "xml": {"attribute": true}},
+			"name": {"type": "string"},
+			"age": {"type": "integer", "minimum": 1},
+			"tags": {"type": "array", "minItems": 1, "xml": {"wrapped": true},
+				"items": {"type": "string", "xml": {"name": "tag"}}}}}
+	}
+}`
+
+func TestXMLBodies(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(received)
+	}))
+	defer server.Close()
+
+	plan := newTestPlan(t, xmlSwagger, server.URL, "")
+	if err := plan.AddFromString("echo:\n- name: post\n  path: /pets\n  method: post\n"); err != nil {
+		t.Fatalf("can't load plan: %v", err)
+	}
+	plan.Run("echo", nil)
+
+	var pet struct {
+		XMLName xml.Name `xml:"pet"`
+		ID      string   `xml:"id,attr"`
+		Name    string   `xml:"name"`
+		Tags    []string `xml:"tags>tag"`
+	}
+	if err := xml.Unmarshal(received, &pet); err != nil || len(pet.ID) == 0 || len(pet.Name) == 0 || len(pet.Tags) == 0 {
+		t.Errorf("expecting the pet in XML, got %s, err %v", received, err)
+	}
+	results := plan.Results()
+	if len(results) != 1 || !results[0].Passed || results[0].Request.ContentType != "application/xml" {
+		t.Fatalf("expecting the echoed pet to pass, got %+v", results)
+	}
+
+	// The decoded values are typed by the schema, so a wrong one fails the schema check.
+	petSchema := (*mqswag.Schema)(spec.RefSchema("#/definitions/Pet"))
+	obj, err := decodeXML([]byte(`<pet id="7"><name>rex</name><age>old</age><tags><tag>a</tag><tag>b</tag></tags>
+		<color>brown</color></pet>`), petSchema, plan.swagger)
+	if err != nil {
+		t.Fatalf("can't decode: %v", err)
+	}
+	expected := map[string]interface{}{"id": json.Number("7"), "name": "rex", "age": "old",
+		"tags": []interface{}{"a", "b"}, "color": "brown"}
+	if !mqutil.InterfaceEquals(expected, obj) {
+		t.Errorf("expecting %v, got %v", expected, obj)
+	}
+	if petSchema.Matches(obj, false, plan.swagger) {
+		t.Errorf("expecting the age that isn't a number not to match")
+	}
+	if _, err = decodeXML([]byte(`<pet><name>`), petSchema, plan.swagger); err == nil {
+		t.Errorf("expecting an error for a broken XML body")
+	}
+}
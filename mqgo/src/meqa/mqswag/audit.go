@@ -0,0 +1,206 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/go-openapi/spec"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// AuditIssue is an example or default value in the swagger spec that doesn't match its schema.
+type AuditIssue struct {
+	Location string // JSON pointer to the value in the swagger document
+	Message  string
+}
+
+func (issue AuditIssue) String() string {
+	return fmt.Sprintf("%s: %s", issue.Location, issue.Message)
+}
+
+type auditor struct {
+	swagger     *Swagger
+	definitions interface{} // the definitions in JSON form, so the schemas' $refs can be resolved
+	issues      []AuditIssue
+}
+
+func escapePointer(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+// AuditExamples validates all the example and default values in the swagger spec against the schemas
+// they belong to. Returns the values that don't match.
+func (swagger *Swagger) AuditExamples() []AuditIssue {
+	a := &auditor{swagger: swagger}
+	defBytes, _ := json.Marshal(swagger.Definitions)
+	json.Unmarshal(defBytes, &a.definitions)
+
+	var names []string
+	for name := range swagger.Definitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := swagger.Definitions[name]
+		a.auditSchema(&schema, "#/definitions/"+escapePointer(name))
+	}
+
+	names = nil
+	for name := range swagger.Parameters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		param := swagger.Parameters[name]
+		a.auditParam(&param, "#/parameters/"+escapePointer(name))
+	}
+
+	names = nil
+	for name := range swagger.Responses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		resp := swagger.Responses[name]
+		a.auditResponse(&resp, "#/responses/"+escapePointer(name))
+	}
+
+	if swagger.Paths == nil {
+		return a.issues
+	}
+	names = nil
+	for name := range swagger.Paths.Paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pathItem := swagger.Paths.Paths[name]
+		location := "#/paths/" + escapePointer(name)
+		for i := range pathItem.Parameters {
+			a.auditParam(&pathItem.Parameters[i], fmt.Sprintf("%s/parameters/%d", location, i))
+		}
+		for _, method := range MethodAll {
+			opInterface, _ := pathItem.JSONLookup(method)
+			op, _ := opInterface.(*spec.Operation)
+			if op == nil {
+				continue
+			}
+			opLocation := location + "/" + method
+			for i := range op.Parameters {
+				a.auditParam(&op.Parameters[i], fmt.Sprintf("%s/parameters/%d", opLocation, i))
+			}
+			if op.Responses == nil {
+				continue
+			}
+			if op.Responses.Default != nil {
+				a.auditResponse(op.Responses.Default, opLocation+"/responses/default")
+			}
+			var codes []int
+			for code := range op.Responses.StatusCodeResponses {
+				codes = append(codes, code)
+			}
+			sort.Ints(codes)
+			for _, code := range codes {
+				resp := op.Responses.StatusCodeResponses[code]
+				a.auditResponse(&resp, fmt.Sprintf("%s/responses/%d", opLocation, code))
+			}
+		}
+	}
+	return a.issues
+}
+
+func (a *auditor) auditParam(param *spec.Parameter, location string) {
+	if param.Schema != nil {
+		a.auditSchema(param.Schema, location+"/schema")
+		return
+	}
+	if param.Type == "file" {
+		return
+	}
+	schema := (*spec.Schema)(CreateSchemaFromSimple(&param.SimpleSchema, &param.CommonValidations))
+	a.check(schema, param.Default, location+"/default")
+	a.check(schema, param.Example, location+"/example")
+}
+
+func (a *auditor) auditResponse(resp *spec.Response, location string) {
+	if resp.Schema == nil {
+		return
+	}
+	a.auditSchema(resp.Schema, location+"/schema")
+	var mimeTypes []string
+	for mimeType := range resp.Examples {
+		mimeTypes = append(mimeTypes, mimeType)
+	}
+	sort.Strings(mimeTypes)
+	for _, mimeType := range mimeTypes {
+		if strings.Contains(mimeType, "json") {
+			a.check(resp.Schema, resp.Examples[mimeType], location+"/examples/"+escapePointer(mimeType))
+		}
+	}
+}
+
+// auditSchema checks the schema's example and default, and goes through all its sub-schemas.
+func (a *auditor) auditSchema(schema *spec.Schema, location string) {
+	if schema == nil {
+		return
+	}
+	a.check(schema, schema.Default, location+"/default")
+	a.check(schema, schema.Example, location+"/example")
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := schema.Properties[name]
+		a.auditSchema(&s, location+"/properties/"+escapePointer(name))
+	}
+	for i := range schema.AllOf {
+		a.auditSchema(&schema.AllOf[i], fmt.Sprintf("%s/allOf/%d", location, i))
+	}
+	for i := range schema.OneOf {
+		a.auditSchema(&schema.OneOf[i], fmt.Sprintf("%s/oneOf/%d", location, i))
+	}
+	for i := range schema.AnyOf {
+		a.auditSchema(&schema.AnyOf[i], fmt.Sprintf("%s/anyOf/%d", location, i))
+	}
+	if schema.Items != nil {
+		a.auditSchema(schema.Items.Schema, location+"/items")
+		for i := range schema.Items.Schemas {
+			a.auditSchema(&schema.Items.Schemas[i], fmt.Sprintf("%s/items/%d", location, i))
+		}
+	}
+	if schema.AdditionalProperties != nil {
+		a.auditSchema(schema.AdditionalProperties.Schema, location+"/additionalProperties")
+	}
+}
+
+// check validates the value against the schema with the JSON schema checker.
+func (a *auditor) check(schema *spec.Schema, value interface{}, location string) {
+	if value == nil {
+		return
+	}
+	var schemaDoc map[string]interface{}
+	schemaBytes, err := json.Marshal(schema)
+	if err == nil {
+		err = json.Unmarshal(schemaBytes, &schemaDoc)
+	}
+	if err != nil {
+		a.issues = append(a.issues, AuditIssue{location, fmt.Sprintf("can't read the schema: %s", err.Error())})
+		return
+	}
+	// The $refs in the schema point to "#/definitions/...", so we make the definitions part of the document.
+	schemaDoc["definitions"] = a.definitions
+
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schemaDoc), gojsonschema.NewGoLoader(value))
+	if err != nil {
+		a.issues = append(a.issues, AuditIssue{location, fmt.Sprintf("can't validate: %s", err.Error())})
+		return
+	}
+	for _, e := range result.Errors() {
+		a.issues = append(a.issues, AuditIssue{location, e.String()})
+	}
+}
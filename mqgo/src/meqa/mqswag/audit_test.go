@@ -0,0 +1,67 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestAuditExamples(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"paths": {
+			"/pets": {
+				"get": {
+					"parameters": [
+						{"name": "limit", "in": "query", "type": "integer", "maximum": 100, "default": 500},
+						{"name": "status", "in": "query", "type": "string", "enum": ["available", "sold"], "default": "sold"}
+					],
+					"responses": {
+						"200": {
+							"description": "ok",
+							"schema": {"type": "array", "items": {"$ref": "#/definitions/Pet"}},
+							"examples": {"application/json": [{"name": "tom", "age": "three"}]}
+						}
+					}
+				}
+			}
+		},
+		"definitions": {
+			"Pet": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"name": {"type": "string", "example": "tom"},
+					"age": {"type": "integer", "minimum": 0, "example": -1}
+				},
+				"example": {"age": 3}
+			}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+
+	issues := swagger.AuditExamples()
+	locations := make(map[string]bool)
+	for _, issue := range issues {
+		locations[issue.Location] = true
+	}
+	expected := []string{
+		"#/definitions/Pet/example",
+		"#/definitions/Pet/properties/age/example",
+		"#/paths/~1pets/get/parameters/0/default",
+		"#/paths/~1pets/get/responses/200/examples/application~1json",
+	}
+	for _, location := range expected {
+		if !locations[location] {
+			t.Errorf("expecting an issue at %s", location)
+		}
+	}
+	if len(locations) != len(expected) {
+		t.Errorf("expecting %d issues, got %v", len(expected), issues)
+	}
+}
@@ -4,9 +4,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"meqa/mqutil"
 	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/go-openapi/spec"
 	"github.com/xeipuuv/gojsonschema"
@@ -42,9 +48,9 @@ func CreateSchemaFromSimple(s *spec.SimpleSchema, v *spec.CommonValidations) *Sc
 }
 
 // Returns all the first level property names for this schema. We will follow the $refs until
-// we hit a map.
+// we hit a map. The properties of the allOf schemas are merged with the schema's own.
 func (schema *Schema) GetProperties(swagger *Swagger) map[string]spec.Schema {
-	if len(schema.Properties) > 0 {
+	if len(schema.Properties) > 0 && len(schema.AllOf) == 0 {
 		return schema.Properties
 	}
 	_, referredSchema, err := swagger.GetReferredSchema(schema)
@@ -62,16 +68,169 @@ func (schema *Schema) GetProperties(swagger *Swagger) map[string]spec.Schema {
 				properties[k] = v
 			}
 		}
+		for k, v := range schema.Properties {
+			properties[k] = v
+		}
 
 		return properties
 	}
 	return nil
 }
 
+// GetRequired returns the names of the required properties, following the $refs. The required lists of the
+// allOf schemas are unioned with the schema's own.
+func (schema *Schema) GetRequired(swagger *Swagger) []string {
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return nil
+	}
+	if referredSchema != nil {
+		return referredSchema.GetRequired(swagger)
+	}
+	required := append([]string(nil), schema.Required...)
+	for _, s := range schema.AllOf {
+		for _, name := range ((*Schema)(&s)).GetRequired(swagger) {
+			if !stringsContain(required, name) {
+				required = append(required, name)
+			}
+		}
+	}
+	return required
+}
+
+// The extension that marks the properties that are sent to the server but never returned, e.g. passwords.
+const ExtWriteOnly = "x-meqa-writeOnly"
+
+// The extension that marks the properties that can be null.
+const ExtNullable = "x-nullable"
+
+// The extension that marks the properties whose values must not collide, e.g. usernames.
+const ExtUnique = "x-meqa-unique"
+
+// The extension that sets the range of the generated dates, e.g. {from: now, to: +90d}.
+const ExtDateRange = "x-meqa-dateRange"
+
+// GetExtension returns the value of the extension. The extension names are case insensitive.
+func (schema *Schema) GetExtension(name string) (interface{}, bool) {
+	for k, v := range schema.Extensions {
+		if strings.EqualFold(k, name) {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// getBoolExtension returns the value of the boolean extension. The extension names are case insensitive.
+func (schema *Schema) getBoolExtension(name string) bool {
+	for k, v := range schema.Extensions {
+		if strings.EqualFold(k, name) {
+			b, _ := v.(bool)
+			return b
+		}
+	}
+	return false
+}
+
+// IsWriteOnly returns whether the schema is marked write-only.
+func (schema *Schema) IsWriteOnly() bool {
+	return schema.getBoolExtension(ExtWriteOnly)
+}
+
+// IsUnique returns whether the schema is marked unique.
+func (schema *Schema) IsUnique() bool {
+	return schema.getBoolExtension(ExtUnique)
+}
+
+// IsNullable returns whether null is a valid value for the schema, either through x-nullable, a "null" type
+// or the OpenAPI 3 nullable keyword some Swagger 2.0 specs use.
+func (schema *Schema) IsNullable() bool {
+	nullable, _ := schema.ExtraProps["nullable"].(bool)
+	return nullable || schema.getBoolExtension(ExtNullable) || schema.Type.Contains(gojsonschema.TYPE_NULL)
+}
+
+// FindWriteOnly returns the write-only fields in the object, e.g. "users[0].password". It goes through
+// the nested objects and arrays.
+func (schema *Schema) FindWriteOnly(name string, object interface{}, swagger *Swagger) []string {
+	_, referredSchema, err := swagger.GetReferredSchema(schema)
+	if err != nil {
+		return nil
+	}
+	if referredSchema != nil {
+		return referredSchema.FindWriteOnly(name, object, swagger)
+	}
+	var found []string
+	if objArray, ok := object.([]interface{}); ok {
+		if schema.Items == nil || schema.Items.Schema == nil {
+			return nil
+		}
+		for i, entry := range objArray {
+			found = append(found, ((*Schema)(schema.Items.Schema)).FindWriteOnly(fmt.Sprintf("%s[%d]", name, i), entry, swagger)...)
+		}
+		return found
+	}
+	objMap, ok := object.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	properties := schema.GetProperties(swagger)
+	var keys []string
+	for k := range objMap {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		p, ok := properties[k]
+		if !ok {
+			continue
+		}
+		fieldName := k
+		if len(name) > 0 {
+			fieldName = name + "." + k
+		}
+		if ((*Schema)(&p)).IsWriteOnly() {
+			found = append(found, fieldName)
+		} else {
+			found = append(found, ((*Schema)(&p)).FindWriteOnly(fieldName, objMap[k], swagger)...)
+		}
+	}
+	return found
+}
+
+// RemoveWriteOnly returns a copy of the object without the write-only properties. The object is
+// returned as is if it doesn't have any.
+func (schema *Schema) RemoveWriteOnly(object map[string]interface{}, swagger *Swagger) map[string]interface{} {
+	properties := schema.GetProperties(swagger)
+	var result map[string]interface{}
+	for k := range object {
+		if p, ok := properties[k]; ok && ((*Schema)(&p)).IsWriteOnly() {
+			if result == nil {
+				result = make(map[string]interface{})
+				for key, v := range object {
+					result[key] = v
+				}
+			}
+			delete(result, k)
+		}
+	}
+	if result == nil {
+		return object
+	}
+	return result
+}
+
+// GetAlternatives returns the oneOf or the anyOf schemas, and whether they are oneOf.
+func (schema *Schema) GetAlternatives() ([]spec.Schema, bool) {
+	if len(schema.OneOf) > 0 {
+		return schema.OneOf, true
+	}
+	return schema.AnyOf, false
+}
+
 // Prases the object against this schema. If the obj and schema doesn't match
 // return an error. Otherwise parse all the objects identified by the schema
-// into the map indexed by the object class name.
-func (schema *Schema) Parses(name string, object interface{}, collection map[string][]interface{}, followRef bool, swagger *Swagger) error {
+// into the map indexed by the object class name. With strict, an object must match exactly one of the oneOf
+// schemas, otherwise matching any of them is enough.
+func (schema *Schema) Parses(name string, object interface{}, collection map[string][]interface{}, followRef bool, strict bool, swagger *Swagger) error {
 	raiseError := func(msg string) error {
 		schemaBytes, _ := json.MarshalIndent((*spec.Schema)(schema), "", "    ")
 		objectBytes, _ := json.MarshalIndent(object, "", "    ")
@@ -90,7 +249,11 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 		if !followRef {
 			return nil
 		}
-		return referredSchema.Parses(refName, object, collection, followRef, swagger)
+		// The object may be a subtype of the referred schema, check it against the subtype.
+		if subtype, subtypeSchema := swagger.GetDiscriminatedSubtype(refName, referredSchema, object); subtypeSchema != nil {
+			return subtypeSchema.Parses(subtype, object, collection, followRef, strict, swagger)
+		}
+		return referredSchema.Parses(refName, object, collection, followRef, strict, swagger)
 	}
 
 	if len(schema.AllOf) > 0 {
@@ -100,8 +263,21 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 			// We don't consider null a valid match
 			return raiseError("object is not a map")
 		}
-		count := 0 // keep track of how many of object's properties are accounted for.
-		for _, s := range schema.AllOf {
+		// A branch may require a property another branch declares, so the required lists are checked
+		// together, and each branch is checked against the properties it declares.
+		for _, requiredName := range schema.GetRequired(swagger) {
+			if _, exist := objMap[requiredName]; !exist {
+				return raiseError(fmt.Sprintf("required field not present: %s", requiredName))
+			}
+		}
+		branches := schema.AllOf
+		if len(schema.Properties) > 0 {
+			// The properties next to the allOf are one more schema to satisfy.
+			own := spec.Schema{}
+			own.Properties = schema.Properties
+			branches = append(append([]spec.Schema(nil), schema.AllOf...), own)
+		}
+		for _, s := range branches {
 			p := ((*Schema)(&s)).GetProperties(swagger)
 			if len(p) == 0 {
 				continue
@@ -110,21 +286,38 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 			for k := range p {
 				if v, ok := objMap[k]; ok {
 					m[k] = v
-					count++
 				}
 			}
 			// The name doesn't get passed down. The name is handled at the current level.
-			err = ((*Schema)(&s)).Parses("", m, collection, followRef, swagger)
+			if refName, referredSchema, _ := swagger.GetReferredSchema((*Schema)(&s)); referredSchema != nil && followRef {
+				// Check against the base itself, not the subtype the discriminator names.
+				err = referredSchema.Parses(refName, m, collection, followRef, strict, swagger)
+			} else {
+				branch := s
+				branch.Required = nil
+				err = ((*Schema)(&branch)).Parses("", m, collection, followRef, strict, swagger)
+			}
 			if err != nil {
 				return err
 			}
 		}
+		count := 0 // keep track of how many of object's properties are accounted for.
+		properties := schema.GetProperties(swagger)
+		var unknownNames []string
+		for k := range objMap {
+			if _, ok := properties[k]; ok {
+				count++
+			} else {
+				unknownNames = append(unknownNames, k)
+			}
+		}
 		if count*4 < len(objMap)*3 {
 			// This is a bit fuzzy. Sometimes it's ok for the object to have a few more fields than
 			// the schema. On the other hand, the schema frequently doesn't have the "required" field.
 			// So we allow a bit margin here but the object's fields can't have too many fields that
 			// aren't in the schema.
-			return raiseError("too many mismatched fields")
+			sort.Strings(unknownNames)
+			return raiseError(fmt.Sprintf("too many mismatched fields: %s", strings.Join(unknownNames, ", ")))
 		}
 
 		// AllOf is satisfied. We can add the whole object to our collection
@@ -134,8 +327,70 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 		return nil
 	}
 
+	if alternatives, isOneOf := schema.GetAlternatives(); len(alternatives) > 0 {
+		// The object matches if any of the alternatives does. We only collect the objects from the
+		// first matching alternative.
+		matched := 0
+		for _, s := range alternatives {
+			c := make(map[string][]interface{})
+			if ((*Schema)(&s)).Parses(name, object, c, followRef, strict, swagger) != nil {
+				continue
+			}
+			matched++
+			if matched == 1 {
+				for k, v := range c {
+					collection[k] = append(collection[k], v...)
+				}
+			}
+		}
+		if matched == 0 {
+			return raiseError("object doesn't match any of the alternative schemas")
+		}
+		if isOneOf && strict && matched > 1 {
+			return raiseError(fmt.Sprintf("object matches %d of the oneOf schemas", matched))
+		}
+		// The constraints next to the oneOf or anyOf apply whichever alternative matched.
+		if len(schema.Enum) > 0 && !enumContains(schema.Enum, object) {
+			return &EnumError{"", object, schema.Enum}
+		}
+		if objMap, objIsMap := object.(map[string]interface{}); objIsMap {
+			for _, requiredName := range schema.Required {
+				if _, exist := objMap[requiredName]; !exist {
+					return raiseError(fmt.Sprintf("required field not present: %s", requiredName))
+				}
+			}
+			for propertyName, propertySchema := range schema.Properties {
+				objProperty, exist := objMap[propertyName]
+				if !exist {
+					continue
+				}
+				err = ((*Schema)(&propertySchema)).Parses("", objProperty, collection, followRef, strict, swagger)
+				if enumErr, ok := err.(*EnumError); ok {
+					enumErr.AddProperty(propertyName)
+				}
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
 	isProperty := true
 	k := reflect.TypeOf(object).Kind()
+	if len(schema.Enum) > 0 && !enumContains(schema.Enum, object) {
+		return &EnumError{"", object, schema.Enum}
+	}
+	if (k == reflect.Map || k == reflect.Array || k == reflect.Slice) && len(schema.Enum) > 0 {
+		// The enum lists the whole values, so there is no need to check the fields or items.
+		if len(name) > 0 {
+			collection[name] = append(collection[name], object)
+		}
+		return nil
+	}
+	if schema.MultipleOf != nil && !IsMultipleOf(object, *schema.MultipleOf) {
+		return raiseError(fmt.Sprintf("%v is not a multiple of %v", object, *schema.MultipleOf))
+	}
 	if k == reflect.Bool {
 		if !schema.Type.Contains(gojsonschema.TYPE_BOOLEAN) {
 			return raiseError("schema is not a boolean")
@@ -144,16 +399,36 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 		if !schema.Type.Contains(gojsonschema.TYPE_INTEGER) && !schema.Type.Contains(gojsonschema.TYPE_NUMBER) {
 			return raiseError("schema is not an integer")
 		}
+		if CheckFormat {
+			if err := CheckNumberFormat(schema.Format, object); err != nil {
+				return err
+			}
+		}
 	} else if k == reflect.Float32 || k == reflect.Float64 {
 		// After unmarshal, the map only holds floats. It doesn't differentiate int and float.
 		if !schema.Type.Contains(gojsonschema.TYPE_INTEGER) && !schema.Type.Contains(gojsonschema.TYPE_NUMBER) {
 			return raiseError("schema is not a floating point number")
 		}
+		if CheckFormat {
+			if err := CheckNumberFormat(schema.Format, object); err != nil {
+				return err
+			}
+		}
 	} else if k == reflect.String {
 		bothAreNumbers := reflect.TypeOf(object).String() == "json.Number" && (schema.Type.Contains(gojsonschema.TYPE_INTEGER) || schema.Type.Contains(gojsonschema.TYPE_NUMBER))
 		if !schema.Type.Contains(gojsonschema.TYPE_STRING) && !bothAreNumbers {
 			return raiseError("schema is not a number")
 		}
+		if CheckFormat {
+			if bothAreNumbers {
+				err = CheckNumberFormat(schema.Format, object)
+			} else {
+				err = CheckStringFormat(schema.Format, reflect.ValueOf(object).String())
+			}
+			if err != nil {
+				return err
+			}
+		}
 	} else if k == reflect.Map {
 		isProperty = false
 		objMap, objIsMap := object.(map[string]interface{})
@@ -165,20 +440,54 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 				return raiseError(fmt.Sprintf("required field not present: %s", requiredName))
 			}
 		}
+		if schema.MinProperties != nil && int64(len(objMap)) < *schema.MinProperties {
+			return raiseError(fmt.Sprintf("%d fields, fewer than minProperties %d", len(objMap), *schema.MinProperties))
+		}
+		if schema.MaxProperties != nil && int64(len(objMap)) > *schema.MaxProperties {
+			return raiseError(fmt.Sprintf("%d fields, more than maxProperties %d", len(objMap), *schema.MaxProperties))
+		}
 		// Check all the properties of the object and make sure that they can be found on the schema.
 		count := 0
+		var unknownNames []string
 		for propertyName, objProperty := range objMap {
 			propertySchema, exist := schema.Properties[propertyName]
 			if exist {
 				count++
-				err = ((*Schema)(&propertySchema)).Parses("", objProperty, collection, followRef, swagger)
+				err = ((*Schema)(&propertySchema)).Parses("", objProperty, collection, followRef, strict, swagger)
+				if formatErr, ok := err.(*FormatError); ok {
+					formatErr.AddProperty(propertyName)
+				} else if enumErr, ok := err.(*EnumError); ok {
+					enumErr.AddProperty(propertyName)
+				}
 				if err != nil {
 					return err
 				}
+			} else if matched, err := schema.parsesPatternProperties(propertyName, objProperty, collection, followRef, strict, swagger); matched {
+				if err != nil {
+					return raiseError(fmt.Sprintf("field %s doesn't match its patternProperties: %s", propertyName, err.Error()))
+				}
+				count++
+			} else {
+				unknownNames = append(unknownNames, propertyName)
+			}
+		}
+		sort.Strings(unknownNames)
+		if additional := schema.AdditionalProperties; additional != nil && len(unknownNames) > 0 {
+			if additional.Schema != nil {
+				// The fields not in properties must match the additionalProperties schema.
+				for _, propertyName := range unknownNames {
+					err = ((*Schema)(additional.Schema)).Parses("", objMap[propertyName], collection, followRef, strict, swagger)
+					if err != nil {
+						return raiseError(fmt.Sprintf("additional field %s doesn't match: %s", propertyName, err.Error()))
+					}
+				}
+				count += len(unknownNames)
+			} else if !additional.Allows {
+				return raiseError(fmt.Sprintf("unexpected fields: %s", strings.Join(unknownNames, ", ")))
 			}
 		}
 		if count*4 < len(objMap)*3 {
-			return raiseError("too many mis-matched fields")
+			return raiseError(fmt.Sprintf("too many mis-matched fields: %s", strings.Join(unknownNames, ", ")))
 		}
 
 		// all the properties are OK.
@@ -201,7 +510,7 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 		}
 		ar := object.([]interface{})
 		for _, item := range ar {
-			err = itemsSchema.Parses("", item, collection, followRef, swagger)
+			err = itemsSchema.Parses("", item, collection, followRef, strict, swagger)
 			if err != nil {
 				return err
 			}
@@ -210,7 +519,7 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 		return raiseError(fmt.Sprintf("unknown type: %v", k))
 	}
 	if isProperty && !followRef {
-		tag := GetMeqaTag(schema.Description)
+		tag := GetTag(schema)
 		if tag != nil && len(tag.Class) > 0 && len(tag.Property) > 0 {
 			key := fmt.Sprintf("%s.%s", tag.Class, tag.Property)
 			collection[key] = append(collection[key], object)
@@ -219,11 +528,79 @@ func (schema *Schema) Parses(name string, object interface{}, collection map[str
 	return nil
 }
 
+// EnumError is returned when a value isn't one of the enum values of its schema.
+type EnumError struct {
+	Property string // the path of the property in the object, e.g. "owner.status"
+	Value    interface{}
+	Enum     []interface{}
+}
+
+func (e *EnumError) Error() string {
+	valueBytes, _ := json.Marshal(e.Value)
+	enumBytes, _ := json.Marshal(e.Enum)
+	if len(e.Property) == 0 {
+		return fmt.Sprintf("%s is not one of the enum values %s", valueBytes, enumBytes)
+	}
+	return fmt.Sprintf("property %s: %s is not one of the enum values %s", e.Property, valueBytes, enumBytes)
+}
+
+// AddProperty puts the name of the property the value belongs to in front of the error's property path.
+func (e *EnumError) AddProperty(name string) {
+	if len(e.Property) == 0 {
+		e.Property = name
+	} else {
+		e.Property = name + "." + e.Property
+	}
+}
+
+// enumContains checks whether the value is one of the enum values. The numbers are compared by value, so 1
+// matches 1.0. The objects and arrays must be equal as a whole.
+func enumContains(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		if mqutil.DeepEquals(e, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsesPatternProperties parses the field against the patternProperties whose pattern matches its name. When
+// several patterns match, the field needs to match one of their schemas. Returns false if no pattern matches the
+// name, then the field is checked against additionalProperties.
+func (schema *Schema) parsesPatternProperties(name string, object interface{}, collection map[string][]interface{},
+	followRef bool, strict bool, swagger *Swagger) (bool, error) {
+
+	var patterns []string
+	for pattern := range schema.PatternProperties {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	matched := false
+	var err error
+	for _, pattern := range patterns {
+		re, compileErr := regexp.Compile(pattern)
+		if compileErr != nil || !re.MatchString(name) {
+			continue
+		}
+		matched = true
+		s := schema.PatternProperties[pattern]
+		c := make(map[string][]interface{})
+		if err = ((*Schema)(&s)).Parses("", object, c, followRef, strict, swagger); err == nil {
+			for k, v := range c {
+				collection[k] = append(collection[k], v...)
+			}
+			return true, nil
+		}
+	}
+	return matched, err
+}
+
 // Matches checks if the Schema matches the input interface. In proper swagger.json
 // Enums should have types as well. So we don't check for untyped enums.
-// TODO check format, handle AllOf, AnyOf, OneOf
-func (schema *Schema) Matches(object interface{}, swagger *Swagger) bool {
-	err := schema.Parses("", object, make(map[string][]interface{}), true, swagger)
+// The string formats are only checked when CheckFormat is set. With strict, the object must match exactly one of
+// the oneOf schemas.
+func (schema *Schema) Matches(object interface{}, strict bool, swagger *Swagger) bool {
+	err := schema.Parses("", object, make(map[string][]interface{}), true, strict, swagger)
 	return err == nil
 }
 
@@ -249,7 +626,7 @@ type SchemaIterator func(swagger *Swagger, schemaName string, schema *Schema, co
 // The iteration order is parent first then children. It will abort on error. The followWeak flag indicates whether
 // we should follow weak references when iterating.
 func (schema *Schema) Iterate(iterFunc SchemaIterator, context interface{}, swagger *Swagger, followWeak bool) error {
-	tag := GetMeqaTag(schema.Description)
+	tag := GetTag(schema)
 	if tag != nil && (tag.Flags&FlagWeak) != 0 && !followWeak {
 		return nil
 	}
@@ -268,6 +645,15 @@ func (schema *Schema) Iterate(iterFunc SchemaIterator, context interface{}, swag
 		}
 		return nil
 	}
+	if alternatives, _ := schema.GetAlternatives(); len(alternatives) > 0 {
+		for _, s := range alternatives {
+			err = ((*Schema)(&s)).Iterate(iterFunc, context, swagger, followWeak)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
 	// Deal with refs.
 	referenceName, referredSchema, err := swagger.GetReferredSchema(schema)
@@ -275,7 +661,7 @@ func (schema *Schema) Iterate(iterFunc SchemaIterator, context interface{}, swag
 		return err
 	}
 	if referredSchema != nil {
-		tag := GetMeqaTag(referredSchema.Description)
+		tag := GetTag(referredSchema)
 		if tag != nil && (tag.Flags&FlagWeak) != 0 && !followWeak {
 			return nil
 		}
@@ -311,6 +697,8 @@ func (schema *Schema) Iterate(iterFunc SchemaIterator, context interface{}, swag
 type DBEntry struct {
 	Data         map[string]interface{}            // The object itself.
 	Associations map[string]map[string]interface{} // The objects associated with this object. Class to object map.
+
+	seq int // the order of the entry in the SchemaDB's objects
 }
 
 func (entry *DBEntry) Matches(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc) bool {
@@ -323,12 +711,139 @@ func (entry *DBEntry) Matches(criteria interface{}, associations map[string]map[
 }
 
 // SchemaDB is our in-memory DB. It is organized around Schemas. Each schema maintains a list of objects that matches
-// the schema. We don't build indexes and do linear search. This keeps the searching flexible for now.
+// the schema. We do linear search by default, which keeps the searching flexible. For the schemas that accumulate
+// many objects, AddIndex indexes a field, e.g. id, so the searches on it only go through the objects that may match.
 type SchemaDB struct {
 	Name      string
 	Schema    *Schema
 	NoHistory bool
 	Objects   []*DBEntry
+
+	indexes map[string]*fieldIndex // field name to its index
+	nextSeq int
+}
+
+// fieldIndex maps the values of a field to the entries that have them. InterfaceEquals matches some values with
+// values of other forms, e.g. a date-time in another format. The entries with such values, or without the field,
+// are kept aside and always searched.
+type fieldIndex struct {
+	buckets map[string][]*DBEntry
+	other   []*DBEntry
+	keys    map[*DBEntry]string // entry to its bucket, "" for other
+}
+
+func newFieldIndex() *fieldIndex {
+	return &fieldIndex{buckets: make(map[string][]*DBEntry), keys: make(map[*DBEntry]string)}
+}
+
+// indexKey returns the bucket of the value, and false if InterfaceEquals could match it with values of other
+// buckets. The numbers are compared through their JSON, so they're keyed by their float64 value. A number in the
+// criteria that isn't a json.Number matches any json.Number, so it has no bucket.
+func indexKey(value interface{}, isCriteria bool) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		if _, err := time.Parse(time.RFC3339, v); err == nil {
+			return "", false
+		}
+		return "s" + v, true
+	case bool:
+		return fmt.Sprintf("b%t", v), true
+	case json.Number:
+		f, err := v.Float64()
+		if err != nil {
+			return "", false
+		}
+		return "n" + strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	if value == nil || isCriteria {
+		return "", false
+	}
+	v := reflect.ValueOf(value)
+	switch {
+	case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+		return "n" + strconv.FormatFloat(float64(v.Int()), 'g', -1, 64), true
+	case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+		return "n" + strconv.FormatFloat(float64(v.Uint()), 'g', -1, 64), true
+	case v.Kind() == reflect.Float32:
+		f, _ := strconv.ParseFloat(strconv.FormatFloat(v.Float(), 'g', -1, 32), 64)
+		return "n" + strconv.FormatFloat(f, 'g', -1, 64), true
+	case v.Kind() == reflect.Float64:
+		return "n" + strconv.FormatFloat(v.Float(), 'g', -1, 64), true
+	}
+	return "", false
+}
+
+func (index *fieldIndex) add(field string, entry *DBEntry) {
+	key, ok := indexKey(entry.Data[field], false)
+	if !ok {
+		index.other = append(index.other, entry)
+		index.keys[entry] = ""
+		return
+	}
+	index.buckets[key] = append(index.buckets[key], entry)
+	index.keys[entry] = key
+}
+
+func (index *fieldIndex) remove(entry *DBEntry) {
+	key, exist := index.keys[entry]
+	if !exist {
+		return
+	}
+	delete(index.keys, entry)
+	list := index.other
+	if len(key) > 0 {
+		list = index.buckets[key]
+	}
+	for i, e := range list {
+		if e == entry {
+			list = append(list[:i], list[i+1:]...)
+			break
+		}
+	}
+	if len(key) == 0 {
+		index.other = list
+	} else if len(list) == 0 {
+		delete(index.buckets, key)
+	} else {
+		index.buckets[key] = list
+	}
+}
+
+// AddIndex indexes the field of the objects. Once a field is indexed, the objects must be changed through Insert,
+// Update and Delete, or reindexed after changing Objects.
+func (db *SchemaDB) AddIndex(field string) {
+	if db.indexes == nil {
+		db.indexes = make(map[string]*fieldIndex)
+	}
+	db.indexes[field] = nil
+	db.reindex()
+}
+
+// reindex rebuilds the indexes from the objects.
+func (db *SchemaDB) reindex() {
+	for i, entry := range db.Objects {
+		entry.seq = i
+	}
+	db.nextSeq = len(db.Objects)
+	for field := range db.indexes {
+		index := newFieldIndex()
+		for _, entry := range db.Objects {
+			index.add(field, entry)
+		}
+		db.indexes[field] = index
+	}
+}
+
+func (db *SchemaDB) addToIndexes(entry *DBEntry) {
+	for field, index := range db.indexes {
+		index.add(field, entry)
+	}
+}
+
+func (db *SchemaDB) removeFromIndexes(entry *DBEntry) {
+	for _, index := range db.indexes {
+		index.remove(entry)
+	}
 }
 
 // Insert inserts an object into the schema's object list.
@@ -336,8 +851,10 @@ func (db *SchemaDB) Insert(obj interface{}, associations map[string]map[string]i
 	if !db.NoHistory {
 		found := db.Find(obj, associations, mqutil.InterfaceEquals, 1)
 		if len(found) == 0 {
-			dbentry := &DBEntry{obj.(map[string]interface{}), associations}
+			dbentry := &DBEntry{Data: obj.(map[string]interface{}), Associations: associations, seq: db.nextSeq}
+			db.nextSeq++
 			db.Objects = append(db.Objects, dbentry)
+			db.addToIndexes(dbentry)
 		}
 	}
 	return nil
@@ -352,65 +869,133 @@ func MatchAlways(criteria interface{}, existing interface{}) bool {
 
 // Clone this one but not the objects.
 func (db *SchemaDB) CloneSchema() *SchemaDB {
-	return &SchemaDB{db.Name, db.Schema, db.NoHistory, nil}
+	clone := &SchemaDB{Name: db.Name, Schema: db.Schema, NoHistory: db.NoHistory}
+	for field := range db.indexes {
+		clone.AddIndex(field)
+	}
+	return clone
 }
 
-// Find finds the specified number of objects that match the input criteria.
-func (db *SchemaDB) Find(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc, desiredCount int) []interface{} {
-	var result []interface{}
+// Clone this one and make a copy of the objects, so changing the clone doesn't change this one.
+func (db *SchemaDB) Clone() *SchemaDB {
+	clone := db.CloneSchema()
 	for _, entry := range db.Objects {
+		data := mqutil.MapCopy(entry.Data)
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		associations := make(map[string]map[string]interface{})
+		for k, v := range entry.Associations {
+			associations[k] = mqutil.MapCopy(v)
+		}
+		clone.Objects = append(clone.Objects, &DBEntry{Data: data, Associations: associations})
+	}
+	clone.reindex()
+	return clone
+}
+
+// candidates returns the entries that may match the criteria, in the order of the objects, using the index of the
+// criteria's field with the fewest entries. It returns false when no index applies and all the objects have to
+// be searched. Only InterfaceEquals compares the fields the way the indexes do.
+func (db *SchemaDB) candidates(criteria interface{}, matches MatchFunc) ([]*DBEntry, bool) {
+	cm, ok := criteria.(map[string]interface{})
+	if len(db.indexes) == 0 || !ok || reflect.ValueOf(matches).Pointer() != reflect.ValueOf(mqutil.InterfaceEquals).Pointer() {
+		return nil, false
+	}
+	if _, isMatcher := cm[mqutil.MatcherKey]; isMatcher {
+		return nil, false
+	}
+	var best *fieldIndex
+	var bestKey string
+	for field, index := range db.indexes {
+		key, ok := indexKey(cm[field], true)
+		if !ok {
+			continue
+		}
+		if best == nil || len(index.buckets[key])+len(index.other) < len(best.buckets[bestKey])+len(best.other) {
+			best, bestKey = index, key
+		}
+	}
+	if best == nil {
+		return nil, false
+	}
+	result := make([]*DBEntry, 0, len(best.buckets[bestKey])+len(best.other))
+	result = append(append(result, best.buckets[bestKey]...), best.other...)
+	sort.Slice(result, func(i, j int) bool { return result[i].seq < result[j].seq })
+	return result, true
+}
+
+// matching returns the specified number of entries that match the input criteria.
+func (db *SchemaDB) matching(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc, desiredCount int) []*DBEntry {
+	entries, indexed := db.candidates(criteria, matches)
+	if !indexed {
+		entries = db.Objects
+	}
+	var result []*DBEntry
+	for _, entry := range entries {
 		if entry.Matches(criteria, associations, matches) {
-			result = append(result, entry.Data)
+			result = append(result, entry)
 			if desiredCount >= 0 && len(result) >= desiredCount {
-				return result
+				break
 			}
 		}
 	}
 	return result
 }
 
+// Find finds the specified number of objects that match the input criteria.
+func (db *SchemaDB) Find(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc, desiredCount int) []interface{} {
+	var result []interface{}
+	for _, entry := range db.matching(criteria, associations, matches, desiredCount) {
+		result = append(result, entry.Data)
+	}
+	return result
+}
+
 // Delete deletes the specified number of elements that match the criteria. Input -1 for delete all.
 // Returns the number of elements deleted.
 func (db *SchemaDB) Delete(criteria interface{}, associations map[string]map[string]interface{}, matches MatchFunc, desiredCount int) int {
-	count := 0
-	for i, entry := range db.Objects {
-		if entry.Matches(criteria, associations, matches) {
-			db.Objects[i] = db.Objects[count]
-			count++
-			if desiredCount >= 0 && count >= desiredCount {
-				break
-			}
+	deleted := make(map[*DBEntry]bool)
+	for _, entry := range db.matching(criteria, associations, matches, desiredCount) {
+		deleted[entry] = true
+		db.removeFromIndexes(entry)
+	}
+	if len(deleted) == 0 {
+		return 0
+	}
+	// Keep the order of the rest, the indexes rely on it.
+	var objects []*DBEntry
+	for _, entry := range db.Objects {
+		if !deleted[entry] {
+			objects = append(objects, entry)
 		}
 	}
-	db.Objects = db.Objects[count:]
-	return count
+	db.Objects = objects
+	return len(deleted)
 }
 
 // Update finds the matching object, then update with the new one.
 func (db *SchemaDB) Update(criteria interface{}, associations map[string]map[string]interface{},
 	matches MatchFunc, newObj map[string]interface{}, desiredCount int, patch bool) int {
 
-	count := 0
-	for _, entry := range db.Objects {
-		if entry.Matches(criteria, associations, matches) {
-			if patch {
-				mqutil.MapCombine(entry.Data, newObj)
-			} else {
-				entry.Data = newObj
-			}
-			count++
-			if desiredCount >= 0 && count >= desiredCount {
-				break
-			}
+	entries := db.matching(criteria, associations, matches, desiredCount)
+	for _, entry := range entries {
+		db.removeFromIndexes(entry)
+		if patch {
+			mqutil.MapCombine(entry.Data, newObj)
+		} else {
+			entry.Data = newObj
 		}
+		db.addToIndexes(entry)
 	}
-	return count
+	return len(entries)
 }
 
 type DB struct {
-	schemas map[string](*SchemaDB)
-	Swagger *Swagger
-	mutex   sync.Mutex // We don't expect much contention, as such mutex will be fast
+	schemas  map[string](*SchemaDB)
+	subtypes map[string][]string // discriminator base definition name to the definitions extending it
+	Swagger  *Swagger
+	mutex    sync.Mutex // We don't expect much contention, as such mutex will be fast
 }
 
 // TODO it seems that if an object is not being used as a parameter to any operation, we don't
@@ -420,14 +1005,21 @@ type DB struct {
 func (db *DB) Init(s *Swagger) {
 	db.Swagger = s
 	db.schemas = make(map[string](*SchemaDB))
+	db.subtypes = make(map[string][]string)
 	for schemaName, schema := range s.Definitions {
+		if subtypes := s.GetSubtypes(schemaName); len(subtypes) > 0 {
+			db.subtypes[schemaName] = subtypes
+		}
 		if _, ok := db.schemas[schemaName]; ok {
 			mqutil.Logger.Printf("warning - schema %s already exists", schemaName)
 		}
 		// Note that schema variable is reused in the loop
 		schemaCopy := schema
-		db.schemas[schemaName] = &SchemaDB{schemaName, (*Schema)(&schemaCopy), false, nil}
+		db.schemas[schemaName] = &SchemaDB{Name: schemaName, Schema: (*Schema)(&schemaCopy)}
 	}
+	subtypeIndexes.Lock()
+	subtypeIndexes.m[s] = db.subtypes
+	subtypeIndexes.Unlock()
 }
 
 // Clone the db but not the objects
@@ -436,7 +1028,92 @@ func (db *DB) CloneSchema() *DB {
 	for k, v := range db.schemas {
 		schemas[k] = v.CloneSchema()
 	}
-	return &DB{schemas, db.Swagger, sync.Mutex{}}
+	return &DB{schemas, db.subtypes, db.Swagger, sync.Mutex{}}
+}
+
+// Clone makes a copy of the DB with all its objects.
+func (db *DB) Clone() *DB {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	schemas := make(map[string]*SchemaDB)
+	for k, v := range db.schemas {
+		schemas[k] = v.Clone()
+	}
+	return &DB{schemas, db.subtypes, db.Swagger, sync.Mutex{}}
+}
+
+// Commit replaces the objects in the DB with the ones in src, which is a clone of the DB that has
+// been changed.
+func (db *DB) Commit(src *DB) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for k, v := range src.schemas {
+		if db.schemas[k] != nil {
+			db.schemas[k].Objects = v.Objects
+			db.schemas[k].reindex()
+		}
+	}
+}
+
+// DBSnapshot is a copy of the objects in the DB, taken by Snapshot and put back by Restore.
+type DBSnapshot struct {
+	schemas map[string]*SchemaDB
+}
+
+// Snapshot copies the objects in the DB, so they can be restored after a test that may corrupt them.
+func (db *DB) Snapshot() *DBSnapshot {
+	return &DBSnapshot{db.Clone().schemas}
+}
+
+// Restore replaces the objects in the DB with the ones in the snapshot. The objects are copied again, so
+// changing them afterwards doesn't change the snapshot, which can be restored more than once.
+func (db *DB) Restore(snapshot *DBSnapshot) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	for k, v := range db.schemas {
+		if saved := snapshot.schemas[k]; saved != nil {
+			v.Objects = saved.Clone().Objects
+		} else {
+			v.Objects = nil
+		}
+		v.reindex()
+	}
+}
+
+// LoadFixtures inserts the existing objects in the JSON file into the DB. The file maps the names of the
+// definitions to arrays of their objects, e.g. {"Pet": [{"id": 1, "name": "fido"}]}. The generated parameters
+// and properties that refer to the definitions then use the objects' values, which the server knows about.
+func (db *DB) LoadFixtures(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		mqutil.Logger.Printf("Can't open the fixtures file: %s", path)
+		return err
+	}
+	var fixtures map[string][]interface{}
+	err = json.Unmarshal(data, &fixtures)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fixtures %s is not a JSON object of arrays: %s", path, err.Error()))
+	}
+	var names []string
+	for name := range fixtures {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		schema := db.GetSchema(name)
+		if schema == nil {
+			return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fixtures %s has objects of unknown definition %s", path, name))
+		}
+		for i, obj := range fixtures[name] {
+			if !schema.Matches(obj, false, db.Swagger) {
+				return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fixture %d of %s doesn't match the definition", i, name))
+			}
+			if err = db.Insert(name, obj, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 func (db *DB) GetSchema(name string) *Schema {
@@ -448,6 +1125,30 @@ func (db *DB) GetSchema(name string) *Schema {
 	return db.schemas[name].Schema
 }
 
+// GetSubtypes returns the names of the definitions that extend the discriminator base definition.
+func (db *DB) GetSubtypes(name string) []string {
+	return db.subtypes[name]
+}
+
+// The subtypes the DBs found, by their swagger, so parsing an object doesn't go through all the definitions to
+// find the subtype its discriminator names.
+var subtypeIndexes = struct {
+	sync.Mutex
+	m map[*Swagger]map[string][]string
+}{m: make(map[*Swagger]map[string][]string)}
+
+// getIndexedSubtypes returns the subtypes of the base the DB of the swagger found, or else goes through the
+// definitions.
+func (swagger *Swagger) getIndexedSubtypes(base string) []string {
+	subtypeIndexes.Lock()
+	index, ok := subtypeIndexes.m[swagger]
+	subtypeIndexes.Unlock()
+	if ok {
+		return index[base]
+	}
+	return swagger.GetSubtypes(base)
+}
+
 func CopyWithoutClass(src map[string]map[string]interface{}, className string) map[string]map[string]interface{} {
 	dst := make(map[string]map[string]interface{})
 	for k, v := range src {
@@ -465,9 +1166,25 @@ func (db *DB) Insert(name string, obj interface{}, associations map[string]map[s
 	if db.schemas[name] == nil {
 		return mqutil.NewError(mqutil.ErrInternal, fmt.Sprintf("inserting into non-existing schema: %s", name))
 	}
+	// The server never returns the write-only fields, so we don't keep them.
+	if objMap, ok := obj.(map[string]interface{}); ok {
+		obj = db.schemas[name].Schema.RemoveWriteOnly(objMap, db.Swagger)
+	}
 	return db.schemas[name].Insert(obj, CopyWithoutClass(associations, name))
 }
 
+// AddIndex indexes the field of the schema's objects, e.g. id, for the schemas that accumulate many objects.
+func (db *DB) AddIndex(name string, field string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.schemas[name] == nil {
+		return mqutil.NewError(mqutil.ErrInternal, fmt.Sprintf("indexing non-existing schema: %s", name))
+	}
+	db.schemas[name].AddIndex(field)
+	return nil
+}
+
 func (db *DB) Find(name string, criteria interface{}, associations map[string]map[string]interface{},
 	matches MatchFunc, desiredCount int) []interface{} {
 
@@ -501,19 +1218,47 @@ func (db *DB) Update(name string, criteria interface{}, associations map[string]
 	if db.schemas[name] == nil {
 		return 0
 	}
+	newObj = db.schemas[name].Schema.RemoveWriteOnly(newObj, db.Swagger)
 	return db.schemas[name].Update(criteria, CopyWithoutClass(associations, name), matches, newObj, desiredCount, patch)
 }
 
-// FindMatchingSchema finds the schema that matches the obj.
+// FindMatchingSchema finds the schema that matches the obj. When both a schema and one composed from it through
+// allOf match, the composed one is more specific and wins.
 func (db *DB) FindMatchingSchema(obj interface{}) (string, *spec.Schema) {
+	var names []string
 	for name, schemaDB := range db.schemas {
-		schema := schemaDB.Schema
-		if schema.Matches(obj, db.Swagger) {
-			mqutil.Logger.Printf("found matching schema: %s", name)
-			return name, (*spec.Schema)(schema)
+		if schemaDB.Schema.Matches(obj, false, db.Swagger) {
+			names = append(names, name)
 		}
 	}
-	return "", nil
+	if len(names) == 0 {
+		return "", nil
+	}
+	sort.Strings(names)
+	best := names[0]
+	for _, name := range names[1:] {
+		if db.composes(name, best) {
+			best = name
+		}
+	}
+	mqutil.Logger.Printf("found matching schema: %s", best)
+	return best, (*spec.Schema)(db.schemas[best].Schema)
+}
+
+// composes returns whether the schema of the name is composed from the base schema through allOf, directly or
+// through other composed schemas.
+func (db *DB) composes(name string, base string) bool {
+	schemaDB := db.schemas[name]
+	if schemaDB == nil {
+		return false
+	}
+	for _, s := range schemaDB.Schema.AllOf {
+		refName, _, err := db.Swagger.GetReferredSchema((*Schema)(&s))
+		if err == nil && len(refName) > 0 && refName != name && (refName == base || db.composes(refName, base)) {
+			return true
+		}
+	}
+	return false
 }
 
 // DB holds schema name to Schema mapping.
@@ -0,0 +1,760 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestMatchesFormat(t *testing.T) {
+	schema := (*Schema)(spec.DateTimeProperty())
+	swagger := &Swagger{}
+
+	CheckFormat = true
+	defer func() { CheckFormat = false }()
+	if !schema.Matches("2017-08-01T10:20:30Z", false, swagger) {
+		t.Error("valid date-time doesn't match")
+	}
+	if schema.Matches("not-a-date", false, swagger) {
+		t.Error("invalid date-time matches")
+	}
+
+	CheckFormat = false
+	if !schema.Matches("not-a-date", false, swagger) {
+		t.Error("format is checked when CheckFormat is off")
+	}
+}
+
+func TestCheckFormats(t *testing.T) {
+	cases := []struct {
+		format string
+		value  interface{}
+		valid  bool
+	}{
+		{"ipv6", "2001:db8::1", true},
+		{"ipv6", "10.0.0.1", false},
+		{"uri", "https://example.com/pets", true},
+		{"uri", "pets", false},
+		{"byte", "aGVsbG8=", true},
+		{"byte", "not base64!", false},
+		{"int32", json.Number("2147483647"), true},
+		{"int32", json.Number("2147483648"), false},
+		{"int32", 3.5, false},
+		{"int64", json.Number("9223372036854775808"), false},
+		{"custom", "anything", true},
+	}
+	for _, c := range cases {
+		var err error
+		if s, ok := c.value.(string); ok {
+			err = CheckStringFormat(c.format, s)
+		} else {
+			err = CheckNumberFormat(c.format, c.value)
+		}
+		if (err == nil) != c.valid {
+			t.Errorf("%s %v: expecting valid %v, got %v", c.format, c.value, c.valid, err)
+		}
+	}
+
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"Owner": {"type": "object", "properties": {"email": {"type": "string", "format": "email"}}},
+			"Pet": {"type": "object", "properties": {"owner": {"$ref": "#/definitions/Owner"}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	CheckFormat = true
+	defer func() { CheckFormat = false }()
+	pet := map[string]interface{}{"owner": map[string]interface{}{"email": "nobody"}}
+	err = swagger.FindSchemaByName("Pet").Parses("", pet, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || err.Error() != "property owner.email: nobody is not a valid email" {
+		t.Errorf("expecting the property, format and value in the error, got %v", err)
+	}
+}
+
+const petSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "pets", "version": "1.0"},
+	"paths": {},
+	"definitions": {
+		"Cat": {"type": "object", "required": ["meow"],
+			"properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "meow": {"type": "string"}}},
+		"Dog": {"type": "object", "required": ["bark"],
+			"properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "bark": {"type": "integer"}}},
+		"Pet": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]},
+		"Pets": {"type": "array", "items": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]}},
+		"Animal": {"anyOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}]},
+		"NamedPet": {"oneOf": [{"$ref": "#/definitions/Cat"}, {"$ref": "#/definitions/Dog"}], "required": ["name"],
+			"properties": {"name": {"type": "string", "enum": ["tom", "rex"]}}},
+		"Size": {"anyOf": [{"type": "string"}, {"type": "integer"}], "enum": ["small", "large"]}
+	}
+}`
+
+func loadPetSwagger(t *testing.T) *Swagger {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(petSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	return swagger
+}
+
+func TestMatchesOneOf(t *testing.T) {
+	swagger := loadPetSwagger(t)
+	pet := swagger.FindSchemaByName("Pet")
+	cat := map[string]interface{}{"meow": "loud"}
+	dog := map[string]interface{}{"bark": 3.0}
+	fish := map[string]interface{}{"swim": true}
+
+	if !pet.Matches(cat, false, swagger) || !pet.Matches(dog, false, swagger) {
+		t.Error("cat or dog doesn't match oneOf pet")
+	}
+	if pet.Matches(fish, false, swagger) {
+		t.Error("fish matches oneOf pet")
+	}
+
+	collection := make(map[string][]interface{})
+	err := pet.Parses("", dog, collection, true, false, swagger)
+	if err != nil || len(collection["Dog"]) != 1 || len(collection["Cat"]) != 0 {
+		t.Errorf("dog should be collected as Dog, got %v, err %v", collection, err)
+	}
+
+	pets := swagger.FindSchemaByName("Pets")
+	if !pets.Matches([]interface{}{cat, dog}, false, swagger) {
+		t.Error("array of cat and dog doesn't match")
+	}
+	if pets.Matches([]interface{}{cat, fish}, false, swagger) {
+		t.Error("array with fish matches")
+	}
+}
+
+func TestMatchesStrictOneOf(t *testing.T) {
+	swagger := loadPetSwagger(t)
+	catDog := map[string]interface{}{"name": "tom", "age": 2.0, "meow": "loud", "bark": 3.0}
+
+	if swagger.FindSchemaByName("Pet").Matches(catDog, true, swagger) {
+		t.Error("object matching both oneOf schemas matches in strict mode")
+	}
+	if !swagger.FindSchemaByName("Animal").Matches(catDog, true, swagger) {
+		t.Error("object matching both anyOf schemas doesn't match")
+	}
+	if !swagger.FindSchemaByName("Pet").Matches(catDog, false, swagger) {
+		t.Error("object matching both oneOf schemas doesn't match when not strict")
+	}
+}
+
+func TestMatchesOneOfSiblings(t *testing.T) {
+	swagger := loadPetSwagger(t)
+	namedPet := swagger.FindSchemaByName("NamedPet")
+	if !namedPet.Matches(map[string]interface{}{"name": "tom", "meow": "loud"}, false, swagger) {
+		t.Error("named cat doesn't match")
+	}
+	if namedPet.Matches(map[string]interface{}{"meow": "loud"}, false, swagger) {
+		t.Error("cat without the required name matches")
+	}
+	if namedPet.Matches(map[string]interface{}{"name": "felix", "meow": "loud"}, false, swagger) {
+		t.Error("cat with a name not in the enum matches")
+	}
+
+	size := swagger.FindSchemaByName("Size")
+	if !size.Matches("small", false, swagger) || size.Matches("medium", false, swagger) {
+		t.Error("the enum next to anyOf isn't checked")
+	}
+}
+
+const animalSwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "animals", "version": "1.0"},
+	"paths": {},
+	"definitions": {
+		"Animal": {"type": "object", "discriminator": "petType", "required": ["petType"],
+			"properties": {"name": {"type": "string"}, "petType": {"type": "string"}}},
+		"Cat": {"allOf": [{"$ref": "#/definitions/Animal"},
+			{"type": "object", "required": ["meow"], "properties": {"meow": {"type": "string"}}}]},
+		"Dog": {"allOf": [{"$ref": "#/definitions/Animal"},
+			{"type": "object", "required": ["bark"], "properties": {"bark": {"type": "integer"}}}]}
+	}
+}`
+
+func TestDiscriminatorSubtypes(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(animalSwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	db := &DB{}
+	db.Init(swagger)
+	if subtypes := db.GetSubtypes("Animal"); len(subtypes) != 2 || subtypes[0] != "Cat" || subtypes[1] != "Dog" {
+		t.Errorf("expecting Cat and Dog as subtypes of Animal, got %v", subtypes)
+	}
+	if subtypes := db.GetSubtypes("Dog"); len(subtypes) != 0 {
+		t.Errorf("expecting no subtypes of Dog, got %v", subtypes)
+	}
+
+	animalRef := &Schema{}
+	animalRef.Ref = spec.MustCreateRef("#/definitions/Animal")
+	dog := map[string]interface{}{"name": "rex", "petType": "Dog", "bark": 3.0}
+	collection := make(map[string][]interface{})
+	err = animalRef.Parses("", dog, collection, true, false, swagger)
+	if err != nil || len(collection["Dog"]) != 1 {
+		t.Errorf("dog should be collected as Dog, got %v, err %v", collection, err)
+	}
+
+	// The object is checked against the subtype the discriminator names.
+	if animalRef.Matches(map[string]interface{}{"name": "rex", "petType": "Dog", "meow": "loud"}, false, swagger) {
+		t.Error("dog without bark matches")
+	}
+
+	// The subtypes come from the DB's index, not from the definitions.
+	db.subtypes["Animal"] = []string{"Dog"}
+	if subtype, _ := swagger.GetDiscriminatedSubtype("Animal", swagger.FindSchemaByName("Animal"),
+		map[string]interface{}{"petType": "Cat"}); subtype != "" {
+		t.Errorf("expecting Cat not to be a subtype once the index drops it, got %s", subtype)
+	}
+}
+
+func TestMatchesAdditionalProperties(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"Closed": {"type": "object", "additionalProperties": false,
+				"properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "color": {"type": "string"}}},
+			"Open": {"type": "object",
+				"properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "color": {"type": "string"}}},
+			"Labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"Pet": {"type": "object",
+				"properties": {"name": {"type": "string"}, "age": {"type": "integer"}, "color": {"type": "string"}, "id": {"type": "integer"}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	obj := map[string]interface{}{"name": "tom", "age": 3.0, "color": "black", "id": 1.0}
+
+	err = swagger.FindSchemaByName("Closed").Parses("", obj, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "unexpected fields: id") {
+		t.Errorf("expecting unexpected field id, got %v", err)
+	}
+	if !swagger.FindSchemaByName("Open").Matches(obj, false, swagger) {
+		t.Error("extra field fails to match when additionalProperties is absent")
+	}
+
+	labels := swagger.FindSchemaByName("Labels")
+	if !labels.Matches(map[string]interface{}{"a": "x", "b": "y"}, false, swagger) {
+		t.Error("string values don't match additionalProperties string schema")
+	}
+	bounded := *labels
+	two, three := int64(2), int64(3)
+	bounded.MinProperties, bounded.MaxProperties = &two, &three
+	err = bounded.Parses("", map[string]interface{}{"a": "x"}, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "fewer than minProperties 2") {
+		t.Errorf("expecting too few fields, got %v", err)
+	}
+	err = bounded.Parses("", map[string]interface{}{"a": "x", "b": "y", "c": "z", "d": "w"},
+		make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "more than maxProperties 3") {
+		t.Errorf("expecting too many fields, got %v", err)
+	}
+	err = labels.Parses("", map[string]interface{}{"a": "x", "b": 1.0}, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "additional field b") {
+		t.Errorf("expecting additional field b not to match, got %v", err)
+	}
+
+	mqutil.NewLogger(ioutil.Discard)
+	db := &DB{}
+	db.Init(&Swagger{Definitions: spec.Definitions{
+		"Closed": swagger.Definitions["Closed"],
+		"Pet":    swagger.Definitions["Pet"],
+	}})
+	if name, _ := db.FindMatchingSchema(obj); name != "Pet" {
+		t.Errorf("expecting the object to be a Pet, got %s", name)
+	}
+}
+
+func TestMatchesPatternProperties(t *testing.T) {
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "additionalProperties": false,
+		"properties": {"host": {"type": "string"}},
+		"patternProperties": {"^cpu_": {"type": "number"}, "_count$": {"type": "integer"}, "^mem_": {"type": "string"}}}`),
+		(*spec.Schema)(schema))
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	swagger := &Swagger{}
+	if !schema.Matches(map[string]interface{}{"host": "a", "cpu_user": 0.5, "mem_free": "1G"}, false, swagger) {
+		t.Error("fields matching the patterns don't match")
+	}
+	// cpu_count matches both patterns, one is enough.
+	if !schema.Matches(map[string]interface{}{"cpu_count": 4.0}, false, swagger) {
+		t.Error("a field matching two patterns doesn't match")
+	}
+	err = schema.Parses("", map[string]interface{}{"cpu_user": "high"}, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "field cpu_user doesn't match its patternProperties") {
+		t.Errorf("expecting cpu_user not to match, got %v", err)
+	}
+	err = schema.Parses("", map[string]interface{}{"disk": 1.0}, make(map[string][]interface{}), true, false, swagger)
+	if err == nil || !strings.Contains(err.Error(), "unexpected fields: disk") {
+		t.Errorf("expecting disk to fall back to additionalProperties, got %v", err)
+	}
+}
+
+func TestMatchesMultipleOf(t *testing.T) {
+	swagger := &Swagger{}
+	cases := []struct {
+		multipleOf float64
+		value      interface{}
+		matches    bool
+	}{
+		{5, 10.0, true},
+		{5, 12.0, false},
+		{5, json.Number("-15"), true},
+		{5, json.Number("7"), false},
+		{5, int64(20), true},
+		{0.01, 19.99, true},
+		{0.01, 0.3, true},
+		{0.01, json.Number("1.005"), false},
+		{0.1, 0.7000000000000001, true},
+		{1.5, 4.5, true},
+		{1.5, 4.0, false},
+		{5, "ten", true},
+	}
+	for _, c := range cases {
+		schema := (*Schema)(new(spec.Schema).Typed("number", ""))
+		if _, isString := c.value.(string); isString {
+			schema = (*Schema)(spec.StringProperty())
+		}
+		schema.MultipleOf = &c.multipleOf
+		if schema.Matches(c.value, false, swagger) != c.matches {
+			t.Errorf("%v multiple of %v, expecting %v", c.value, c.multipleOf, c.matches)
+		}
+	}
+}
+
+func TestFindWriteOnly(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "users", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"User": {"type": "object", "properties": {"name": {"type": "string"},
+				"password": {"type": "string", "x-meqa-writeOnly": true}}},
+			"Team": {"type": "object", "properties": {"users": {"type": "array", "items": {"$ref": "#/definitions/User"}}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	team := map[string]interface{}{"users": []interface{}{
+		map[string]interface{}{"name": "tom"},
+		map[string]interface{}{"name": "jerry", "password": "secret"},
+	}}
+	fields := swagger.FindSchemaByName("Team").FindWriteOnly("", team, swagger)
+	if len(fields) != 1 || fields[0] != "users[1].password" {
+		t.Errorf("expecting users[1].password, got %v", fields)
+	}
+
+	user := map[string]interface{}{"name": "jerry", "password": "secret"}
+	removed := swagger.FindSchemaByName("User").RemoveWriteOnly(user, swagger)
+	if len(removed) != 1 || removed["name"] != "jerry" || len(user) != 2 {
+		t.Errorf("expecting a copy without the password, got %v from %v", removed, user)
+	}
+}
+
+func TestNullable(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "users", "version": "1.0"},
+		"paths": {},
+		"definitions": {
+			"User": {"type": "object", "properties": {"name": {"type": "string"},
+				"nick": {"type": "string", "x-nullable": true}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	user := swagger.FindSchemaByName("User")
+	nick := user.Properties["nick"]
+	name := user.Properties["name"]
+	if !((*Schema)(&nick)).IsNullable() || ((*Schema)(&name)).IsNullable() {
+		t.Error("expecting only nick to be nullable")
+	}
+	if !user.Matches(map[string]interface{}{"name": "tom", "nick": nil}, false, swagger) {
+		t.Error("null doesn't match the nullable property")
+	}
+	keyword := Schema{}
+	if err = json.Unmarshal([]byte(`{"type": "string", "nullable": true}`), (*spec.Schema)(&keyword)); err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	if !keyword.IsNullable() || !keyword.Matches(nil, false, swagger) || !keyword.Matches("tom", false, swagger) || keyword.Matches(3.0, false, swagger) {
+		t.Error("expecting the nullable keyword to allow null besides strings")
+	}
+
+	// An explicit null only finds the objects where the field is null or missing.
+	db := &DB{}
+	db.Init(swagger)
+	db.Insert("User", map[string]interface{}{"name": "tom", "nick": "tommy"}, nil)
+	db.Insert("User", map[string]interface{}{"name": "jerry"}, nil)
+	found := db.Find("User", map[string]interface{}{"nick": nil}, nil, mqutil.InterfaceEquals, -1)
+	if len(found) != 1 || found[0].(map[string]interface{})["name"] != "jerry" {
+		t.Errorf("expecting only jerry, got %v", found)
+	}
+}
+
+func TestFindWithMatchers(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	db := &SchemaDB{Name: "Store"}
+	db.Objects = []*DBEntry{
+		{Data: map[string]interface{}{"name": "Downtown", "version": "v1.2.0",
+			"location": []interface{}{json.Number("37.7749"), json.Number("-122.4194")}}},
+		{Data: map[string]interface{}{"name": "Airport", "version": "1.3",
+			"location": map[string]interface{}{"lat": 37.6213, "lng": -122.379}}},
+	}
+	find := func(criteria map[string]interface{}) []interface{} {
+		return db.Find(criteria, nil, mqutil.InterfaceEquals, -1)
+	}
+
+	near := map[string]interface{}{"location": map[string]interface{}{
+		mqutil.MatcherKey: "geoNear", "value": []interface{}{37.78, -122.41}, "radius": 5}}
+	if found := find(near); len(found) != 1 || found[0].(map[string]interface{})["name"] != "Downtown" {
+		t.Errorf("expecting Downtown within 5 km, got %v", found)
+	}
+	near["location"].(map[string]interface{})["radius"] = 50
+	if found := find(near); len(found) != 2 {
+		t.Errorf("expecting both stores within 50 km, got %v", found)
+	}
+	if found := find(map[string]interface{}{"version": map[string]interface{}{
+		mqutil.MatcherKey: "semverEqual", "value": "1.2"}}); len(found) != 1 {
+		t.Errorf("expecting v1.2.0 to equal 1.2, got %v", found)
+	}
+	if found := find(map[string]interface{}{"name": map[string]interface{}{
+		mqutil.MatcherKey: "caseInsensitive", "value": "AIRPORT"}}); len(found) != 1 {
+		t.Errorf("expecting Airport to match case insensitively, got %v", found)
+	}
+
+	mqutil.RegisterMatcher("prefix", func(criteria map[string]interface{}, existing interface{}) bool {
+		prefix, _ := criteria["value"].(string)
+		s, _ := existing.(string)
+		return strings.HasPrefix(s, prefix)
+	})
+	prefix := map[string]interface{}{"name": map[string]interface{}{mqutil.MatcherKey: "prefix", "value": "Air"}}
+	if count := db.Delete(prefix, nil, mqutil.InterfaceEquals, -1); count != 1 || len(db.Objects) != 1 {
+		t.Errorf("expecting the custom matcher to delete Airport, deleted %d", count)
+	}
+
+	err := mqutil.CheckMatchers(map[string]interface{}{"name": map[string]interface{}{mqutil.MatcherKey: "fuzzy"}})
+	if err == nil || !strings.Contains(err.Error(), "caseInsensitive, geoNear, prefix, semverEqual") {
+		t.Errorf("expecting the registered matchers in the error, got %v", err)
+	}
+}
+
+const huskySwagger = `{
+	"swagger": "2.0",
+	"info": {"title": "huskies", "version": "1.0"},
+	"paths": {},
+	"definitions": {
+		"Animal": {"type": "object", "discriminator": "petType", "required": ["petType"],
+			"properties": {"name": {"type": "string"}, "petType": {"type": "string"}}},
+		"Dog": {"allOf": [{"$ref": "#/definitions/Animal"},
+			{"type": "object", "properties": {"bark": {"type": "integer"}}}]},
+		"Husky": {"allOf": [{"$ref": "#/definitions/Dog"},
+			{"required": ["name", "sled"]},
+			{"type": "object", "properties": {"sled": {"type": "boolean"}}}],
+			"properties": {"eyes": {"type": "string"}}}
+	}
+}`
+
+// indexTestObjects returns objects whose ids come in all the forms InterfaceEquals compares.
+func indexTestObjects(count int) []map[string]interface{} {
+	var objects []map[string]interface{}
+	for i := 0; i < count; i++ {
+		var id interface{}
+		switch i % 5 {
+		case 0:
+			id = json.Number(fmt.Sprint(i % 40))
+		case 1:
+			id = float64(i % 40)
+		case 2:
+			id = fmt.Sprint(i % 40)
+		case 3:
+			id = fmt.Sprintf("2017-08-01T10:%02d:00Z", i%40)
+		}
+		obj := map[string]interface{}{"name": fmt.Sprintf("pet%d", i%7), "tag": i%3 == 0}
+		if id != nil {
+			obj["id"] = id
+		}
+		objects = append(objects, obj)
+	}
+	return objects
+}
+
+func TestIndexedFind(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	scan := &SchemaDB{Name: "Pet"}
+	indexed := &SchemaDB{Name: "Pet"}
+	indexed.AddIndex("id")
+	indexed.AddIndex("name")
+	for _, obj := range indexTestObjects(400) {
+		scan.Insert(mqutil.MapCopy(obj), nil)
+		indexed.Insert(mqutil.MapCopy(obj), nil)
+	}
+
+	var criteriaList []map[string]interface{}
+	for i := 0; i < 40; i++ {
+		criteriaList = append(criteriaList,
+			map[string]interface{}{"id": json.Number(fmt.Sprint(i))},
+			map[string]interface{}{"id": i},
+			map[string]interface{}{"id": float64(i), "name": fmt.Sprintf("pet%d", i%7)},
+			map[string]interface{}{"id": fmt.Sprint(i)},
+			map[string]interface{}{"id": fmt.Sprintf("10:%02d", i)},
+			map[string]interface{}{"id": nil, "tag": true})
+	}
+	criteriaList = append(criteriaList, map[string]interface{}{"name": map[string]interface{}{
+		mqutil.MatcherKey: "caseInsensitive", "value": "PET3"}})
+	compare := func(step string) {
+		for _, criteria := range criteriaList {
+			for _, count := range []int{-1, 1} {
+				expected := scan.Find(criteria, nil, mqutil.InterfaceEquals, count)
+				if found := indexed.Find(criteria, nil, mqutil.InterfaceEquals, count); !reflect.DeepEqual(found, expected) {
+					t.Fatalf("%s: %v finds %v with the index, %v without", step, criteria, found, expected)
+				}
+			}
+		}
+	}
+	compare("insert")
+
+	for i := 0; i < 40; i += 3 {
+		criteria := map[string]interface{}{"id": json.Number(fmt.Sprint(i))}
+		newObj := map[string]interface{}{"id": fmt.Sprint(i + 1), "name": "renamed"}
+		for _, db := range []*SchemaDB{scan, indexed} {
+			db.Update(criteria, nil, mqutil.InterfaceEquals, mqutil.MapCopy(newObj), 1, i%2 == 0)
+		}
+	}
+	compare("update")
+
+	for i := 0; i < 40; i += 4 {
+		criteria := map[string]interface{}{"id": fmt.Sprint(i)}
+		if scan.Delete(criteria, nil, mqutil.InterfaceEquals, 3) != indexed.Delete(criteria, nil, mqutil.InterfaceEquals, 3) {
+			t.Fatalf("deleting %v, the counts differ", criteria)
+		}
+	}
+	compare("delete")
+
+	clone := indexed.Clone()
+	clone.Insert(map[string]interface{}{"id": json.Number("1000")}, nil)
+	if found := clone.Find(map[string]interface{}{"id": json.Number("1000")}, nil, mqutil.InterfaceEquals, -1); len(found) != 1 {
+		t.Errorf("expecting the clone's index to find the new object, got %v", found)
+	}
+	if found := indexed.Find(map[string]interface{}{"id": json.Number("1000")}, nil, mqutil.InterfaceEquals, -1); len(found) != 0 {
+		t.Errorf("expecting the clone not to change the original, got %v", found)
+	}
+}
+
+func TestMatchesObjectEnum(t *testing.T) {
+	swagger := &Swagger{}
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "enum": [{"mode": "fast", "level": 1},
+		{"mode": "safe", "level": 2, "retries": [1, 2]}]}`), (*spec.Schema)(schema))
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	arraySchema := &Schema{}
+	err = json.Unmarshal([]byte(`{"type": "array", "items": {"type": "string"}, "enum": [["a", "b"], []]}`),
+		(*spec.Schema)(arraySchema))
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	cases := []struct {
+		schema  *Schema
+		value   interface{}
+		matches bool
+	}{
+		{schema, map[string]interface{}{"mode": "fast", "level": json.Number("1")}, true},
+		{schema, map[string]interface{}{"mode": "safe", "level": 2.0, "retries": []interface{}{json.Number("1"), 2}}, true},
+		{schema, map[string]interface{}{"mode": "fast", "level": json.Number("2")}, false},
+		{schema, map[string]interface{}{"mode": "fast"}, false},
+		{schema, map[string]interface{}{"mode": "fast", "level": 1, "extra": true}, false},
+		{schema, map[string]interface{}{"mode": "safe", "level": 2, "retries": []interface{}{2, 1}}, false},
+		{schema, map[string]interface{}{"mode": "fast", "level": "1"}, false},
+		{arraySchema, []interface{}{"a", "b"}, true},
+		{arraySchema, []interface{}{}, true},
+		{arraySchema, []interface{}{"b", "a"}, false},
+		{arraySchema, []interface{}{"a"}, false},
+	}
+	for _, c := range cases {
+		if c.schema.Matches(c.value, false, swagger) != c.matches {
+			t.Errorf("%v, expecting the enum to match %v", c.value, c.matches)
+		}
+	}
+}
+
+func TestMatchesScalarEnum(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &Swagger{}
+	schema := &Schema{}
+	err := json.Unmarshal([]byte(`{"type": "object", "properties": {
+		"status": {"type": "string", "enum": ["ACTIVE", "INACTIVE"]},
+		"level": {"type": "integer", "enum": [1, 2]},
+		"ratio": {"type": "number", "enum": [0.5, 1]}}}`), (*spec.Schema)(schema))
+	if err != nil {
+		t.Fatalf("can't load schema: %v", err)
+	}
+	cases := []struct {
+		value map[string]interface{}
+		err   string
+	}{
+		{map[string]interface{}{"status": "ACTIVE", "level": 1, "ratio": 0.5}, ""},
+		{map[string]interface{}{"status": "INACTIVE", "level": 2.0, "ratio": json.Number("1")}, ""},
+		{map[string]interface{}{"level": json.Number("2"), "ratio": 1.0}, ""},
+		{map[string]interface{}{"status": "ACTIV"}, `property status: "ACTIV" is not one of the enum values ["ACTIVE","INACTIVE"]`},
+		{map[string]interface{}{"status": "active"}, `property status: "active" is not one of the enum values`},
+		{map[string]interface{}{"level": 3}, "property level: 3 is not one of the enum values [1,2]"},
+		{map[string]interface{}{"ratio": json.Number("0.25")}, "property ratio: 0.25 is not one of the enum values [0.5,1]"},
+	}
+	for _, c := range cases {
+		err := schema.Parses("", c.value, make(map[string][]interface{}), true, false, swagger)
+		if len(c.err) == 0 && err != nil || len(c.err) > 0 && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%v: expecting error %q, got %v", c.value, c.err, err)
+		}
+		if schema.Matches(c.value, false, swagger) != (len(c.err) == 0) {
+			t.Errorf("%v: expecting the match to be %v", c.value, len(c.err) == 0)
+		}
+	}
+
+	// The objects that only differ in their enum values match their own schemas.
+	db := &DB{}
+	db.Init(&Swagger{Definitions: spec.Definitions{
+		"Cat": *new(spec.Schema).Typed("object", "").SetProperty("kind", *spec.StringProperty().WithEnum("cat")),
+		"Dog": *new(spec.Schema).Typed("object", "").SetProperty("kind", *spec.StringProperty().WithEnum("dog")),
+	}})
+	if name, _ := db.FindMatchingSchema(map[string]interface{}{"kind": "dog"}); name != "Dog" {
+		t.Errorf("expecting the dog to match Dog, got %s", name)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	db := &DB{}
+	db.Init(&Swagger{Definitions: spec.Definitions{"Pet": *spec.MapProperty(nil)}})
+	db.AddIndex("Pet", "id")
+	db.Insert("Pet", map[string]interface{}{"id": json.Number("1"), "name": "cat",
+		"tags": []interface{}{"small"}}, nil)
+	db.Insert("Pet", map[string]interface{}{"id": json.Number("2"), "name": "dog"}, nil)
+	snapshot := db.Snapshot()
+
+	// A destructive test renames, deletes and adds pets, and changes the nested objects in place.
+	found := db.Find("Pet", map[string]interface{}{"id": json.Number("1")}, nil, mqutil.InterfaceEquals, 1)
+	found[0].(map[string]interface{})["tags"].([]interface{})[0] = "huge"
+	db.Update("Pet", map[string]interface{}{"id": json.Number("1")}, nil, mqutil.InterfaceEquals,
+		map[string]interface{}{"name": "tiger"}, 1, true)
+	db.Delete("Pet", map[string]interface{}{"id": json.Number("2")}, nil, mqutil.InterfaceEquals, 1)
+	db.Insert("Pet", map[string]interface{}{"id": json.Number("3"), "name": "fish"}, nil)
+
+	expected := []interface{}{
+		map[string]interface{}{"id": json.Number("1"), "name": "cat", "tags": []interface{}{"small"}},
+		map[string]interface{}{"id": json.Number("2"), "name": "dog"},
+	}
+	for i := 0; i < 2; i++ {
+		db.Restore(snapshot)
+		all := db.Find("Pet", nil, nil, MatchAlways, -1)
+		if !reflect.DeepEqual(all, expected) {
+			t.Fatalf("expecting the restore to undo the changes, got %v", all)
+		}
+		// The restored objects don't share anything with the snapshot.
+		all[0].(map[string]interface{})["tags"].([]interface{})[0] = "changed"
+		all[0].(map[string]interface{})["name"] = "changed"
+	}
+	if found := db.Find("Pet", map[string]interface{}{"id": json.Number("3")}, nil, mqutil.InterfaceEquals, -1); len(found) != 0 {
+		t.Errorf("expecting the index not to find the pet added after the snapshot, got %v", found)
+	}
+}
+
+func BenchmarkFind(b *testing.B) {
+	mqutil.NewLogger(ioutil.Discard)
+	for _, index := range []bool{false, true} {
+		db := &SchemaDB{Name: "Pet"}
+		if index {
+			db.AddIndex("id")
+		}
+		for i := 0; i < 5000; i++ {
+			db.Insert(map[string]interface{}{"id": json.Number(fmt.Sprint(i)), "name": fmt.Sprintf("pet%d", i)}, nil)
+		}
+		b.Run(fmt.Sprintf("indexed=%v", index), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				criteria := map[string]interface{}{"id": json.Number(fmt.Sprint(i % 5000))}
+				if found := db.Find(criteria, nil, mqutil.InterfaceEquals, 1); len(found) != 1 {
+					b.Fatalf("expecting to find %v, got %v", criteria, found)
+				}
+			}
+		})
+	}
+}
+
+func TestMatchesAllOfChain(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(huskySwagger), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	husky := swagger.FindSchemaByName("Husky")
+	newHusky := func() map[string]interface{} {
+		return map[string]interface{}{"name": "balto", "petType": "Husky", "bark": 2.0, "sled": true, "eyes": "blue"}
+	}
+	if !husky.Matches(newHusky(), false, swagger) {
+		t.Error("husky doesn't match its composed schema")
+	}
+	if required := husky.GetRequired(swagger); len(required) != 3 {
+		t.Errorf("expecting the required lists of the chain to be unioned, got %v", required)
+	}
+	if properties := husky.GetProperties(swagger); len(properties) != 5 {
+		t.Errorf("expecting the properties of the chain to be merged, got %v", properties)
+	}
+	for field, value := range map[string]interface{}{"name": nil, "petType": nil, "sled": "yes", "bark": "loud", "eyes": 3.0} {
+		obj := newHusky()
+		if value == nil {
+			delete(obj, field)
+		} else {
+			obj[field] = value
+		}
+		if husky.Matches(obj, false, swagger) {
+			t.Errorf("husky with %s %v matches", field, value)
+		}
+	}
+
+	// The discriminator names a subtype two levels down.
+	if subtypes := swagger.GetSubtypes("Animal"); len(subtypes) != 2 || subtypes[0] != "Dog" || subtypes[1] != "Husky" {
+		t.Errorf("expecting Dog and Husky as subtypes of Animal, got %v", subtypes)
+	}
+	animalRef := &Schema{}
+	animalRef.Ref = spec.MustCreateRef("#/definitions/Animal")
+	collection := make(map[string][]interface{})
+	err = animalRef.Parses("", newHusky(), collection, true, false, swagger)
+	if err != nil || len(collection["Husky"]) != 1 {
+		t.Errorf("husky should be collected as Husky, got %v, err %v", collection, err)
+	}
+
+	db := &DB{}
+	db.Init(swagger)
+	for i := 0; i < 10; i++ {
+		if name, _ := db.FindMatchingSchema(newHusky()); name != "Husky" {
+			t.Fatalf("expecting the composed subtype to match, got %s", name)
+		}
+	}
+}
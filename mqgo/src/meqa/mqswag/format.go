@@ -0,0 +1,166 @@
+package mqswag
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Whether we check the format (date, date-time, uuid, email, uri, ipv4, ipv6, byte, int32, int64) of the
+// values when matching objects against schemas. Off by default, servers are frequently lenient about formats.
+var CheckFormat = false
+
+// FormatError is a value that doesn't conform to the format of its schema.
+type FormatError struct {
+	Property string // the path of the property in the object, e.g. "owner.email"
+	Format   string
+	Value    interface{}
+}
+
+func (e *FormatError) Error() string {
+	if len(e.Property) == 0 {
+		return fmt.Sprintf("%v is not a valid %s", e.Value, e.Format)
+	}
+	return fmt.Sprintf("property %s: %v is not a valid %s", e.Property, e.Value, e.Format)
+}
+
+// AddProperty puts the name of the property the value belongs to in front of the error's property path.
+func (e *FormatError) AddProperty(name string) {
+	if len(e.Property) == 0 {
+		e.Property = name
+	} else {
+		e.Property = name + "." + e.Property
+	}
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// formatCheckers holds the checkers for the formats we know about. Formats not in here are
+// always considered valid.
+var formatCheckers = map[string]func(string) bool{
+	"date": func(s string) bool {
+		_, err := time.Parse("2006-01-02", s)
+		return err == nil
+	},
+	"date-time": func(s string) bool {
+		_, err := time.Parse(time.RFC3339, s)
+		return err == nil
+	},
+	"uuid": func(s string) bool {
+		return uuidRegexp.MatchString(s)
+	},
+	"email": func(s string) bool {
+		addr, err := mail.ParseAddress(s)
+		return err == nil && addr.Address == s
+	},
+	"ipv4": func(s string) bool {
+		ip := net.ParseIP(s)
+		return ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	},
+	"ipv6": func(s string) bool {
+		return net.ParseIP(s) != nil && strings.Contains(s, ":")
+	},
+	"uri": func(s string) bool {
+		u, err := url.Parse(s)
+		return err == nil && u.IsAbs()
+	},
+	"byte": func(s string) bool {
+		_, err := base64.StdEncoding.DecodeString(s)
+		return err == nil
+	},
+}
+
+// CheckStringFormat returns an error if the string doesn't conform to the format.
+func CheckStringFormat(format string, str string) error {
+	checker := formatCheckers[format]
+	if checker == nil || checker(str) {
+		return nil
+	}
+	return &FormatError{"", format, str}
+}
+
+// CheckNumberFormat returns an error if the number is not an integer in the range of the int32 or
+// int64 format.
+func CheckNumberFormat(format string, number interface{}) error {
+	var min, max int64
+	switch format {
+	case "int32":
+		min, max = math.MinInt32, math.MaxInt32
+	case "int64":
+		min, max = math.MinInt64, math.MaxInt64
+	default:
+		return nil
+	}
+	valid := true
+	switch n := number.(type) {
+	case json.Number:
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		valid = err == nil && i >= min && i <= max
+	default:
+		v := reflect.ValueOf(number)
+		switch {
+		case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+			valid = v.Int() >= min && v.Int() <= max
+		case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+			valid = v.Uint() <= uint64(max)
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			// float64 can't hold all the int64 values, 2^63 is the first one that's out of range.
+			f := v.Float()
+			valid = f == math.Trunc(f) && f >= float64(min) && f < -float64(min)
+		}
+	}
+	if !valid {
+		return &FormatError{"", format, number}
+	}
+	return nil
+}
+
+// The relative tolerance when checking that a floating point number is a multiple of multipleOf, e.g. 0.3 is
+// 2.9999999999999996 times 0.1.
+const multipleOfEpsilon = 1e-9
+
+// IsMultipleOf returns whether the number, an int, a float or a json.Number, is a whole multiple of multipleOf.
+// The values that aren't numbers, and a multipleOf that isn't positive, are not checked.
+func IsMultipleOf(number interface{}, multipleOf float64) bool {
+	if multipleOf <= 0 {
+		return true
+	}
+	var f float64
+	switch n := number.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(n.String(), 10, 64); err == nil && multipleOf == math.Trunc(multipleOf) &&
+			multipleOf <= math.MaxInt64 {
+			return i%int64(multipleOf) == 0
+		}
+		var err error
+		if f, err = n.Float64(); err != nil {
+			return true
+		}
+	default:
+		v := reflect.ValueOf(number)
+		switch {
+		case v.Kind() >= reflect.Int && v.Kind() <= reflect.Int64:
+			if multipleOf == math.Trunc(multipleOf) && multipleOf <= math.MaxInt64 {
+				return v.Int()%int64(multipleOf) == 0
+			}
+			f = float64(v.Int())
+		case v.Kind() >= reflect.Uint && v.Kind() <= reflect.Uint64:
+			f = float64(v.Uint())
+		case v.Kind() == reflect.Float32 || v.Kind() == reflect.Float64:
+			f = v.Float()
+		default:
+			return true
+		}
+	}
+	q := f / multipleOf
+	return math.Abs(q-math.Round(q)) <= multipleOfEpsilon*math.Max(1, math.Abs(q))
+}
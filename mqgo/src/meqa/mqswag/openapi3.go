@@ -0,0 +1,691 @@
+package mqswag
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"meqa/mqutil"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This file converts OpenAPI 3.0 documents to Swagger 2.0, so the rest of meqa works on them unchanged.
+// The documents are converted in their JSON form: components.schemas become definitions, the requestBody
+// becomes a body (or formData) parameter, and the first server becomes the host, basePath and schemes.
+// The servers are kept under ExtServers, so the plan can pick another one and fill in its variables.
+// Of the content types of a body, application/json is picked when it's there.
+
+const jsonContentType = "application/json"
+
+// IsOpenAPI3 checks whether the JSON document is an OpenAPI 3.x document.
+func IsOpenAPI3(doc []byte) bool {
+	var header struct {
+		OpenAPI string `json:"openapi"`
+	}
+	if json.Unmarshal(doc, &header) != nil {
+		return false
+	}
+	return strings.HasPrefix(header.OpenAPI, "3.")
+}
+
+// ConvertOpenAPI3 converts the OpenAPI 3.x JSON document to a Swagger 2.0 JSON document.
+func ConvertOpenAPI3(doc []byte) ([]byte, error) {
+	d := json.NewDecoder(bytes.NewReader(doc))
+	d.UseNumber()
+	var src map[string]interface{}
+	if err := d.Decode(&src); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid OpenAPI 3 document: %s", err.Error()))
+	}
+	c := &openAPI3Converter{}
+	c.components, _ = src["components"].(map[string]interface{})
+
+	dst := map[string]interface{}{"swagger": "2.0"}
+	for _, key := range []string{"info", "tags", "security", "externalDocs"} {
+		if src[key] != nil {
+			dst[key] = c.convertRefs(src[key])
+		}
+	}
+	for k, v := range src {
+		if strings.HasPrefix(k, "x-") {
+			dst[k] = v
+		}
+	}
+	if err := c.convertServers(src, dst); err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]interface{})
+	srcPaths, _ := src["paths"].(map[string]interface{})
+	for path, item := range srcPaths {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths[path] = c.convertPathItem(itemMap)
+	}
+	dst["paths"] = paths
+
+	if schemas := c.component("schemas"); len(schemas) > 0 {
+		definitions := make(map[string]interface{})
+		for name, schema := range schemas {
+			definitions[name] = c.convertSchema(schema)
+		}
+		dst["definitions"] = definitions
+	}
+	if params := c.component("parameters"); len(params) > 0 {
+		converted := make(map[string]interface{})
+		for name, param := range params {
+			if p, ok := param.(map[string]interface{}); ok {
+				converted[name] = c.convertParameter(p)
+			}
+		}
+		dst["parameters"] = converted
+	}
+	if responses := c.component("responses"); len(responses) > 0 {
+		converted := make(map[string]interface{})
+		for name, resp := range responses {
+			if r, ok := resp.(map[string]interface{}); ok {
+				converted[name] = c.convertResponse(r, nil)
+			}
+		}
+		dst["responses"] = converted
+	}
+	if schemes := c.component("securitySchemes"); len(schemes) > 0 {
+		converted := make(map[string]interface{})
+		for name, scheme := range schemes {
+			if s, ok := scheme.(map[string]interface{}); ok {
+				if def := convertSecurityScheme(s); def != nil {
+					converted[name] = def
+				}
+			}
+		}
+		dst["securityDefinitions"] = converted
+	}
+	return json.Marshal(dst)
+}
+
+type openAPI3Converter struct {
+	components map[string]interface{}
+}
+
+func (c *openAPI3Converter) component(kind string) map[string]interface{} {
+	m, _ := c.components[kind].(map[string]interface{})
+	return m
+}
+
+// resolve follows a local $ref to the components, e.g. #/components/requestBodies/Pet. The objects that
+// aren't references are returned as they are.
+func (c *openAPI3Converter) resolve(obj map[string]interface{}) map[string]interface{} {
+	for i := 0; i < 10; i++ {
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return obj
+		}
+		ar := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		if len(ar) != 2 {
+			return obj
+		}
+		referred, ok := c.component(ar[0])[ar[1]].(map[string]interface{})
+		if !ok {
+			return obj
+		}
+		obj = referred
+	}
+	return obj
+}
+
+// convertRef points a $ref to the components at its Swagger 2.0 location.
+func convertRef(ref string) string {
+	ref = strings.Replace(ref, "#/components/schemas/", "#/definitions/", 1)
+	ref = strings.Replace(ref, "#/components/parameters/", "#/parameters/", 1)
+	return strings.Replace(ref, "#/components/responses/", "#/responses/", 1)
+}
+
+// convertRefs copies the value, pointing the $refs to the components at their Swagger 2.0 locations.
+func (c *openAPI3Converter) convertRefs(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, entry := range v {
+			if ref, ok := entry.(string); ok && k == "$ref" {
+				m[k] = convertRef(ref)
+			} else {
+				m[k] = c.convertRefs(entry)
+			}
+		}
+		return m
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, entry := range v {
+			a[i] = c.convertRefs(entry)
+		}
+		return a
+	}
+	return value
+}
+
+// convertServers keeps the servers under ExtServers, and sets the host, basePath and schemes from the first
+// one. When a variable of the first server has no default, they're left unset until the plan supplies it.
+func (c *openAPI3Converter) convertServers(src map[string]interface{}, dst map[string]interface{}) error {
+	servers, _ := src["servers"].([]interface{})
+	if len(servers) == 0 {
+		return nil
+	}
+	dst[ExtServers] = servers
+	var server Server
+	serverBytes, _ := json.Marshal(servers[0])
+	if err := json.Unmarshal(serverBytes, &server); err != nil {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid server %s: %s", serverBytes, err.Error()))
+	}
+	serverURL, err := server.Resolve(nil)
+	if err != nil {
+		mqutil.Logger.Printf("the base url is left to the plan: %s", err.Error())
+		return nil
+	}
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid server url %s: %s", serverURL, err.Error()))
+	}
+	if len(u.Host) > 0 {
+		dst["host"] = u.Host
+	}
+	if len(u.Scheme) > 0 {
+		dst["schemes"] = []interface{}{u.Scheme}
+	}
+	if len(u.Path) > 0 && u.Path != "/" {
+		dst["basePath"] = strings.TrimSuffix(u.Path, "/")
+	}
+	return nil
+}
+
+// ExtServers keeps the servers of an OpenAPI 3 document in the converted Swagger 2.0 document.
+const ExtServers = "x-meqa-servers"
+
+// Server is an OpenAPI 3 server. Its url can have variables in braces, e.g. https://{region}.example.com/{basePath}.
+type Server struct {
+	URL       string                    `json:"url"`
+	Variables map[string]ServerVariable `json:"variables,omitempty"`
+}
+
+// ServerVariable is a variable of a server url, with its default value and the values it can take.
+type ServerVariable struct {
+	Default interface{}   `json:"default,omitempty"`
+	Enum    []interface{} `json:"enum,omitempty"`
+}
+
+var serverVariableRegexp = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// Resolve fills in the variables of the server's url with the values given, or their defaults. It's an error
+// for a variable to have neither, or to have a value not in its enum.
+func (server *Server) Resolve(values map[string]interface{}) (string, error) {
+	var err error
+	resolved := serverVariableRegexp.ReplaceAllStringFunc(server.URL, func(match string) string {
+		name := match[1 : len(match)-1]
+		variable := server.Variables[name]
+		value, ok := values[name]
+		if !ok || value == nil {
+			value = variable.Default
+		}
+		if value == nil {
+			if err == nil {
+				err = mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+					"server variable %s of %s has neither a value in serverVariables nor a default", name, server.URL))
+			}
+			return match
+		}
+		str := fmt.Sprint(value)
+		if len(variable.Enum) > 0 && !stringsContain(interfacesToStrings(variable.Enum), str) {
+			if err == nil {
+				err = mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf(
+					"server variable %s of %s is %s, expecting one of %v", name, server.URL, str, variable.Enum))
+			}
+			return match
+		}
+		return str
+	})
+	if err != nil {
+		return "", err
+	}
+	return resolved, nil
+}
+
+func interfacesToStrings(ar []interface{}) []string {
+	var strs []string
+	for _, entry := range ar {
+		strs = append(strs, fmt.Sprint(entry))
+	}
+	return strs
+}
+
+// GetServers returns the servers of the OpenAPI 3 document the swagger was converted from.
+func (swagger *Swagger) GetServers() ([]Server, error) {
+	raw, ok := swagger.Extensions[ExtServers]
+	if !ok {
+		return nil, nil
+	}
+	var servers []Server
+	serverBytes, _ := json.Marshal(raw)
+	if err := json.Unmarshal(serverBytes, &servers); err != nil {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("invalid servers %s: %s", serverBytes, err.Error()))
+	}
+	return servers, nil
+}
+
+// ResolveServerURL picks one of the OpenAPI 3 servers and fills in its variables. The selector is either the
+// index of the server or a substring of its url, and picks the first server when it's empty. Returns an empty
+// string when the document has no servers.
+func (swagger *Swagger) ResolveServerURL(selector string, values map[string]interface{}) (string, error) {
+	servers, err := swagger.GetServers()
+	if err != nil || len(servers) == 0 {
+		return "", err
+	}
+	server := &servers[0]
+	if i, convErr := strconv.Atoi(selector); convErr == nil {
+		if i < 0 || i >= len(servers) {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("server %d not found, the spec has %d servers",
+				i, len(servers)))
+		}
+		server = &servers[i]
+	} else if len(selector) > 0 {
+		var matches []string
+		for i := range servers {
+			if strings.Contains(servers[i].URL, selector) {
+				matches = append(matches, servers[i].URL)
+				server = &servers[i]
+			}
+		}
+		if len(matches) != 1 {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("expecting exactly one server url containing %s, found %v",
+				selector, matches))
+		}
+	}
+	return server.Resolve(values)
+}
+
+func (c *openAPI3Converter) convertPathItem(item map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{})
+	for k, v := range item {
+		switch {
+		case k == "parameters":
+			if params := c.convertParameters(v); len(params) > 0 {
+				dst[k] = params
+			}
+		case strings.HasPrefix(k, "x-"):
+			dst[k] = v
+		case k == "summary" || k == "description" || k == "servers":
+		default:
+			if op, ok := v.(map[string]interface{}); ok {
+				dst[k] = c.convertOperation(op)
+			}
+		}
+	}
+	return dst
+}
+
+func (c *openAPI3Converter) convertOperation(op map[string]interface{}) map[string]interface{} {
+	dst := make(map[string]interface{})
+	for _, key := range []string{"tags", "summary", "description", "operationId", "deprecated", "security", "externalDocs"} {
+		if op[key] != nil {
+			dst[key] = c.convertRefs(op[key])
+		}
+	}
+	for k, v := range op {
+		if strings.HasPrefix(k, "x-") {
+			dst[k] = v
+		}
+	}
+	params := c.convertParameters(op["parameters"])
+	if body, ok := op["requestBody"].(map[string]interface{}); ok {
+		body = c.resolve(body)
+		contentType, media := pickContent(body["content"])
+		if media != nil {
+			dst["consumes"] = []interface{}{contentType}
+			schema, _ := media["schema"].(map[string]interface{})
+			if contentType == "application/x-www-form-urlencoded" || contentType == "multipart/form-data" {
+				params = append(params, c.formParameters(schema)...)
+			} else {
+				param := map[string]interface{}{"name": "body", "in": "body", "schema": c.convertSchema(schema)}
+				if body["description"] != nil {
+					param["description"] = body["description"]
+				}
+				if body["required"] != nil {
+					param["required"] = body["required"]
+				}
+				params = append(params, param)
+			}
+		}
+	}
+	if len(params) > 0 {
+		dst["parameters"] = params
+	}
+
+	responses := make(map[string]interface{})
+	produces := make(map[string]bool)
+	srcResponses, _ := op["responses"].(map[string]interface{})
+	for status, resp := range srcResponses {
+		if r, ok := resp.(map[string]interface{}); ok {
+			if _, isRef := r["$ref"]; isRef {
+				responses[status] = c.convertRefs(r)
+				continue
+			}
+			responses[status] = c.convertResponse(r, produces)
+		}
+	}
+	dst["responses"] = responses
+	if len(produces) > 0 {
+		var types []string
+		for t := range produces {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		var ar []interface{}
+		for _, t := range types {
+			ar = append(ar, t)
+		}
+		dst["produces"] = ar
+	}
+	return dst
+}
+
+func (c *openAPI3Converter) convertResponse(resp map[string]interface{}, produces map[string]bool) map[string]interface{} {
+	dst := map[string]interface{}{"description": ""}
+	if resp["description"] != nil {
+		dst["description"] = resp["description"]
+	}
+	contentType, media := pickContent(resp["content"])
+	if media != nil {
+		if produces != nil {
+			produces[contentType] = true
+		}
+		if schema, ok := media["schema"].(map[string]interface{}); ok {
+			dst["schema"] = c.convertSchema(schema)
+		}
+	}
+	if headers, ok := resp["headers"].(map[string]interface{}); ok {
+		converted := make(map[string]interface{})
+		for name, header := range headers {
+			if h, ok := header.(map[string]interface{}); ok {
+				h = c.resolve(h)
+				dstHeader := c.flattenSchema(h["schema"])
+				if h["description"] != nil {
+					dstHeader["description"] = h["description"]
+				}
+				converted[name] = dstHeader
+			}
+		}
+		dst["headers"] = converted
+	}
+	return dst
+}
+
+// pickContent picks application/json from the content map of a body, or the first content type if
+// there is no JSON.
+func pickContent(content interface{}) (string, map[string]interface{}) {
+	contentMap, _ := content.(map[string]interface{})
+	if media, ok := contentMap[jsonContentType].(map[string]interface{}); ok {
+		return jsonContentType, media
+	}
+	var types []string
+	for t := range contentMap {
+		types = append(types, t)
+	}
+	if len(types) == 0 {
+		return "", nil
+	}
+	sort.Strings(types)
+	for _, t := range types {
+		// e.g. application/problem+json or application/json; charset=utf-8
+		if strings.Contains(t, "json") {
+			media, _ := contentMap[t].(map[string]interface{})
+			return t, media
+		}
+	}
+	media, _ := contentMap[types[0]].(map[string]interface{})
+	return types[0], media
+}
+
+func (c *openAPI3Converter) convertParameters(params interface{}) []interface{} {
+	ar, ok := params.([]interface{})
+	if !ok {
+		return nil
+	}
+	var dst []interface{}
+	for _, param := range ar {
+		p, ok := param.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if _, isRef := p["$ref"]; isRef {
+			if resolved := c.resolve(p); resolved["in"] == "cookie" {
+				continue
+			}
+			dst = append(dst, c.convertRefs(p))
+			continue
+		}
+		if p["in"] == "cookie" {
+			mqutil.Logger.Printf("cookie parameter %v is not supported, skipping it", p["name"])
+			continue
+		}
+		dst = append(dst, c.convertParameter(p))
+	}
+	return dst
+}
+
+// convertParameter moves the parameter's schema into the parameter, and its style into collectionFormat.
+func (c *openAPI3Converter) convertParameter(param map[string]interface{}) map[string]interface{} {
+	dst := c.flattenSchema(param["schema"])
+	if _, content := pickContent(param["content"]); content != nil {
+		dst = c.flattenSchema(content["schema"])
+	}
+	for _, key := range []string{"name", "in", "description", "required", "allowEmptyValue"} {
+		if param[key] != nil {
+			dst[key] = param[key]
+		}
+	}
+	for k, v := range param {
+		if strings.HasPrefix(k, "x-") {
+			dst[k] = v
+		}
+	}
+	if dst["type"] == "array" {
+		explode, hasExplode := param["explode"].(bool)
+		switch param["style"] {
+		case "spaceDelimited":
+			dst["collectionFormat"] = "ssv"
+		case "pipeDelimited":
+			dst["collectionFormat"] = "pipes"
+		case "form", nil:
+			// form is the default style of query parameters, and it explodes by default.
+			if param["in"] == "query" && (!hasExplode || explode) {
+				dst["collectionFormat"] = "multi"
+			} else {
+				dst["collectionFormat"] = "csv"
+			}
+		default:
+			dst["collectionFormat"] = "csv"
+		}
+	}
+	return dst
+}
+
+// formParameters turns the properties of a form body's schema into formData parameters.
+func (c *openAPI3Converter) formParameters(schema map[string]interface{}) []interface{} {
+	schema = c.resolve(schema)
+	required := make(map[string]bool)
+	if ar, ok := schema["required"].([]interface{}); ok {
+		for _, name := range ar {
+			required[fmt.Sprint(name)] = true
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	var names []string
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var params []interface{}
+	for _, name := range names {
+		param := c.flattenSchema(properties[name])
+		if param["type"] == "string" && (param["format"] == "binary" || param["format"] == "base64") {
+			param["type"] = "file"
+			delete(param, "format")
+		}
+		param["name"] = name
+		param["in"] = "formData"
+		if required[name] {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+	return params
+}
+
+// flattenSchema converts the schema of a non-body parameter or a header to the fields that Swagger 2.0
+// puts in the parameter or header itself.
+func (c *openAPI3Converter) flattenSchema(schema interface{}) map[string]interface{} {
+	dst := make(map[string]interface{})
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		dst["type"] = "string"
+		return dst
+	}
+	s = c.resolve(s)
+	for k, v := range s {
+		switch k {
+		case "items":
+			dst[k] = c.flattenSchema(v)
+		case "nullable", "readOnly", "writeOnly", "example", "xml", "externalDocs", "title", "additionalProperties",
+			"properties", "required", "oneOf", "anyOf", "allOf", "not", "discriminator", "deprecated":
+		default:
+			dst[k] = v
+		}
+	}
+	if dst["type"] == nil {
+		dst["type"] = "string"
+	}
+	convertExclusiveBounds(dst)
+	return dst
+}
+
+// convertSchema converts the keywords of an OpenAPI 3.0 schema that Swagger 2.0 doesn't have. The nullable
+// and writeOnly properties become the x-nullable and x-meqa-writeOnly extensions meqa understands.
+func (c *openAPI3Converter) convertSchema(schema interface{}) interface{} {
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return c.convertRefs(schema)
+	}
+	dst := make(map[string]interface{})
+	for k, v := range s {
+		switch k {
+		case "$ref":
+			if ref, ok := v.(string); ok {
+				dst[k] = convertRef(ref)
+			}
+		case "nullable":
+			dst[ExtNullable] = v
+		case "writeOnly":
+			dst[ExtWriteOnly] = v
+		case "discriminator":
+			if d, ok := v.(map[string]interface{}); ok {
+				dst[k] = d["propertyName"]
+			} else {
+				dst[k] = v
+			}
+		case "properties", "patternProperties":
+			if m, ok := v.(map[string]interface{}); ok {
+				properties := make(map[string]interface{})
+				for name, p := range m {
+					properties[name] = c.convertSchema(p)
+				}
+				dst[k] = properties
+			}
+		case "items", "additionalProperties", "not":
+			dst[k] = c.convertSchema(v)
+		case "allOf", "oneOf", "anyOf":
+			if ar, ok := v.([]interface{}); ok {
+				schemas := make([]interface{}, len(ar))
+				for i, entry := range ar {
+					schemas[i] = c.convertSchema(entry)
+				}
+				dst[k] = schemas
+			}
+		default:
+			dst[k] = c.convertRefs(v)
+		}
+	}
+	convertExclusiveBounds(dst)
+	return dst
+}
+
+// convertExclusiveBounds converts the numeric exclusiveMinimum and exclusiveMaximum of OpenAPI 3.1 to a minimum
+// and a maximum with the boolean flags of Swagger 2.0. When the schema has both a minimum and a numeric
+// exclusiveMinimum, the stricter one is kept, and the same for the maximum.
+func convertExclusiveBounds(dst map[string]interface{}) {
+	for _, pair := range [][2]string{{"minimum", "exclusiveMinimum"}, {"maximum", "exclusiveMaximum"}} {
+		bound, exclusive := pair[0], pair[1]
+		limit, ok := jsonFloat(dst[exclusive])
+		if !ok {
+			continue
+		}
+		value := dst[exclusive]
+		delete(dst, exclusive)
+		if current, ok := jsonFloat(dst[bound]); ok &&
+			(bound == "minimum" && current > limit || bound == "maximum" && current < limit) {
+			continue
+		}
+		dst[bound] = value
+		dst[exclusive] = true
+	}
+}
+
+// jsonFloat returns the value of the JSON number.
+func jsonFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+func convertSecurityScheme(scheme map[string]interface{}) map[string]interface{} {
+	switch scheme["type"] {
+	case "apiKey":
+		if scheme["in"] == "cookie" {
+			return nil
+		}
+		return map[string]interface{}{"type": "apiKey", "name": scheme["name"], "in": scheme["in"]}
+	case "http":
+		if strings.EqualFold(fmt.Sprint(scheme["scheme"]), "basic") {
+			return map[string]interface{}{"type": "basic"}
+		}
+		// Bearer tokens are sent in the Authorization header.
+		return map[string]interface{}{"type": "apiKey", "name": "Authorization", "in": "header"}
+	case "oauth2":
+		flows, _ := scheme["flows"].(map[string]interface{})
+		for _, names := range [][2]string{{"implicit", "implicit"}, {"password", "password"},
+			{"clientCredentials", "application"}, {"authorizationCode", "accessCode"}} {
+			flow, ok := flows[names[0]].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			def := map[string]interface{}{"type": "oauth2", "flow": names[1], "scopes": flow["scopes"]}
+			if def["scopes"] == nil {
+				def["scopes"] = map[string]interface{}{}
+			}
+			if flow["authorizationUrl"] != nil {
+				def["authorizationUrl"] = flow["authorizationUrl"]
+			}
+			if flow["tokenUrl"] != nil {
+				def["tokenUrl"] = flow["tokenUrl"]
+			}
+			return def
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"meqa/mqutil"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+// openAPI3Pets is a minimal OpenAPI 3.0 document.
+const openAPI3Pets = `{
+	"openapi": "3.0.1",
+	"info": {"title": "pets", "version": "1.0"},
+	"servers": [{"url": "https://{env}.example.com/v1/", "variables": {"env": {"default": "api"}}}],
+	"paths": {
+		"/pets": {
+			"get": {
+				"parameters": [
+					{"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string"}}},
+					{"name": "limit", "in": "query", "required": true, "schema": {"type": "integer", "maximum": 100}},
+					{"name": "session", "in": "cookie", "schema": {"type": "string"}}
+				],
+				"responses": {
+					"200": {
+						"description": "ok",
+						"content": {
+							"application/xml": {"schema": {"type": "string"}},
+							"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Pet"}}}
+						}
+					}
+				}
+			},
+			"post": {
+				"requestBody": {"$ref": "#/components/requestBodies/Pet"},
+				"responses": {"201": {"description": "created", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}}
+			}
+		},
+		"/pets/{id}/photo": {
+			"post": {
+				"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+				"requestBody": {"content": {"multipart/form-data": {"schema": {
+					"type": "object", "required": ["file"],
+					"properties": {"file": {"type": "string", "format": "binary"}, "caption": {"type": "string"}}}}}},
+				"responses": {"200": {"description": "ok"}}
+			}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Pet": {
+				"type": "object",
+				"required": ["name"],
+				"properties": {
+					"id": {"type": "integer", "format": "int64", "readOnly": true},
+					"name": {"type": "string"},
+					"nick": {"type": "string", "nullable": true},
+					"secret": {"type": "string", "writeOnly": true}
+				}
+			}
+		},
+		"requestBodies": {
+			"Pet": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Pet"}}}}
+		},
+		"securitySchemes": {"bearer": {"type": "http", "scheme": "bearer"}}
+	}
+}`
+
+func TestConvertOpenAPI3(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	if !IsOpenAPI3([]byte(openAPI3Pets)) || IsOpenAPI3([]byte(`{"swagger": "2.0"}`)) {
+		t.Fatalf("OpenAPI 3 documents aren't detected")
+	}
+	doc, err := ConvertOpenAPI3([]byte(openAPI3Pets))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	swagger := &Swagger{}
+	if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load the converted document: %v", err)
+	}
+
+	if swagger.Swagger != "2.0" || swagger.Host != "api.example.com" || swagger.BasePath != "/v1" ||
+		len(swagger.Schemes) != 1 || swagger.Schemes[0] != "https" {
+		t.Errorf("servers not converted: %s %s %s %v", swagger.Swagger, swagger.Host, swagger.BasePath, swagger.Schemes)
+	}
+	pet := swagger.FindSchemaByName("Pet")
+	if pet == nil {
+		t.Fatalf("components.schemas not converted to definitions")
+	}
+	nick, secret := pet.Properties["nick"], pet.Properties["secret"]
+	if !(*Schema)(&nick).IsNullable() || !(*Schema)(&secret).IsWriteOnly() || !pet.Properties["id"].ReadOnly {
+		t.Errorf("nullable, writeOnly or readOnly not converted: %v", pet.Properties)
+	}
+
+	get := swagger.Paths.Paths["/pets"].Get
+	if len(get.Parameters) != 2 {
+		t.Fatalf("expecting the cookie parameter to be dropped, got %v", get.Parameters)
+	}
+	tags, limit := get.Parameters[0], get.Parameters[1]
+	if tags.Type != "array" || tags.Items.Type != "string" || tags.CollectionFormat != "multi" {
+		t.Errorf("array query parameter not converted: %+v", tags)
+	}
+	if limit.Type != "integer" || !limit.Required || limit.Maximum == nil || *limit.Maximum != 100 {
+		t.Errorf("query parameter not converted: %+v", limit)
+	}
+	resp := get.Responses.StatusCodeResponses[200]
+	if resp.Schema == nil || resp.Schema.Items == nil || resp.Schema.Items.Schema.Ref.String() != "#/definitions/Pet" {
+		t.Errorf("expecting the application/json response schema, got %+v", resp.Schema)
+	}
+
+	post := swagger.Paths.Paths["/pets"].Post
+	if len(post.Parameters) != 1 || post.Parameters[0].In != "body" || !post.Parameters[0].Required ||
+		post.Parameters[0].Schema.Ref.String() != "#/definitions/Pet" {
+		t.Errorf("requestBody not converted to a body parameter: %+v", post.Parameters)
+	}
+
+	photo := swagger.Paths.Paths["/pets/{id}/photo"].Post
+	if len(photo.Parameters) != 3 || photo.Parameters[1].Name != "caption" || photo.Parameters[1].In != "formData" ||
+		photo.Parameters[2].Type != "file" || !photo.Parameters[2].Required || photo.Consumes[0] != "multipart/form-data" {
+		t.Errorf("form requestBody not converted to formData parameters: %+v", photo.Parameters)
+	}
+
+	if swagger.SecurityDefinitions["bearer"] == nil || swagger.SecurityDefinitions["bearer"].In != "header" {
+		t.Errorf("bearer security scheme not converted: %v", swagger.SecurityDefinitions)
+	}
+}
+
+func TestConvertExclusiveBounds(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	doc, err := ConvertOpenAPI3([]byte(`{
+		"openapi": "3.1.0",
+		"info": {"title": "bounds", "version": "1.0"},
+		"paths": {"/items": {"get": {
+			"parameters": [{"name": "price", "in": "query",
+				"schema": {"type": "number", "exclusiveMinimum": 0, "exclusiveMaximum": 100}}],
+			"responses": {"200": {"description": "ok"}}}}},
+		"components": {"schemas": {"Item": {"type": "object", "properties": {
+			"age": {"type": "integer", "minimum": 5, "exclusiveMinimum": 0},
+			"score": {"type": "number", "minimum": 0, "exclusiveMinimum": 0, "maximum": 10, "exclusiveMaximum": 5},
+			"legacy": {"type": "integer", "minimum": 1, "exclusiveMinimum": true}}}}}
+	}`))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	swagger := &Swagger{}
+	if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load the converted document: %v", err)
+	}
+
+	bounds := func(min *float64, exclusiveMin bool, max *float64, exclusiveMax bool) string {
+		str := func(f *float64) string {
+			if f == nil {
+				return "nil"
+			}
+			return fmt.Sprint(*f)
+		}
+		return fmt.Sprintf("%s %v %s %v", str(min), exclusiveMin, str(max), exclusiveMax)
+	}
+	price := swagger.Paths.Paths["/items"].Get.Parameters[0]
+	if b := bounds(price.Minimum, price.ExclusiveMinimum, price.Maximum, price.ExclusiveMaximum); b != "0 true 100 true" {
+		t.Errorf("expecting the parameter's numeric bounds to be exclusive, got %s", b)
+	}
+	item := swagger.FindSchemaByName("Item")
+	for name, expected := range map[string]string{
+		// The stricter of the two forms wins.
+		"age":    "5 false nil false",
+		"score":  "0 true 5 true",
+		"legacy": "1 true nil false",
+	} {
+		p := item.Properties[name]
+		if b := bounds(p.Minimum, p.ExclusiveMinimum, p.Maximum, p.ExclusiveMaximum); b != expected {
+			t.Errorf("%s: expecting the bounds %s, got %s", name, expected, b)
+		}
+	}
+}
+
+func TestResolveServerURL(t *testing.T) {
+	mqutil.NewLogger(ioutil.Discard)
+	doc, err := ConvertOpenAPI3([]byte(`{
+		"openapi": "3.0.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"servers": [
+			{"url": "https://{region}.api.example.com/{basePath}", "variables": {
+				"region": {"enum": ["us-east-1", "eu-west-1"]},
+				"basePath": {"default": "v2"}}},
+			{"url": "https://staging.example.com/v1"}
+		],
+		"paths": {}
+	}`))
+	if err != nil {
+		t.Fatalf("conversion failed: %v", err)
+	}
+	swagger := &Swagger{}
+	if err = json.Unmarshal(doc, (*spec.Swagger)(swagger)); err != nil {
+		t.Fatalf("can't load the converted document: %v", err)
+	}
+	if len(swagger.Host) != 0 {
+		t.Errorf("expecting the host to be left to the plan when a variable has no default, got %s", swagger.Host)
+	}
+
+	region := map[string]interface{}{"region": "eu-west-1"}
+	cases := []struct {
+		selector string
+		values   map[string]interface{}
+		expected string
+	}{
+		{"", region, "https://eu-west-1.api.example.com/v2"},
+		{"0", map[string]interface{}{"region": "us-east-1", "basePath": "v3"}, "https://us-east-1.api.example.com/v3"},
+		{"1", nil, "https://staging.example.com/v1"},
+		{"staging", nil, "https://staging.example.com/v1"},
+	}
+	for _, c := range cases {
+		u, err := swagger.ResolveServerURL(c.selector, c.values)
+		if err != nil || u != c.expected {
+			t.Errorf("server %q with %v: expecting %s, got %s, err %v", c.selector, c.values, c.expected, u, err)
+		}
+	}
+
+	for _, c := range []struct {
+		selector string
+		values   map[string]interface{}
+	}{
+		{"", nil},
+		{"", map[string]interface{}{"region": "ap-south-1"}},
+		{"2", region},
+		{"example.com", region},
+		{"prod", region},
+	} {
+		if u, err := swagger.ResolveServerURL(c.selector, c.values); err == nil {
+			t.Errorf("server %q with %v: expecting an error, got %s", c.selector, c.values, u)
+		}
+	}
+}
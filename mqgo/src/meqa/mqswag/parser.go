@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/go-openapi/loads"
@@ -39,14 +40,48 @@ var MethodAll []string = []string{MethodGet, MethodPut, MethodPost, MethodDelete
 const (
 	FlagSuccess = 1 << iota
 	FlagFail
-	FlagWeak
+	FlagWeak      // the referred object may not exist yet, a fresh value is fine
+	FlagNoCompare // the value isn't compared with the server's objects
+	FlagNoFake    // the value isn't a fake one picked by the property name, even with realisticData
+	FlagAllEnums  // the tests run once per value of the parameter's enum
 )
 
+// tagFlags maps the names of the flags in the meqa tags to their values.
+var tagFlags = map[string]int64{
+	"success":   FlagSuccess,
+	"fail":      FlagFail,
+	"weak":      FlagWeak,
+	"nocompare": FlagNoCompare,
+	"nofake":    FlagNoFake,
+	"allenums":  FlagAllEnums,
+}
+
+// tagGenerator is the prefix of the generator name in the meqa tags, e.g. generator:vin.
+const tagGenerator = "generator:"
+
+// parseTagFlags parses the comma separated flags, e.g. weak,nocompare. The unknown flags are logged and
+// ignored, so the tags written for newer versions still work.
+func parseTagFlags(str string, desc string) int64 {
+	var flags int64
+	for _, name := range strings.Split(str, ",") {
+		if len(name) == 0 {
+			continue
+		}
+		if f, ok := tagFlags[name]; ok {
+			flags |= f
+		} else {
+			mqutil.Logger.Printf("warning: unknown flag %s in meqa tag: %s", name, desc)
+		}
+	}
+	return flags
+}
+
 type MeqaTag struct {
 	Class     string
 	Property  string
 	Operation string
 	Flags     int64
+	Generator string // the name of the generator of the values, from generator:<name>
 }
 
 func (t *MeqaTag) Equals(o *MeqaTag) bool {
@@ -67,11 +102,13 @@ func (t *MeqaTag) ToString() string {
 
 // GetMeqaTag extracts the <meqa > tags.
 // Example. for  <meqa Pet.Name.update>, return Pet, Name, update
+// The flags follow the tag, e.g. <meqa Pet.id weak>, or are its fourth part, e.g. <meqa Pet.id.get.weak,nocompare>.
+// A generator:<name> after the tag, or on its own, e.g. <meqa generator:vin>, names the generator of the values.
 func GetMeqaTag(desc string) *MeqaTag {
 	if len(desc) == 0 {
 		return nil
 	}
-	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]* *[a-zA-Z,]* *>")
+	re := regexp.MustCompile("<meqa *[/-~\\-]+\\.?[/-~\\-]*\\.?[a-zA-Z]*(\\.[a-zA-Z,]*)?( +[a-zA-Z0-9,:_\\-]*)* *>")
 	ar := re.FindAllString(desc, -1)
 
 	// TODO it's possible that we have multiple choices because the server can't be
@@ -89,15 +126,15 @@ func GetMeqaTag(desc string) *MeqaTag {
 	meqa = strings.Trim(meqa[:right], " ")
 	tags := strings.Split(meqa, " ")
 	var flags int64
-	var objtags string
+	var objtags, generator string
 	for _, t := range tags {
 		if len(t) > 0 {
-			if t == "success" {
-				flags |= FlagSuccess
-			} else if t == "fail" {
-				flags |= FlagFail
-			} else if t == "weak" {
-				flags |= FlagWeak
+			if f, ok := tagFlags[t]; ok {
+				flags |= f
+			} else if strings.HasPrefix(t, tagGenerator) {
+				generator = t[len(tagGenerator):]
+			} else if strings.Contains(t, ",") && !strings.Contains(t, ".") {
+				flags |= parseTagFlags(t, desc)
 			} else {
 				objtags = t
 			}
@@ -105,19 +142,89 @@ func GetMeqaTag(desc string) *MeqaTag {
 	}
 
 	contents := strings.Split(objtags, ".")
+	if len(contents) == 4 {
+		flags |= parseTagFlags(contents[3], desc)
+		contents = contents[:3]
+	}
 	switch len(contents) {
 	case 1:
-		return &MeqaTag{contents[0], "", "", flags}
+		return &MeqaTag{contents[0], "", "", flags, generator}
 	case 2:
-		return &MeqaTag{contents[0], contents[1], "", flags}
+		return &MeqaTag{contents[0], contents[1], "", flags, generator}
 	case 3:
-		return &MeqaTag{contents[0], contents[1], contents[2], flags}
+		return &MeqaTag{contents[0], contents[1], contents[2], flags, generator}
 	default:
 		mqutil.Logger.Printf("invalid meqa tag in description: %s", desc)
 		return nil
 	}
 }
 
+// The vendor extensions that can be used instead of the <meqa> tag in the description, so the tags don't show up
+// in the docs, e.g. x-meqa-class: Pet, x-meqa-property: id, x-meqa-op: post, x-meqa-generator: vin.
+const (
+	ExtClass     = "x-meqa-class"
+	ExtProperty  = "x-meqa-property"
+	ExtOp        = "x-meqa-op"
+	ExtGenerator = "x-meqa-generator"
+)
+
+// GetTag gets the meqa tag of the operation, parameter, schema or response from its x-meqa-* extensions, or the
+// <meqa> tag in its description. The extensions win when there are both. The flags, e.g. success, only come
+// from the description. The generator comes from either.
+func GetTag(obj interface{}) *MeqaTag {
+	var desc string
+	var extensions spec.Extensions
+	switch o := obj.(type) {
+	case *spec.Operation:
+		desc, extensions = o.Description, o.Extensions
+	case *spec.Parameter:
+		desc, extensions = o.Description, o.Extensions
+	case *spec.Schema:
+		desc, extensions = o.Description, o.Extensions
+	case *Schema:
+		desc, extensions = o.Description, o.Extensions
+	case *spec.Response:
+		desc, extensions = o.Description, o.Extensions
+	}
+	tag := GetMeqaTag(desc)
+	class := getStringExtension(extensions, ExtClass)
+	property := getStringExtension(extensions, ExtProperty)
+	op := strings.ToLower(getStringExtension(extensions, ExtOp))
+	generator := getStringExtension(extensions, ExtGenerator)
+	if len(class) == 0 && len(property) == 0 && len(op) == 0 {
+		if len(generator) > 0 {
+			if tag == nil {
+				tag = &MeqaTag{}
+			}
+			tag.Generator = generator
+		}
+		return tag
+	}
+	extTag := &MeqaTag{class, property, op, 0, generator}
+	if tag != nil {
+		if !tag.Equals(extTag) {
+			mqutil.Logger.Printf("warning: both the %s tag in the description and the x-meqa extensions %s are present, "+
+				"using the extensions", tag.ToString(), extTag.ToString())
+		}
+		extTag.Flags = tag.Flags
+		if len(generator) == 0 {
+			extTag.Generator = tag.Generator
+		}
+	}
+	return extTag
+}
+
+// getStringExtension returns the value of the string extension. The extension names are case insensitive.
+func getStringExtension(extensions spec.Extensions, name string) string {
+	for k, v := range extensions {
+		if strings.EqualFold(k, name) {
+			str, _ := v.(string)
+			return str
+		}
+	}
+	return ""
+}
+
 type Swagger spec.Swagger
 
 // Init from a file
@@ -131,22 +238,33 @@ func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
 	}
 	defer os.Remove(tmpPath)
 
-	// If input is yaml, transform to json
+	// If input is yaml, transform to json. OpenAPI 3 documents are converted to swagger 2.
 	var swaggerJsonPath string
 	ar := strings.Split(path, ".")
-	if ar[len(ar)-1] == "json" {
-		swaggerJsonPath = path
-	} else {
-		yamlBytes, err := ioutil.ReadFile(path)
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		mqutil.Logger.Printf("can't read file %s", path)
+		return nil, err
+	}
+	jsonBytes := fileBytes
+	if ar[len(ar)-1] != "json" {
+		jsonBytes, err = mqutil.YamlToJson(fileBytes)
 		if err != nil {
-			mqutil.Logger.Printf("can't read file %s", path)
+			mqutil.Logger.Printf("invalid yaml in file %s %v", path, err)
 			return nil, err
 		}
-		jsonBytes, err := mqutil.YamlToJson(yamlBytes)
+	}
+	openAPI3 := IsOpenAPI3(jsonBytes)
+	if openAPI3 {
+		jsonBytes, err = ConvertOpenAPI3(jsonBytes)
 		if err != nil {
-			mqutil.Logger.Printf("invalid yaml in file %s %v", path, err)
+			mqutil.Logger.Printf("can't convert the OpenAPI 3 document %s %v", path, err)
 			return nil, err
 		}
+	}
+	if ar[len(ar)-1] == "json" && !openAPI3 {
+		swaggerJsonPath = path
+	} else {
 		_, err = tmpFile.Write(jsonBytes)
 		if err != nil {
 			mqutil.Logger.Printf("can't access tmp file %s", tmpPath)
@@ -164,7 +282,14 @@ func CreateSwaggerFromURL(path string, meqaPath string) (*Swagger, error) {
 
 	// log.Println("Would be serving:", specDoc.Spec().Info.Title)
 
-	return (*Swagger)(specDoc.Spec()), nil
+	swagger := (*Swagger)(specDoc.Spec())
+	err = swagger.ResolveExternalRefs(path)
+	if err != nil {
+		mqutil.Logger.Printf("Can't resolve the external references in %s", path)
+		mqutil.Logger.Println(err.Error())
+		return nil, err
+	}
+	return swagger, nil
 }
 
 func GetWhitelistSuites(path string) (map[string]bool, error) {
@@ -190,6 +315,24 @@ func (swagger *Swagger) FindSchemaByName(name string) *Schema {
 	return (*Schema)(&schema)
 }
 
+// GetConsumes returns the media types the operation accepts in request bodies. The operation's own list
+// overrides the spec's global one.
+func (swagger *Swagger) GetConsumes(op *spec.Operation) []string {
+	if op != nil && len(op.Consumes) > 0 {
+		return op.Consumes
+	}
+	return swagger.Consumes
+}
+
+// GetProduces returns the media types the operation responds with. The operation's own list overrides the
+// spec's global one.
+func (swagger *Swagger) GetProduces(op *spec.Operation) []string {
+	if op != nil && len(op.Produces) > 0 {
+		return op.Produces
+	}
+	return swagger.Produces
+}
+
 // GetReferredSchema returns what the schema refers to, and nil if it doesn't refer to any.
 func (swagger *Swagger) GetReferredSchema(schema *Schema) (string, *Schema, error) {
 	if schema.Ref.GetURL() == nil {
@@ -209,11 +352,70 @@ func (swagger *Swagger) GetReferredSchema(schema *Schema) (string, *Schema, erro
 	return tokens[1], referredSchema, nil
 }
 
+// GetSubtypes returns the names of the definitions that extend the base definition through allOf, directly or
+// through other subtypes, sorted. Only a base with a discriminator has subtypes.
+func (swagger *Swagger) GetSubtypes(base string) []string {
+	baseSchema := swagger.FindSchemaByName(base)
+	if baseSchema == nil || len(baseSchema.Discriminator) == 0 {
+		return nil
+	}
+	found := map[string]bool{base: true}
+	var subtypes []string
+	for parents := []string{base}; len(parents) > 0; {
+		var children []string
+		for name, schema := range swagger.Definitions {
+			if found[name] {
+				continue
+			}
+			for _, s := range schema.AllOf {
+				referenceName, _, err := swagger.GetReferredSchema((*Schema)(&s))
+				if err == nil && stringsContain(parents, referenceName) {
+					found[name] = true
+					children = append(children, name)
+					break
+				}
+			}
+		}
+		subtypes = append(subtypes, children...)
+		parents = children
+	}
+	sort.Strings(subtypes)
+	return subtypes
+}
+
+func stringsContain(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDiscriminatedSubtype returns the subtype of the base definition the object's discriminator names,
+// or nil if the object doesn't name a subtype.
+func (swagger *Swagger) GetDiscriminatedSubtype(base string, baseSchema *Schema, object interface{}) (string, *Schema) {
+	objMap, ok := object.(map[string]interface{})
+	if !ok || len(baseSchema.Discriminator) == 0 {
+		return "", nil
+	}
+	subtype, ok := objMap[baseSchema.Discriminator].(string)
+	if !ok || subtype == base {
+		return "", nil
+	}
+	for _, name := range swagger.getIndexedSubtypes(base) {
+		if name == subtype {
+			return name, swagger.FindSchemaByName(name)
+		}
+	}
+	return "", nil
+}
+
 // GetSchemaRootType gets the real object type fo the specified schema. It only returns meaningful
 // data for object and array of object type of parameters. If the parameter is a basic type it returns
 // nil
 func (swagger *Swagger) GetSchemaRootType(schema *Schema, parentTag *MeqaTag) (*MeqaTag, *Schema) {
-	tag := GetMeqaTag(schema.Description)
+	tag := GetTag(schema)
 	if tag == nil {
 		tag = parentTag
 	}
@@ -224,7 +426,7 @@ func (swagger *Swagger) GetSchemaRootType(schema *Schema, parentTag *MeqaTag) (*
 	}
 	if referredSchema != nil {
 		if tag == nil {
-			tag = &MeqaTag{referenceName, "", "", 0}
+			tag = &MeqaTag{Class: referenceName}
 		}
 		return swagger.GetSchemaRootType(referredSchema, tag)
 	}
@@ -294,7 +496,7 @@ func (dep *Dependencies) CollectFromTag(tag *MeqaTag) string {
 // the specified map.
 func CollectSchemaDependencies(schema *Schema, swagger *Swagger, dag *DAG, dep *Dependencies) error {
 	iterFunc := func(swagger *Swagger, schemaName string, schema *Schema, context interface{}) error {
-		collected := dep.CollectFromTag(GetMeqaTag(schema.Description))
+		collected := dep.CollectFromTag(GetTag(schema))
 		if len(collected) == 0 && len(schemaName) > 0 {
 			dep.Default[schemaName] = 1
 		}
@@ -317,13 +519,13 @@ func CollectParamDependencies(params []spec.Parameter, swagger *Swagger, dag *DA
 		} else {
 			dep.Default = dep.Consumes
 		}
-		collected := dep.CollectFromTag(GetMeqaTag(param.Description))
+		collected := dep.CollectFromTag(GetTag(&param))
 
 		if param.Schema != nil {
 			var schema *Schema
 			schema = (*Schema)(param.Schema)
 			if len(collected) == 0 {
-				collected = dep.CollectFromTag(GetMeqaTag(schema.Description))
+				collected = dep.CollectFromTag(GetTag(schema))
 			}
 			if len(collected) > 0 {
 				// Only try to collect addition info from the object schema if the object is not
@@ -371,7 +573,7 @@ func CollectResponseDependencies(responses *spec.Responses, swagger *Swagger, da
 	dep.Default = make(map[string]interface{}) // We don't assume by default anything so we throw Default away.
 	defer func() { dep.Default = nil }()
 	for respCode, respSpec := range responses.StatusCodeResponses {
-		collected := dep.CollectFromTag(GetMeqaTag(respSpec.Description))
+		collected := dep.CollectFromTag(GetTag(&respSpec))
 		if len(collected) > 0 {
 			continue
 		}
@@ -418,7 +620,7 @@ func AddOperation(pathName string, pathItem *spec.PathItem, method string, swagg
 	// The nodes that are part of outputs depends on this operation. The outputs are children.
 	// We have to be careful here. Get operations will also return objects. For gets, the outputs
 	// are children only if they are not part of input parameters.
-	tag := GetMeqaTag(op.Description)
+	tag := GetTag(op)
 	dep := &Dependencies{}
 	dep.Produces = make(map[string]interface{})
 	dep.Consumes = make(map[string]interface{})
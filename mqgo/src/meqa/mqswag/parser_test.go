@@ -0,0 +1,88 @@
+package mqswag
+
+import (
+	"bytes"
+	"meqa/mqutil"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestGetTagFromExtensions(t *testing.T) {
+	var log bytes.Buffer
+	mqutil.NewLogger(&log)
+
+	param := &spec.Parameter{}
+	param.Description = "Pet id to delete"
+	param.Extensions = spec.Extensions{"x-meqa-class": "Pet", "x-meqa-property": "id"}
+	if tag := GetTag(param); tag == nil || tag.ToString() != "<meqa Pet.id>" {
+		t.Errorf("expecting <meqa Pet.id> from the extensions, got %v", tag)
+	}
+
+	op := &spec.Operation{}
+	op.Description = "Update a pet <meqa Pet.name.put weak>"
+	op.Extensions = spec.Extensions{"x-meqa-class": "Pet", "X-Meqa-Op": "POST"}
+	tag := GetTag(op)
+	if tag == nil || tag.ToString() != "<meqa Pet.post>" || tag.Flags&FlagWeak == 0 {
+		t.Errorf("expecting the extensions to win and keep the weak flag, got %v", tag)
+	}
+	if !strings.Contains(log.String(), "using the extensions") {
+		t.Errorf("expecting a warning about both the tag and the extensions, got %s", log.String())
+	}
+
+	schema := &Schema{}
+	schema.Description = "<meqa Order>"
+	if tag := GetTag(schema); tag == nil || tag.Class != "Order" {
+		t.Errorf("expecting the description tag without extensions, got %v", tag)
+	}
+	if tag := GetTag(&spec.Response{}); tag != nil {
+		t.Errorf("expecting no tag, got %v", tag)
+	}
+}
+
+func TestGetMeqaTagFlags(t *testing.T) {
+	var log bytes.Buffer
+	mqutil.NewLogger(&log)
+
+	tag := GetMeqaTag("Pet id <meqa Pet.id.get.weak,nocompare>")
+	if tag == nil || tag.ToString() != "<meqa Pet.id.get>" || tag.Flags != FlagWeak|FlagNoCompare {
+		t.Errorf("expecting Pet.id.get with the weak and nocompare flags, got %v", tag)
+	}
+	tag = GetMeqaTag("<meqa Pet.id weak,nocompare>")
+	if tag == nil || tag.ToString() != "<meqa Pet.id>" || tag.Flags != FlagWeak|FlagNoCompare {
+		t.Errorf("expecting Pet.id with the weak and nocompare flags, got %v", tag)
+	}
+	tag = GetMeqaTag("<meqa Pet.id..fail>")
+	if tag == nil || tag.ToString() != "<meqa Pet.id>" || tag.Flags != FlagFail {
+		t.Errorf("expecting Pet.id with the fail flag, got %v", tag)
+	}
+	if len(log.String()) > 0 {
+		t.Errorf("expecting no warnings, got %s", log.String())
+	}
+
+	// The unknown flags are ignored with a warning.
+	tag = GetMeqaTag("<meqa Pet.id.get.weak,sticky>")
+	if tag == nil || tag.Class != "Pet" || tag.Flags != FlagWeak {
+		t.Errorf("expecting Pet.id.get with the weak flag, got %v", tag)
+	}
+	if !strings.Contains(log.String(), "unknown flag sticky") {
+		t.Errorf("expecting a warning about the unknown flag, got %s", log.String())
+	}
+}
+
+func TestGetMeqaTagGenerator(t *testing.T) {
+	tag := GetMeqaTag("The VIN <meqa generator:vin>")
+	if tag == nil || tag.Generator != "vin" || len(tag.Class) > 0 {
+		t.Errorf("expecting the vin generator, got %v", tag)
+	}
+	tag = GetMeqaTag("<meqa Car.vin weak generator:vin-17>")
+	if tag == nil || tag.ToString() != "<meqa Car.vin>" || tag.Flags != FlagWeak || tag.Generator != "vin-17" {
+		t.Errorf("expecting Car.vin with the weak flag and the vin-17 generator, got %v", tag)
+	}
+	tag = GetTag(&spec.Schema{VendorExtensible: spec.VendorExtensible{Extensions: spec.Extensions{
+		ExtGenerator: "ulid"}}})
+	if tag == nil || tag.Generator != "ulid" {
+		t.Errorf("expecting the ulid generator from the extension, got %v", tag)
+	}
+}
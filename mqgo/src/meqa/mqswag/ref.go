@@ -0,0 +1,366 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"meqa/mqutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-openapi/spec"
+)
+
+// This file resolves the $refs that point outside of the swagger spec, e.g. "./definitions/pet.json#/Pet"
+// or "https://example.com/models.yml#/definitions/Pet". The referred schemas are merged into the swagger's
+// definitions, and the $refs are rewritten to point to them, so the rest of the code only deals with the
+// local "#/definitions/..." refs.
+
+// Whether we fetch $refs that point to http(s) URLs.
+var FetchRemoteRefs = true
+
+// How long we wait for a remote $ref to be fetched.
+var RemoteRefTimeout = 10 * time.Second
+
+// The most bytes we read of a remote $ref's document.
+var RemoteRefMaxSize int64 = 10 * 1024 * 1024
+
+type refResolver struct {
+	swagger *Swagger
+	baseDir string                 // the directory of the swagger spec file
+	docs    map[string]interface{} // the external documents loaded, by location
+	names   map[string]string      // the external ref (location#fragment) to the definition name
+}
+
+// ResolveExternalRefs resolves all the external schema refs in the swagger spec. Relative file refs are
+// resolved against the directory of the spec file at specPath.
+func (swagger *Swagger) ResolveExternalRefs(specPath string) error {
+	r := &refResolver{swagger, filepath.Dir(specPath), make(map[string]interface{}), make(map[string]string)}
+	if swagger.Definitions == nil {
+		swagger.Definitions = make(spec.Definitions)
+	}
+
+	var names []string
+	for name := range swagger.Definitions {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		schema := swagger.Definitions[name]
+		err := r.resolveSchema(&schema, "")
+		if err != nil {
+			return err
+		}
+		swagger.Definitions[name] = schema
+	}
+
+	for name, param := range swagger.Parameters {
+		if param.Schema != nil {
+			err := r.resolveSchema(param.Schema, "")
+			if err != nil {
+				return err
+			}
+			swagger.Parameters[name] = param
+		}
+	}
+	for _, resp := range swagger.Responses {
+		if resp.Schema != nil {
+			err := r.resolveSchema(resp.Schema, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if swagger.Paths == nil {
+		return nil
+	}
+	for _, pathItem := range swagger.Paths.Paths {
+		err := r.resolveParams(pathItem.Parameters)
+		if err != nil {
+			return err
+		}
+		for _, method := range MethodAll {
+			opInterface, _ := pathItem.JSONLookup(method)
+			op, _ := opInterface.(*spec.Operation)
+			if op == nil {
+				continue
+			}
+			err = r.resolveParams(op.Parameters)
+			if err != nil {
+				return err
+			}
+			if op.Responses == nil {
+				continue
+			}
+			if op.Responses.Default != nil && op.Responses.Default.Schema != nil {
+				err = r.resolveSchema(op.Responses.Default.Schema, "")
+				if err != nil {
+					return err
+				}
+			}
+			for _, resp := range op.Responses.StatusCodeResponses {
+				if resp.Schema != nil {
+					err = r.resolveSchema(resp.Schema, "")
+					if err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (r *refResolver) resolveParams(params []spec.Parameter) error {
+	for i := range params {
+		if params[i].Schema != nil {
+			err := r.resolveSchema(params[i].Schema, "")
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveSchema goes through the schema and all its sub-schemas. The location is where the schema comes
+// from, empty for the swagger spec itself.
+func (r *refResolver) resolveSchema(schema *spec.Schema, location string) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref.GetURL() != nil && len(schema.Ref.String()) > 0 {
+		name, err := r.resolveRef(schema.Ref.GetURL(), location)
+		if err != nil {
+			return err
+		}
+		if len(name) > 0 {
+			schema.Ref = spec.MustCreateRef("#/definitions/" + name)
+		}
+	}
+
+	for k, v := range schema.Properties {
+		err := r.resolveSchema(&v, location)
+		if err != nil {
+			return err
+		}
+		schema.Properties[k] = v
+	}
+	for i := range schema.AllOf {
+		err := r.resolveSchema(&schema.AllOf[i], location)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range schema.OneOf {
+		err := r.resolveSchema(&schema.OneOf[i], location)
+		if err != nil {
+			return err
+		}
+	}
+	for i := range schema.AnyOf {
+		err := r.resolveSchema(&schema.AnyOf[i], location)
+		if err != nil {
+			return err
+		}
+	}
+	if schema.Items != nil {
+		err := r.resolveSchema(schema.Items.Schema, location)
+		if err != nil {
+			return err
+		}
+		for i := range schema.Items.Schemas {
+			err = r.resolveSchema(&schema.Items.Schemas[i], location)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if schema.AdditionalItems != nil {
+		err := r.resolveSchema(schema.AdditionalItems.Schema, location)
+		if err != nil {
+			return err
+		}
+	}
+	for k, v := range schema.PatternProperties {
+		err := r.resolveSchema(&v, location)
+		if err != nil {
+			return err
+		}
+		schema.PatternProperties[k] = v
+	}
+	if schema.AdditionalProperties != nil {
+		err := r.resolveSchema(schema.AdditionalProperties.Schema, location)
+		if err != nil {
+			return err
+		}
+	}
+	return r.resolveSchema(schema.Not, location)
+}
+
+// resolveRef makes sure the schema the ref points to is in the definitions. Returns the definition's name,
+// or "" if the ref is a local ref in the swagger spec that needs no change.
+func (r *refResolver) resolveRef(u *url.URL, location string) (string, error) {
+	isLocal := len(u.Scheme) == 0 && len(u.Host) == 0 && len(u.Path) == 0
+	if isLocal && len(location) == 0 {
+		return "", nil
+	}
+
+	docLocation := location
+	if !isLocal {
+		var err error
+		docLocation, err = r.getLocation(u, location)
+		if err != nil {
+			return "", err
+		}
+	}
+	key := docLocation + "#" + u.Fragment
+	if name, ok := r.names[key]; ok {
+		// Already resolved, or being resolved if the refs are circular.
+		return name, nil
+	}
+
+	doc, err := r.loadDoc(docLocation)
+	if err != nil {
+		return "", err
+	}
+	tokens := strings.Split(strings.Trim(u.Fragment, "/"), "/")
+	if len(u.Fragment) == 0 || u.Fragment == "/" {
+		tokens = nil
+	}
+	found := doc
+	for _, token := range tokens {
+		token = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+		m, ok := found.(map[string]interface{})
+		if !ok || m[token] == nil {
+			return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object not found: %s", key))
+		}
+		found = m[token]
+	}
+	schemaBytes, err := json.Marshal(found)
+	if err != nil {
+		return "", err
+	}
+	schema := spec.Schema{}
+	err = json.Unmarshal(schemaBytes, &schema)
+	if err != nil {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Reference object is not a schema: %s, %s", key, err.Error()))
+	}
+
+	name := r.getDefinitionName(docLocation, tokens)
+	r.names[key] = name
+	r.swagger.Definitions[name] = schema
+	err = r.resolveSchema(&schema, docLocation)
+	if err != nil {
+		return "", err
+	}
+	r.swagger.Definitions[name] = schema
+	return name, nil
+}
+
+// getDefinitionName picks a name for the external schema that doesn't collide with existing definitions. The
+// names taken get a number, e.g. Pet_2, and the numbered names are checked as well, so a local Pet_2 stays.
+func (r *refResolver) getDefinitionName(docLocation string, tokens []string) string {
+	var base string
+	if len(tokens) > 0 {
+		base = tokens[len(tokens)-1]
+	} else {
+		base = filepath.Base(docLocation)
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	name := base
+	for i := 2; ; i++ {
+		if _, exist := r.swagger.Definitions[name]; !exist {
+			return name
+		}
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+}
+
+// getLocation returns the absolute location (file path or URL) of the document the ref points to.
+func (r *refResolver) getLocation(u *url.URL, location string) (string, error) {
+	docURL := *u
+	docURL.Fragment = ""
+	if docURL.Scheme == "http" || docURL.Scheme == "https" {
+		return docURL.String(), nil
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		base, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(&docURL).String(), nil
+	}
+	if len(docURL.Scheme) > 0 && docURL.Scheme != "file" {
+		return "", mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Unsupported reference: %s", u.String()))
+	}
+	if filepath.IsAbs(docURL.Path) {
+		return filepath.Clean(docURL.Path), nil
+	}
+	dir := r.baseDir
+	if len(location) > 0 {
+		dir = filepath.Dir(location)
+	}
+	return filepath.Join(dir, docURL.Path), nil
+}
+
+func (r *refResolver) loadDoc(location string) (interface{}, error) {
+	if doc, ok := r.docs[location]; ok {
+		return doc, nil
+	}
+	var docBytes []byte
+	var err error
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		if !FetchRemoteRefs {
+			return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("Fetching remote reference is disabled: %s", location))
+		}
+		docBytes, err = fetchRemoteDoc(location)
+	} else {
+		docBytes, err = ioutil.ReadFile(location)
+	}
+	if err != nil {
+		mqutil.Logger.Printf("can't load referenced document %s", location)
+		return nil, err
+	}
+
+	var doc interface{}
+	err = json.Unmarshal(docBytes, &doc)
+	if err != nil {
+		jsonBytes, yamlErr := mqutil.YamlToJson(docBytes)
+		if yamlErr != nil {
+			mqutil.Logger.Printf("invalid yaml in referenced document %s %v", location, yamlErr)
+			return nil, yamlErr
+		}
+		err = json.Unmarshal(jsonBytes, &doc)
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.docs[location] = doc
+	return doc, nil
+}
+
+func fetchRemoteDoc(location string) ([]byte, error) {
+	client := http.Client{Timeout: RemoteRefTimeout}
+	resp, err := client.Get(location)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, mqutil.NewError(mqutil.ErrHttp, fmt.Sprintf("fetching %s failed, status %d", location, resp.StatusCode))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, RemoteRefMaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > RemoteRefMaxSize {
+		return nil, mqutil.NewError(mqutil.ErrInvalid, fmt.Sprintf("fetching %s failed, the document is over %d bytes",
+			location, RemoteRefMaxSize))
+	}
+	return body, nil
+}
@@ -0,0 +1,124 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestResolveExternalRefNames(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meqa-ref")
+	if err != nil {
+		t.Fatalf("can't create the temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	// Both files define a Pet, and the spec has its own Pet and Pet_2 already.
+	files := map[string]string{
+		"cats.json": `{"Pet": {"type": "object", "properties": {"meow": {"type": "string"}}}}`,
+		"dogs.json": `{"Pet": {"type": "object", "properties": {"bark": {"type": "string"}}}}`,
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("can't write %s: %v", name, err)
+		}
+	}
+	swagger := &Swagger{}
+	err = json.Unmarshal([]byte(`{"swagger": "2.0", "info": {"title": "pets", "version": "1"}, "paths": {}, "definitions": {
+		"Pet": {"type": "object", "properties": {"name": {"type": "string"}}},
+		"Pet_2": {"type": "object", "properties": {"tag": {"type": "string"}}},
+		"Cat": {"$ref": "cats.json#/Pet"},
+		"Dog": {"$ref": "dogs.json#/Pet"}}}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	if err = swagger.ResolveExternalRefs(filepath.Join(dir, "swagger.json")); err != nil {
+		t.Fatalf("can't resolve the refs: %v", err)
+	}
+
+	if _, ok := swagger.Definitions["Pet"].Properties["name"]; !ok {
+		t.Errorf("expecting the local Pet to be kept, got %v", swagger.Definitions["Pet"].Properties)
+	}
+	if _, ok := swagger.Definitions["Pet_2"].Properties["tag"]; !ok {
+		t.Errorf("expecting the local Pet_2 to be kept, got %v", swagger.Definitions["Pet_2"].Properties)
+	}
+	refs := map[string]string{}
+	for _, name := range []string{"Cat", "Dog"} {
+		schema := swagger.Definitions[name]
+		ref := schema.Ref.String()
+		refName := strings.TrimPrefix(ref, "#/definitions/")
+		if refName == "Pet" || refName == "Pet_2" || refName == ref {
+			t.Errorf("expecting %s to refer to a new definition, got %s", name, ref)
+		}
+		refs[name] = refName
+	}
+	if refs["Cat"] == refs["Dog"] {
+		t.Errorf("expecting the two external Pets to get different names, got %v", refs)
+	}
+	if _, ok := swagger.Definitions[refs["Cat"]].Properties["meow"]; !ok {
+		t.Errorf("expecting %s to be the cats' Pet, got %v", refs["Cat"], swagger.Definitions[refs["Cat"]].Properties)
+	}
+	if _, ok := swagger.Definitions[refs["Dog"]].Properties["bark"]; !ok {
+		t.Errorf("expecting %s to be the dogs' Pet, got %v", refs["Dog"], swagger.Definitions[refs["Dog"]].Properties)
+	}
+}
+
+func TestResolveExternalRefKeywords(t *testing.T) {
+	dir, err := ioutil.TempDir("", "meqa-ref")
+	if err != nil {
+		t.Fatalf("can't create the temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	defs := `{"Cat": {"type": "object"}, "Dog": {"type": "object"}, "Tag": {"type": "string"}}`
+	if err = ioutil.WriteFile(filepath.Join(dir, "defs.json"), []byte(defs), 0644); err != nil {
+		t.Fatalf("can't write defs.json: %v", err)
+	}
+	swagger := &Swagger{}
+	err = json.Unmarshal([]byte(`{"swagger": "2.0", "info": {"title": "pets", "version": "1"}, "paths": {}, "definitions": {
+		"NotCat": {"not": {"$ref": "defs.json#/Cat"}},
+		"Pair": {"type": "array", "items": [{"type": "string"}], "additionalItems": {"$ref": "defs.json#/Dog"}},
+		"Labels": {"type": "object", "patternProperties": {"^x-": {"$ref": "defs.json#/Tag"}}}}}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+	if err = swagger.ResolveExternalRefs(filepath.Join(dir, "swagger.json")); err != nil {
+		t.Fatalf("can't resolve the refs: %v", err)
+	}
+
+	refs := map[string]string{
+		"Cat": swagger.Definitions["NotCat"].Not.Ref.String(),
+		"Dog": swagger.Definitions["Pair"].AdditionalItems.Schema.Ref.String(),
+		"Tag": func() string { s := swagger.Definitions["Labels"].PatternProperties["^x-"]; return s.Ref.String() }(),
+	}
+	for name, ref := range refs {
+		if ref != "#/definitions/"+name {
+			t.Errorf("expecting the ref to %s to be resolved, got %s", name, ref)
+		}
+		if _, ok := swagger.Definitions[name]; !ok {
+			t.Errorf("expecting %s in the definitions", name)
+		}
+	}
+}
+
+func TestFetchRemoteDocLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Pet": {"type": "object", "description": "` + strings.Repeat("x", 100) + `"}}`))
+	}))
+	defer server.Close()
+	defer func(size int64) { RemoteRefMaxSize = size }(RemoteRefMaxSize)
+
+	RemoteRefMaxSize = 1000
+	if body, err := fetchRemoteDoc(server.URL); err != nil || !strings.Contains(string(body), "Pet") {
+		t.Errorf("expecting the document, got %s, %v", body, err)
+	}
+	RemoteRefMaxSize = 50
+	if _, err := fetchRemoteDoc(server.URL); err == nil || !strings.Contains(err.Error(), "over 50 bytes") {
+		t.Errorf("expecting the document to be over the limit, got %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package mqswag
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-openapi/spec"
+)
+
+// ValidationIssue is a problem in the swagger spec that would make the tests fail in confusing ways, e.g. a
+// $ref that doesn't resolve or a parameter without a type.
+type ValidationIssue struct {
+	Location string // JSON pointer to the entity in the swagger document
+	Message  string
+}
+
+func (issue ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s", issue.Location, issue.Message)
+}
+
+type validator struct {
+	swagger      *Swagger
+	operationIds map[string]string // operationId to the location of the first operation using it
+	issues       []ValidationIssue
+}
+
+func (v *validator) add(location string, format string, args ...interface{}) {
+	v.issues = append(v.issues, ValidationIssue{location, fmt.Sprintf(format, args...)})
+}
+
+// sortedKeys returns the names in the map of definitions, parameters, responses or paths, sorted.
+func sortedKeys(m interface{}) []string {
+	var names []string
+	switch mm := m.(type) {
+	case spec.Definitions:
+		for name := range mm {
+			names = append(names, name)
+		}
+	case map[string]spec.Schema:
+		for name := range mm {
+			names = append(names, name)
+		}
+	case map[string]spec.Parameter:
+		for name := range mm {
+			names = append(names, name)
+		}
+	case map[string]spec.Response:
+		for name := range mm {
+			names = append(names, name)
+		}
+	case map[string]spec.PathItem:
+		for name := range mm {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate walks all the definitions, parameters, responses and paths of the swagger spec, and returns the
+// unresolved $refs, parameters without types, body parameters without schemas, enums without types, 2xx
+// responses without schemas and duplicate operationIds. A 204 response, and the responses of a head operation,
+// don't need a schema.
+func (swagger *Swagger) Validate() []ValidationIssue {
+	v := &validator{swagger: swagger, operationIds: make(map[string]string)}
+	for _, name := range sortedKeys(swagger.Definitions) {
+		schema := swagger.Definitions[name]
+		v.validateSchema(&schema, "#/definitions/"+escapePointer(name))
+	}
+	for _, name := range sortedKeys(swagger.Parameters) {
+		param := swagger.Parameters[name]
+		v.validateParam(&param, "#/parameters/"+escapePointer(name))
+	}
+	for _, name := range sortedKeys(swagger.Responses) {
+		resp := swagger.Responses[name]
+		v.validateResponse(&resp, "#/responses/"+escapePointer(name), false)
+	}
+	if swagger.Paths == nil {
+		return v.issues
+	}
+	for _, name := range sortedKeys(swagger.Paths.Paths) {
+		pathItem := swagger.Paths.Paths[name]
+		location := "#/paths/" + escapePointer(name)
+		for i := range pathItem.Parameters {
+			v.validateParam(&pathItem.Parameters[i], fmt.Sprintf("%s/parameters/%d", location, i))
+		}
+		for _, method := range MethodAll {
+			opInterface, _ := pathItem.JSONLookup(method)
+			op, _ := opInterface.(*spec.Operation)
+			if op == nil {
+				continue
+			}
+			v.validateOperation(op, location+"/"+method, method)
+		}
+	}
+	return v.issues
+}
+
+func (v *validator) validateOperation(op *spec.Operation, location string, method string) {
+	if len(op.ID) > 0 {
+		if first, exist := v.operationIds[op.ID]; exist {
+			v.add(location, "operationId %s is already used by %s", op.ID, first)
+		} else {
+			v.operationIds[op.ID] = location
+		}
+	}
+	for i := range op.Parameters {
+		v.validateParam(&op.Parameters[i], fmt.Sprintf("%s/parameters/%d", location, i))
+	}
+	if op.Responses == nil {
+		return
+	}
+	if op.Responses.Default != nil {
+		v.validateResponse(op.Responses.Default, location+"/responses/default", false)
+	}
+	var codes []int
+	for code := range op.Responses.StatusCodeResponses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		resp := op.Responses.StatusCodeResponses[code]
+		needsSchema := code >= 200 && code < 300 && code != 204 && method != MethodHead
+		v.validateResponse(&resp, fmt.Sprintf("%s/responses/%d", location, code), needsSchema)
+	}
+}
+
+// resolveLocalRef checks that the $ref points to an entity of the kind, e.g. parameters, at the top of the spec.
+func (v *validator) resolveLocalRef(ref spec.Ref, kind string, location string) {
+	tokens := ref.GetPointer().DecodedTokens()
+	found := false
+	if len(tokens) == 2 && tokens[0] == kind {
+		switch kind {
+		case "parameters":
+			_, found = v.swagger.Parameters[tokens[1]]
+		case "responses":
+			_, found = v.swagger.Responses[tokens[1]]
+		}
+	}
+	if !found {
+		v.add(location, "unresolved $ref %s", ref.String())
+	}
+}
+
+func (v *validator) validateParam(param *spec.Parameter, location string) {
+	if param.Ref.GetURL() != nil {
+		v.resolveLocalRef(param.Ref, "parameters", location)
+		return
+	}
+	if param.In == "body" {
+		if param.Schema == nil {
+			v.add(location, "body parameter %s doesn't have a schema", param.Name)
+			return
+		}
+		v.validateSchema(param.Schema, location+"/schema")
+		return
+	}
+	if len(param.Type) == 0 {
+		v.add(location, "parameter %s (in %s) doesn't have a type", param.Name, param.In)
+	} else if param.Type == "array" && (param.Items == nil || len(param.Items.Type) == 0) {
+		v.add(location, "array parameter %s (in %s) doesn't have an items type", param.Name, param.In)
+	}
+}
+
+func (v *validator) validateResponse(resp *spec.Response, location string, needsSchema bool) {
+	if resp.Ref.GetURL() != nil {
+		v.resolveLocalRef(resp.Ref, "responses", location)
+		return
+	}
+	if resp.Schema == nil {
+		if needsSchema {
+			v.add(location, "success response doesn't have a schema")
+		}
+		return
+	}
+	v.validateSchema(resp.Schema, location+"/schema")
+}
+
+// validateSchema checks the schema's $ref and enum, and goes through all its sub-schemas.
+func (v *validator) validateSchema(schema *spec.Schema, location string) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref.GetURL() != nil {
+		if _, _, err := v.swagger.GetReferredSchema((*Schema)(schema)); err != nil {
+			v.add(location, "unresolved $ref %s", schema.Ref.String())
+		}
+		return
+	}
+	if len(schema.Enum) > 0 && len(schema.Type) == 0 {
+		v.add(location, "enum %v doesn't have a type", schema.Enum)
+	}
+
+	var names []string
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s := schema.Properties[name]
+		v.validateSchema(&s, location+"/properties/"+escapePointer(name))
+	}
+	for i := range schema.AllOf {
+		v.validateSchema(&schema.AllOf[i], fmt.Sprintf("%s/allOf/%d", location, i))
+	}
+	for i := range schema.OneOf {
+		v.validateSchema(&schema.OneOf[i], fmt.Sprintf("%s/oneOf/%d", location, i))
+	}
+	for i := range schema.AnyOf {
+		v.validateSchema(&schema.AnyOf[i], fmt.Sprintf("%s/anyOf/%d", location, i))
+	}
+	if schema.Items != nil {
+		v.validateSchema(schema.Items.Schema, location+"/items")
+		for i := range schema.Items.Schemas {
+			v.validateSchema(&schema.Items.Schemas[i], fmt.Sprintf("%s/items/%d", location, i))
+		}
+	}
+	if schema.AdditionalProperties != nil {
+		v.validateSchema(schema.AdditionalProperties.Schema, location+"/additionalProperties")
+	}
+}
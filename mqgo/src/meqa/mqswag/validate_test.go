@@ -0,0 +1,81 @@
+package mqswag
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/go-openapi/spec"
+)
+
+func TestValidate(t *testing.T) {
+	swagger := &Swagger{}
+	err := json.Unmarshal([]byte(`{
+		"swagger": "2.0",
+		"info": {"title": "pets", "version": "1.0"},
+		"paths": {
+			"/pets": {
+				"get": {
+					"operationId": "listPets",
+					"parameters": [
+						{"name": "limit", "in": "query"},
+						{"$ref": "#/parameters/missing"},
+						{"$ref": "#/parameters/offset"}
+					],
+					"responses": {
+						"200": {"description": "ok"},
+						"404": {"description": "not found"}
+					}
+				},
+				"post": {
+					"operationId": "listPets",
+					"parameters": [{"name": "pet", "in": "body"}],
+					"responses": {"201": {"description": "created", "schema": {"$ref": "#/definitions/Pet"}}}
+				},
+				"delete": {
+					"responses": {"204": {"description": "deleted"}, "default": {"$ref": "#/responses/Error"}}
+				}
+			}
+		},
+		"parameters": {
+			"offset": {"name": "offset", "in": "query", "type": "integer"}
+		},
+		"definitions": {
+			"Pet": {
+				"type": "object",
+				"properties": {
+					"status": {"enum": ["available", "sold"]},
+					"owner": {"$ref": "#/definitions/Owner"},
+					"tags": {"type": "array", "items": {"$ref": "#/definitions/Tag"}}
+				}
+			},
+			"Tag": {"type": "object", "properties": {"name": {"type": "string"}}}
+		}
+	}`), (*spec.Swagger)(swagger))
+	if err != nil {
+		t.Fatalf("can't load swagger: %v", err)
+	}
+
+	issues := swagger.Validate()
+	locations := make(map[string]bool)
+	for _, issue := range issues {
+		locations[issue.Location] = true
+	}
+	expected := []string{
+		"#/definitions/Pet/properties/owner",
+		"#/definitions/Pet/properties/status",
+		"#/paths/~1pets/get/parameters/0",
+		"#/paths/~1pets/get/parameters/1",
+		"#/paths/~1pets/get/responses/200",
+		"#/paths/~1pets/post",
+		"#/paths/~1pets/post/parameters/0",
+		"#/paths/~1pets/delete/responses/default",
+	}
+	for _, location := range expected {
+		if !locations[location] {
+			t.Errorf("expecting an issue at %s", location)
+		}
+	}
+	if len(issues) != len(expected) {
+		t.Errorf("expecting %d issues, got %v", len(expected), issues)
+	}
+}
@@ -25,6 +25,7 @@ type Error interface {
 type TypedError struct {
 	errType int
 	errMsg  string
+	message string // the message without the back trace
 }
 
 func (e *TypedError) Error() string {
@@ -35,9 +36,17 @@ func (e *TypedError) Type() int {
 	return e.errType
 }
 
+// ErrorMessage returns the message of the error, without the back trace of a TypedError.
+func ErrorMessage(err error) string {
+	if e, ok := err.(*TypedError); ok {
+		return e.message
+	}
+	return err.Error()
+}
+
 func NewError(errType int, str string) error {
 	buf := string(debug.Stack())
-	err := TypedError{errType, ""}
+	err := TypedError{errType, "", str}
 	err.errMsg = fmt.Sprintf("==== %v ====\nError message:\n%s\nBacktrace:%v", errType, str, buf)
 	return &err
 }
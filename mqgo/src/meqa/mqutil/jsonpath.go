@@ -0,0 +1,173 @@
+package mqutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The JSONPath expressions are evaluated against the decoded JSON values, i.e. maps, arrays and scalars. The
+// supported syntax is the root $, the children .name and ['name'], the array items [0] and [-1], the wildcards
+// .* and [*], and the recursive descent ..name. The filters and the slices aren't supported.
+
+// jsonPathStep is one step of a JSONPath expression. A name of * is the wildcard. When index is set, the step
+// takes the array item instead of the child of the name.
+type jsonPathStep struct {
+	name      string
+	index     *int
+	recursive bool // the step applies to all the descendants, as in ..name
+}
+
+// parseJSONPath splits the JSONPath expression into its steps.
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	invalid := func(reason string) error {
+		return NewError(ErrInvalid, fmt.Sprintf("invalid JSONPath %s: %s", path, reason))
+	}
+	if !strings.HasPrefix(path, "$") {
+		return nil, invalid("expecting it to start with $")
+	}
+	var steps []jsonPathStep
+	rest := path[1:]
+	for len(rest) > 0 {
+		var step jsonPathStep
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			step.recursive = true
+			rest = rest[2:]
+			if strings.HasPrefix(rest, "[") {
+				break
+			}
+			fallthrough
+		case strings.HasPrefix(rest, "."):
+			rest = strings.TrimPrefix(rest, ".")
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid("expecting a name after the dot")
+			}
+			step.name, rest = rest[:end], rest[end:]
+			steps = append(steps, step)
+			continue
+		case !strings.HasPrefix(rest, "["):
+			return nil, invalid(fmt.Sprintf("unexpected %s", rest))
+		}
+
+		// A bracket, after a .. or on its own.
+		end := strings.Index(rest, "]")
+		if end < 0 {
+			return nil, invalid("expecting ]")
+		}
+		inner := strings.TrimSpace(rest[1:end])
+		if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') {
+			// The quoted names can have dots, but not brackets.
+			if inner[len(inner)-1] != inner[0] {
+				return nil, invalid("expecting the closing quote")
+			}
+			step.name = inner[1 : len(inner)-1]
+		} else if inner == "*" {
+			step.name = inner
+		} else {
+			i, err := strconv.Atoi(inner)
+			if err != nil {
+				return nil, invalid(fmt.Sprintf("unsupported [%s], expecting a name, an index or *", inner))
+			}
+			step.index = &i
+		}
+		rest = rest[end+1:]
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// CheckJSONPath returns an error if the JSONPath expression isn't valid or uses unsupported syntax.
+func CheckJSONPath(path string) error {
+	_, err := parseJSONPath(path)
+	return err
+}
+
+// JSONPath returns the values in the document that the JSONPath expression selects, in the document's order with
+// the map keys sorted. It returns no values when nothing matches.
+func JSONPath(doc interface{}, path string) ([]interface{}, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return nil, err
+	}
+	nodes := []interface{}{doc}
+	for _, step := range steps {
+		var next []interface{}
+		for _, node := range nodes {
+			candidates := []interface{}{node}
+			if step.recursive {
+				candidates = jsonDescendants(node, nil)
+			}
+			for _, c := range candidates {
+				next = append(next, jsonPathSelect(c, step)...)
+			}
+		}
+		nodes = next
+	}
+	return nodes, nil
+}
+
+// jsonPathSelect returns the children of the node that the step selects.
+func jsonPathSelect(node interface{}, step jsonPathStep) []interface{} {
+	switch n := node.(type) {
+	case map[string]interface{}:
+		if step.index != nil {
+			return nil
+		}
+		if step.name == "*" {
+			var found []interface{}
+			for _, k := range sortedKeys(n) {
+				found = append(found, n[k])
+			}
+			return found
+		}
+		if v, exist := n[step.name]; exist {
+			return []interface{}{v}
+		}
+	case []interface{}:
+		if step.index != nil {
+			i := *step.index
+			if i < 0 {
+				i += len(n)
+			}
+			if i >= 0 && i < len(n) {
+				return []interface{}{n[i]}
+			}
+			return nil
+		}
+		if step.name == "*" {
+			return append([]interface{}{}, n...)
+		}
+	}
+	return nil
+}
+
+// jsonDescendants returns the node and all the values under it, depth first.
+func jsonDescendants(node interface{}, found []interface{}) []interface{} {
+	found = append(found, node)
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(n) {
+			found = jsonDescendants(n[k], found)
+		}
+	case []interface{}:
+		for _, v := range n {
+			found = jsonDescendants(v, found)
+		}
+	}
+	return found
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 
@@ -114,6 +115,49 @@ func MapAdd(dst map[string]interface{}, src map[string]interface{}) map[string]i
 	return dst
 }
 
+// HeaderKey returns the key in the headers map that names the same header as name. Header names are
+// case insensitive, so "x-api-key" and "X-API-Key" are the same header. Returns name and false if
+// the header isn't in the map.
+func HeaderKey(headers map[string]interface{}, name string) (string, bool) {
+	if _, exist := headers[name]; exist {
+		return name, true
+	}
+	for k := range headers {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return name, false
+}
+
+// HeaderCombine is MapCombine for header maps. The header names are compared case insensitively, and
+// the casing in src is kept along with its value.
+func HeaderCombine(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	if len(dst) == 0 {
+		return MapCopy(src)
+	}
+	for k, v := range src {
+		if key, exist := HeaderKey(dst, k); exist {
+			delete(dst, key)
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// HeaderAdd is MapAdd for header maps. The header names are compared case insensitively.
+func HeaderAdd(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	if len(dst) == 0 {
+		return MapCopy(src)
+	}
+	for k, v := range src {
+		if _, exist := HeaderKey(dst, k); !exist {
+			dst[k] = v
+		}
+	}
+	return dst
+}
+
 // MapReplace replaces the values in dst with the ones in src with the matching keys.
 func MapReplace(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
 	if len(src) == 0 {
@@ -133,13 +177,7 @@ func MapCopy(src map[string]interface{}) map[string]interface{} {
 	}
 	dst := make(map[string]interface{})
 	for k, v := range src {
-		if m, ok := v.(map[string]interface{}); ok {
-			v = MapCopy(m)
-		}
-		if a, ok := v.([]interface{}); ok {
-			v = ArrayCopy(a)
-		}
-		dst[k] = v
+		dst[k] = InterfaceCopy(v)
 	}
 	return dst
 }
@@ -149,15 +187,27 @@ func ArrayCopy(src []interface{}) (dst []interface{}) {
 		return nil
 	}
 	for _, v := range src {
-		if m, ok := v.(map[string]interface{}); ok {
-			v = MapCopy(m)
+		dst = append(dst, InterfaceCopy(v))
+	}
+	return dst
+}
+
+// InterfaceCopy copies the maps and arrays in the value. An empty map or array stays empty rather than becoming
+// nil, which would be sent as null.
+func InterfaceCopy(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		if vv != nil && len(vv) == 0 {
+			return make(map[string]interface{})
 		}
-		if a, ok := v.([]interface{}); ok {
-			v = ArrayCopy(a)
+		return MapCopy(vv)
+	case []interface{}:
+		if vv != nil && len(vv) == 0 {
+			return []interface{}{}
 		}
-		dst = append(dst, v)
+		return ArrayCopy(vv)
 	}
-	return dst
+	return v
 }
 
 func InterfacePrint(m interface{}, printToConsole bool) {
@@ -169,8 +219,12 @@ func InterfacePrint(m interface{}, printToConsole bool) {
 }
 
 // Check if existing matches criteria. When criteria is a map, we check whether
-// everything in criteria can be found and equals a field in existing.
+// everything in criteria can be found and equals a field in existing. A criteria
+// map with a $matcher is matched by the named matcher instead.
 func InterfaceEquals(criteria interface{}, existing interface{}) bool {
+	if matched, isMatcher := matcherEquals(criteria, existing); isMatcher {
+		return matched
+	}
 	if criteria == nil {
 		if existing == nil {
 			return true
@@ -218,6 +272,13 @@ func InterfaceEquals(criteria interface{}, existing interface{}) bool {
 			return false
 		}
 		for k, v := range cm {
+			if v == nil {
+				// An explicit null field only matches a null or missing field.
+				if em[k] != nil {
+					return false
+				}
+				continue
+			}
 			if !InterfaceEquals(v, em[k]) {
 				return false
 			}
@@ -234,6 +295,159 @@ func InterfaceEquals(criteria interface{}, existing interface{}) bool {
 	return string(cJson) == string(eJson)
 }
 
+// DeepEquals checks whether the two values are the same JSON value. Unlike InterfaceEquals, the maps must have
+// the same fields and the arrays the same items in the same order. The numbers are compared by value, whether
+// they are Go numbers or json.Number.
+func DeepEquals(v1 interface{}, v2 interface{}) bool {
+	switch a := v1.(type) {
+	case map[string]interface{}:
+		b, ok := v2.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, exist := b[k]; !exist || !DeepEquals(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		b, ok := v2.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !DeepEquals(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case string:
+		return v1 == v2
+	}
+	if _, isString := v2.(string); !isString {
+		if f1, ok := toFloat(v1); ok {
+			f2, ok := toFloat(v2)
+			return ok && f1 == f2
+		}
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+// InterfaceDiff returns where the existing doesn't match the criteria, as InterfaceEquals compares them. Each
+// difference is a "path: expected ..., got ..." line, where the path names the field, e.g. owner.name. The
+// lines are sorted.
+func InterfaceDiff(criteria interface{}, existing interface{}) []string {
+	var diffs []string
+	interfaceDiff(criteria, existing, "", &diffs)
+	sort.Strings(diffs)
+	return diffs
+}
+
+func interfaceDiff(criteria interface{}, existing interface{}, path string, diffs *[]string) {
+	cm, cIsMap := criteria.(map[string]interface{})
+	em, eIsMap := existing.(map[string]interface{})
+	if _, isMatcher := cm[MatcherKey]; cIsMap && eIsMap && !isMatcher {
+		for k, v := range cm {
+			p := k
+			if len(path) > 0 {
+				p = path + "." + k
+			}
+			e, exist := em[k]
+			switch {
+			case v == nil:
+				// An explicit null field only matches a null or missing field.
+				if e != nil {
+					*diffs = append(*diffs, fmt.Sprintf("%s: expected null, got %s", p, InterfaceToJsonString(e)))
+				}
+			case !exist:
+				*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, missing", p, InterfaceToJsonString(v)))
+			default:
+				interfaceDiff(v, e, p, diffs)
+			}
+		}
+		return
+	}
+	if !InterfaceEquals(criteria, existing) {
+		if len(path) == 0 {
+			path = "(body)"
+		}
+		*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", path, InterfaceToJsonString(criteria),
+			InterfaceToJsonString(existing)))
+	}
+}
+
+// InterfaceMatchDiff returns where the actual doesn't match the expected, like InterfaceDiff, except that the
+// arrays are compared item by item and must have the same length. Unless exact, the fields of actual that aren't
+// in expected are ignored. When exact, they are listed as "path: unexpected ...".
+func InterfaceMatchDiff(expected interface{}, actual interface{}, exact bool) []string {
+	var diffs []string
+	interfaceMatchDiff(expected, actual, "", exact, &diffs)
+	sort.Strings(diffs)
+	return diffs
+}
+
+func interfaceMatchDiff(expected interface{}, actual interface{}, path string, exact bool, diffs *[]string) {
+	fieldPath := func(k string) string {
+		if len(path) > 0 {
+			return path + "." + k
+		}
+		return k
+	}
+	if len(path) == 0 {
+		path = "(body)"
+	}
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		if _, isMatcher := e[MatcherKey]; isMatcher {
+			break
+		}
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for k, v := range e {
+			got, exist := a[k]
+			switch {
+			case v == nil:
+				// An explicit null field only matches a null or missing field.
+				if got != nil {
+					*diffs = append(*diffs, fmt.Sprintf("%s: expected null, got %s", fieldPath(k), InterfaceToJsonString(got)))
+				}
+			case !exist:
+				*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, missing", fieldPath(k), InterfaceToJsonString(v)))
+			default:
+				interfaceMatchDiff(v, got, fieldPath(k), exact, diffs)
+			}
+		}
+		if exact {
+			for k, v := range a {
+				if _, exist := e[k]; !exist {
+					*diffs = append(*diffs, fmt.Sprintf("%s: unexpected %s", fieldPath(k), InterfaceToJsonString(v)))
+				}
+			}
+		}
+		return
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+		if len(a) != len(e) {
+			*diffs = append(*diffs, fmt.Sprintf("%s: expected %d items, got %d", path, len(e), len(a)))
+			return
+		}
+		for i := range e {
+			interfaceMatchDiff(e[i], a[i], fmt.Sprintf("%s[%d]", strings.TrimPrefix(path, "(body)"), i), exact, diffs)
+		}
+		return
+	}
+	if !InterfaceEquals(expected, actual) {
+		*diffs = append(*diffs, fmt.Sprintf("%s: expected %s, got %s", path, InterfaceToJsonString(expected),
+			InterfaceToJsonString(actual)))
+	}
+}
+
 func MarshalJsonIndentNoEscape(i interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	enc := json.NewEncoder(buf)
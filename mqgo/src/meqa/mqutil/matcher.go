@@ -0,0 +1,219 @@
+package mqutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A criteria field can be matched by a named matcher instead of by equality, e.g. the criteria
+// {location: {$matcher: geoNear, value: [37.77, -122.42], radius: 10}}. The matcher gets the whole
+// map, so it can take arguments other than the value.
+const (
+	MatcherKey   = "$matcher"
+	MatcherValue = "value"
+)
+
+// Matcher checks whether the existing value matches the criteria map that names the matcher.
+type Matcher func(criteria map[string]interface{}, existing interface{}) bool
+
+var matcherMutex sync.RWMutex
+var matcherMap = map[string]Matcher{
+	"caseInsensitive": MatchCaseInsensitive,
+	"semverEqual":     MatchSemverEqual,
+	"geoNear":         MatchGeoNear,
+}
+
+// RegisterMatcher makes the matcher available to the criteria under the name. Registering a name
+// again replaces the matcher.
+func RegisterMatcher(name string, matcher Matcher) {
+	matcherMutex.Lock()
+	defer matcherMutex.Unlock()
+	matcherMap[name] = matcher
+}
+
+// GetMatcher returns the matcher registered under the name, or nil.
+func GetMatcher(name string) Matcher {
+	matcherMutex.RLock()
+	defer matcherMutex.RUnlock()
+	return matcherMap[name]
+}
+
+// MatcherNames returns the sorted names of the registered matchers.
+func MatcherNames() []string {
+	matcherMutex.RLock()
+	defer matcherMutex.RUnlock()
+	var names []string
+	for name := range matcherMap {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CheckMatchers returns an error if the criteria refers to a matcher that isn't registered.
+func CheckMatchers(criteria interface{}) error {
+	switch c := criteria.(type) {
+	case map[string]interface{}:
+		if name, exist := c[MatcherKey]; exist {
+			nameStr, _ := name.(string)
+			if GetMatcher(nameStr) == nil {
+				return NewError(ErrInvalid, fmt.Sprintf("unknown %s %v, the registered matchers are: %s",
+					MatcherKey, name, strings.Join(MatcherNames(), ", ")))
+			}
+			return nil
+		}
+		for _, v := range c {
+			if err := CheckMatchers(v); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, v := range c {
+			if err := CheckMatchers(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matcherEquals checks the existing value against a criteria map that names a matcher. The second
+// return is false when the criteria doesn't name one.
+func matcherEquals(criteria interface{}, existing interface{}) (bool, bool) {
+	cm, ok := criteria.(map[string]interface{})
+	if !ok {
+		return false, false
+	}
+	name, exist := cm[MatcherKey]
+	if !exist {
+		return false, false
+	}
+	nameStr, _ := name.(string)
+	matcher := GetMatcher(nameStr)
+	if matcher == nil {
+		Logger.Printf("unknown %s %v", MatcherKey, name)
+		return false, true
+	}
+	return matcher(cm, existing), true
+}
+
+// MatchCaseInsensitive matches the strings that are equal ignoring case.
+func MatchCaseInsensitive(criteria map[string]interface{}, existing interface{}) bool {
+	value, ok := criteria[MatcherValue].(string)
+	existingStr, eok := existing.(string)
+	return ok && eok && strings.EqualFold(value, existingStr)
+}
+
+// MatchSemverEqual matches the versions that are the same semantic version, e.g. "1.2" and "v1.2.0".
+// The build metadata after a + is ignored.
+func MatchSemverEqual(criteria map[string]interface{}, existing interface{}) bool {
+	value, ok := criteria[MatcherValue].(string)
+	existingStr, eok := existing.(string)
+	if !ok || !eok {
+		return false
+	}
+	v1, ok := parseSemver(value)
+	v2, eok := parseSemver(existingStr)
+	return ok && eok && v1 == v2
+}
+
+type semver struct {
+	major, minor, patch int
+	prerelease          string
+}
+
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.Index(s, "+"); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.prerelease = s[i+1:]
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return v, false
+	}
+	numbers := []*int{&v.major, &v.minor, &v.patch}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, false
+		}
+		*numbers[i] = n
+	}
+	return v, true
+}
+
+// MatchGeoNear matches the points within radius kilometers of the value. A point is either a
+// [latitude, longitude] array or a map with lat/latitude and lng/lon/longitude fields.
+func MatchGeoNear(criteria map[string]interface{}, existing interface{}) bool {
+	lat1, lon1, ok := geoPoint(criteria[MatcherValue])
+	lat2, lon2, eok := geoPoint(existing)
+	radius, rok := toFloat(criteria["radius"])
+	if !ok || !eok || !rok {
+		return false
+	}
+	const earthRadius = 6371.0 // km
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	distance := 2 * earthRadius * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+	return distance <= radius
+}
+
+func geoPoint(p interface{}) (float64, float64, bool) {
+	switch point := p.(type) {
+	case []interface{}:
+		if len(point) != 2 {
+			return 0, 0, false
+		}
+		lat, ok := toFloat(point[0])
+		lon, lok := toFloat(point[1])
+		return lat, lon, ok && lok
+	case map[string]interface{}:
+		var lat, lon float64
+		var ok, lok bool
+		for _, k := range []string{"lat", "latitude"} {
+			if lat, ok = toFloat(point[k]); ok {
+				break
+			}
+		}
+		for _, k := range []string{"lng", "lon", "longitude"} {
+			if lon, lok = toFloat(point[k]); lok {
+				break
+			}
+		}
+		return lat, lon, ok && lok
+	}
+	return 0, 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}